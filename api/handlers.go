@@ -3,6 +3,7 @@ package api
 import (
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/contiv/errored"
@@ -12,6 +13,7 @@ import (
 	"github.com/contiv/volplugin/storage"
 	"github.com/contiv/volplugin/storage/cgroup"
 	"github.com/contiv/volplugin/storage/control"
+	"github.com/docker/go-units"
 )
 
 func (a *API) createVolume(w http.ResponseWriter, volume *config.VolumeRequest, policyObj *config.Policy) func(ld *lock.Driver, ucs []config.UseLocker) error {
@@ -282,14 +284,35 @@ func (a *API) Mount(w http.ResponseWriter, r *http.Request) {
 	// mounts something, after the resulting unmount occurs. This seems like a
 	// great way to fix tons of errors in our code before they ever accidentally
 	// reach a user.
+	driverOpts.Encryption, err = a.Client.Encryption(volConfig)
+	if err != nil {
+		a.clearMount(mountState{w, err, ut, driver, driverOpts, volConfig})
+		return
+	}
+
 	mc, err := driver.Mount(driverOpts)
 	if err != nil {
+		if erd, ok := err.(*errored.Error); ok && erd.Contains(errors.FSCheck) {
+			a.recordFSCheck(volConfig, &storage.FSCheck{Mode: driverOpts.FSOptions.CheckMode, Status: storage.FSCheckFailed, Output: err.Error()})
+		}
+
 		a.clearMount(mountState{w, err, ut, driver, driverOpts, volConfig})
 		return
 	}
 
+	if mc.FSCheck != nil {
+		a.recordFSCheck(volConfig, mc.FSCheck)
+	}
+
 	a.MountCollection.Add(mc)
 
+	// volumes resized while they were not mounted anywhere are grown now.
+	if resizer, ok := driver.(storage.ResizeDriver); ok && NeedsGrowing(mc, driverOpts) {
+		if err := resizer.GrowFilesystem(driverOpts); err != nil {
+			logrus.Errorf("Could not grow filesystem of volume %q: %v", volConfig, err)
+		}
+	}
+
 	// Only perform the TTL refresh if the driver is in unlocked mode.
 	if !volConfig.Unlocked {
 		if err := a.startTTLRefresh(volName); err != nil {
@@ -313,6 +336,32 @@ func (a *API) Mount(w http.ResponseWriter, r *http.Request) {
 	a.WriteMount(path, w)
 }
 
+// recordFSCheck publishes the result of the filesystem check made while
+// mounting. Failing to do so does not fail the mount.
+func (a *API) recordFSCheck(volConfig *config.Volume, check *storage.FSCheck) {
+	logrus.Infof("Filesystem check of volume %q: %s", volConfig, check.Status)
+
+	record := &config.FSCheck{Hostname: a.Hostname, Time: time.Now(), FSCheck: *check}
+	if err := a.Client.PublishFSCheck(volConfig, record); err != nil {
+		logrus.Errorf("Could not record filesystem check of volume %q: %v", volConfig, err)
+	}
+}
+
+// NeedsGrowing tells if the filesystem of the mount is smaller than the
+// volume, whose size is in MiB. Filesystems which cannot tell their size are
+// grown in case they need it.
+func NeedsGrowing(mc *storage.Mount, do storage.DriverOptions) bool {
+	fsSize, err := storage.FileSystemSize(do.FSOptions.Type, mc.Device, mc.Path, do.Timeout)
+	if err != nil {
+		logrus.Debugf("Growing filesystem of volume %q in case it is smaller than the volume: %v", do.Volume.Name, err)
+		return true
+	}
+
+	// filesystems span their devices but for the last block, and volumes are
+	// sized in whole MiB.
+	return fsSize+units.MiB <= do.Volume.Size*units.MiB
+}
+
 func (a *API) startTTLRefresh(volName string) error {
 	ut := &config.UseMount{
 		Volume:   volName,
@@ -60,3 +60,16 @@ func (c *Collection) Get(vol string) (*storage.Mount, error) {
 
 	return mc, nil
 }
+
+// List returns all mounts in the collection.
+func (c *Collection) List() []*storage.Mount {
+	c.mountMapMutex.Lock()
+	defer c.mountMapMutex.Unlock()
+
+	mounts := []*storage.Mount{}
+	for _, mc := range c.mountMap {
+		mounts = append(mounts, mc)
+	}
+
+	return mounts
+}
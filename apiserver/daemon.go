@@ -14,6 +14,7 @@ import (
 	"github.com/Sirupsen/logrus"
 	"github.com/contiv/errored"
 	"github.com/contiv/volplugin/api"
+	"github.com/contiv/volplugin/backup"
 	"github.com/contiv/volplugin/config"
 	"github.com/contiv/volplugin/errors"
 	"github.com/contiv/volplugin/info"
@@ -22,9 +23,27 @@ import (
 	"github.com/contiv/volplugin/storage/backend"
 	"github.com/contiv/volplugin/storage/control"
 	"github.com/contiv/volplugin/watch"
+	"github.com/docker/go-units"
 	"github.com/gorilla/mux"
 )
 
+// flattenTimeout bounds flattening a copy, which copies all of its data and
+// can run far longer than the global timeout.
+const flattenTimeout = 24 * time.Hour
+
+// cloneSnapshotFormat names the snapshots volumes are cloned from, as
+// volsupervisor names the snapshots it takes. They are told apart by their
+// recorded origin, which keeps them out of the snapshots pruning keeps.
+const cloneSnapshotFormat = "2006-01-02T15.04.05.000000000Z"
+
+// transferTimeout bounds exporting and importing a volume, which stream all of
+// its data over the connection.
+const transferTimeout = 24 * time.Hour
+
+// exportErrorTrailer is the trailer reporting the failure of an export which
+// broke off after the image started streaming, once the status is sent.
+const exportErrorTrailer = "Export-Error"
+
 // DaemonConfig is the configuration struct used by the apiserver to hold globals.
 type DaemonConfig struct {
 	Config   *config.Client
@@ -58,6 +77,8 @@ func (d *DaemonConfig) Daemon(listen string) {
 	errored.AlwaysDebug = d.Global.Debug
 	errored.AlwaysTrace = d.Global.Debug
 
+	d.failInterruptedFlattens()
+
 	go info.HandleDebugSignal()
 	go info.HandleDumpTarballSignal(d.Config)
 
@@ -81,6 +102,13 @@ func (d *DaemonConfig) Daemon(listen string) {
 		"/global":                           d.handleGlobalUpload,
 		"/volumes/create":                   d.handleCreate,
 		"/volumes/copy":                     d.handleCopy,
+		"/volumes/clone":                    d.handleClone,
+		"/volumes/resize":                   d.handleResize,
+		"/volumes/rename":                   d.handleRename,
+		"/volumes/adopt":                    d.handleAdopt,
+		"/volumes/rollback":                 d.handleRollback,
+		"/volumes/import/{policy}/{volume}": d.handleImport,
+		"/backups/restore":                  d.handleBackupRestore,
 		"/volumes/request":                  d.handleRequest,
 		"/policies/{policy}":                d.handlePolicyUpload,
 		"/runtime/{policy}/{volume}":        d.handleRuntimeUpload,
@@ -103,6 +131,7 @@ func (d *DaemonConfig) Daemon(listen string) {
 
 	getRouter := map[string]func(http.ResponseWriter, *http.Request){
 		"/global":                              d.handleGlobal,
+		"/copies/{policy}/{volume}":            d.handleCopyStatus,
 		"/policy-archives/{policy}":            d.handlePolicyListRevisions,
 		"/policy-archives/{policy}/{revision}": d.handlePolicyGetRevision,
 		"/policies":                            d.handlePolicyList,
@@ -112,8 +141,12 @@ func (d *DaemonConfig) Daemon(listen string) {
 		"/volumes":                             d.handleListAll,
 		"/volumes/{policy}":                    d.handleList,
 		"/volumes/{policy}/{volume}":           d.handleGet,
+		"/volumes/{policy}/{volume}/stats":     d.handleStats,
+		"/volumes/{policy}/{volume}/export":    d.handleExport,
 		"/runtime/{policy}/{volume}":           d.handleRuntime,
 		"/snapshots/{policy}/{volume}":         d.handleSnapshotList,
+		"/backups/{policy}/{volume}":           d.handleBackupList,
+		"/images/{policy}":                     d.handleImageList,
 	}
 
 	if err := addRoute(r, getRouter, "GET", d.Global.Debug); err != nil {
@@ -400,6 +433,34 @@ func (d *DaemonConfig) handleSnapshotList(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	infos, err := d.Config.ListSnapshotInfo(volConfig.String())
+	if err != nil {
+		api.RESTHTTPError(w, errors.ListSnapshots.Combine(err))
+		return
+	}
+
+	copies, err := d.Config.ListCopies(volConfig.PolicyName)
+	if err != nil {
+		api.RESTHTTPError(w, errors.ListSnapshots.Combine(err))
+		return
+	}
+
+	parents := map[string]bool{}
+	for _, cp := range copies {
+		if cp.Source == volConfig.String() && cp.Dependent() {
+			parents[cp.Snapshot] = true
+		}
+	}
+
+	for i, snap := range results {
+		if info, ok := infos[snap.Name]; ok {
+			results[i].Origin = info.Origin
+			results[i].Labels = info.Labels
+		}
+
+		results[i].Parent = parents[snap.Name]
+	}
+
 	content, err := json.Marshal(results)
 	if err != nil {
 		api.RESTHTTPError(w, errors.MarshalResponse.Combine(err))
@@ -414,7 +475,23 @@ func (d *DaemonConfig) handleSnapshotTake(w http.ResponseWriter, r *http.Request
 	policy := vars["policy"]
 	volume := vars["volume"]
 
-	if err := d.Config.TakeSnapshot(fmt.Sprintf("%v/%v", policy, volume)); err != nil {
+	labels := map[string]string{}
+
+	content, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		api.RESTHTTPError(w, errors.ReadBody.Combine(err))
+		return
+	}
+
+	// the labels are optional.
+	if len(content) > 0 {
+		if err := json.Unmarshal(content, &labels); err != nil {
+			api.RESTHTTPError(w, errors.UnmarshalRequest.Combine(err))
+			return
+		}
+	}
+
+	if err := d.Config.TakeSnapshot(fmt.Sprintf("%v/%v", policy, volume), labels); err != nil {
 		api.RESTHTTPError(w, errors.SnapshotFailed.Combine(err))
 		return
 	}
@@ -459,6 +536,13 @@ func (d *DaemonConfig) handleCopy(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	flatten := req.Options["flatten"] == "true"
+	flattenDriver, ok := driver.(storage.FlattenDriver)
+	if flatten && !ok {
+		api.RESTHTTPError(w, errors.FlattenUnsupported.Combine(errored.New(volConfig.Backends.Snapshot)))
+		return
+	}
+
 	newVolConfig, err := d.Config.GetVolume(req.Policy, req.Name)
 	if err != nil {
 		api.RESTHTTPError(w, errors.GetVolume.Combine(err))
@@ -466,14 +550,8 @@ func (d *DaemonConfig) handleCopy(w http.ResponseWriter, r *http.Request) {
 	}
 
 	newVolConfig.VolumeName = req.Options["target"]
-
-	do := storage.DriverOptions{
-		Volume: storage.Volume{
-			Name:   volConfig.String(),
-			Params: volConfig.DriverOptions,
-		},
-		Timeout: d.Global.Timeout,
-	}
+	// copies are new images, named after the new volume.
+	delete(newVolConfig.DriverOptions, storage.ImageParam)
 
 	host, err := os.Hostname()
 	if err != nil {
@@ -503,13 +581,15 @@ func (d *DaemonConfig) handleCopy(w http.ResponseWriter, r *http.Request) {
 	}
 
 	err = lock.NewDriver(d.Config).ExecuteWithMultiUseLock([]config.UseLocker{newUC, newSnapUC, snapUC}, d.Global.Timeout, func(ld *lock.Driver, ucs []config.UseLocker) error {
-		if err := d.Config.PublishVolume(newVolConfig); err != nil {
+		cp, err := d.copySnapshot(driver, volConfig, newVolConfig, req.Options["snapshot"], flatten)
+		if err != nil {
 			return err
 		}
 
-		if err := driver.CopySnapshot(do, req.Options["snapshot"], newVolConfig.String()); err != nil {
-			return err
+		if flatten {
+			go d.flatten(flattenDriver, newVolConfig, cp)
 		}
+
 		return nil
 	})
 
@@ -536,246 +616,1478 @@ func (d *DaemonConfig) handleCopy(w http.ResponseWriter, r *http.Request) {
 	w.Write(content)
 }
 
-func (d *DaemonConfig) handleGlobal(w http.ResponseWriter, r *http.Request) {
-	content, err := json.Marshal(d.Global.Published())
+// handleClone copies a volume as it is now: a snapshot is taken, copied and,
+// if the copy is to be flattened, flattened and removed, all under the
+// snapshot lock of the volume. Unflattened clones keep depending on their
+// snapshot, which is kept until they are flattened.
+func (d *DaemonConfig) handleClone(w http.ResponseWriter, r *http.Request) {
+	req, err := unmarshalRequest(r)
 	if err != nil {
-		api.RESTHTTPError(w, errors.MarshalGlobal.Combine(err))
+		api.RESTHTTPError(w, errors.UnmarshalRequest.Combine(err))
 		return
 	}
 
-	w.Write(content)
-}
-
-func (d *DaemonConfig) handleList(w http.ResponseWriter, r *http.Request) {
-	vols, err := d.Config.ListAllVolumes()
-	if err != nil {
-		api.RESTHTTPError(w, errors.ListVolume.Combine(err))
+	target, ok := req.Options["target"]
+	if !ok {
+		api.RESTHTTPError(w, errors.MissingTargetOption)
 		return
 	}
 
-	response := []*config.Volume{}
-	for _, vol := range vols {
-		parts := strings.SplitN(vol, "/", 2)
-		if len(parts) != 2 {
-			api.RESTHTTPError(w, errors.InvalidVolume.Combine(errored.New(vol)))
-			return
-		}
-		// FIXME make this take a single string and not a split one
-		volConfig, err := d.Config.GetVolume(parts[0], parts[1])
-		if err != nil {
-			api.RESTHTTPError(w, errors.ListVolume.Combine(err))
-			return
-		}
-
-		response = append(response, volConfig)
+	if strings.Contains(target, "/") {
+		api.RESTHTTPError(w, errors.InvalidVolume.Combine(errored.New("/")))
+		return
 	}
 
-	content, err := json.Marshal(response)
-	if err != nil {
-		api.RESTHTTPError(w, errors.MarshalResponse.Combine(err))
+	if target == req.Name {
+		api.RESTHTTPError(w, errors.CannotCopyVolume.Combine(errored.Errorf("You cannot clone volume %q onto itself.", req.Name)))
 		return
 	}
 
-	w.Write(content)
-}
-
-func (d *DaemonConfig) handleListAll(w http.ResponseWriter, r *http.Request) {
-	vols, err := d.Config.ListAllVolumes()
+	volConfig, err := d.Config.GetVolume(req.Policy, req.Name)
 	if err != nil {
-		api.RESTHTTPError(w, errors.ListVolume.Combine(err))
+		api.RESTHTTPError(w, errors.GetVolume.Combine(err))
 		return
 	}
 
-	response := []*config.Volume{}
-	for _, vol := range vols {
-		parts := strings.SplitN(vol, "/", 2)
-		if len(parts) != 2 {
-			api.RESTHTTPError(w, errors.InvalidVolume.Combine(errored.New(vol)))
-			return
-		}
-		// FIXME make this take a single string and not a split one
-		volConfig, err := d.Config.GetVolume(parts[0], parts[1])
-		if err != nil {
-			api.RESTHTTPError(w, errors.ListVolume.Combine(err))
-			return
-		}
-
-		response = append(response, volConfig)
+	if volConfig.Backends.Snapshot == "" {
+		api.RESTHTTPError(w, errors.SnapshotsUnsupported.Combine(errored.New(volConfig.Backends.Snapshot)))
+		return
 	}
 
-	content, err := json.Marshal(response)
+	driver, err := backend.NewSnapshotDriver(volConfig.Backends.Snapshot)
 	if err != nil {
-		api.RESTHTTPError(w, errors.ListVolume.Combine(err))
+		api.RESTHTTPError(w, errors.GetDriver.Combine(err))
 		return
 	}
 
-	w.Write(content)
-}
-
-func (d *DaemonConfig) handleGet(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	policy := vars["policy"]
-	volumeName := vars["volume"]
-
-	volConfig, err := d.Config.GetVolume(policy, volumeName)
-	if erd, ok := err.(*errored.Error); ok && erd.Contains(errors.NotExists) {
-		w.WriteHeader(404)
-		return
-	} else if err != nil {
-		api.RESTHTTPError(w, errors.GetVolume.Combine(err))
+	flatten := req.Options["flatten"] == "true"
+	flattenDriver, ok := driver.(storage.FlattenDriver)
+	if flatten && !ok {
+		api.RESTHTTPError(w, errors.FlattenUnsupported.Combine(errored.New(volConfig.Backends.Snapshot)))
 		return
 	}
 
-	content, err := json.Marshal(volConfig)
+	newVolConfig, err := d.Config.GetVolume(req.Policy, req.Name)
 	if err != nil {
-		api.RESTHTTPError(w, errors.MarshalResponse.Combine(err))
+		api.RESTHTTPError(w, errors.GetVolume.Combine(err))
 		return
 	}
 
-	w.Write(content)
-}
+	newVolConfig.VolumeName = target
+	// copies are new images, named after the new volume.
+	delete(newVolConfig.DriverOptions, storage.ImageParam)
 
-func (d *DaemonConfig) createRemoveLocks(vc *config.Volume) ([]config.UseLocker, error) {
-	hostname, err := os.Hostname()
+	host, err := os.Hostname()
 	if err != nil {
-		return nil, errors.GetHostname.Combine(err)
-	}
-
-	uc := &config.UseMount{
-		Volume:   vc.String(),
-		Reason:   lock.ReasonRemove,
-		Hostname: hostname,
+		api.RESTHTTPError(w, errors.GetHostname.Combine(err))
+		return
 	}
 
 	snapUC := &config.UseSnapshot{
-		Volume: vc.String(),
-		Reason: lock.ReasonRemove,
-	}
-
-	return []config.UseLocker{uc, snapUC}, nil
-}
-
-func (d *DaemonConfig) removeVolume(req *config.VolumeRequest, vc *config.Volume) error {
-	if err := d.Config.RemoveVolume(req.Policy, req.Name); err != nil {
-		return errors.ClearVolume.Combine(errored.New(vc.String())).Combine(err)
+		Volume: volConfig.String(),
+		Reason: lock.ReasonCopy,
 	}
 
-	return nil
-}
-
-func (d *DaemonConfig) completeRemove(req *config.VolumeRequest, vc *config.Volume) error {
-	if err := control.RemoveVolume(vc, d.Global.Timeout); err != nil && err != errors.NoActionTaken {
-		logrus.Warn(errors.RemoveImage.Combine(errored.New(vc.String())).Combine(err))
+	newUC := &config.UseMount{
+		Volume:   newVolConfig.String(),
+		Reason:   lock.ReasonCopy,
+		Hostname: host,
 	}
 
-	return d.removeVolume(req, vc)
-}
-
-// this cleans up uses when forcing the removal
-func (d *DaemonConfig) removeVolumeUse(lock config.UseLocker, vc *config.Volume) {
-	// locks[0] is the usemount lock
-	if err := d.Config.RemoveUse(lock, true); err != nil {
-		logrus.Warn(errors.RemoveImage.Combine(errored.New(vc.String())).Combine(err))
+	newSnapUC := &config.UseSnapshot{
+		Volume: newVolConfig.String(),
+		Reason: lock.ReasonCopy,
 	}
-}
 
-func (d *DaemonConfig) handleForceRemoveLock(req *config.VolumeRequest, vc *config.Volume, locks []config.UseLocker) error {
-	exists, err := control.ExistsVolume(vc, d.Global.Timeout)
-	if err != nil && err != errors.NoActionTaken {
-		return errors.RemoveVolume.Combine(errored.New(vc.String())).Combine(err)
+	// flattening can take far longer than the locks of a request are held,
+	// so they expire if the apiserver dies while holding them.
+	release, err := d.acquireWithTTLRefresh([]config.UseLocker{newUC, newSnapUC, snapUC})
+	if err != nil {
+		api.RESTHTTPError(w, errors.LockFailed.Combine(err))
+		return
 	}
 
-	if err == errors.NoActionTaken {
-		if err := d.completeRemove(req, vc); err != nil {
-			return err
-		}
-
-		d.removeVolumeUse(locks[0], vc)
-	}
+	err = d.clone(driver, flattenDriver, volConfig, newVolConfig, flatten)
+	release()
 
 	if err != nil {
-		return errors.RemoveVolume.Combine(errored.New(vc.String())).Combine(err)
-	}
-
-	if !exists {
-		d.removeVolume(req, vc)
-		return errors.RemoveVolume.Combine(errored.New(vc.String())).Combine(errors.NotExists)
+		api.RESTHTTPError(w, errors.PublishVolume.Combine(errored.Errorf(
+			"Cloning volume %q to %q",
+			volConfig.String(),
+			newVolConfig.String(),
+		)).Combine(err))
+		return
 	}
 
-	err = d.completeRemove(req, vc)
+	content, err := json.Marshal(newVolConfig)
 	if err != nil {
-		return errors.RemoveVolume.Combine(errored.New(vc.String())).Combine(errors.NotExists)
+		api.RESTHTTPError(w, errors.MarshalResponse.Combine(err))
+		return
 	}
 
-	d.removeVolumeUse(locks[0], vc)
-	return nil
+	w.Write(content)
 }
 
-func (d *DaemonConfig) handleRemove(w http.ResponseWriter, r *http.Request) {
-	// set a default timeout if none is specified
-	timeout := d.Global.Timeout
+func (d *DaemonConfig) handleRollback(w http.ResponseWriter, r *http.Request) {
 	req, err := unmarshalRequest(r)
 	if err != nil {
 		api.RESTHTTPError(w, errors.UnmarshalRequest.Combine(err))
 		return
 	}
 
-	if req.Options["timeout"] != "" {
-		var t time.Duration
-		if t, err = time.ParseDuration(req.Options["timeout"]); err != nil {
-			api.RESTHTTPError(w, errors.RemoveVolume.Combine(err))
-			return
-		}
-		timeout = t
+	if _, ok := req.Options["snapshot"]; !ok {
+		api.RESTHTTPError(w, errors.MissingSnapshotOption)
+		return
 	}
 
-	vc, err := d.Config.GetVolume(req.Policy, req.Name)
+	volConfig, err := d.Config.GetVolume(req.Policy, req.Name)
 	if err != nil {
 		api.RESTHTTPError(w, errors.GetVolume.Combine(err))
 		return
 	}
 
-	locks, err := d.createRemoveLocks(vc)
-	if err != nil {
-		api.RESTHTTPError(w, err)
+	if volConfig.Backends.Snapshot == "" {
+		api.RESTHTTPError(w, errors.SnapshotsUnsupported.Combine(errored.New(volConfig.Backends.Snapshot)))
 		return
 	}
 
-	if req.Options["force"] == "true" {
-		if err := d.handleForceRemoveLock(req, vc, locks); err != nil {
-			api.RESTHTTPError(w, err)
-			return
-		}
-	}
-
-	err = lock.NewDriver(d.Config).ExecuteWithMultiUseLock(locks, timeout, func(ld *lock.Driver, ucs []config.UseLocker) error {
-		exists, err := control.ExistsVolume(vc, timeout)
-		if err != nil && err != errors.NoActionTaken {
-			return err
-		}
-
-		if err == errors.NoActionTaken {
-			return d.completeRemove(req, vc)
-		}
-
-		if !exists {
-			d.removeVolume(req, vc)
-			return errors.NotExists
-		}
-
-		return d.completeRemove(req, vc)
-	})
-
-	if err == errors.NotExists {
-		w.WriteHeader(404)
+	// unlocked volumes leave no trace of their mounts, so they cannot be known
+	// to be unmounted.
+	if volConfig.Unlocked {
+		api.RESTHTTPError(w, errors.SnapshotRollback.Combine(errored.Errorf("Volume %q is unlocked and may be mounted", volConfig)))
 		return
 	}
 
+	inUse, err := d.Config.IsVolumeInUse(volConfig, d.Global)
 	if err != nil {
-		api.RESTHTTPError(w, errors.RemoveVolume.Combine(errored.New(vc.String())).Combine(err))
+		api.RESTHTTPError(w, errors.SnapshotRollback.Combine(err))
 		return
 	}
-}
+
+	if inUse {
+		api.RESTHTTPError(w, errors.SnapshotRollback.Combine(errored.Errorf("Volume %q is mounted", volConfig)))
+		return
+	}
+
+	driver, err := backend.NewSnapshotDriver(volConfig.Backends.Snapshot)
+	if err != nil {
+		api.RESTHTTPError(w, errors.GetDriver.Combine(err))
+		return
+	}
+
+	do, err := volConfig.ToDriverOptions(d.Global.Timeout)
+	if err != nil {
+		api.RESTHTTPError(w, errors.SnapshotRollback.Combine(err))
+		return
+	}
+
+	host, err := os.Hostname()
+	if err != nil {
+		api.RESTHTTPError(w, errors.GetHostname.Combine(err))
+		return
+	}
+
+	// holding the mount lock keeps the volume from being mounted until the
+	// rollback is done.
+	uc := &config.UseMount{
+		Volume:   volConfig.String(),
+		Reason:   lock.ReasonRollback,
+		Hostname: host,
+	}
+
+	snapUC := &config.UseSnapshot{
+		Volume: volConfig.String(),
+		Reason: lock.ReasonRollback,
+	}
+
+	err = lock.NewDriver(d.Config).ExecuteWithMultiUseLock([]config.UseLocker{uc, snapUC}, d.Global.Timeout, func(ld *lock.Driver, ucs []config.UseLocker) error {
+		return driver.RollbackSnapshot(req.Options["snapshot"], do)
+	})
+
+	if err != nil {
+		api.RESTHTTPError(w, errors.SnapshotRollback.Combine(errored.Errorf(
+			"Rolling back volume %q to snapshot %q",
+			volConfig.String(),
+			req.Options["snapshot"],
+		)).Combine(err))
+		return
+	}
+}
+
+// startedWriter tells if anything was written through it.
+type startedWriter struct {
+	w       io.Writer
+	started bool
+}
+
+func (sw *startedWriter) Write(p []byte) (int, error) {
+	sw.started = true
+	return sw.w.Write(p)
+}
+
+func (d *DaemonConfig) handleExport(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	snapName := r.URL.Query().Get("snapshot")
+	if snapName == "" {
+		api.RESTHTTPError(w, errors.MissingSnapshotOption)
+		return
+	}
+
+	volConfig, err := d.Config.GetVolume(vars["policy"], vars["volume"])
+	if err != nil {
+		api.RESTHTTPError(w, errors.GetVolume.Combine(err))
+		return
+	}
+
+	// holding the snapshot lock keeps the snapshot from being pruned while it
+	// is exported.
+	snapUC := &config.UseSnapshot{
+		Volume: volConfig.String(),
+		Reason: lock.ReasonExport,
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Trailer", exportErrorTrailer)
+	sw := &startedWriter{w: w}
+
+	err = lock.NewDriver(d.Config).ExecuteWithMultiUseLock([]config.UseLocker{snapUC}, d.Global.Timeout, func(ld *lock.Driver, ucs []config.UseLocker) error {
+		return control.ExportVolume(volConfig, snapName, sw, transferTimeout)
+	})
+
+	if err == nil {
+		return
+	}
+
+	err = errors.ExportVolume.Combine(errored.Errorf("Exporting snapshot %q of volume %q", snapName, volConfig)).Combine(err)
+
+	if !sw.started {
+		w.Header().Del("Trailer")
+		api.RESTHTTPError(w, err)
+		return
+	}
+
+	logrus.Error(err)
+	w.Header().Set(exportErrorTrailer, strings.Replace(err.Error(), "\n", " ", -1))
+}
+
+func (d *DaemonConfig) handleImport(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	// the body is the image, so the options come in the query.
+	req := &config.VolumeRequest{
+		Policy:  vars["policy"],
+		Name:    vars["volume"],
+		Options: map[string]string{},
+	}
+
+	for key := range r.URL.Query() {
+		req.Options[key] = r.URL.Query().Get(key)
+	}
+
+	if _, err := d.Config.GetVolume(req.Policy, req.Name); err == nil {
+		api.RESTHTTPError(w, errors.ImportVolume.Combine(errored.Errorf("Volume %v/%v already exists", req.Policy, req.Name)).Combine(errors.Exists))
+		return
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		api.RESTHTTPError(w, errors.GetHostname.Combine(err))
+		return
+	}
+
+	uc := &config.UseMount{
+		Volume:   strings.Join([]string{req.Policy, req.Name}, "/"),
+		Reason:   lock.ReasonImport,
+		Hostname: hostname,
+	}
+
+	snapUC := &config.UseSnapshot{
+		Volume: strings.Join([]string{req.Policy, req.Name}, "/"),
+		Reason: lock.ReasonImport,
+	}
+
+	err = lock.NewDriver(d.Config).ExecuteWithMultiUseLock([]config.UseLocker{uc, snapUC}, d.Global.Timeout, func(ld *lock.Driver, ucs []config.UseLocker) error {
+		volConfig, err := d.Config.CreateVolume(req)
+		if err != nil {
+			return err
+		}
+
+		// XXX images of encrypted volumes are imported as they are, so they can
+		//     only be mounted if both volumes take their key from the same file.
+
+		if err := control.ImportVolume(volConfig, r.Body, transferTimeout); err != nil {
+			return err
+		}
+
+		// the image is made at the size of the volume it was exported from.
+		d.recordBackendSize(volConfig)
+
+		if err := ld.Config.PublishVolume(volConfig); err != nil {
+			if err := control.RemoveVolume(volConfig, d.Global.Timeout); err != nil {
+				logrus.Errorf("Error during cleanup of failed import: %v", err)
+			}
+			return errors.PublishVolume.Combine(err)
+		}
+
+		content, err := json.Marshal(volConfig)
+		if err != nil {
+			return errors.MarshalPolicy.Combine(err)
+		}
+
+		w.Write(content)
+		return nil
+	})
+
+	if err != nil {
+		api.RESTHTTPError(w, errors.ImportVolume.Combine(errored.Errorf("Importing volume %v/%v", req.Policy, req.Name)).Combine(err))
+		return
+	}
+}
+
+// recordBackendSize sets the size of the volume to the size of its image, as
+// the backend reports it, for volumes whose images were not made at the
+// size of their configuration. Sizes are recorded in MB, which volumes are
+// made in units of.
+func (d *DaemonConfig) recordBackendSize(volConfig *config.Volume) {
+	stats, err := control.VolumeStats(volConfig, nil, d.Global.Timeout)
+	if err != nil {
+		logrus.Warnf("Cannot tell the size of volume %q; keeping %q: %v", volConfig, volConfig.CreateOptions.Size, err)
+		return
+	}
+
+	if stats.ProvisionedBytes != 0 {
+		volConfig.CreateOptions.Size = fmt.Sprintf("%dMB", stats.ProvisionedBytes/units.MiB)
+	}
+}
+
+// backupRepository returns the backup repository of the volume. Volumes which
+// were removed take the repository of their policy, so their backups can still
+// be restored.
+func (d *DaemonConfig) backupRepository(policy, volume string) (*backup.Repository, error) {
+	var runtime config.RuntimeOptions
+
+	if volConfig, err := d.Config.GetVolume(policy, volume); err == nil {
+		runtime = volConfig.RuntimeOptions
+	} else {
+		policyConfig, err := d.Config.GetPolicy(policy)
+		if err != nil {
+			return nil, errors.GetPolicy.Combine(err)
+		}
+
+		runtime = policyConfig.RuntimeOptions
+	}
+
+	if runtime.Backup.Repository == "" {
+		return nil, errors.NoBackupRepository.Combine(errored.Errorf("%v/%v", policy, volume))
+	}
+
+	return backup.NewRepository(runtime.Backup.Repository), nil
+}
+
+func (d *DaemonConfig) handleBackupList(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	volume := fmt.Sprintf("%v/%v", vars["policy"], vars["volume"])
+
+	repo, err := d.backupRepository(vars["policy"], vars["volume"])
+	if err != nil {
+		api.RESTHTTPError(w, errors.ListBackups.Combine(err))
+		return
+	}
+
+	catalog, err := repo.Catalog(volume)
+	if err != nil {
+		api.RESTHTTPError(w, errors.ListBackups.Combine(err))
+		return
+	}
+
+	content, err := json.Marshal(catalog.Backups)
+	if err != nil {
+		api.RESTHTTPError(w, errors.MarshalResponse.Combine(err))
+		return
+	}
+
+	w.Write(content)
+}
+
+func (d *DaemonConfig) handleBackupRestore(w http.ResponseWriter, r *http.Request) {
+	req, err := unmarshalRequest(r)
+	if err != nil {
+		api.RESTHTTPError(w, errors.UnmarshalRequest.Combine(err))
+		return
+	}
+
+	backupName, ok := req.Options["backup"]
+	if !ok {
+		api.RESTHTTPError(w, errors.MissingBackupOption)
+		return
+	}
+
+	target, ok := req.Options["target"]
+	if !ok {
+		api.RESTHTTPError(w, errors.MissingTargetOption)
+		return
+	}
+
+	if strings.Contains(target, "/") {
+		api.RESTHTTPError(w, errors.InvalidVolume.Combine(errored.New("/")))
+		return
+	}
+
+	source := fmt.Sprintf("%v/%v", req.Policy, req.Name)
+
+	repo, err := d.backupRepository(req.Policy, req.Name)
+	if err != nil {
+		api.RESTHTTPError(w, errors.RestoreBackup.Combine(err))
+		return
+	}
+
+	catalog, err := repo.Catalog(source)
+	if err != nil {
+		api.RESTHTTPError(w, errors.RestoreBackup.Combine(err))
+		return
+	}
+
+	if _, err := catalog.Chain(backupName); err != nil {
+		api.RESTHTTPError(w, errors.RestoreBackup.Combine(err))
+		return
+	}
+
+	if _, err := d.Config.GetVolume(req.Policy, target); err == nil {
+		api.RESTHTTPError(w, errors.RestoreBackup.Combine(errored.Errorf("Volume %v/%v already exists", req.Policy, target)).Combine(errors.Exists))
+		return
+	}
+
+	policy, err := d.Config.GetPolicy(req.Policy)
+	if err != nil {
+		api.RESTHTTPError(w, errors.GetPolicy.Combine(errored.New(req.Policy).Combine(err)))
+		return
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		api.RESTHTTPError(w, errors.GetHostname.Combine(err))
+		return
+	}
+
+	// the volume is restored into a new one, created as any other volume of
+	// the policy would be.
+	targetReq := &config.VolumeRequest{
+		Policy:  req.Policy,
+		Name:    target,
+		Options: map[string]string{},
+	}
+
+	uc := &config.UseMount{
+		Volume:   targetReq.String(),
+		Reason:   lock.ReasonRestore,
+		Hostname: hostname,
+	}
+
+	snapUC := &config.UseSnapshot{
+		Volume: targetReq.String(),
+		Reason: lock.ReasonRestore,
+	}
+
+	err = lock.NewDriver(d.Config).ExecuteWithMultiUseLock([]config.UseLocker{uc, snapUC}, d.Global.Timeout, func(ld *lock.Driver, ucs []config.UseLocker) error {
+		volConfig, err := d.Config.CreateVolume(targetReq)
+		if err != nil {
+			return err
+		}
+
+		if volConfig.Backends.Snapshot == "" {
+			return errors.SnapshotsUnsupported.Combine(errored.New(volConfig.Backends.Snapshot))
+		}
+
+		driver, err := backend.NewSnapshotDriver(volConfig.Backends.Snapshot)
+		if err != nil {
+			return errors.GetDriver.Combine(err)
+		}
+
+		differ, ok := driver.(storage.DiffDriver)
+		if !ok {
+			return errors.BackupsUnsupported.Combine(errored.New(volConfig.Backends.Snapshot))
+		}
+
+		// the backups hold the data of the volume they were taken of, encrypted
+		// with its key. Keys kept in the database go with removed volumes, so
+		// their backups can only be restored while they exist.
+		sourceConfig := *volConfig
+		sourceConfig.VolumeName = req.Name
+
+		if err := d.Config.CopyEncryption(&sourceConfig, volConfig); err != nil {
+			return err
+		}
+
+		do, err := control.CreateVolume(policy, volConfig, d.Global.Timeout)
+		if err != nil {
+			return errors.CreateVolume.Combine(err)
+		}
+
+		do.Timeout = transferTimeout
+
+		err = repo.Restore(source, backupName, func(r io.Reader) error {
+			return differ.ImportDiff(do, r)
+		})
+
+		if err == nil {
+			// the image takes the size of the volume the backups were taken of.
+			d.recordBackendSize(volConfig)
+			err = ld.Config.PublishVolume(volConfig)
+		}
+
+		if err != nil {
+			if err := control.RemoveVolume(volConfig, d.Global.Timeout); err != nil {
+				logrus.Errorf("Error during cleanup of failed restore: %v", err)
+			}
+			return err
+		}
+
+		content, err := json.Marshal(volConfig)
+		if err != nil {
+			return errors.MarshalPolicy.Combine(err)
+		}
+
+		w.Write(content)
+		return nil
+	})
+
+	if err != nil {
+		api.RESTHTTPError(w, errors.RestoreBackup.Combine(errored.Errorf(
+			"Restoring backup %q of volume %q to %q",
+			backupName,
+			source,
+			targetReq.String(),
+		)).Combine(err))
+		return
+	}
+}
+
+// clone takes a snapshot of the volume and copies it into the new volume,
+// flattening the copy if asked to. The snapshot is removed once nothing
+// depends on it any longer.
+func (d *DaemonConfig) clone(driver storage.SnapshotDriver, flattenDriver storage.FlattenDriver, volConfig, newVolConfig *config.Volume, flatten bool) error {
+	do := storage.DriverOptions{
+		Volume: storage.Volume{
+			Name:   volConfig.String(),
+			Params: volConfig.DriverOptions,
+		},
+		Timeout: d.Global.Timeout,
+	}
+
+	snapName := time.Now().UTC().Format(cloneSnapshotFormat)
+
+	if err := driver.CreateSnapshot(snapName, do); err != nil {
+		return errors.SnapshotFailed.Combine(err)
+	}
+
+	info := &config.SnapshotInfo{Origin: storage.SnapshotPreCopy}
+	if err := d.Config.PublishSnapshotInfo(volConfig.String(), snapName, info); err != nil {
+		logrus.Errorf("Error recording snapshot %q for volume %q: %v", snapName, volConfig, err)
+	}
+
+	removeSnapshot := func() {
+		if err := driver.RemoveSnapshot(snapName, do); err != nil {
+			logrus.Errorf("Removing snapshot %q of volume %q: %v", snapName, volConfig, err)
+			return
+		}
+
+		if err := d.Config.RemoveSnapshotInfo(volConfig.String(), snapName); err != nil {
+			logrus.Debugf("Removing info of snapshot %q for volume %q: %v", snapName, volConfig, err)
+		}
+	}
+
+	cp, err := d.copySnapshot(driver, volConfig, newVolConfig, snapName, flatten)
+	if err != nil {
+		if cp == nil {
+			removeSnapshot()
+		}
+		return err
+	}
+
+	if !flatten {
+		return nil
+	}
+
+	// a clone which failed to flatten still needs the snapshot.
+	if err := d.flatten(flattenDriver, newVolConfig, cp); err != nil {
+		return err
+	}
+
+	removeSnapshot()
+	return nil
+}
+
+// copySnapshot records the new volume, copies the snapshot of the volume into
+// it and records the copy. The new volume is removed again if the snapshot
+// could not be copied, in which case no copy is returned.
+func (d *DaemonConfig) copySnapshot(driver storage.SnapshotDriver, volConfig, newVolConfig *config.Volume, snapName string, flatten bool) (*config.Copy, error) {
+	if err := d.Config.PublishVolume(newVolConfig); err != nil {
+		return nil, err
+	}
+
+	// the copy shares the data of the volume, encrypted with its key.
+	err := d.Config.CopyEncryption(volConfig, newVolConfig)
+	if err == nil {
+		do := storage.DriverOptions{
+			Volume: storage.Volume{
+				Name:   volConfig.String(),
+				Params: volConfig.DriverOptions,
+			},
+			Timeout: d.Global.Timeout,
+		}
+
+		err = driver.CopySnapshot(do, snapName, newVolConfig.String())
+	}
+
+	if err != nil {
+		if err := d.Config.RemoveVolume(newVolConfig.PolicyName, newVolConfig.VolumeName); err != nil {
+			logrus.Errorf("Removing volume %q after failed copy: %v", newVolConfig, err)
+		}
+		return nil, err
+	}
+
+	cp := &config.Copy{
+		Source:   volConfig.String(),
+		Snapshot: snapName,
+		Target:   newVolConfig.String(),
+		Status:   config.CopyCloned,
+		Updated:  time.Now(),
+	}
+
+	if flatten {
+		cp.Status = config.CopyFlattening
+	}
+
+	return cp, d.Config.PublishCopy(cp)
+}
+
+// acquireWithTTLRefresh acquires the locks, refreshing their TTL until the
+// returned function is called to release them. No lock is held on error.
+func (d *DaemonConfig) acquireWithTTLRefresh(ucs []config.UseLocker) (func(), error) {
+	ld := lock.NewDriver(d.Config)
+	stopChans := []chan struct{}{}
+
+	release := func() {
+		for _, stopChan := range stopChans {
+			stopChan <- struct{}{}
+		}
+	}
+
+	for _, uc := range ucs {
+		stopChan, err := ld.AcquireWithTTLRefresh(uc, d.Global.TTL, d.Global.Timeout)
+		if err != nil {
+			release()
+			return nil, err
+		}
+		stopChans = append(stopChans, stopChan)
+	}
+
+	return release, nil
+}
+
+// flatten detaches a copy from its snapshot, recording its progress as it
+// goes. The error is recorded with the copy as well as returned.
+//
+// XXX flattening is not resumed when the apiserver restarts; the copy is
+// marked failed on startup and keeps depending on its snapshot.
+func (d *DaemonConfig) flatten(driver storage.FlattenDriver, vc *config.Volume, cp *config.Copy) error {
+	do, err := vc.ToDriverOptions(flattenTimeout)
+	if err == nil {
+		err = driver.Flatten(do, func(percent int) {
+			if percent == cp.Progress {
+				return
+			}
+
+			cp.Progress = percent
+			cp.Updated = time.Now()
+			if err := d.Config.PublishCopy(cp); err != nil {
+				logrus.Errorf("Recording progress of flattening volume %q: %v", cp.Target, err)
+			}
+		})
+	}
+
+	if err != nil {
+		logrus.Errorf("Flattening volume %q: %v", cp.Target, err)
+		cp.Status = config.CopyFailed
+		cp.Error = err.Error()
+	} else {
+		cp.Status = config.CopyFlattened
+		cp.Progress = 100
+	}
+
+	// the volume may have been removed while it was flattened.
+	if _, getErr := d.Config.GetVolume(vc.PolicyName, vc.VolumeName); getErr != nil {
+		return err
+	}
+
+	cp.Updated = time.Now()
+	if err := d.Config.PublishCopy(cp); err != nil {
+		logrus.Errorf("Recording flattening of volume %q: %v", cp.Target, err)
+	}
+
+	return err
+}
+
+// failInterruptedFlattens marks the copies which were still being flattened
+// when the apiserver stopped as failed, as nothing will finish flattening them.
+func (d *DaemonConfig) failInterruptedFlattens() {
+	policies, err := d.Config.ListPolicies()
+	if err != nil {
+		logrus.Errorf("Listing policies to find interrupted flattens: %v", err)
+		return
+	}
+
+	for _, policy := range policies {
+		copies, err := d.Config.ListCopies(policy.Name)
+		if err != nil {
+			logrus.Errorf("Listing copies of policy %q to find interrupted flattens: %v", policy.Name, err)
+			continue
+		}
+
+		for _, cp := range copies {
+			if cp.Status != config.CopyFlattening {
+				continue
+			}
+
+			logrus.Warnf("Flattening volume %q was interrupted by a restart; marking it failed", cp.Target)
+			cp.Status = config.CopyFailed
+			cp.Error = "flattening was interrupted by a restart of the apiserver"
+			cp.Updated = time.Now()
+			if err := d.Config.PublishCopy(cp); err != nil {
+				logrus.Errorf("Recording interrupted flattening of volume %q: %v", cp.Target, err)
+			}
+		}
+	}
+}
+
+func (d *DaemonConfig) handleCopyStatus(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	cp, err := d.Config.GetCopy(vars["policy"], vars["volume"])
+	if erd, ok := err.(*errored.Error); ok && erd.Contains(errors.NotExists) {
+		w.WriteHeader(404)
+		return
+	} else if err != nil {
+		api.RESTHTTPError(w, errors.GetVolume.Combine(err))
+		return
+	}
+
+	content, err := json.Marshal(cp)
+	if err != nil {
+		api.RESTHTTPError(w, errors.MarshalResponse.Combine(err))
+		return
+	}
+
+	w.Write(content)
+}
+
+func (d *DaemonConfig) handleResize(w http.ResponseWriter, r *http.Request) {
+	req, err := unmarshalRequest(r)
+	if err != nil {
+		api.RESTHTTPError(w, errors.UnmarshalRequest.Combine(err))
+		return
+	}
+
+	if _, ok := req.Options["size"]; !ok {
+		api.RESTHTTPError(w, errors.MissingSizeOption)
+		return
+	}
+
+	volConfig, err := d.Config.GetVolume(req.Policy, req.Name)
+	if err != nil {
+		api.RESTHTTPError(w, errors.GetVolume.Combine(err))
+		return
+	}
+
+	oldSize, err := volConfig.CreateOptions.ActualSize()
+	if err != nil {
+		api.RESTHTTPError(w, errors.ResizeVolume.Combine(err))
+		return
+	}
+
+	volConfig.CreateOptions.Size = req.Options["size"]
+
+	newSize, err := volConfig.CreateOptions.ActualSize()
+	if err != nil {
+		api.RESTHTTPError(w, errors.ResizeVolume.Combine(err))
+		return
+	}
+
+	if newSize <= oldSize {
+		api.RESTHTTPError(w, errors.ResizeVolume.Combine(errored.Errorf("Volume %q can only grow: %dMB requested, %dMB now", volConfig, newSize, oldSize)))
+		return
+	}
+
+	locks := []config.UseLocker{
+		&config.UseSnapshot{
+			Volume: volConfig.String(),
+			Reason: lock.ReasonResize,
+		},
+	}
+
+	// mounted volumes are resized online, and the hosts which have them
+	// mounted grow their filesystems when they see the updated volume. Others
+	// are kept from being mounted until the resize is done; they grow their
+	// filesystems when they are mounted. Unlocked volumes may be mounted
+	// anywhere, so they are always resized online.
+	if !volConfig.Unlocked && !d.isMounted(volConfig) {
+		host, err := os.Hostname()
+		if err != nil {
+			api.RESTHTTPError(w, errors.GetHostname.Combine(err))
+			return
+		}
+
+		locks = append(locks, &config.UseMount{
+			Volume:   volConfig.String(),
+			Reason:   lock.ReasonResize,
+			Hostname: host,
+		})
+	}
+
+	err = lock.NewDriver(d.Config).ExecuteWithMultiUseLock(locks, d.Global.Timeout, func(ld *lock.Driver, ucs []config.UseLocker) error {
+		if err := control.ResizeVolume(volConfig, d.Global.Timeout); err != nil {
+			return err
+		}
+
+		return d.Config.UpdateVolume(volConfig)
+	})
+
+	if err != nil {
+		api.RESTHTTPError(w, errors.ResizeVolume.Combine(errored.New(volConfig.String())).Combine(err))
+		return
+	}
+
+	content, err := json.Marshal(volConfig)
+	if err != nil {
+		api.RESTHTTPError(w, errors.MarshalResponse.Combine(err))
+		return
+	}
+
+	w.Write(content)
+}
+
+// isMounted tells if the mount lock of the volume is held by a mount.
+func (d *DaemonConfig) isMounted(volConfig *config.Volume) bool {
+	uc := &config.UseMount{}
+	if err := d.Config.GetUse(uc, volConfig); err != nil {
+		return false
+	}
+
+	return uc.Reason == lock.ReasonMount
+}
+
+// handleRename renames a volume, or moves it to another policy, in its
+// backend and in the database. The volume must not be mounted; it cannot be
+// mounted under either name until the rename is done.
+func (d *DaemonConfig) handleRename(w http.ResponseWriter, r *http.Request) {
+	req, err := unmarshalRequest(r)
+	if err != nil {
+		api.RESTHTTPError(w, errors.UnmarshalRequest.Combine(err))
+		return
+	}
+
+	policy := req.Policy
+	if p, ok := req.Options["target-policy"]; ok {
+		policy = p
+	}
+
+	name := req.Name
+	if n, ok := req.Options["target"]; ok {
+		name = n
+	}
+
+	if policy == "" || name == "" || strings.Contains(policy, "/") || strings.Contains(name, "/") {
+		api.RESTHTTPError(w, errors.InvalidVolume.Combine(errored.Errorf("%v/%v", policy, name)))
+		return
+	}
+
+	if policy == req.Policy && name == req.Name {
+		api.RESTHTTPError(w, errors.RenameVolume.Combine(errored.Errorf("Volume %q is already named so", req)))
+		return
+	}
+
+	volConfig, err := d.Config.GetVolume(req.Policy, req.Name)
+	if err != nil {
+		api.RESTHTTPError(w, errors.GetVolume.Combine(err))
+		return
+	}
+
+	// unlocked volumes leave no trace of their mounts, so they cannot be known
+	// to be unmounted.
+	if volConfig.Unlocked {
+		api.RESTHTTPError(w, errors.RenameVolume.Combine(errored.Errorf("Volume %q is unlocked and may be mounted", volConfig)))
+		return
+	}
+
+	newVolConfig, err := d.Config.RenamedVolume(volConfig, policy, name)
+	if err != nil {
+		api.RESTHTTPError(w, errors.RenameVolume.Combine(err))
+		return
+	}
+
+	host, err := os.Hostname()
+	if err != nil {
+		api.RESTHTTPError(w, errors.GetHostname.Combine(err))
+		return
+	}
+
+	// the mount locks fail to be taken while the volume is mounted, and keep
+	// it from being mounted under either name until the rename is done.
+	locks := []config.UseLocker{}
+	for _, vc := range []*config.Volume{volConfig, newVolConfig} {
+		locks = append(locks,
+			&config.UseMount{
+				Volume:   vc.String(),
+				Reason:   lock.ReasonRename,
+				Hostname: host,
+			},
+			&config.UseSnapshot{
+				Volume: vc.String(),
+				Reason: lock.ReasonRename,
+			},
+		)
+	}
+
+	err = lock.NewDriver(d.Config).ExecuteWithMultiUseLock(locks, d.Global.Timeout, func(ld *lock.Driver, ucs []config.UseLocker) error {
+		if _, err := d.Config.GetVolume(newVolConfig.PolicyName, newVolConfig.VolumeName); err == nil {
+			return errors.Exists.Combine(errored.New(newVolConfig.String()))
+		}
+
+		err := control.RenameVolume(volConfig, newVolConfig.String(), d.Global.Timeout)
+		if err == errors.NoActionTaken {
+			err = nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if err := d.Config.RenameVolume(volConfig, newVolConfig); err != nil {
+			if err := control.RenameVolume(newVolConfig, volConfig.String(), d.Global.Timeout); err != nil && err != errors.NoActionTaken {
+				logrus.Errorf("Renaming volume %q back to %q after failing to rename its records: %v", newVolConfig, volConfig, err)
+			}
+			return err
+		}
+
+		d.renameBackups(volConfig, newVolConfig)
+
+		return nil
+	})
+
+	if err != nil {
+		api.RESTHTTPError(w, errors.RenameVolume.Combine(errored.Errorf("Renaming volume %q to %q", volConfig, newVolConfig)).Combine(err))
+		return
+	}
+
+	content, err := json.Marshal(newVolConfig)
+	if err != nil {
+		api.RESTHTTPError(w, errors.MarshalResponse.Combine(err))
+		return
+	}
+
+	w.Write(content)
+}
+
+// renameBackups moves the backups of a renamed volume along with it, if it is
+// still backed up to the same repository. Otherwise they are left under the
+// old name, from which they can still be restored.
+func (d *DaemonConfig) renameBackups(volConfig, newVolConfig *config.Volume) {
+	repository := volConfig.RuntimeOptions.Backup.Repository
+	if repository == "" {
+		return
+	}
+
+	if repository != newVolConfig.RuntimeOptions.Backup.Repository {
+		logrus.Warnf("Volume %q is backed up to another repository than %q; leaving its backups under %q", newVolConfig, repository, volConfig)
+		return
+	}
+
+	if err := backup.NewRepository(repository).Rename(volConfig.String(), newVolConfig.String()); err != nil {
+		logrus.Errorf("Moving backups of volume %q to %q: %v", volConfig, newVolConfig, err)
+	}
+}
+
+// handleAdopt records an image made in the backend outside volplugin as a
+// volume, without creating or formatting it. The image is named by the
+// "image" option, optionally prefixed by its pool, and keeps its name. Its
+// size is taken from the backend if it can tell, and its filesystem is probed
+// if the "detect-filesystem" option is set.
+func (d *DaemonConfig) handleAdopt(w http.ResponseWriter, r *http.Request) {
+	req, err := unmarshalRequest(r)
+	if err != nil {
+		api.RESTHTTPError(w, errors.UnmarshalRequest.Combine(err))
+		return
+	}
+
+	image := req.Options["image"]
+	detectFS := req.Options["detect-filesystem"] == "true"
+	delete(req.Options, "image")
+	delete(req.Options, "detect-filesystem")
+
+	var pool string
+	if parts := strings.SplitN(image, "/", 2); len(parts) == 2 {
+		pool, image = parts[0], parts[1]
+	}
+
+	if image == "" {
+		api.RESTHTTPError(w, errors.AdoptVolume.Combine(errored.Errorf("No image given for volume %q", req)))
+		return
+	}
+
+	policy, err := d.Config.GetPolicy(req.Policy)
+	if err != nil {
+		api.RESTHTTPError(w, errors.GetPolicy.Combine(errored.New(req.Policy).Combine(err)))
+		return
+	}
+
+	volConfig, err := d.Config.CreateVolume(req)
+	if err != nil {
+		api.RESTHTTPError(w, errors.AdoptVolume.Combine(err))
+		return
+	}
+
+	if pool != "" {
+		volConfig.DriverOptions["pool"] = pool
+	}
+
+	// the keys of encrypted volumes are made when they are formatted, which
+	// images made outside volplugin never were.
+	if volConfig.CreateOptions.Encryption.Enabled() {
+		api.RESTHTTPError(w, errors.AdoptVolume.Combine(errored.Errorf("Volumes of policy %q are encrypted", req.Policy)))
+		return
+	}
+
+	host, err := os.Hostname()
+	if err != nil {
+		api.RESTHTTPError(w, errors.GetHostname.Combine(err))
+		return
+	}
+
+	uc := &config.UseMount{
+		Volume:   volConfig.String(),
+		Reason:   lock.ReasonAdopt,
+		Hostname: host,
+	}
+
+	snapUC := &config.UseSnapshot{
+		Volume: volConfig.String(),
+		Reason: lock.ReasonAdopt,
+	}
+
+	err = lock.NewDriver(d.Config).ExecuteWithMultiUseLock([]config.UseLocker{uc, snapUC}, d.Global.Timeout, func(ld *lock.Driver, ucs []config.UseLocker) error {
+		if _, err := d.Config.GetVolume(volConfig.PolicyName, volConfig.VolumeName); err == nil {
+			return errors.Exists.Combine(errored.New(volConfig.String()))
+		}
+
+		volumes, err := d.volumes()
+		if err != nil {
+			return err
+		}
+
+		// nothing is changed in the backend, so there is nothing to undo if the
+		// volume cannot be recorded.
+		if err := control.AdoptVolume(volConfig, image, volumes, d.Global.Timeout); err != nil {
+			return err
+		}
+
+		if err := d.adoptedVolume(volConfig, policy, detectFS); err != nil {
+			return err
+		}
+
+		return d.Config.PublishVolume(volConfig)
+	})
+
+	if err != nil {
+		api.RESTHTTPError(w, errors.AdoptVolume.Combine(errored.Errorf("Adopting image %q as volume %q", image, volConfig)).Combine(err))
+		return
+	}
+
+	content, err := json.Marshal(volConfig)
+	if err != nil {
+		api.RESTHTTPError(w, errors.MarshalResponse.Combine(err))
+		return
+	}
+
+	w.Write(content)
+}
+
+// volumes returns all the recorded volumes.
+func (d *DaemonConfig) volumes() ([]*config.Volume, error) {
+	names, err := d.Config.ListAllVolumes()
+	if err != nil {
+		return nil, errors.ListVolume.Combine(err)
+	}
+
+	volumes := []*config.Volume{}
+	for _, name := range names {
+		parts := strings.SplitN(name, "/", 2)
+		if len(parts) != 2 {
+			return nil, errors.InvalidVolume.Combine(errored.New(name))
+		}
+
+		volConfig, err := d.Config.GetVolume(parts[0], parts[1])
+		if err != nil {
+			return nil, errors.ListVolume.Combine(err)
+		}
+
+		volumes = append(volumes, volConfig)
+	}
+
+	return volumes, nil
+}
+
+// adoptedVolume fills in the size, and if asked the filesystem, of a volume
+// adopted from an image as the backend reports them.
+func (d *DaemonConfig) adoptedVolume(volConfig *config.Volume, policy *config.Policy, detectFS bool) error {
+	d.recordBackendSize(volConfig)
+
+	if !detectFS {
+		return nil
+	}
+
+	fsType, err := control.VolumeFileSystem(volConfig, d.Global.Timeout)
+	if err != nil {
+		return err
+	}
+
+	if fsType == "" {
+		return errored.Errorf("No filesystem found on volume %q", volConfig)
+	}
+
+	if fsType != volConfig.CreateOptions.FileSystem {
+		// the mount options of the filesystem the policy assumed do not apply.
+		if volConfig.RuntimeOptions.MountOptions == policy.MountOptions[volConfig.CreateOptions.FileSystem] {
+			volConfig.RuntimeOptions.MountOptions = policy.MountOptions[fsType]
+		}
+
+		volConfig.CreateOptions.FileSystem = fsType
+	}
+
+	return nil
+}
+
+// handleImageList lists the images in the backend of a policy, along with the
+// volumes using them. Images no volume uses can be adopted. The "pool" query
+// parameter overrides the pool of the policy.
+func (d *DaemonConfig) handleImageList(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	policy, err := d.Config.GetPolicy(vars["policy"])
+	if err != nil {
+		api.RESTHTTPError(w, errors.GetPolicy.Combine(errored.New(vars["policy"]).Combine(err)))
+		return
+	}
+
+	params := storage.Params{}
+	for key, value := range policy.DriverOptions {
+		params[key] = value
+	}
+
+	if pool := r.URL.Query().Get("pool"); pool != "" {
+		params["pool"] = pool
+	}
+
+	volumes, err := d.volumes()
+	if err != nil {
+		api.RESTHTTPError(w, err)
+		return
+	}
+
+	images, err := control.ListImages(policy, params, volumes)
+	if err != nil {
+		api.RESTHTTPError(w, errors.ListVolume.Combine(err))
+		return
+	}
+
+	content, err := json.Marshal(images)
+	if err != nil {
+		api.RESTHTTPError(w, errors.MarshalResponse.Combine(err))
+		return
+	}
+
+	w.Write(content)
+}
+
+func (d *DaemonConfig) handleGlobal(w http.ResponseWriter, r *http.Request) {
+	content, err := json.Marshal(d.Global.Published())
+	if err != nil {
+		api.RESTHTTPError(w, errors.MarshalGlobal.Combine(err))
+		return
+	}
+
+	w.Write(content)
+}
+
+func (d *DaemonConfig) handleList(w http.ResponseWriter, r *http.Request) {
+	vols, err := d.Config.ListAllVolumes()
+	if err != nil {
+		api.RESTHTTPError(w, errors.ListVolume.Combine(err))
+		return
+	}
+
+	response := []*config.Volume{}
+	for _, vol := range vols {
+		parts := strings.SplitN(vol, "/", 2)
+		if len(parts) != 2 {
+			api.RESTHTTPError(w, errors.InvalidVolume.Combine(errored.New(vol)))
+			return
+		}
+		// FIXME make this take a single string and not a split one
+		volConfig, err := d.Config.GetVolume(parts[0], parts[1])
+		if err != nil {
+			api.RESTHTTPError(w, errors.ListVolume.Combine(err))
+			return
+		}
+
+		response = append(response, volConfig)
+	}
+
+	content, err := json.Marshal(response)
+	if err != nil {
+		api.RESTHTTPError(w, errors.MarshalResponse.Combine(err))
+		return
+	}
+
+	w.Write(content)
+}
+
+func (d *DaemonConfig) handleListAll(w http.ResponseWriter, r *http.Request) {
+	vols, err := d.Config.ListAllVolumes()
+	if err != nil {
+		api.RESTHTTPError(w, errors.ListVolume.Combine(err))
+		return
+	}
+
+	response := []*config.Volume{}
+	for _, vol := range vols {
+		parts := strings.SplitN(vol, "/", 2)
+		if len(parts) != 2 {
+			api.RESTHTTPError(w, errors.InvalidVolume.Combine(errored.New(vol)))
+			return
+		}
+		// FIXME make this take a single string and not a split one
+		volConfig, err := d.Config.GetVolume(parts[0], parts[1])
+		if err != nil {
+			api.RESTHTTPError(w, errors.ListVolume.Combine(err))
+			return
+		}
+
+		response = append(response, volConfig)
+	}
+
+	content, err := json.Marshal(response)
+	if err != nil {
+		api.RESTHTTPError(w, errors.ListVolume.Combine(err))
+		return
+	}
+
+	w.Write(content)
+}
+
+func (d *DaemonConfig) handleGet(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	policy := vars["policy"]
+	volumeName := vars["volume"]
+
+	volConfig, err := d.Config.GetVolume(policy, volumeName)
+	if erd, ok := err.(*errored.Error); ok && erd.Contains(errors.NotExists) {
+		w.WriteHeader(404)
+		return
+	} else if err != nil {
+		api.RESTHTTPError(w, errors.GetVolume.Combine(err))
+		return
+	}
+
+	content, err := json.Marshal(volConfig)
+	if err != nil {
+		api.RESTHTTPError(w, errors.MarshalResponse.Combine(err))
+		return
+	}
+
+	w.Write(content)
+}
+
+func (d *DaemonConfig) handleStats(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	policy := vars["policy"]
+	volumeName := vars["volume"]
+
+	volConfig, err := d.Config.GetVolume(policy, volumeName)
+	if erd, ok := err.(*errored.Error); ok && erd.Contains(errors.NotExists) {
+		w.WriteHeader(404)
+		return
+	} else if err != nil {
+		api.RESTHTTPError(w, errors.GetVolume.Combine(err))
+		return
+	}
+
+	// only volplugin can measure filesystems and host-local storage, so it
+	// publishes what it sees.
+	reported, err := d.Config.GetVolumeStats(volConfig.String())
+	if erd, ok := err.(*errored.Error); ok && erd.Contains(errors.NotExists) {
+		reported = nil
+	} else if err != nil {
+		api.RESTHTTPError(w, errors.GetStats.Combine(errored.New(volConfig.String())).Combine(err))
+		return
+	}
+
+	stats, err := control.VolumeStats(volConfig, reported, d.Global.Timeout)
+	if err != nil {
+		api.RESTHTTPError(w, errors.GetStats.Combine(errored.New(volConfig.String())).Combine(err))
+		return
+	}
+
+	content, err := json.Marshal(stats)
+	if err != nil {
+		api.RESTHTTPError(w, errors.MarshalResponse.Combine(err))
+		return
+	}
+
+	w.Write(content)
+}
+
+func (d *DaemonConfig) createRemoveLocks(vc *config.Volume) ([]config.UseLocker, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, errors.GetHostname.Combine(err)
+	}
+
+	uc := &config.UseMount{
+		Volume:   vc.String(),
+		Reason:   lock.ReasonRemove,
+		Hostname: hostname,
+	}
+
+	snapUC := &config.UseSnapshot{
+		Volume: vc.String(),
+		Reason: lock.ReasonRemove,
+	}
+
+	return []config.UseLocker{uc, snapUC}, nil
+}
+
+func (d *DaemonConfig) removeVolume(req *config.VolumeRequest, vc *config.Volume) error {
+	if err := d.Config.RemoveVolume(req.Policy, req.Name); err != nil {
+		return errors.ClearVolume.Combine(errored.New(vc.String())).Combine(err)
+	}
+
+	return nil
+}
+
+func (d *DaemonConfig) completeRemove(req *config.VolumeRequest, vc *config.Volume) error {
+	if err := control.RemoveVolume(vc, d.Global.Timeout); err != nil && err != errors.NoActionTaken {
+		logrus.Warn(errors.RemoveImage.Combine(errored.New(vc.String())).Combine(err))
+	}
+
+	return d.removeVolume(req, vc)
+}
+
+// this cleans up uses when forcing the removal
+func (d *DaemonConfig) removeVolumeUse(lock config.UseLocker, vc *config.Volume) {
+	// locks[0] is the usemount lock
+	if err := d.Config.RemoveUse(lock, true); err != nil {
+		logrus.Warn(errors.RemoveImage.Combine(errored.New(vc.String())).Combine(err))
+	}
+}
+
+func (d *DaemonConfig) handleForceRemoveLock(req *config.VolumeRequest, vc *config.Volume, locks []config.UseLocker) error {
+	exists, err := control.ExistsVolume(vc, d.Global.Timeout)
+	if err != nil && err != errors.NoActionTaken {
+		return errors.RemoveVolume.Combine(errored.New(vc.String())).Combine(err)
+	}
+
+	if err == errors.NoActionTaken {
+		if err := d.completeRemove(req, vc); err != nil {
+			return err
+		}
+
+		d.removeVolumeUse(locks[0], vc)
+	}
+
+	if err != nil {
+		return errors.RemoveVolume.Combine(errored.New(vc.String())).Combine(err)
+	}
+
+	if !exists {
+		d.removeVolume(req, vc)
+		return errors.RemoveVolume.Combine(errored.New(vc.String())).Combine(errors.NotExists)
+	}
+
+	err = d.completeRemove(req, vc)
+	if err != nil {
+		return errors.RemoveVolume.Combine(errored.New(vc.String())).Combine(errors.NotExists)
+	}
+
+	d.removeVolumeUse(locks[0], vc)
+	return nil
+}
+
+func (d *DaemonConfig) handleRemove(w http.ResponseWriter, r *http.Request) {
+	// set a default timeout if none is specified
+	timeout := d.Global.Timeout
+	req, err := unmarshalRequest(r)
+	if err != nil {
+		api.RESTHTTPError(w, errors.UnmarshalRequest.Combine(err))
+		return
+	}
+
+	if req.Options["timeout"] != "" {
+		var t time.Duration
+		if t, err = time.ParseDuration(req.Options["timeout"]); err != nil {
+			api.RESTHTTPError(w, errors.RemoveVolume.Combine(err))
+			return
+		}
+		timeout = t
+	}
+
+	vc, err := d.Config.GetVolume(req.Policy, req.Name)
+	if err != nil {
+		api.RESTHTTPError(w, errors.GetVolume.Combine(err))
+		return
+	}
+
+	locks, err := d.createRemoveLocks(vc)
+	if err != nil {
+		api.RESTHTTPError(w, err)
+		return
+	}
+
+	if req.Options["force"] == "true" {
+		if err := d.handleForceRemoveLock(req, vc, locks); err != nil {
+			api.RESTHTTPError(w, err)
+			return
+		}
+	}
+
+	err = lock.NewDriver(d.Config).ExecuteWithMultiUseLock(locks, timeout, func(ld *lock.Driver, ucs []config.UseLocker) error {
+		exists, err := control.ExistsVolume(vc, timeout)
+		if err != nil && err != errors.NoActionTaken {
+			return err
+		}
+
+		if err == errors.NoActionTaken {
+			return d.completeRemove(req, vc)
+		}
+
+		if !exists {
+			d.removeVolume(req, vc)
+			return errors.NotExists
+		}
+
+		return d.completeRemove(req, vc)
+	})
+
+	if err == errors.NotExists {
+		w.WriteHeader(404)
+		return
+	}
+
+	if err != nil {
+		api.RESTHTTPError(w, errors.RemoveVolume.Combine(errored.New(vc.String())).Combine(err))
+		return
+	}
+}
 
 func (d *DaemonConfig) handleRemoveForce(w http.ResponseWriter, r *http.Request) {
 	req, err := unmarshalRequest(r)
@@ -897,7 +2209,12 @@ func (d *DaemonConfig) createVolume(w http.ResponseWriter, req *config.VolumeReq
 			return errors.CreateVolume.Combine(err)
 		}
 
-		if err := control.FormatVolume(volConfig, do); err != nil {
+		do.Encryption, err = d.Config.NewEncryption(volConfig)
+		if err == nil {
+			err = control.FormatVolume(volConfig, do)
+		}
+
+		if err != nil {
 			if err := control.RemoveVolume(volConfig, d.Global.Timeout); err != nil {
 				logrus.Errorf("Error during cleanup of failed format: %v", err)
 			}
@@ -0,0 +1,313 @@
+// Package backup implements the repositories volsupervisor writes backups of
+// volumes to.
+//
+// A repository is a directory, local or mounted over e.g. NFS, which holds a
+// directory for each volume backed up. Each backup is a diff written by the
+// storage driver, either of all of the snapshot it was taken from or of the
+// changes since the snapshot of the backup before it. The catalog file of the
+// volume records the backups in the order they were taken, so a volume can be
+// rebuilt from the chain of diffs leading up to any of them.
+package backup
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/storage"
+)
+
+const (
+	catalogFile = "catalog.json"
+	diffSuffix  = ".diff"
+)
+
+// Backup is a backup of a volume, named after the snapshot it was taken from.
+// Parent is the backup the diff holds the changes since; it is empty for full
+// backups.
+type Backup struct {
+	Name    string    `json:"name"`
+	Parent  string    `json:"parent,omitempty"`
+	File    string    `json:"file"`
+	Created time.Time `json:"created"`
+	Size    uint64    `json:"size"`
+}
+
+// Full tells if the backup holds all of the volume.
+func (b *Backup) Full() bool {
+	return b.Parent == ""
+}
+
+// Catalog is the record of the backups of a volume, oldest first.
+type Catalog struct {
+	Volume  string    `json:"volume"`
+	Backups []*Backup `json:"backups"`
+}
+
+// Get returns the named backup, or nil if there is none.
+func (c *Catalog) Get(name string) *Backup {
+	for _, b := range c.Backups {
+		if b.Name == name {
+			return b
+		}
+	}
+
+	return nil
+}
+
+// Latest returns the backup taken last, or nil if there are none.
+func (c *Catalog) Latest() *Backup {
+	if len(c.Backups) == 0 {
+		return nil
+	}
+
+	return c.Backups[len(c.Backups)-1]
+}
+
+// Chain returns the backups to restore, in order, to rebuild the volume as of
+// the named backup: the full backup it goes back to, and every one since.
+func (c *Catalog) Chain(name string) ([]*Backup, error) {
+	chain := []*Backup{}
+
+	for name != "" {
+		b := c.Get(name)
+		if b == nil {
+			return nil, errored.Errorf("Backup %q of volume %q does not exist", name, c.Volume).Combine(errors.NotExists)
+		}
+
+		chain = append([]*Backup{b}, chain...)
+		name = b.Parent
+	}
+
+	return chain, nil
+}
+
+// Repository is a directory holding backups.
+type Repository struct {
+	path string
+}
+
+// NewRepository returns the repository at path. It is created when the first
+// backup is written.
+func NewRepository(path string) *Repository {
+	return &Repository{path: path}
+}
+
+func (r *Repository) volumeDir(volume string) (string, error) {
+	policy, name, err := storage.SplitName(volume)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(r.path, policy, name), nil
+}
+
+// Catalog returns the catalog of the volume, named policy/volume. Volumes
+// never backed up have an empty one.
+func (r *Repository) Catalog(volume string) (*Catalog, error) {
+	dir, err := r.volumeDir(volume)
+	if err != nil {
+		return nil, err
+	}
+
+	catalog := &Catalog{Volume: volume, Backups: []*Backup{}}
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, catalogFile))
+	if os.IsNotExist(err) {
+		return catalog, nil
+	} else if err != nil {
+		return nil, errored.Errorf("Reading backup catalog of volume %q", volume).Combine(err)
+	}
+
+	if err := json.Unmarshal(content, catalog); err != nil {
+		return nil, errored.Errorf("Reading backup catalog of volume %q", volume).Combine(err)
+	}
+
+	return catalog, nil
+}
+
+// writeFile replaces the file at path with what write writes, so a partial
+// file is never left in its place. It returns the number of bytes written.
+func writeFile(path string, write func(io.Writer) error) (uint64, error) {
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return 0, err
+	}
+
+	cw := &countingWriter{w: f}
+	err = write(cw)
+	if err == nil {
+		err = f.Sync()
+	}
+
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+
+	if err != nil {
+		os.Remove(f.Name())
+		return 0, err
+	}
+
+	return cw.count, nil
+}
+
+type countingWriter struct {
+	w     io.Writer
+	count uint64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.count += uint64(n)
+	return n, err
+}
+
+// Add writes a backup of the volume, the diff write writes, and records it in
+// the catalog. The name, and parent for incremental backups, must be set; the
+// rest is filled in.
+func (r *Repository) Add(volume string, b *Backup, write func(io.Writer) error) error {
+	if b.Name == "" || b.Name == "." || b.Name == ".." || strings.Contains(b.Name, "/") {
+		return errored.Errorf("Invalid backup name %q", b.Name)
+	}
+
+	catalog, err := r.Catalog(volume)
+	if err != nil {
+		return err
+	}
+
+	if catalog.Get(b.Name) != nil {
+		return errored.Errorf("Backup %q of volume %q already exists", b.Name, volume).Combine(errors.Exists)
+	}
+
+	if b.Parent != "" && catalog.Get(b.Parent) == nil {
+		return errored.Errorf("Parent backup %q of volume %q does not exist", b.Parent, volume).Combine(errors.NotExists)
+	}
+
+	dir, err := r.volumeDir(volume)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return errored.Errorf("Creating backup directory of volume %q", volume).Combine(err)
+	}
+
+	b.File = b.Name + diffSuffix
+
+	size, err := writeFile(filepath.Join(dir, b.File), write)
+	if err != nil {
+		return errored.Errorf("Writing backup %q of volume %q", b.Name, volume).Combine(err)
+	}
+
+	b.Size = size
+	if b.Created.IsZero() {
+		b.Created = time.Now()
+	}
+
+	catalog.Backups = append(catalog.Backups, b)
+
+	return writeCatalog(dir, catalog)
+}
+
+func writeCatalog(dir string, catalog *Catalog) error {
+	content, err := json.MarshalIndent(catalog, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = writeFile(filepath.Join(dir, catalogFile), func(w io.Writer) error {
+		_, err := w.Write(content)
+		return err
+	})
+	if err != nil {
+		return errored.Errorf("Writing backup catalog of volume %q", catalog.Volume).Combine(err)
+	}
+
+	return nil
+}
+
+// Rename moves the backups of the volume to those of newVolume, which must
+// have none. Volumes never backed up are left alone.
+func (r *Repository) Rename(volume, newVolume string) error {
+	dir, err := r.volumeDir(volume)
+	if err != nil {
+		return err
+	}
+
+	newDir, err := r.volumeDir(newVolume)
+	if err != nil {
+		return err
+	}
+
+	catalog, err := r.Catalog(volume)
+	if err != nil {
+		return err
+	}
+
+	if len(catalog.Backups) == 0 {
+		return nil
+	}
+
+	if _, err := os.Stat(newDir); err == nil {
+		return errored.Errorf("Backups of volume %q already exist", newVolume).Combine(errors.Exists)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(newDir), 0700); err != nil {
+		return errored.Errorf("Creating backup directory of volume %q", newVolume).Combine(err)
+	}
+
+	if err := os.Rename(dir, newDir); err != nil {
+		return errored.Errorf("Moving backups of volume %q to %q", volume, newVolume).Combine(err)
+	}
+
+	catalog.Volume = newVolume
+	return writeCatalog(newDir, catalog)
+}
+
+// Restore passes the diffs of the chain of backups leading up to the named
+// one to apply, in order.
+func (r *Repository) Restore(volume, name string, apply func(io.Reader) error) error {
+	catalog, err := r.Catalog(volume)
+	if err != nil {
+		return err
+	}
+
+	chain, err := catalog.Chain(name)
+	if err != nil {
+		return err
+	}
+
+	dir, err := r.volumeDir(volume)
+	if err != nil {
+		return err
+	}
+
+	for _, b := range chain {
+		if err := applyFile(filepath.Join(dir, b.File), apply); err != nil {
+			return errored.Errorf("Restoring backup %q of volume %q", b.Name, volume).Combine(err)
+		}
+	}
+
+	return nil
+}
+
+func applyFile(path string, apply func(io.Reader) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return apply(f)
+}
@@ -0,0 +1,151 @@
+package backup
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	. "testing"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/contiv/errored"
+)
+
+type backupSuite struct {
+	dir string
+}
+
+var _ = Suite(&backupSuite{})
+
+func TestBackup(t *T) { TestingT(t) }
+
+func (s *backupSuite) SetUpTest(c *C) {
+	var err error
+	s.dir, err = ioutil.TempDir("", "volplugin-backup")
+	c.Assert(err, IsNil)
+}
+
+func (s *backupSuite) TearDownTest(c *C) {
+	c.Assert(os.RemoveAll(s.dir), IsNil)
+}
+
+func writeString(str string) func(io.Writer) error {
+	return func(w io.Writer) error {
+		_, err := io.WriteString(w, str)
+		return err
+	}
+}
+
+func (s *backupSuite) TestAddRestore(c *C) {
+	repo := NewRepository(s.dir)
+
+	catalog, err := repo.Catalog("policy1/test")
+	c.Assert(err, IsNil)
+	c.Assert(len(catalog.Backups), Equals, 0)
+	c.Assert(catalog.Latest(), IsNil)
+
+	c.Assert(repo.Add("policy1/test", &Backup{Name: "snap1"}, writeString("full1")), IsNil)
+	c.Assert(repo.Add("policy1/test", &Backup{Name: "snap2", Parent: "snap1"}, writeString("incr2")), IsNil)
+	c.Assert(repo.Add("policy1/test", &Backup{Name: "snap3"}, writeString("full3")), IsNil)
+	c.Assert(repo.Add("policy1/test", &Backup{Name: "snap4", Parent: "snap3"}, writeString("incr4")), IsNil)
+
+	c.Assert(repo.Add("policy1/test", &Backup{Name: "snap4"}, writeString("again")), NotNil)
+	c.Assert(repo.Add("policy1/test", &Backup{Name: "snap5", Parent: "nonexistent"}, writeString("incr5")), NotNil)
+	c.Assert(repo.Add("policy1/test", &Backup{Name: "../snap5"}, writeString("full5")), NotNil)
+	c.Assert(repo.Add("test", &Backup{Name: "snap5"}, writeString("full5")), NotNil)
+
+	// a diff which fails to be written leaves nothing behind.
+	c.Assert(repo.Add("policy1/test", &Backup{Name: "snap5"}, func(w io.Writer) error {
+		io.WriteString(w, "partial")
+		return errored.New("failed")
+	}), NotNil)
+
+	files, err := ioutil.ReadDir(filepath.Join(s.dir, "policy1/test"))
+	c.Assert(err, IsNil)
+	c.Assert(len(files), Equals, 5)
+
+	catalog, err = repo.Catalog("policy1/test")
+	c.Assert(err, IsNil)
+	c.Assert(len(catalog.Backups), Equals, 4)
+	c.Assert(catalog.Latest().Name, Equals, "snap4")
+	c.Assert(catalog.Latest().Full(), Equals, false)
+	c.Assert(catalog.Get("snap3").Full(), Equals, true)
+	c.Assert(catalog.Get("snap3").Size, Equals, uint64(5))
+	c.Assert(catalog.Get("snap3").Created.IsZero(), Equals, false)
+
+	restored := &bytes.Buffer{}
+	apply := func(r io.Reader) error {
+		_, err := io.Copy(restored, r)
+		return err
+	}
+
+	c.Assert(repo.Restore("policy1/test", "snap2", apply), IsNil)
+	c.Assert(restored.String(), Equals, "full1incr2")
+
+	restored.Reset()
+	c.Assert(repo.Restore("policy1/test", "snap4", apply), IsNil)
+	c.Assert(restored.String(), Equals, "full3incr4")
+
+	c.Assert(repo.Restore("policy1/test", "nonexistent", apply), NotNil)
+	c.Assert(repo.Restore("policy1/test", "snap4", func(io.Reader) error { return errored.New("failed") }), NotNil)
+
+	// volumes are kept apart.
+	catalog, err = repo.Catalog("policy2/test")
+	c.Assert(err, IsNil)
+	c.Assert(len(catalog.Backups), Equals, 0)
+}
+
+func (s *backupSuite) TestRename(c *C) {
+	repo := NewRepository(s.dir)
+
+	c.Assert(repo.Rename("policy1/none", "policy1/other"), IsNil)
+
+	c.Assert(repo.Add("policy1/test", &Backup{Name: "snap1"}, writeString("full1")), IsNil)
+	c.Assert(repo.Add("policy2/taken", &Backup{Name: "snap1"}, writeString("full1")), IsNil)
+	c.Assert(repo.Rename("policy1/test", "policy2/taken"), NotNil)
+
+	c.Assert(repo.Rename("policy1/test", "policy2/test"), IsNil)
+
+	catalog, err := repo.Catalog("policy1/test")
+	c.Assert(err, IsNil)
+	c.Assert(len(catalog.Backups), Equals, 0)
+
+	catalog, err = repo.Catalog("policy2/test")
+	c.Assert(err, IsNil)
+	c.Assert(catalog.Volume, Equals, "policy2/test")
+	c.Assert(catalog.Latest().Name, Equals, "snap1")
+
+	restored := &bytes.Buffer{}
+	c.Assert(repo.Restore("policy2/test", "snap1", func(r io.Reader) error {
+		_, err := io.Copy(restored, r)
+		return err
+	}), IsNil)
+	c.Assert(restored.String(), Equals, "full1")
+}
+
+func (s *backupSuite) TestChain(c *C) {
+	catalog := &Catalog{
+		Volume: "policy1/test",
+		Backups: []*Backup{
+			{Name: "snap1"},
+			{Name: "snap2", Parent: "snap1"},
+			{Name: "snap3", Parent: "snap2"},
+			{Name: "snap4", Parent: "missing"},
+		},
+	}
+
+	chain, err := catalog.Chain("snap3")
+	c.Assert(err, IsNil)
+	c.Assert(len(chain), Equals, 3)
+	c.Assert(chain[0].Name, Equals, "snap1")
+	c.Assert(chain[2].Name, Equals, "snap3")
+
+	chain, err = catalog.Chain("snap1")
+	c.Assert(err, IsNil)
+	c.Assert(len(chain), Equals, 1)
+
+	_, err = catalog.Chain("snap4")
+	c.Assert(err, NotNil)
+}
@@ -24,9 +24,13 @@ const (
 	rootPolicy        = "policies"
 	rootPolicyArchive = "policy-archives"
 	rootSnapshots     = "snapshots"
+	rootCopies        = "copies"
+	rootSnapshotInfo  = "snapshot-info"
+	rootKeys          = "keys"
+	rootStats         = "stats"
 )
 
-var defaultPaths = []string{rootVolume, rootUse, rootPolicy, rootPolicyArchive, rootSnapshots}
+var defaultPaths = []string{rootVolume, rootUse, rootPolicy, rootPolicyArchive, rootSnapshots, rootCopies, rootSnapshotInfo, rootKeys, rootStats}
 
 // VolumeRequest provides a request structure for communicating volumes to the
 // apiserver or internally. it is the basic representation of a volume.
@@ -0,0 +1,101 @@
+package config
+
+import (
+	"encoding/json"
+	"path"
+	"time"
+
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/errors"
+	"github.com/coreos/etcd/client"
+	"golang.org/x/net/context"
+)
+
+// Statuses of a volume copied from a snapshot.
+const (
+	// CopyCloned copies still share their data with the snapshot.
+	CopyCloned = "cloned"
+	// CopyFlattening copies are having their data copied from the snapshot.
+	CopyFlattening = "flattening"
+	// CopyFlattened copies no longer depend on the snapshot.
+	CopyFlattened = "flattened"
+	// CopyFailed copies could not be flattened, and still depend on the snapshot.
+	CopyFailed = "failed"
+)
+
+// Copy records a volume copied from a snapshot, and how far along flattening
+// it is.
+type Copy struct {
+	Source   string    `json:"source"`
+	Snapshot string    `json:"snapshot"`
+	Target   string    `json:"target"`
+	Status   string    `json:"status"`
+	Progress int       `json:"progress"`
+	Error    string    `json:"error,omitempty"`
+	Updated  time.Time `json:"updated"`
+}
+
+// Dependent returns true if the copy still needs its snapshot.
+func (cp *Copy) Dependent() bool {
+	return cp.Status != CopyFlattened
+}
+
+func (c *Client) copy(target string) string {
+	return c.prefixed(rootCopies, target)
+}
+
+// PublishCopy records the copy, replacing any previous record of its target.
+func (c *Client) PublishCopy(cp *Copy) error {
+	content, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+
+	if _, err := c.etcdClient.Set(context.Background(), c.copy(cp.Target), string(content), nil); err != nil {
+		return errors.EtcdToErrored(err)
+	}
+
+	return nil
+}
+
+// GetCopy returns the copy record of the volume.
+func (c *Client) GetCopy(policy, name string) (*Copy, error) {
+	resp, err := c.etcdClient.Get(context.Background(), c.copy(path.Join(policy, name)), nil)
+	if err != nil {
+		return nil, errors.EtcdToErrored(err)
+	}
+
+	cp := &Copy{}
+	return cp, json.Unmarshal([]byte(resp.Node.Value), cp)
+}
+
+// ListCopies returns the copy records of the volumes in the policy.
+func (c *Client) ListCopies(policy string) ([]*Copy, error) {
+	resp, err := c.etcdClient.Get(context.Background(), c.prefixed(rootCopies, policy), &client.GetOptions{Sort: true})
+	if err != nil {
+		if er, ok := errors.EtcdToErrored(err).(*errored.Error); ok && er.Contains(errors.NotExists) {
+			return []*Copy{}, nil
+		}
+
+		return nil, errors.EtcdToErrored(err)
+	}
+
+	copies := []*Copy{}
+
+	for _, node := range resp.Node.Nodes {
+		cp := &Copy{}
+		if err := json.Unmarshal([]byte(node.Value), cp); err != nil {
+			return nil, err
+		}
+
+		copies = append(copies, cp)
+	}
+
+	return copies, nil
+}
+
+// RemoveCopy removes the copy record of the volume.
+func (c *Client) RemoveCopy(policy, name string) error {
+	_, err := c.etcdClient.Delete(context.Background(), c.copy(path.Join(policy, name)), nil)
+	return errors.EtcdToErrored(err)
+}
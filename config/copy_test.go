@@ -0,0 +1,56 @@
+package config
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *configSuite) TestCopyCRUD(c *C) {
+	copies, err := s.tlc.ListCopies("policy1")
+	c.Assert(err, IsNil)
+	c.Assert(len(copies), Equals, 0)
+
+	_, err = s.tlc.GetCopy("policy1", "copy")
+	c.Assert(err, NotNil)
+
+	cp := &Copy{
+		Source:   "policy1/test",
+		Snapshot: "snap",
+		Target:   "policy1/copy",
+		Status:   CopyFlattening,
+		Progress: 50,
+		Updated:  time.Unix(1000, 0).UTC(),
+	}
+
+	c.Assert(cp.Dependent(), Equals, true)
+	c.Assert(s.tlc.PublishCopy(cp), IsNil)
+
+	cp2, err := s.tlc.GetCopy("policy1", "copy")
+	c.Assert(err, IsNil)
+	c.Assert(cp2, DeepEquals, cp)
+
+	cp.Status = CopyFlattened
+	cp.Progress = 100
+	c.Assert(cp.Dependent(), Equals, false)
+	c.Assert(s.tlc.PublishCopy(cp), IsNil)
+
+	copies, err = s.tlc.ListCopies("policy1")
+	c.Assert(err, IsNil)
+	c.Assert(copies, DeepEquals, []*Copy{cp})
+
+	copies, err = s.tlc.ListCopies("policy2")
+	c.Assert(err, IsNil)
+	c.Assert(len(copies), Equals, 0)
+
+	// removing the volume removes the record.
+	c.Assert(s.tlc.PublishPolicy("policy1", testPolicies["basic"]), IsNil)
+	vol, err := s.tlc.CreateVolume(&VolumeRequest{Policy: "policy1", Name: "copy"})
+	c.Assert(err, IsNil)
+	c.Assert(s.tlc.PublishVolume(vol), IsNil)
+	c.Assert(s.tlc.RemoveVolume("policy1", "copy"), IsNil)
+
+	_, err = s.tlc.GetCopy("policy1", "copy")
+	c.Assert(err, NotNil)
+	c.Assert(s.tlc.RemoveCopy("policy1", "copy"), NotNil)
+}
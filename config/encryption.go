@@ -0,0 +1,319 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/storage"
+	"golang.org/x/net/context"
+)
+
+// Providers of the keys of encrypted volumes.
+const (
+	// KeyProviderFile gives every volume of the policy the key in the key file.
+	KeyProviderFile = "file"
+	// KeyProviderDatabase gives every volume a key of its own, kept in the
+	// database encrypted with the master key in the key file.
+	KeyProviderDatabase = "database"
+)
+
+// volumeKeySize is the size of the keys made for volumes, in bytes.
+const volumeKeySize = 64
+
+// encryptingBackends are the backends which can encrypt volumes: those which
+// keep them on block devices.
+var encryptingBackends = map[string]bool{
+	"ceph": true,
+	"loop": true,
+	"lvm":  true,
+}
+
+// EncryptionConfig is the configuration for encrypting volumes at rest.
+// Volumes are encrypted if a key provider is set. The key file is read on the
+// hosts the volumes are created and mounted on, so it must be on all of them.
+// Encryption is set by the policy; volumes cannot opt out of it.
+type EncryptionConfig struct {
+	Provider string `json:"provider,omitempty"`
+	Cipher   string `json:"cipher,omitempty"`
+	KeyFile  string `json:"key-file,omitempty"`
+}
+
+// Enabled tells if volumes are encrypted.
+func (ec EncryptionConfig) Enabled() bool {
+	return ec.Provider != ""
+}
+
+func (ec EncryptionConfig) validate(backends *BackendDrivers) error {
+	if !ec.Enabled() || backends == nil {
+		return nil
+	}
+
+	for _, backend := range []string{backends.CRUD, backends.Mount} {
+		if !encryptingBackends[backend] {
+			return errors.EncryptionUnsupported.Combine(errored.New(backend))
+		}
+	}
+
+	return nil
+}
+
+// KeyProvider supplies the keys encrypted volumes are encrypted with. Volumes
+// are named policy/volume.
+type KeyProvider interface {
+	// NewKey returns the key a new volume is to be encrypted with.
+	NewKey(volume string) ([]byte, error)
+
+	// Key returns the key the volume is encrypted with.
+	Key(volume string) ([]byte, error)
+
+	// SetKey records the key of a volume which shares the data of another,
+	// such as a copy of one of its snapshots.
+	SetKey(volume string, key []byte) error
+
+	// RemoveKey forgets the key of a removed volume.
+	RemoveKey(volume string) error
+}
+
+// FileKeyProvider gives every volume the key read from a file, which is
+// distributed to the hosts out of band.
+type FileKeyProvider struct {
+	path string
+}
+
+// NewFileKeyProvider returns a provider of the key in the file at path.
+func NewFileKeyProvider(path string) *FileKeyProvider {
+	return &FileKeyProvider{path: path}
+}
+
+// NewKey returns the key in the file.
+func (fp *FileKeyProvider) NewKey(volume string) ([]byte, error) {
+	return fp.Key(volume)
+}
+
+// Key returns the key in the file.
+func (fp *FileKeyProvider) Key(volume string) ([]byte, error) {
+	key, err := readKeyFile(fp.path)
+	if err != nil {
+		return nil, errors.EncryptionKey.Combine(errored.New(volume)).Combine(err)
+	}
+
+	return key, nil
+}
+
+// SetKey does nothing; all volumes have the key in the file.
+func (fp *FileKeyProvider) SetKey(volume string, key []byte) error {
+	return nil
+}
+
+// RemoveKey does nothing; the key in the file is kept for other volumes.
+func (fp *FileKeyProvider) RemoveKey(volume string) error {
+	return nil
+}
+
+func readKeyFile(path string) ([]byte, error) {
+	key, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(key) == 0 {
+		return nil, errored.Errorf("Key file %q is empty", path)
+	}
+
+	return key, nil
+}
+
+// DatabaseKeyProvider gives every volume a random key of its own, which it
+// keeps in the database encrypted with a master key. The master key is read
+// from a file distributed to the hosts out of band, and never stored.
+type DatabaseKeyProvider struct {
+	client        *Client
+	masterKeyFile string
+}
+
+// NewDatabaseKeyProvider returns a provider of keys kept in the database,
+// encrypted with the master key in the file at masterKeyFile.
+func (c *Client) NewDatabaseKeyProvider(masterKeyFile string) *DatabaseKeyProvider {
+	return &DatabaseKeyProvider{client: c, masterKeyFile: masterKeyFile}
+}
+
+func (c *Client) key(volume string) string {
+	return c.prefixed(rootKeys, volume)
+}
+
+// masterKey returns the AES-GCM cipher of the master key. Master keys of any
+// length are hashed to a 256-bit key.
+func (dp *DatabaseKeyProvider) masterKey() (cipher.AEAD, error) {
+	content, err := readKeyFile(dp.masterKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(content)
+
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// NewKey makes a random key for the volume and records it.
+func (dp *DatabaseKeyProvider) NewKey(volume string) ([]byte, error) {
+	key := make([]byte, volumeKeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, errors.EncryptionKey.Combine(errored.New(volume)).Combine(err)
+	}
+
+	if err := dp.SetKey(volume, key); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// Key returns the recorded key of the volume.
+func (dp *DatabaseKeyProvider) Key(volume string) ([]byte, error) {
+	resp, err := dp.client.etcdClient.Get(context.Background(), dp.client.key(volume), nil)
+	if err != nil {
+		return nil, errors.EncryptionKey.Combine(errored.New(volume)).Combine(errors.EtcdToErrored(err))
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(resp.Node.Value)
+	if err != nil {
+		return nil, errors.EncryptionKey.Combine(errored.New(volume)).Combine(err)
+	}
+
+	aead, err := dp.masterKey()
+	if err != nil {
+		return nil, errors.EncryptionKey.Combine(errored.New(volume)).Combine(err)
+	}
+
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.EncryptionKey.Combine(errored.Errorf("Recorded key of volume %q is truncated", volume))
+	}
+
+	nonce, sealed := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+
+	// the volume name is authenticated so keys cannot be swapped around.
+	key, err := aead.Open(nil, nonce, sealed, []byte(volume))
+	if err != nil {
+		return nil, errors.EncryptionKey.Combine(errored.Errorf("Decrypting key of volume %q", volume)).Combine(err)
+	}
+
+	return key, nil
+}
+
+// SetKey records the key of the volume, encrypted with the master key.
+func (dp *DatabaseKeyProvider) SetKey(volume string, key []byte) error {
+	aead, err := dp.masterKey()
+	if err != nil {
+		return errors.EncryptionKey.Combine(errored.New(volume)).Combine(err)
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return errors.EncryptionKey.Combine(errored.New(volume)).Combine(err)
+	}
+
+	sealed := aead.Seal(nonce, nonce, key, []byte(volume))
+
+	if _, err := dp.client.etcdClient.Set(context.Background(), dp.client.key(volume), base64.StdEncoding.EncodeToString(sealed), nil); err != nil {
+		return errors.EtcdToErrored(err)
+	}
+
+	return nil
+}
+
+// RemoveKey forgets the key of the volume. Data encrypted with it can no
+// longer be read.
+func (dp *DatabaseKeyProvider) RemoveKey(volume string) error {
+	return dp.client.removeKey(volume)
+}
+
+func (c *Client) removeKey(volume string) error {
+	if _, err := c.etcdClient.Delete(context.Background(), c.key(volume), nil); err != nil {
+		return errors.EtcdToErrored(err)
+	}
+
+	return nil
+}
+
+// KeyProvider returns the provider of the keys of volumes encrypted as
+// configured.
+func (c *Client) KeyProvider(ec EncryptionConfig) (KeyProvider, error) {
+	switch ec.Provider {
+	case KeyProviderFile:
+		return NewFileKeyProvider(ec.KeyFile), nil
+	case KeyProviderDatabase:
+		return c.NewDatabaseKeyProvider(ec.KeyFile), nil
+	default:
+		return nil, errors.EncryptionKey.Combine(errored.Errorf("Invalid key provider %q", ec.Provider))
+	}
+}
+
+func (c *Client) encryption(vc *Volume, makeKey bool) (storage.Encryption, error) {
+	ec := vc.CreateOptions.Encryption
+	if !ec.Enabled() {
+		return storage.Encryption{}, nil
+	}
+
+	provider, err := c.KeyProvider(ec)
+	if err != nil {
+		return storage.Encryption{}, err
+	}
+
+	var key []byte
+
+	if makeKey {
+		key, err = provider.NewKey(vc.String())
+	} else {
+		key, err = provider.Key(vc.String())
+	}
+
+	if err != nil {
+		return storage.Encryption{}, err
+	}
+
+	return storage.Encryption{Cipher: ec.Cipher, Key: key}, nil
+}
+
+// NewEncryption makes the key of a new volume, and returns the encryption to
+// format it with. Unencrypted volumes yield an empty one.
+func (c *Client) NewEncryption(vc *Volume) (storage.Encryption, error) {
+	return c.encryption(vc, true)
+}
+
+// Encryption returns the encryption to mount the volume with. Unencrypted
+// volumes yield an empty one.
+func (c *Client) Encryption(vc *Volume) (storage.Encryption, error) {
+	return c.encryption(vc, false)
+}
+
+// CopyEncryption gives the volume the key of the volume its data was copied
+// from, so it can be mounted.
+func (c *Client) CopyEncryption(from, to *Volume) error {
+	if !from.CreateOptions.Encryption.Enabled() {
+		return nil
+	}
+
+	enc, err := c.Encryption(from)
+	if err != nil {
+		return err
+	}
+
+	provider, err := c.KeyProvider(to.CreateOptions.Encryption)
+	if err != nil {
+		return err
+	}
+
+	return provider.SetKey(to.String(), enc.Key)
+}
@@ -0,0 +1,176 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/contiv/volplugin/errors"
+	"golang.org/x/net/context"
+)
+
+func writeKeyFile(c *C, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	c.Assert(ioutil.WriteFile(path, []byte(content), 0600), IsNil)
+	return path
+}
+
+func (s *configSuite) TestEncryptionValidation(c *C) {
+	policy := &Policy{
+		Name:          "encrypted",
+		Backend:       "ceph",
+		DriverOptions: map[string]string{"pool": "rbd"},
+		CreateOptions: CreateOptions{
+			Size:       "10MB",
+			Encryption: EncryptionConfig{Provider: KeyProviderFile, KeyFile: "/etc/volplugin/volume.key"},
+		},
+	}
+
+	c.Assert(policy.ValidateJSON(), IsNil)
+	c.Assert(policy.Validate(), IsNil)
+
+	policy.CreateOptions.Encryption.Provider = "vault"
+	c.Assert(policy.ValidateJSON(), ErrorMatches, "(?m)*provider must be one of.*")
+
+	policy.CreateOptions.Encryption.Provider = KeyProviderDatabase
+	policy.CreateOptions.Encryption.KeyFile = "volume.key"
+	c.Assert(policy.ValidateJSON(), ErrorMatches, "(?m)*key-file: Does not match pattern.*")
+
+	policy.CreateOptions.Encryption.KeyFile = ""
+	c.Assert(policy.ValidateJSON(), ErrorMatches, "(?m)*create.encryption: Must validate at least one schema.*")
+
+	// volumes on backends which are not block devices cannot be encrypted.
+	policy.CreateOptions.Encryption.KeyFile = "/etc/volplugin/master.key"
+	policy.Backend = "nfs"
+	policy.Backends = nil
+	c.Assert(policy.Validate(), ErrorMatches, ".*Backend does not support encryption.*")
+
+	c.Assert(EncryptionConfig{}.validate(&BackendDrivers{Mount: "nfs"}), IsNil)
+	c.Assert(policy.CreateOptions.Encryption.validate(&BackendDrivers{CRUD: "lvm", Mount: "lvm"}), IsNil)
+	c.Assert(policy.CreateOptions.Encryption.validate(&BackendDrivers{CRUD: "ceph", Mount: "cephfs"}), NotNil)
+
+	vol := &Volume{
+		PolicyName:    "encrypted",
+		VolumeName:    "test",
+		DriverOptions: map[string]string{"pool": "rbd"},
+		CreateOptions: CreateOptions{Size: "10MB", Encryption: EncryptionConfig{Provider: KeyProviderFile}},
+		Backends:      defaultBackends,
+	}
+
+	c.Assert(vol.ValidateJSON(), ErrorMatches, "(?m)*create.encryption: Must validate at least one schema.*")
+	vol.CreateOptions.Encryption.KeyFile = "/etc/volplugin/volume.key"
+	c.Assert(vol.Validate(), IsNil)
+}
+
+func (s *configSuite) TestFileKeyProvider(c *C) {
+	dir, err := ioutil.TempDir("", "volplugin-keys")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+
+	provider := NewFileKeyProvider(writeKeyFile(c, dir, "volume.key", "secret"))
+
+	key, err := provider.NewKey("policy1/test")
+	c.Assert(err, IsNil)
+	c.Assert(string(key), Equals, "secret")
+
+	key, err = provider.Key("policy1/other")
+	c.Assert(err, IsNil)
+	c.Assert(string(key), Equals, "secret")
+
+	c.Assert(provider.SetKey("policy1/test", []byte("ignored")), IsNil)
+	c.Assert(provider.RemoveKey("policy1/test"), IsNil)
+
+	key, err = provider.Key("policy1/test")
+	c.Assert(err, IsNil)
+	c.Assert(string(key), Equals, "secret")
+
+	_, err = NewFileKeyProvider(writeKeyFile(c, dir, "empty.key", "")).Key("policy1/test")
+	c.Assert(err, NotNil)
+
+	_, err = NewFileKeyProvider(filepath.Join(dir, "nonexistent.key")).Key("policy1/test")
+	c.Assert(err, NotNil)
+
+	_, err = s.tlc.KeyProvider(EncryptionConfig{Provider: "vault"})
+	c.Assert(err, NotNil)
+}
+
+func (s *configSuite) TestDatabaseKeyProvider(c *C) {
+	dir, err := ioutil.TempDir("", "volplugin-keys")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+
+	provider := s.tlc.NewDatabaseKeyProvider(writeKeyFile(c, dir, "master.key", "master"))
+
+	_, err = provider.Key("policy1/test")
+	c.Assert(err, NotNil)
+
+	key, err := provider.NewKey("policy1/test")
+	c.Assert(err, IsNil)
+	c.Assert(len(key), Equals, volumeKeySize)
+
+	key2, err := provider.NewKey("policy1/test2")
+	c.Assert(err, IsNil)
+	c.Assert(key2, Not(DeepEquals), key)
+
+	got, err := provider.Key("policy1/test")
+	c.Assert(err, IsNil)
+	c.Assert(got, DeepEquals, key)
+
+	// the key is not stored as it is.
+	resp, err := s.tlc.etcdClient.Get(context.Background(), s.tlc.key("policy1/test"), nil)
+	c.Assert(err, IsNil)
+	c.Assert(resp.Node.Value, Not(Equals), string(key))
+
+	// nor can it be read with another master key, or as the key of another
+	// volume.
+	_, err = s.tlc.NewDatabaseKeyProvider(writeKeyFile(c, dir, "other.key", "other")).Key("policy1/test")
+	c.Assert(err, NotNil)
+
+	_, err = s.tlc.etcdClient.Set(context.Background(), s.tlc.key("policy1/test2"), resp.Node.Value, nil)
+	c.Assert(err, IsNil)
+	_, err = provider.Key("policy1/test2")
+	c.Assert(err, NotNil)
+
+	c.Assert(provider.SetKey("policy1/copy", key), IsNil)
+	got, err = provider.Key("policy1/copy")
+	c.Assert(err, IsNil)
+	c.Assert(got, DeepEquals, key)
+
+	c.Assert(provider.RemoveKey("policy1/copy"), IsNil)
+	_, err = provider.Key("policy1/copy")
+	c.Assert(err, NotNil)
+
+	// volumes get their key made when they are created, and copies take the
+	// key of the volume they were copied from.
+	policy := *testPolicies["basic"]
+	policy.CreateOptions.Encryption = EncryptionConfig{Provider: KeyProviderDatabase, KeyFile: filepath.Join(dir, "master.key")}
+	c.Assert(s.tlc.PublishPolicy("policy1", &policy), IsNil)
+
+	vol, err := s.tlc.CreateVolume(&VolumeRequest{Policy: "policy1", Name: "encrypted"})
+	c.Assert(err, IsNil)
+	c.Assert(s.tlc.PublishVolume(vol), IsNil)
+
+	enc, err := s.tlc.NewEncryption(vol)
+	c.Assert(err, IsNil)
+	c.Assert(enc.Enabled(), Equals, true)
+
+	copyVol, err := s.tlc.CreateVolume(&VolumeRequest{Policy: "policy1", Name: "encryptedcopy"})
+	c.Assert(err, IsNil)
+	c.Assert(s.tlc.CopyEncryption(vol, copyVol), IsNil)
+
+	copyEnc, err := s.tlc.Encryption(copyVol)
+	c.Assert(err, IsNil)
+	c.Assert(copyEnc, DeepEquals, enc)
+
+	// removing the volume removes its key.
+	c.Assert(s.tlc.RemoveVolume("policy1", "encrypted"), IsNil)
+	_, err = s.tlc.Encryption(vol)
+	c.Assert(err, ErrorMatches, ".*"+errors.EncryptionKey.Error()+".*")
+
+	// unencrypted volumes have no key.
+	enc, err = s.tlc.Encryption(&Volume{PolicyName: "policy1", VolumeName: "plain"})
+	c.Assert(err, IsNil)
+	c.Assert(enc.Enabled(), Equals, false)
+}
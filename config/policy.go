@@ -2,17 +2,28 @@ package config
 
 import (
 	"encoding/json"
+	"time"
 
 	"github.com/contiv/errored"
 	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/storage"
+	"github.com/contiv/volplugin/storage/backend"
 	"github.com/coreos/etcd/client"
 	"golang.org/x/net/context"
 )
 
 // Type definitions for backend drivers
 var defaultDrivers = map[string]*BackendDrivers{
-	"ceph": {"ceph", "ceph", "ceph"},
-	"nfs":  {"", "nfs", ""},
+	"ceph":   {"ceph", "ceph", "ceph"},
+	"nfs":    {"", "nfs", ""},
+	"loop":   {"loop", "loop", "loop"},
+	"lvm":    {"lvm", "lvm", "lvm"},
+	"zfs":    {"zfs", "zfs", "zfs"},
+	"btrfs":  {"btrfs", "btrfs", "btrfs"},
+	"local":  {"local", "local", ""},
+	"cephfs": {"cephfs", "cephfs", "cephfs"},
+	"null":   {"null", "null", "null"},
+	"exec":   {"exec", "exec", "exec"},
 }
 
 // Policy is the configuration of the policy. It includes default
@@ -24,6 +35,7 @@ type Policy struct {
 	RuntimeOptions RuntimeOptions    `json:"runtime"`
 	DriverOptions  map[string]string `json:"driver"`
 	FileSystems    map[string]string `json:"filesystems"`
+	MountOptions   map[string]string `json:"mount-options,omitempty"`
 	Backends       *BackendDrivers   `json:"backends,omitempty"`
 	Backend        string            `json:"backend,omitempty"`
 }
@@ -145,6 +157,12 @@ func (cfg *Policy) Validate() error {
 		return errors.ErrJSONValidation.Combine(err)
 	}
 
+	for fs := range cfg.MountOptions {
+		if _, ok := cfg.FileSystems[fs]; !ok {
+			return errored.Errorf("Mount options given for unknown filesystem %q", fs)
+		}
+	}
+
 	if cfg.Backends == nil { // backend should be defined and its validated
 		backends, ok := defaultDrivers[cfg.Backend]
 
@@ -154,12 +172,50 @@ func (cfg *Policy) Validate() error {
 		cfg.Backends = backends
 	}
 
+	if err := cfg.CreateOptions.Encryption.validate(cfg.Backends); err != nil {
+		return err
+	}
+
 	size, err := cfg.CreateOptions.ActualSize()
 	if cfg.Backends.CRUD != "" && (size == 0 || err != nil) {
 		return errored.Errorf("Size set to zero for non-empty CRUD backend %v", cfg.Backends.CRUD).Combine(err)
 	}
 
-	return nil
+	return cfg.validateDriverOptions(size)
+}
+
+// validateDriverOptions has the CRUD driver validate the driver options, so
+// bad ones are rejected when the policy is uploaded instead of when the first
+// volume is created.
+func (cfg *Policy) validateDriverOptions(size uint64) error {
+	if cfg.Backends.CRUD == "" {
+		return nil
+	}
+
+	crud, err := backend.NewCRUDDriver(cfg.Backends.CRUD)
+	if err != nil {
+		return err
+	}
+
+	params := storage.Params{}
+	for key, value := range cfg.DriverOptions {
+		params[key] = value
+	}
+
+	// the volume name and timeout are dummies; they are not known yet.
+	do := storage.DriverOptions{
+		Volume: storage.Volume{
+			Name:   cfg.Name + "/policy",
+			Size:   size,
+			Params: params,
+		},
+		FSOptions: storage.FSOptions{
+			Type: cfg.CreateOptions.FileSystem,
+		},
+		Timeout: time.Second,
+	}
+
+	return crud.Validate(&do)
 }
 
 func (cfg *Policy) String() string {
@@ -101,6 +101,58 @@ var testPolicies = map[string]*Policy{
 		},
 		FileSystems: defaultFilesystems,
 	},
+	"mountoptions": {
+		Name: "mountoptions",
+		Backends: &BackendDrivers{
+			CRUD:     "ceph",
+			Mount:    "ceph",
+			Snapshot: "ceph",
+		},
+		DriverOptions: map[string]string{"pool": "rbd"},
+		CreateOptions: CreateOptions{
+			Size:       "10MB",
+			FileSystem: defaultFilesystem,
+		},
+		FileSystems: map[string]string{
+			"ext4": "mkfs.ext4 -m0 %",
+			"xfs":  "mkfs.xfs %",
+		},
+		MountOptions: map[string]string{
+			"ext4": "noatime,discard",
+			"xfs":  "nobarrier,logbufs=8",
+		},
+	},
+	"badmountoptions": {
+		Name: "badmountoptions",
+		Backends: &BackendDrivers{
+			CRUD:     "ceph",
+			Mount:    "ceph",
+			Snapshot: "ceph",
+		},
+		DriverOptions: map[string]string{"pool": "rbd"},
+		CreateOptions: CreateOptions{
+			Size:       "10MB",
+			FileSystem: defaultFilesystem,
+		},
+		FileSystems: defaultFilesystems,
+		MountOptions: map[string]string{
+			"btrfs": "noatime",
+		},
+	},
+	"badlayout": {
+		Name: "badlayout",
+		Backends: &BackendDrivers{
+			CRUD:     "ceph",
+			Mount:    "ceph",
+			Snapshot: "ceph",
+		},
+		DriverOptions: map[string]string{"pool": "rbd", "features": "layering,object-map"},
+		CreateOptions: CreateOptions{
+			Size:       "10MB",
+			FileSystem: defaultFilesystem,
+		},
+		FileSystems: defaultFilesystems,
+	},
 	"blanksize": {
 		Backends: &BackendDrivers{
 			Mount: "ceph",
@@ -226,7 +278,7 @@ func (s *configSuite) TestBasicPolicy(c *C) {
 }
 
 func (s *configSuite) TestPolicyValidate(c *C) {
-	for _, key := range []string{"basic", "basic2", "nilfs", "blanksize"} {
+	for _, key := range []string{"basic", "basic2", "nilfs", "blanksize", "mountoptions"} {
 		c.Assert(testPolicies[key].Validate(), IsNil)
 	}
 
@@ -237,6 +289,8 @@ func (s *configSuite) TestPolicyValidate(c *C) {
 
 	c.Assert(testPolicies["nobackend"].Validate(), NotNil)
 	c.Assert(testPolicies["untouchedwithzerosize"].Validate(), NotNil)
+	c.Assert(testPolicies["badmountoptions"].Validate(), NotNil)
+	c.Assert(testPolicies["badlayout"].Validate(), ErrorMatches, `.*"object-map" requires "exclusive-lock".*`)
 	_, err := testPolicies["badsize3"].CreateOptions.ActualSize()
 	c.Assert(err, NotNil)
 }
@@ -5,21 +5,45 @@ var (
 	RuntimeSchema = `{
 		"title": "Runtime config validation",
 		"type": "object",
-		"oneOf": [ {
-			"properties": {
-				"snapshots": { "enum": [ true ] },
-				"snapshot": {
-					"type": "object",
-					"properties": {
-						"frequency": { "type": "string", "pattern": "^[0-9]+.$", "minLength": 1 },
-						"keep": { "type": "number", "minimum": 1 }
-					},
-					"required": [ "frequency", "keep" ]
+		"properties": {
+			"fsck": { "enum": [ "", "off", "check", "repair" ] },
+			"mount-options": { "type": "string" }
+		},
+		"allOf": [ {
+			"oneOf": [ {
+				"properties": {
+					"snapshots": { "enum": [ true ] },
+					"snapshot": {
+						"type": "object",
+						"properties": {
+							"frequency": { "type": "string", "pattern": "^[0-9]+.$", "minLength": 1 },
+							"keep": { "type": "number", "minimum": 1 }
+						},
+						"required": [ "frequency", "keep" ]
+					}
 				}
-			}
-			},
-			{ "properties": { "snapshots": { "enum": [ false ] } } }
-		]
+				},
+				{ "properties": { "snapshots": { "enum": [ false ] } } }
+			]
+			}, {
+			"oneOf": [ {
+				"properties": {
+					"backups": { "enum": [ true ] },
+					"snapshots": { "enum": [ true ] },
+					"backup": {
+						"type": "object",
+						"properties": {
+							"frequency": { "type": "string", "pattern": "^[0-9]+.$", "minLength": 1 },
+							"repository": { "type": "string", "pattern": "^/", "minLength": 1 },
+							"full-every": { "type": "number", "minimum": 0 }
+						},
+						"required": [ "frequency", "repository" ]
+					}
+				}
+				},
+				{ "properties": { "backups": { "enum": [ false ] } } }
+			]
+		} ]
 	}`
 
 	// PolicySchema defines the json schema for policy
@@ -31,13 +55,34 @@ var (
 			"backends": {
 				"type": "object",
 				"properties": {
-					"mount": { "type": "string", "minLength": 1, "enum": [ "ceph", "nfs" ] },
-					"crud": { "type": "string", "enum": [ "ceph", "" ] },
-					"snapshot": { "type": "string", "enum": [ "ceph", "" ] }
+					"mount": { "type": "string", "minLength": 1, "enum": [ "ceph", "nfs", "loop", "lvm", "zfs", "btrfs", "local", "cephfs", "null", "exec" ] },
+					"crud": { "type": "string", "enum": [ "ceph", "nfs", "loop", "lvm", "zfs", "btrfs", "local", "cephfs", "null", "exec", "" ] },
+					"snapshot": { "type": "string", "enum": [ "ceph", "loop", "lvm", "zfs", "btrfs", "cephfs", "null", "exec", "" ] }
 				},
 				"required": [ "mount" ]
 			}, 
-			"backend": { "enum": [ "ceph", "nfs" ] }
+			"backend": { "enum": [ "ceph", "nfs", "loop", "lvm", "zfs", "btrfs", "local", "cephfs", "null", "exec" ] },
+			"create": {
+				"type": "object",
+				"properties": {
+					"encryption": {
+						"type": "object",
+						"properties": {
+							"provider": { "enum": [ "", "file", "database" ] },
+							"cipher": { "type": "string" },
+							"key-file": { "type": "string" }
+						},
+						"anyOf": [
+							{ "properties": { "provider": { "enum": [ "" ] } } },
+							{
+								"properties": { "key-file": { "type": "string", "pattern": "^/" } },
+								"required": [ "key-file" ]
+							}
+						]
+					}
+				}
+			},
+			"mount-options": { "type": "object", "additionalProperties": { "type": "string" } }
 		},
 		"anyOf": [
 			{ "required": [ "backend" ] },
@@ -53,12 +98,32 @@ var (
 		"properties": {
 			"name": { "type": "string", "minLength": 1, "pattern": "^[^./]+$" },
 			"policy": { "type": "string", "minLength": 1, "pattern": "^[^./]+$" },
+			"create": {
+				"type": "object",
+				"properties": {
+					"encryption": {
+						"type": "object",
+						"properties": {
+							"provider": { "enum": [ "", "file", "database" ] },
+							"cipher": { "type": "string" },
+							"key-file": { "type": "string" }
+						},
+						"anyOf": [
+							{ "properties": { "provider": { "enum": [ "" ] } } },
+							{
+								"properties": { "key-file": { "type": "string", "pattern": "^/" } },
+								"required": [ "key-file" ]
+							}
+						]
+					}
+				}
+			},
 			"backends": {
 				"type": "object",
 				"properties": {
-					"mount": { "type": "string", "minLength": 1, "enum": [ "ceph", "nfs" ] },
-					"crud": { "type": "string", "enum": [ "ceph", "" ] },
-					"snapshot": { "type": "string", "enum": [ "ceph", "" ] }
+					"mount": { "type": "string", "minLength": 1, "enum": [ "ceph", "nfs", "loop", "lvm", "zfs", "btrfs", "local", "cephfs", "null", "exec" ] },
+					"crud": { "type": "string", "enum": [ "ceph", "nfs", "loop", "lvm", "zfs", "btrfs", "local", "cephfs", "null", "exec", "" ] },
+					"snapshot": { "type": "string", "enum": [ "ceph", "loop", "lvm", "zfs", "btrfs", "cephfs", "null", "exec", "" ] }
 				},
 				"required": [ "mount" ]
 			}
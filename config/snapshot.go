@@ -0,0 +1,83 @@
+package config
+
+import (
+	"encoding/json"
+	"net/url"
+	"path"
+
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/errors"
+	"github.com/coreos/etcd/client"
+	"golang.org/x/net/context"
+)
+
+// SnapshotInfo is what volplugin records of a snapshot it took, beyond what
+// the storage driver keeps.
+type SnapshotInfo struct {
+	Origin string            `json:"origin"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// snapshot names are free-form, so they are escaped to make up a single key.
+func (c *Client) snapshotInfo(volume, snapName string) string {
+	return c.prefixed(rootSnapshotInfo, volume, url.QueryEscape(snapName))
+}
+
+// PublishSnapshotInfo records the info of a snapshot of the volume, named
+// policy/volume.
+func (c *Client) PublishSnapshotInfo(volume, snapName string, info *SnapshotInfo) error {
+	content, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+
+	if _, err := c.etcdClient.Set(context.Background(), c.snapshotInfo(volume, snapName), string(content), nil); err != nil {
+		return errors.EtcdToErrored(err)
+	}
+
+	return nil
+}
+
+// ListSnapshotInfo returns the recorded info of the snapshots of the volume,
+// by snapshot name.
+func (c *Client) ListSnapshotInfo(volume string) (map[string]*SnapshotInfo, error) {
+	infos := map[string]*SnapshotInfo{}
+
+	resp, err := c.etcdClient.Get(context.Background(), c.prefixed(rootSnapshotInfo, volume), nil)
+	if err != nil {
+		if er, ok := errors.EtcdToErrored(err).(*errored.Error); ok && er.Contains(errors.NotExists) {
+			return infos, nil
+		}
+
+		return nil, errors.EtcdToErrored(err)
+	}
+
+	for _, node := range resp.Node.Nodes {
+		snapName, err := url.QueryUnescape(path.Base(node.Key))
+		if err != nil {
+			return nil, err
+		}
+
+		info := &SnapshotInfo{}
+		if err := json.Unmarshal([]byte(node.Value), info); err != nil {
+			return nil, err
+		}
+
+		infos[snapName] = info
+	}
+
+	return infos, nil
+}
+
+// RemoveSnapshotInfo removes the recorded info of a snapshot of the volume.
+func (c *Client) RemoveSnapshotInfo(volume, snapName string) error {
+	_, err := c.etcdClient.Delete(context.Background(), c.snapshotInfo(volume, snapName), nil)
+	return errors.EtcdToErrored(err)
+}
+
+// removeSnapshotInfos removes the recorded info of all snapshots of the
+// volume.
+func (c *Client) removeSnapshotInfos(volume string) error {
+	_, err := c.etcdClient.Delete(context.Background(), c.prefixed(rootSnapshotInfo, volume), &client.DeleteOptions{Recursive: true})
+	return errors.EtcdToErrored(err)
+}
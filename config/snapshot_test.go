@@ -0,0 +1,45 @@
+package config
+
+import (
+	"github.com/contiv/volplugin/storage"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *configSuite) TestSnapshotInfoCRUD(c *C) {
+	infos, err := s.tlc.ListSnapshotInfo("policy1/test")
+	c.Assert(err, IsNil)
+	c.Assert(len(infos), Equals, 0)
+
+	scheduled := &SnapshotInfo{Origin: storage.SnapshotScheduled}
+	manual := &SnapshotInfo{Origin: storage.SnapshotManual, Labels: map[string]string{"reason": "upgrade"}}
+
+	// snapshot names may hold anything, slashes included.
+	c.Assert(s.tlc.PublishSnapshotInfo("policy1/test", "2016-01-01 10:00:00 +0000 UTC", scheduled), IsNil)
+	c.Assert(s.tlc.PublishSnapshotInfo("policy1/test", "before/upgrade", manual), IsNil)
+
+	infos, err = s.tlc.ListSnapshotInfo("policy1/test")
+	c.Assert(err, IsNil)
+	c.Assert(infos, DeepEquals, map[string]*SnapshotInfo{
+		"2016-01-01 10:00:00 +0000 UTC": scheduled,
+		"before/upgrade":                manual,
+	})
+
+	c.Assert(s.tlc.RemoveSnapshotInfo("policy1/test", "before/upgrade"), IsNil)
+	c.Assert(s.tlc.RemoveSnapshotInfo("policy1/test", "before/upgrade"), NotNil)
+
+	infos, err = s.tlc.ListSnapshotInfo("policy1/test")
+	c.Assert(err, IsNil)
+	c.Assert(infos, DeepEquals, map[string]*SnapshotInfo{"2016-01-01 10:00:00 +0000 UTC": scheduled})
+
+	// removing the volume removes the info of its snapshots.
+	c.Assert(s.tlc.PublishPolicy("policy1", testPolicies["basic"]), IsNil)
+	vol, err := s.tlc.CreateVolume(&VolumeRequest{Policy: "policy1", Name: "test"})
+	c.Assert(err, IsNil)
+	c.Assert(s.tlc.PublishVolume(vol), IsNil)
+	c.Assert(s.tlc.RemoveVolume("policy1", "test"), IsNil)
+
+	infos, err = s.tlc.ListSnapshotInfo("policy1/test")
+	c.Assert(err, IsNil)
+	c.Assert(len(infos), Equals, 0)
+}
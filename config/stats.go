@@ -0,0 +1,53 @@
+package config
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/storage"
+	"github.com/coreos/etcd/client"
+	"golang.org/x/net/context"
+)
+
+func (c *Client) volumeStats(volume string) string {
+	return c.prefixed(rootStats, volume)
+}
+
+// PublishVolumeStats records the stats of the volume, named policy/volume, as
+// the host which has it mounted or owns its storage measured them. They
+// expire after the TTL, so hosts must keep publishing them.
+func (c *Client) PublishVolumeStats(volume string, stats *storage.Stats, ttl time.Duration) error {
+	content, err := json.Marshal(stats)
+	if err != nil {
+		return err
+	}
+
+	if _, err := c.etcdClient.Set(context.Background(), c.volumeStats(volume), string(content), &client.SetOptions{TTL: ttl}); err != nil {
+		return errors.EtcdToErrored(err)
+	}
+
+	return nil
+}
+
+// GetVolumeStats returns the recorded stats of the volume. Volumes no host
+// published stats for yield errors.NotExists.
+func (c *Client) GetVolumeStats(volume string) (*storage.Stats, error) {
+	resp, err := c.etcdClient.Get(context.Background(), c.volumeStats(volume), nil)
+	if err != nil {
+		return nil, errors.EtcdToErrored(err)
+	}
+
+	stats := &storage.Stats{}
+	if err := json.Unmarshal([]byte(resp.Node.Value), stats); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// RemoveVolumeStats removes the recorded stats of the volume.
+func (c *Client) RemoveVolumeStats(volume string) error {
+	_, err := c.etcdClient.Delete(context.Background(), c.volumeStats(volume), nil)
+	return errors.EtcdToErrored(err)
+}
@@ -0,0 +1,41 @@
+package config
+
+import (
+	"time"
+
+	"github.com/contiv/volplugin/storage"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *configSuite) TestVolumeStatsCRUD(c *C) {
+	_, err := s.tlc.GetVolumeStats("policy1/test")
+	c.Assert(err, NotNil)
+
+	stats := &storage.Stats{ProvisionedBytes: 1024, UsedBytes: 512, Inodes: 10, InodesUsed: 2}
+	c.Assert(s.tlc.PublishVolumeStats("policy1/test", stats, time.Minute), IsNil)
+
+	published, err := s.tlc.GetVolumeStats("policy1/test")
+	c.Assert(err, IsNil)
+	c.Assert(published, DeepEquals, stats)
+
+	c.Assert(s.tlc.RemoveVolumeStats("policy1/test"), IsNil)
+	c.Assert(s.tlc.RemoveVolumeStats("policy1/test"), NotNil)
+
+	// stats expire with their TTL.
+	c.Assert(s.tlc.PublishVolumeStats("policy1/test", stats, time.Second), IsNil)
+	time.Sleep(2 * time.Second)
+	_, err = s.tlc.GetVolumeStats("policy1/test")
+	c.Assert(err, NotNil)
+
+	// removing the volume removes its stats.
+	c.Assert(s.tlc.PublishPolicy("policy1", testPolicies["basic"]), IsNil)
+	vol, err := s.tlc.CreateVolume(&VolumeRequest{Policy: "policy1", Name: "test"})
+	c.Assert(err, IsNil)
+	c.Assert(s.tlc.PublishVolume(vol), IsNil)
+	c.Assert(s.tlc.PublishVolumeStats("policy1/test", stats, time.Minute), IsNil)
+	c.Assert(s.tlc.RemoveVolume("policy1", "test"), IsNil)
+
+	_, err = s.tlc.GetVolumeStats("policy1/test")
+	c.Assert(err, NotNil)
+}
@@ -82,10 +82,50 @@ var (
 				Name:    "backendceph",
 				Backend: "ceph",
 			},
+			"backendloop": {
+				Name:    "backendloop",
+				Backend: "loop",
+			},
+			"backendlvm": {
+				Name:    "backendlvm",
+				Backend: "lvm",
+			},
+			"backendzfs": {
+				Name:    "backendzfs",
+				Backend: "zfs",
+			},
+			"backendbtrfs": {
+				Name:    "backendbtrfs",
+				Backend: "btrfs",
+			},
+			"backendlocal": {
+				Name:    "backendlocal",
+				Backend: "local",
+			},
+			"backendcephfs": {
+				Name:    "backendcephfs",
+				Backend: "cephfs",
+			},
+			"backendnull": {
+				Name:    "backendnull",
+				Backend: "null",
+			},
+			"backendexec": {
+				Name:    "backendexec",
+				Backend: "exec",
+			},
 			"backendnfs": {
 				Name:    "backendnfs",
 				Backend: "nfs",
 			},
+			"crudnfs": {
+				Name: "crudnfs",
+				Backends: &BackendDrivers{
+					CRUD:     "nfs",
+					Mount:    "nfs",
+					Snapshot: "",
+				},
+			},
 			"withbackendattr1": {
 				Name: "withbackendattr1",
 				Backends: &BackendDrivers{
@@ -141,7 +181,7 @@ var (
 				Name:     "nomount",
 				Backends: &BackendDrivers{},
 			},
-			"nfsbackends": { //only "nfs" mount it is valid
+			"nfsbackends": { // nfs cannot snapshot
 				Name: "crudnfs",
 				Backends: &BackendDrivers{
 					CRUD:     "nfs",
@@ -171,6 +211,19 @@ var (
 			"nosnapshots": {
 				UseSnapshots: false,
 			},
+			"backups": {
+				UseSnapshots: true,
+				Snapshot: SnapshotConfig{
+					Keep:      10,
+					Frequency: "1m",
+				},
+				UseBackups: true,
+				Backup: BackupConfig{
+					Frequency:  "1d",
+					Repository: "/mnt/backups",
+					FullEvery:  7,
+				},
+			},
 		},
 		"invalid": {
 			"nosnapshotconfig": {
@@ -216,6 +269,37 @@ var (
 					Keep:      0,
 				},
 			},
+			"backupswithoutsnapshots": {
+				UseSnapshots: false, // backups are taken from snapshots
+				UseBackups:   true,
+				Backup: BackupConfig{
+					Frequency:  "1d",
+					Repository: "/mnt/backups",
+				},
+			},
+			"norepository": {
+				UseSnapshots: true,
+				Snapshot: SnapshotConfig{
+					Keep:      10,
+					Frequency: "1m",
+				},
+				UseBackups: true,
+				Backup: BackupConfig{ // requires repository
+					Frequency: "1d",
+				},
+			},
+			"relativerepository": {
+				UseSnapshots: true,
+				Snapshot: SnapshotConfig{
+					Keep:      10,
+					Frequency: "1m",
+				},
+				UseBackups: true,
+				Backup: BackupConfig{
+					Frequency:  "1d",
+					Repository: "backups", // must be absolute
+				},
+			},
 		},
 	}
 )
@@ -244,6 +328,12 @@ func (s *configSuite) TestRuntimeValidation(c *C) {
 	err = invalidRuntimeConfigs["invalidsnapshotconfig"].ValidateJSON()
 	c.Assert(err, ErrorMatches, "(?m)*snapshot.frequency:.*Does not match pattern.*")
 	c.Assert(err, ErrorMatches, "(?m)*snapshot.keep:.*greater than or equal to 1.*")
+
+	c.Assert(invalidRuntimeConfigs["backupswithoutsnapshots"].ValidateJSON(), ErrorMatches, "(?m)*snapshots:.*must be one of the following: true.*")
+
+	c.Assert(invalidRuntimeConfigs["norepository"].ValidateJSON(), ErrorMatches, "(?m)*backup.repository:.*length must be greater than or equal to 1.*")
+
+	c.Assert(invalidRuntimeConfigs["relativerepository"].ValidateJSON(), ErrorMatches, "(?m)*backup.repository:.*Does not match pattern.*")
 }
 
 func (s *configSuite) TestSingletonBackend(c *C) {
@@ -253,6 +343,30 @@ func (s *configSuite) TestSingletonBackend(c *C) {
 	PolicyConfigs["valid"]["backendnfs"].Validate()
 	s.validateBackendsConfig(c, PolicyConfigs["valid"]["backendnfs"].Backends, "", "nfs", "")
 
+	PolicyConfigs["valid"]["backendloop"].Validate()
+	s.validateBackendsConfig(c, PolicyConfigs["valid"]["backendloop"].Backends, "loop", "loop", "loop")
+
+	PolicyConfigs["valid"]["backendlvm"].Validate()
+	s.validateBackendsConfig(c, PolicyConfigs["valid"]["backendlvm"].Backends, "lvm", "lvm", "lvm")
+
+	PolicyConfigs["valid"]["backendzfs"].Validate()
+	s.validateBackendsConfig(c, PolicyConfigs["valid"]["backendzfs"].Backends, "zfs", "zfs", "zfs")
+
+	PolicyConfigs["valid"]["backendbtrfs"].Validate()
+	s.validateBackendsConfig(c, PolicyConfigs["valid"]["backendbtrfs"].Backends, "btrfs", "btrfs", "btrfs")
+
+	PolicyConfigs["valid"]["backendlocal"].Validate()
+	s.validateBackendsConfig(c, PolicyConfigs["valid"]["backendlocal"].Backends, "local", "local", "")
+
+	PolicyConfigs["valid"]["backendcephfs"].Validate()
+	s.validateBackendsConfig(c, PolicyConfigs["valid"]["backendcephfs"].Backends, "cephfs", "cephfs", "cephfs")
+
+	PolicyConfigs["valid"]["backendnull"].Validate()
+	s.validateBackendsConfig(c, PolicyConfigs["valid"]["backendnull"].Backends, "null", "null", "null")
+
+	PolicyConfigs["valid"]["backendexec"].Validate()
+	s.validateBackendsConfig(c, PolicyConfigs["valid"]["backendexec"].Backends, "exec", "exec", "exec")
+
 	// Below test ensures that "Validate" did not change the given "backends" config, in case there is one provided
 	PolicyConfigs["valid"]["basicceph"].Validate()
 	s.validateBackendsConfig(c, PolicyConfigs["valid"]["basicceph"].Backends, "ceph", "ceph", "ceph")
@@ -295,9 +409,7 @@ func (s *configSuite) TestPolicyValidation(c *C) {
 	c.Assert(err, ErrorMatches, "(?m)*backends.crud must be one.*")
 	c.Assert(err, ErrorMatches, "(?m)*backends.snapshot must be one.*")
 
-	err = invalidPolicyConfigs["nfsbackends"].ValidateJSON()
-	c.Assert(err, ErrorMatches, "(?m)*backends.crud must be one.*")
-	c.Assert(err, ErrorMatches, "(?m)*backends.snapshot must be one.*")
+	c.Assert(invalidPolicyConfigs["nfsbackends"].ValidateJSON(), ErrorMatches, "(?m)*backends.snapshot must be one.*")
 
 	c.Assert(invalidPolicyConfigs["invalidpolicyname1"].ValidateJSON(), ErrorMatches, "(?m)*name: Does not match pattern.*")
 	c.Assert(invalidPolicyConfigs["invalidpolicyname2"].ValidateJSON(), ErrorMatches, "(?m)*name: Does not match pattern.*")
@@ -35,8 +35,9 @@ type Volume struct {
 // CreateOptions are the set of options used by apiserver during the volume
 // create operation.
 type CreateOptions struct {
-	Size       string `json:"size" merge:"size"`
-	FileSystem string `json:"filesystem" merge:"filesystem"`
+	Size       string           `json:"size" merge:"size"`
+	FileSystem string           `json:"filesystem" merge:"filesystem"`
+	Encryption EncryptionConfig `json:"encryption,omitempty"`
 }
 
 // RuntimeOptions are the set of options used by volplugin when mounting the
@@ -44,7 +45,11 @@ type CreateOptions struct {
 type RuntimeOptions struct {
 	UseSnapshots bool            `json:"snapshots" merge:"snapshots"`
 	Snapshot     SnapshotConfig  `json:"snapshot"`
+	UseBackups   bool            `json:"backups" merge:"backups"`
+	Backup       BackupConfig    `json:"backup"`
 	RateLimit    RateLimitConfig `json:"rate-limit,omitempty"`
+	FSCheck      string          `json:"fsck,omitempty" merge:"fsck"`
+	MountOptions string          `json:"mount-options,omitempty" merge:"mount-options"`
 }
 
 // RateLimitConfig is the configuration for limiting the rate of disk access.
@@ -59,6 +64,17 @@ type SnapshotConfig struct {
 	Keep      uint   `json:"keep" merge:"snapshots.keep"`
 }
 
+// BackupConfig is the configuration for backups. Backups are written to the
+// repository, a directory on the hosts running volsupervisor and apiserver.
+// Every FullEvery backups one holds all of the volume; the rest hold the
+// changes since the one before. Zero only takes a full backup when there is
+// nothing to take the changes against.
+type BackupConfig struct {
+	Frequency  string `json:"frequency" merge:"backups.frequency"`
+	Repository string `json:"repository" merge:"backups.repository"`
+	FullEvery  uint   `json:"full-every,omitempty" merge:"backups.full-every"`
+}
+
 func (c *Client) volume(policy, name, typ string) string {
 	return c.prefixed(rootVolume, policy, name, typ)
 }
@@ -128,6 +144,11 @@ func (c *Client) CreateVolume(rc *VolumeRequest) (*Volume, error) {
 		vc.CreateOptions.FileSystem = defaultFilesystem
 	}
 
+	// mount options given for the volume override those of its filesystem.
+	if vc.RuntimeOptions.MountOptions == "" {
+		vc.RuntimeOptions.MountOptions = resp.MountOptions[vc.CreateOptions.FileSystem]
+	}
+
 	return vc, nil
 }
 
@@ -151,6 +172,194 @@ func (c *Client) PublishVolume(vc *Volume) error {
 	return c.PublishVolumeRuntime(vc, vc.RuntimeOptions)
 }
 
+// UpdateVolume rewrites the configuration of an existing volume, e.g. after
+// a resize. The runtime parameters are left alone.
+func (c *Client) UpdateVolume(vc *Volume) error {
+	if err := vc.Validate(); err != nil {
+		return err
+	}
+
+	remarshal, err := json.Marshal(vc)
+	if err != nil {
+		return err
+	}
+
+	if _, err := c.etcdClient.Set(context.Background(), c.volume(vc.PolicyName, vc.VolumeName, "create"), string(remarshal), &client.SetOptions{PrevExist: client.PrevExist}); err != nil {
+		return errors.EtcdToErrored(err)
+	}
+
+	return nil
+}
+
+// RenamedVolume returns the configuration the volume takes when it is renamed
+// to policy/name. Volumes moved to another policy keep their driver and create
+// options, which their data was made with, and take the runtime options of the
+// policy; the policy must use the same backends, and encrypt its volumes if
+// and only if the volume is encrypted.
+func (c *Client) RenamedVolume(vc *Volume, policy, name string) (*Volume, error) {
+	newVC := *vc
+	newVC.PolicyName = policy
+	newVC.VolumeName = name
+
+	if policy != vc.PolicyName {
+		resp, err := c.GetPolicy(policy)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := resp.Validate(); err != nil {
+			return nil, err
+		}
+
+		if vc.Backends == nil || resp.Backends == nil || *resp.Backends != *vc.Backends {
+			return nil, errors.RenameVolume.Combine(errored.Errorf("Policy %q does not use the backends of volume %q", policy, vc))
+		}
+
+		if resp.CreateOptions.Encryption.Enabled() != vc.CreateOptions.Encryption.Enabled() {
+			return nil, errors.RenameVolume.Combine(errored.Errorf("Policy %q does not encrypt its volumes as volume %q is", policy, vc))
+		}
+
+		// copies and the volumes they depend on are looked up within their
+		// policy, so they cannot be split up.
+		copies, err := c.ListCopies(vc.PolicyName)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, cp := range copies {
+			if cp.Dependent() && (cp.Source == vc.String() || cp.Target == vc.String()) {
+				return nil, errors.RenameVolume.Combine(errored.Errorf("Copy %q depends on snapshot %q of volume %q and must be flattened first", cp.Target, cp.Snapshot, cp.Source))
+			}
+		}
+
+		newVC.Unlocked = resp.Unlocked
+		newVC.RuntimeOptions = resp.RuntimeOptions
+
+		if newVC.RuntimeOptions.MountOptions == "" {
+			newVC.RuntimeOptions.MountOptions = resp.MountOptions[newVC.CreateOptions.FileSystem]
+		}
+	}
+
+	if err := newVC.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &newVC, nil
+}
+
+// RenameVolume moves the records of the volume to those of newVC: its
+// configuration, runtime parameters, last filesystem check, copy record,
+// snapshot info and key. Copies made from the volume are pointed at its new
+// name. The volume must have been renamed in the backend already. The records
+// of the volume are left alone if any of its own fail to move.
+func (c *Client) RenameVolume(vc, newVC *Volume) error {
+	if err := c.PublishVolume(newVC); err != nil {
+		return err
+	}
+
+	if err := c.moveVolumeRecords(vc, newVC); err != nil {
+		if err := c.RemoveVolume(newVC.PolicyName, newVC.VolumeName); err != nil {
+			logrus.Errorf("Removing records of volume %q after failed rename: %v", newVC, err)
+		}
+		return err
+	}
+
+	if err := c.RemoveVolume(vc.PolicyName, vc.VolumeName); err != nil {
+		return err
+	}
+
+	copies, err := c.ListCopies(vc.PolicyName)
+	if err != nil {
+		return err
+	}
+
+	for _, cp := range copies {
+		if cp.Source != vc.String() {
+			continue
+		}
+
+		cp.Source = newVC.String()
+		if err := c.PublishCopy(cp); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *Client) moveVolumeRecords(vc, newVC *Volume) error {
+	check, err := c.GetFSCheck(vc.PolicyName, vc.VolumeName)
+	if err == nil {
+		err = c.PublishFSCheck(newVC, check)
+	} else if er, ok := err.(*errored.Error); ok && er.Contains(errors.NotExists) {
+		err = nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	cp, err := c.GetCopy(vc.PolicyName, vc.VolumeName)
+	if err == nil {
+		cp.Target = newVC.String()
+		err = c.PublishCopy(cp)
+	} else if er, ok := err.(*errored.Error); ok && er.Contains(errors.NotExists) {
+		err = nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	infos, err := c.ListSnapshotInfo(vc.String())
+	if err != nil {
+		return err
+	}
+
+	for snapName, info := range infos {
+		if err := c.PublishSnapshotInfo(newVC.String(), snapName, info); err != nil {
+			return err
+		}
+	}
+
+	// keys in the database are sealed with the name of their volume.
+	return c.CopyEncryption(vc, newVC)
+}
+
+// FSCheck records the last filesystem check of a volume, made by the host
+// which mounted it.
+type FSCheck struct {
+	Hostname string    `json:"hostname"`
+	Time     time.Time `json:"time"`
+	storage.FSCheck
+}
+
+// PublishFSCheck records the result of a filesystem check of the volume,
+// replacing any previous one.
+func (c *Client) PublishFSCheck(vc *Volume, check *FSCheck) error {
+	content, err := json.Marshal(check)
+	if err != nil {
+		return err
+	}
+
+	if _, err := c.etcdClient.Set(context.Background(), c.volume(vc.PolicyName, vc.VolumeName, "fsck"), string(content), nil); err != nil {
+		return errors.EtcdToErrored(err)
+	}
+
+	return nil
+}
+
+// GetFSCheck returns the last filesystem check of the volume.
+func (c *Client) GetFSCheck(policy, name string) (*FSCheck, error) {
+	resp, err := c.etcdClient.Get(context.Background(), c.volume(policy, name, "fsck"), nil)
+	if err != nil {
+		return nil, errors.EtcdToErrored(err)
+	}
+
+	check := &FSCheck{}
+	return check, json.Unmarshal([]byte(resp.Node.Value), check)
+}
+
 // ActualSize returns the size of the volume as an integer of megabytes.
 func (co *CreateOptions) ActualSize() (uint64, error) {
 	sizeStr := co.Size
@@ -208,7 +417,35 @@ func (c *Client) GetVolumeRuntime(policy, name string) (RuntimeOptions, error) {
 func (c *Client) RemoveVolume(policy, name string) error {
 	logrus.Debugf("Removing volume %s/%s from database", policy, name)
 	_, err := c.etcdClient.Delete(context.Background(), c.prefixed(rootVolume, policy, name), &client.DeleteOptions{Recursive: true})
-	return errors.EtcdToErrored(err)
+	if err != nil {
+		return errors.EtcdToErrored(err)
+	}
+
+	if err := c.RemoveCopy(policy, name); err != nil {
+		if er, ok := err.(*errored.Error); !ok || !er.Contains(errors.NotExists) {
+			return err
+		}
+	}
+
+	if err := c.removeSnapshotInfos(path.Join(policy, name)); err != nil {
+		if er, ok := err.(*errored.Error); !ok || !er.Contains(errors.NotExists) {
+			return err
+		}
+	}
+
+	if err := c.RemoveVolumeStats(path.Join(policy, name)); err != nil {
+		if er, ok := err.(*errored.Error); !ok || !er.Contains(errors.NotExists) {
+			return err
+		}
+	}
+
+	if err := c.removeKey(path.Join(policy, name)); err != nil {
+		if er, ok := err.(*errored.Error); !ok || !er.Contains(errors.NotExists) {
+			return err
+		}
+	}
+
+	return nil
 }
 
 // ListVolumes returns a map of volume name -> Volume.
@@ -321,9 +558,39 @@ func (c *Client) WatchVolumeRuntimes(activity chan *watch.Watch) {
 	watch.Create(w)
 }
 
-// TakeSnapshot immediately takes a snapshot by signaling the volsupervisor through etcd.
-func (c *Client) TakeSnapshot(name string) error {
-	_, err := c.etcdClient.Set(context.Background(), c.prefixed(rootSnapshots, name), "", nil)
+// WatchVolumeUpdates watches for volumes rewritten with UpdateVolume and
+// yields them back through the activity channel.
+func (c *Client) WatchVolumeUpdates(activity chan *watch.Watch) {
+	w := watch.NewWatcher(activity, c.prefixed(rootVolume), func(resp *client.Response, w *watch.Watcher) {
+		if resp.Node.Dir || path.Base(resp.Node.Key) != "create" || resp.Action != "update" {
+			return
+		}
+
+		volName := strings.TrimPrefix(path.Dir(resp.Node.Key), c.prefixed(rootVolume)+"/")
+		logrus.Debugf("Handling watch event %q for volume %q", resp.Action, volName)
+
+		policy, vol := path.Split(volName)
+		volume, err := c.GetVolume(policy, vol)
+		if err != nil {
+			logrus.Errorf("Could not retrieve volume %q after watch notification: %v", volName, err)
+			return
+		}
+
+		w.Channel <- &watch.Watch{Key: volName, Config: volume}
+	})
+
+	watch.Create(w)
+}
+
+// TakeSnapshot immediately takes a snapshot by signaling the volsupervisor
+// through etcd. The labels are recorded with the snapshot.
+func (c *Client) TakeSnapshot(name string, labels map[string]string) error {
+	content, err := json.Marshal(labels)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.etcdClient.Set(context.Background(), c.prefixed(rootSnapshots, name), string(content), nil)
 	return errors.EtcdToErrored(err)
 }
 
@@ -334,12 +601,21 @@ func (c *Client) RemoveTakeSnapshot(name string) error {
 }
 
 // WatchSnapshotSignal watches for a signal to be provided to
-// /volplugin/snapshots via writing an empty file to the policy/volume name.
+// /volplugin/snapshots via writing a file to the policy/volume name. The
+// Config of the watch is the map of labels to record with the snapshot.
 func (c *Client) WatchSnapshotSignal(activity chan *watch.Watch) {
 	w := watch.NewWatcher(activity, c.prefixed(rootSnapshots), func(resp *client.Response, w *watch.Watcher) {
 
 		if !resp.Node.Dir && resp.Action != "delete" {
-			vw := &watch.Watch{Key: strings.Replace(resp.Node.Key, c.prefixed(rootSnapshots)+"/", "", -1), Config: nil}
+			labels := map[string]string{}
+			// older signals are empty.
+			if resp.Node.Value != "" {
+				if err := json.Unmarshal([]byte(resp.Node.Value), &labels); err != nil {
+					logrus.Errorf("Invalid labels in snapshot signal %q: %v", resp.Node.Key, err)
+				}
+			}
+
+			vw := &watch.Watch{Key: strings.Replace(resp.Node.Key, c.prefixed(rootSnapshots)+"/", "", -1), Config: labels}
 			w.Channel <- vw
 		}
 	})
@@ -353,6 +629,10 @@ func (cfg *Volume) Validate() error {
 		return errors.ErrJSONValidation.Combine(err)
 	}
 
+	if err := cfg.CreateOptions.Encryption.validate(cfg.Backends); err != nil {
+		return err
+	}
+
 	return cfg.validateBackends()
 }
 
@@ -411,7 +691,9 @@ func (cfg *Volume) ToDriverOptions(timeout time.Duration) (storage.DriverOptions
 			Params: cfg.DriverOptions,
 		},
 		FSOptions: storage.FSOptions{
-			Type: cfg.CreateOptions.FileSystem,
+			Type:         cfg.CreateOptions.FileSystem,
+			CheckMode:    cfg.RuntimeOptions.FSCheck,
+			MountOptions: cfg.RuntimeOptions.MountOptions,
 		},
 		Timeout: timeout,
 		Source:  cfg.MountSource,
@@ -3,6 +3,7 @@ package config
 import (
 	"path"
 	"sort"
+	"time"
 
 	"github.com/contiv/volplugin/errors"
 	"github.com/contiv/volplugin/storage"
@@ -108,6 +109,161 @@ func (s *configSuite) TestWatchVolumes(c *C) {
 	c.Assert(vol, DeepEquals, volConfig)
 }
 
+func (s *configSuite) TestUpdateVolume(c *C) {
+	c.Assert(s.tlc.PublishPolicy("policy1", testPolicies["basic"]), IsNil)
+	volumeChan := make(chan *watch.Watch)
+	s.tlc.WatchVolumeUpdates(volumeChan)
+
+	vol, err := s.tlc.CreateVolume(&VolumeRequest{Policy: "policy1", Name: "test"})
+	c.Assert(err, IsNil)
+	c.Assert(s.tlc.UpdateVolume(vol), NotNil)
+	c.Assert(s.tlc.PublishVolume(vol), IsNil)
+
+	vol.CreateOptions.Size = "20MB"
+	c.Assert(s.tlc.UpdateVolume(vol), IsNil)
+
+	vol2 := <-volumeChan
+	c.Assert(vol2.Key, Equals, "policy1/test")
+	c.Assert(vol2.Config, DeepEquals, vol)
+
+	vol3, err := s.tlc.GetVolume("policy1", "test")
+	c.Assert(err, IsNil)
+	c.Assert(vol3.CreateOptions.Size, Equals, "20MB")
+}
+
+func (s *configSuite) TestFSCheck(c *C) {
+	c.Assert(s.tlc.PublishPolicy("policy1", testPolicies["basic"]), IsNil)
+
+	vol, err := s.tlc.CreateVolume(&VolumeRequest{Policy: "policy1", Name: "test", Options: map[string]string{"fsck": "repair"}})
+	c.Assert(err, IsNil)
+	c.Assert(vol.RuntimeOptions.FSCheck, Equals, storage.FSCheckRepair)
+	c.Assert(s.tlc.PublishVolume(vol), IsNil)
+
+	do, err := vol.ToDriverOptions(time.Second)
+	c.Assert(err, IsNil)
+	c.Assert(do.FSOptions.CheckMode, Equals, storage.FSCheckRepair)
+
+	_, err = s.tlc.GetFSCheck("policy1", "test")
+	c.Assert(err, NotNil)
+
+	check := &FSCheck{
+		Hostname: "mon0",
+		Time:     time.Unix(1000, 0).UTC(),
+		FSCheck:  storage.FSCheck{Mode: storage.FSCheckRepair, Status: storage.FSCheckRepaired, Output: "fixed"},
+	}
+
+	c.Assert(s.tlc.PublishFSCheck(vol, check), IsNil)
+
+	check2, err := s.tlc.GetFSCheck("policy1", "test")
+	c.Assert(err, IsNil)
+	c.Assert(check2, DeepEquals, check)
+
+	// the record must not confuse volume listing.
+	vols, err := s.tlc.ListVolumes("policy1")
+	c.Assert(err, IsNil)
+	c.Assert(vols["test"].RuntimeOptions.FSCheck, Equals, storage.FSCheckRepair)
+
+	c.Assert(s.tlc.RemoveVolume("policy1", "test"), IsNil)
+	_, err = s.tlc.GetFSCheck("policy1", "test")
+	c.Assert(err, NotNil)
+
+	vol.RuntimeOptions.FSCheck = "sometimes"
+	c.Assert(vol.RuntimeOptions.ValidateJSON(), NotNil)
+}
+
+func (s *configSuite) TestRenameVolume(c *C) {
+	c.Assert(s.tlc.PublishPolicy("policy1", testPolicies["basic"]), IsNil)
+	c.Assert(s.tlc.PublishPolicy("policy2", testPolicies["basic2"]), IsNil)
+	c.Assert(s.tlc.PublishPolicy("policy3", testPolicies["nfs"]), IsNil)
+
+	vol, err := s.tlc.CreateVolume(&VolumeRequest{Policy: "policy1", Name: "test", Options: map[string]string{"size": "30MB"}})
+	c.Assert(err, IsNil)
+	c.Assert(s.tlc.PublishVolume(vol), IsNil)
+
+	check := &FSCheck{Hostname: "mon0", Time: time.Unix(1000, 0).UTC()}
+	c.Assert(s.tlc.PublishFSCheck(vol, check), IsNil)
+	c.Assert(s.tlc.PublishSnapshotInfo("policy1/test", "snap", &SnapshotInfo{Origin: storage.SnapshotManual}), IsNil)
+
+	cp := &Copy{Source: "policy1/test", Snapshot: "snap", Target: "policy1/copy", Status: CopyCloned}
+	c.Assert(s.tlc.PublishCopy(cp), IsNil)
+
+	// policies with other backends, or copies not yet flattened, keep volumes
+	// from moving.
+	_, err = s.tlc.RenamedVolume(vol, "policy3", "test")
+	c.Assert(err, NotNil)
+	_, err = s.tlc.RenamedVolume(vol, "policy2", "test")
+	c.Assert(err, NotNil)
+
+	renamed, err := s.tlc.RenamedVolume(vol, "policy1", "renamed")
+	c.Assert(err, IsNil)
+	c.Assert(renamed.String(), Equals, "policy1/renamed")
+	c.Assert(renamed.RuntimeOptions, DeepEquals, vol.RuntimeOptions)
+
+	c.Assert(s.tlc.RenameVolume(vol, renamed), IsNil)
+
+	_, err = s.tlc.GetVolume("policy1", "test")
+	c.Assert(err, NotNil)
+
+	vol2, err := s.tlc.GetVolume("policy1", "renamed")
+	c.Assert(err, IsNil)
+	c.Assert(vol2, DeepEquals, renamed)
+
+	check2, err := s.tlc.GetFSCheck("policy1", "renamed")
+	c.Assert(err, IsNil)
+	c.Assert(check2, DeepEquals, check)
+
+	infos, err := s.tlc.ListSnapshotInfo("policy1/renamed")
+	c.Assert(err, IsNil)
+	c.Assert(infos["snap"].Origin, Equals, storage.SnapshotManual)
+
+	cp2, err := s.tlc.GetCopy("policy1", "copy")
+	c.Assert(err, IsNil)
+	c.Assert(cp2.Source, Equals, "policy1/renamed")
+
+	// volumes cannot be renamed onto others.
+	c.Assert(s.tlc.RenameVolume(vol2, vol2), NotNil)
+
+	// once the copy is flattened, the volume can move, keeping its size and
+	// taking the runtime options of the policy.
+	cp2.Status = CopyFlattened
+	c.Assert(s.tlc.PublishCopy(cp2), IsNil)
+
+	moved, err := s.tlc.RenamedVolume(vol2, "policy2", "renamed")
+	c.Assert(err, IsNil)
+	c.Assert(moved.CreateOptions.Size, Equals, "30MB")
+	c.Assert(moved.RuntimeOptions, DeepEquals, testPolicies["basic2"].RuntimeOptions)
+
+	c.Assert(s.tlc.RenameVolume(vol2, moved), IsNil)
+
+	vols, err := s.tlc.ListVolumes("policy1")
+	c.Assert(err, IsNil)
+	c.Assert(len(vols), Equals, 0)
+
+	vol3, err := s.tlc.GetVolume("policy2", "renamed")
+	c.Assert(err, IsNil)
+	c.Assert(vol3, DeepEquals, moved)
+}
+
+func (s *configSuite) TestMountOptions(c *C) {
+	c.Assert(s.tlc.PublishPolicy("policy1", testPolicies["mountoptions"]), IsNil)
+
+	vol, err := s.tlc.CreateVolume(&VolumeRequest{Policy: "policy1", Name: "ext4"})
+	c.Assert(err, IsNil)
+	c.Assert(vol.RuntimeOptions.MountOptions, Equals, "noatime,discard")
+
+	vol, err = s.tlc.CreateVolume(&VolumeRequest{Policy: "policy1", Name: "xfs", Options: map[string]string{"filesystem": "xfs"}})
+	c.Assert(err, IsNil)
+	c.Assert(vol.RuntimeOptions.MountOptions, Equals, "nobarrier,logbufs=8")
+
+	vol, err = s.tlc.CreateVolume(&VolumeRequest{Policy: "policy1", Name: "override", Options: map[string]string{"filesystem": "xfs", "mount-options": "noatime"}})
+	c.Assert(err, IsNil)
+	c.Assert(vol.RuntimeOptions.MountOptions, Equals, "noatime")
+
+	do, err := vol.ToDriverOptions(time.Second)
+	c.Assert(err, IsNil)
+	c.Assert(do.FSOptions.MountOptions, Equals, "noatime")
+}
+
 func (s *configSuite) TestVolumeCRUD(c *C) {
 	policyNames := []string{"foo", "bar"}
 	volumeNames := []string{"baz", "quux"}
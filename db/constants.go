@@ -4,8 +4,16 @@ import "time"
 
 // DefaultDrivers are macro type definitions for backend drivers.
 var DefaultDrivers = map[string]*BackendDrivers{
-	"ceph": {"ceph", "ceph", "ceph"},
-	"nfs":  {"", "nfs", ""},
+	"ceph":   {"ceph", "ceph", "ceph"},
+	"nfs":    {"", "nfs", ""},
+	"loop":   {"loop", "loop", "loop"},
+	"lvm":    {"lvm", "lvm", "lvm"},
+	"zfs":    {"zfs", "zfs", "zfs"},
+	"btrfs":  {"btrfs", "btrfs", "btrfs"},
+	"local":  {"local", "local", ""},
+	"cephfs": {"cephfs", "cephfs", "cephfs"},
+	"null":   {"null", "null", "null"},
+	"exec":   {"exec", "exec", "exec"},
 }
 
 // DefaultFilesystems is a map of our default supported filesystems. Overridden
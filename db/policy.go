@@ -2,9 +2,12 @@ package db
 
 import (
 	"strings"
+	"time"
 
 	"github.com/contiv/errored"
 	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/storage"
+	"github.com/contiv/volplugin/storage/backend"
 )
 
 // NewPolicy creates a policy struct with the required parameters for using it.
@@ -58,6 +61,12 @@ func (p *Policy) Validate() error {
 		return errors.ErrJSONValidation.Combine(err)
 	}
 
+	for fs := range p.MountOptions {
+		if _, ok := p.FileSystems[fs]; !ok {
+			return errored.Errorf("Mount options given for unknown filesystem %q", fs)
+		}
+	}
+
 	if p.Backends == nil { // backend should be defined and its validated
 		backends, ok := DefaultDrivers[p.Backend]
 
@@ -72,7 +81,41 @@ func (p *Policy) Validate() error {
 		return errored.Errorf("Size set to zero for non-empty CRUD backend %v", p.Backends.CRUD).Combine(err)
 	}
 
-	return nil
+	return p.validateDriverOptions(size)
+}
+
+// validateDriverOptions has the CRUD driver validate the driver options, so
+// bad ones are rejected when the policy is uploaded instead of when the first
+// volume is created.
+func (p *Policy) validateDriverOptions(size uint64) error {
+	if p.Backends.CRUD == "" {
+		return nil
+	}
+
+	crud, err := backend.NewCRUDDriver(p.Backends.CRUD)
+	if err != nil {
+		return err
+	}
+
+	params := storage.Params{}
+	for key, value := range p.DriverOptions {
+		params[key] = value
+	}
+
+	// the volume name and timeout are dummies; they are not known yet.
+	do := storage.DriverOptions{
+		Volume: storage.Volume{
+			Name:   p.Name + "/policy",
+			Size:   size,
+			Params: params,
+		},
+		FSOptions: storage.FSOptions{
+			Type: p.CreateOptions.FileSystem,
+		},
+		Timeout: time.Second,
+	}
+
+	return crud.Validate(&do)
 }
 
 func (p *Policy) String() string {
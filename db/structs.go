@@ -13,6 +13,7 @@ type Policy struct {
 	RuntimeOptions *RuntimeOptions   `json:"runtime"`
 	DriverOptions  map[string]string `json:"driver"`
 	FileSystems    map[string]string `json:"filesystems"`
+	MountOptions   map[string]string `json:"mount-options,omitempty"`
 	Backends       *BackendDrivers   `json:"backends,omitempty"`
 	Backend        string            `json:"backend,omitempty"`
 }
@@ -74,8 +75,17 @@ type Volume struct {
 // CreateOptions are the set of options used by apiserver during the volume
 // create operation.
 type CreateOptions struct {
-	Size       string `json:"size" merge:"size"`
-	FileSystem string `json:"filesystem" merge:"filesystem"`
+	Size       string           `json:"size" merge:"size"`
+	FileSystem string           `json:"filesystem" merge:"filesystem"`
+	Encryption EncryptionConfig `json:"encryption,omitempty"`
+}
+
+// EncryptionConfig is the configuration for encrypting volumes at rest.
+// Volumes are encrypted if a key provider is set.
+type EncryptionConfig struct {
+	Provider string `json:"provider,omitempty"`
+	Cipher   string `json:"cipher,omitempty"`
+	KeyFile  string `json:"key-file,omitempty"`
 }
 
 // RuntimeOptions are the set of options used by volplugin when mounting the
@@ -83,7 +93,11 @@ type CreateOptions struct {
 type RuntimeOptions struct {
 	UseSnapshots bool            `json:"snapshots" merge:"snapshots"`
 	Snapshot     SnapshotConfig  `json:"snapshot"`
+	UseBackups   bool            `json:"backups" merge:"backups"`
+	Backup       BackupConfig    `json:"backup"`
 	RateLimit    RateLimitConfig `json:"rate-limit,omitempty"`
+	FSCheck      string          `json:"fsck,omitempty" merge:"fsck"`
+	MountOptions string          `json:"mount-options,omitempty" merge:"mount-options"`
 
 	policyName string
 	volumeName string
@@ -100,3 +114,10 @@ type SnapshotConfig struct {
 	Frequency string `json:"frequency" merge:"snapshots.frequency"`
 	Keep      uint   `json:"keep" merge:"snapshots.keep"`
 }
+
+// BackupConfig is the configuration for backups.
+type BackupConfig struct {
+	Frequency  string `json:"frequency" merge:"backups.frequency"`
+	Repository string `json:"repository" merge:"backups.repository"`
+	FullEvery  uint   `json:"full-every,omitempty" merge:"backups.full-every"`
+}
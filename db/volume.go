@@ -65,6 +65,17 @@ func CreateVolume(vr *VolumeRequest) (*Volume, error) {
 		vc.CreateOptions.FileSystem = DefaultFilesystem
 	}
 
+	// mount options given for the volume override those of its filesystem.
+	if opts, ok := vr.Policy.MountOptions[vc.CreateOptions.FileSystem]; ok && (vc.RuntimeOptions == nil || vc.RuntimeOptions.MountOptions == "") {
+		ro := RuntimeOptions{}
+		if vc.RuntimeOptions != nil {
+			ro = *vc.RuntimeOptions
+		}
+
+		ro.MountOptions = opts
+		vc.RuntimeOptions = &ro
+	}
+
 	return vc, nil
 }
 
@@ -202,17 +213,21 @@ func (v *Volume) ToDriverOptions(timeout time.Duration) (storage.DriverOptions,
 		return storage.DriverOptions{}, err
 	}
 
+	fsOptions := storage.FSOptions{Type: v.CreateOptions.FileSystem}
+	if v.RuntimeOptions != nil {
+		fsOptions.CheckMode = v.RuntimeOptions.FSCheck
+		fsOptions.MountOptions = v.RuntimeOptions.MountOptions
+	}
+
 	return storage.DriverOptions{
 		Volume: storage.Volume{
 			Name:   v.String(),
 			Size:   actualSize,
 			Params: v.DriverOptions,
 		},
-		FSOptions: storage.FSOptions{
-			Type: v.CreateOptions.FileSystem,
-		},
-		Timeout: timeout,
-		Source:  v.MountSource,
+		FSOptions: fsOptions,
+		Timeout:   timeout,
+		Source:    v.MountSource,
 	}, nil
 }
 
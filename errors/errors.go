@@ -58,6 +58,12 @@ var (
 
 	// SnapshotCopy is used when copying snapshots to volumes fail.
 	SnapshotCopy = errored.New("Copying snapshot to volume")
+
+	// SnapshotRollback is used when rolling volumes back to snapshots fail.
+	SnapshotRollback = errored.New("Rolling back volume to snapshot")
+
+	// Flatten is used when flattening a copied volume fails.
+	Flatten = errored.New("Flattening volume")
 )
 
 // protocol-level errors
@@ -96,6 +102,50 @@ var (
 	FormatVolume = errored.New("Formatting Volume")
 	// CreateVolume is used when creating volumes
 	CreateVolume = errored.New("Creating Volume")
+	// RenameVolume is used when renaming volumes or moving them to other policies.
+	RenameVolume = errored.New("Renaming volume")
+	// RenameUnsupported is used when the backend does not support renaming volumes.
+	RenameUnsupported = errored.New("Backend does not support renaming volumes")
+	// AdoptVolume is used when adopting images made outside volplugin as volumes.
+	AdoptVolume = errored.New("Adopting volume")
+	// AdoptUnsupported is used when the backend cannot adopt images as volumes.
+	AdoptUnsupported = errored.New("Backend does not support adopting images")
+	// ResizeVolume is used when resizing volumes.
+	ResizeVolume = errored.New("Resizing volume")
+	// ResizeUnsupported is used when the backend does not support resizing.
+	ResizeUnsupported = errored.New("Backend does not support resizing")
+	// MissingSizeOption is used when the size option is missing for volume resizes.
+	MissingSizeOption = errored.New("Could not find size option in request: cannot resize.")
+	// GetStats is used when retrieving volume statistics.
+	GetStats = errored.New("Retrieving volume statistics")
+	// StatsUnsupported is used when neither the backend nor a local mount can report statistics.
+	StatsUnsupported = errored.New("Backend does not support statistics and the volume is not mounted here")
+	// FSCheck is used when the filesystem check before mounting finds errors it cannot repair.
+	FSCheck = errored.New("Filesystem check found unrecoverable errors")
+	// FlattenUnsupported is used when a flattened copy is requested of a backend which cannot flatten volumes.
+	FlattenUnsupported = errored.New("Backend does not support flattening volumes")
+	// ExportVolume is used when exporting a volume fails.
+	ExportVolume = errored.New("Exporting volume")
+	// ImportVolume is used when importing a volume fails.
+	ImportVolume = errored.New("Importing volume")
+	// ExportUnsupported is used when the backend cannot export or import volumes.
+	ExportUnsupported = errored.New("Backend does not support exporting and importing volumes")
+	// Backup is used when backing up a volume fails.
+	Backup = errored.New("Backing up volume")
+	// ListBackups is used when listing the backups of a volume fails.
+	ListBackups = errored.New("Listing backups")
+	// RestoreBackup is used when restoring a volume from a backup fails.
+	RestoreBackup = errored.New("Restoring volume from backup")
+	// BackupsUnsupported is used when the backend cannot write or apply the diffs backups are made of.
+	BackupsUnsupported = errored.New("Backend does not support backups")
+	// NoBackupRepository is used when backups are requested of a volume without a backup repository.
+	NoBackupRepository = errored.New("Volume has no backup repository")
+	// MissingBackupOption is used when the backup option is missing for restores.
+	MissingBackupOption = errored.New("Could not find backup option in request: cannot restore.")
+	// EncryptionKey is used when the key of an encrypted volume cannot be made or retrieved.
+	EncryptionKey = errored.New("Retrieving encryption key")
+	// EncryptionUnsupported is used when the backend cannot encrypt volumes.
+	EncryptionUnsupported = errored.New("Backend does not support encryption")
 	// ConfiguringVolume is used when configuring the volume structs.
 	ConfiguringVolume = errored.New("Configuring volume parameters")
 	// MarshalVolume is used when Marshaling volumes.
@@ -39,6 +39,22 @@ const (
 
 	// ReasonCopy indicates a copy from snapshot operation.
 	ReasonCopy = "Copy"
+	// ReasonRollback indicates a rollback to a snapshot.
+	ReasonRollback = "Rollback"
+	// ReasonExport indicates a volume is being exported.
+	ReasonExport = "Export"
+	// ReasonImport indicates a volume is being imported.
+	ReasonImport = "Import"
+	// ReasonBackup indicates a volume is being backed up.
+	ReasonBackup = "Backup"
+	// ReasonRestore indicates a volume is being restored from a backup.
+	ReasonRestore = "Restore"
+	// ReasonResize indicates a resize operation.
+	ReasonResize = "Resize"
+	// ReasonAdopt indicates an image made outside volplugin is being adopted as a volume.
+	ReasonAdopt = "Adopt"
+	// ReasonRename indicates a volume is being renamed or moved to another policy.
+	ReasonRename = "Rename"
 	// ReasonMaintenance indicates that an operator is acquiring the lock.
 	ReasonMaintenance = "Maintenance"
 )
@@ -3,8 +3,16 @@ package backend
 import (
 	"github.com/contiv/errored"
 	"github.com/contiv/volplugin/storage"
+	"github.com/contiv/volplugin/storage/backend/btrfs"
 	"github.com/contiv/volplugin/storage/backend/ceph"
+	"github.com/contiv/volplugin/storage/backend/cephfs"
+	"github.com/contiv/volplugin/storage/backend/exec"
+	"github.com/contiv/volplugin/storage/backend/local"
+	"github.com/contiv/volplugin/storage/backend/loop"
+	"github.com/contiv/volplugin/storage/backend/lvm"
 	"github.com/contiv/volplugin/storage/backend/nfs"
+	"github.com/contiv/volplugin/storage/backend/null"
+	"github.com/contiv/volplugin/storage/backend/zfs"
 )
 
 // DriverTypes
@@ -17,18 +25,42 @@ var (
 
 // MountDrivers is the map of string to storage.MountDriver.
 var MountDrivers = map[string]func(string) (storage.MountDriver, error){
-	ceph.BackendName: ceph.NewMountDriver,
-	nfs.BackendName:  nfs.NewMountDriver,
+	ceph.BackendName:   ceph.NewMountDriver,
+	nfs.BackendName:    nfs.NewMountDriver,
+	loop.BackendName:   loop.NewMountDriver,
+	lvm.BackendName:    lvm.NewMountDriver,
+	zfs.BackendName:    zfs.NewMountDriver,
+	btrfs.BackendName:  btrfs.NewMountDriver,
+	cephfs.BackendName: cephfs.NewMountDriver,
+	local.BackendName:  local.NewMountDriver,
+	null.BackendName:   null.NewMountDriver,
+	exec.BackendName:   exec.NewMountDriver,
 }
 
 // CRUDDrivers is the map of string to storage.CRUDDriver.
 var CRUDDrivers = map[string]func() (storage.CRUDDriver, error){
-	ceph.BackendName: ceph.NewCRUDDriver,
+	ceph.BackendName:   ceph.NewCRUDDriver,
+	nfs.BackendName:    nfs.NewCRUDDriver,
+	loop.BackendName:   loop.NewCRUDDriver,
+	lvm.BackendName:    lvm.NewCRUDDriver,
+	zfs.BackendName:    zfs.NewCRUDDriver,
+	btrfs.BackendName:  btrfs.NewCRUDDriver,
+	cephfs.BackendName: cephfs.NewCRUDDriver,
+	local.BackendName:  local.NewCRUDDriver,
+	null.BackendName:   null.NewCRUDDriver,
+	exec.BackendName:   exec.NewCRUDDriver,
 }
 
 // SnapshotDrivers is the map of string to storage.SnapshotDriver.
 var SnapshotDrivers = map[string]func() (storage.SnapshotDriver, error){
-	ceph.BackendName: ceph.NewSnapshotDriver,
+	ceph.BackendName:   ceph.NewSnapshotDriver,
+	loop.BackendName:   loop.NewSnapshotDriver,
+	lvm.BackendName:    lvm.NewSnapshotDriver,
+	zfs.BackendName:    zfs.NewSnapshotDriver,
+	btrfs.BackendName:  btrfs.NewSnapshotDriver,
+	cephfs.BackendName: cephfs.NewSnapshotDriver,
+	null.BackendName:   null.NewSnapshotDriver,
+	exec.BackendName:   exec.NewSnapshotDriver,
 }
 
 // NewMountDriver instantiates and return a mount driver instance of the
@@ -0,0 +1,532 @@
+package btrfs
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/storage"
+)
+
+const (
+	// BackendName is the name of the btrfs storage backend.
+	BackendName = "btrfs"
+
+	snapshotSuffix = ".snapshots"
+	rollbackSuffix = ".rollback"
+
+	// subvolumeInode is the inode number of the root directory of every
+	// btrfs subvolume.
+	subvolumeInode = 256
+)
+
+// Driver implements a storage driver on top of btrfs subvolumes.
+//
+// -- Layout
+//
+// The `path` driver option names a directory on a mounted btrfs filesystem.
+// A volume `policy/volume` is the subvolume `<path>/policy/volume`, and its
+// size is enforced with a qgroup limit. Snapshots are read-only snapshots of
+// the subvolume kept in `<path>/policy/volume.snapshots/`; copies of them are
+// writable snapshots. As subvolumes are filesystems already, there is nothing
+// to format.
+//
+// -- Hosts
+//
+// The btrfs filesystem is local to a host, so volumes belong to the host they
+// were created on, which is recorded in the `host` driver option. Other hosts
+// refuse to work on them: volsupervisor and the apiserver can only snapshot,
+// copy or roll back volumes when they run on that host.
+type Driver struct {
+	mountpath string
+}
+
+// NewMountDriver is a generator for Driver structs. It is used by the storage
+// framework to yield new drivers on every creation.
+func NewMountDriver(mountpath string) (storage.MountDriver, error) {
+	return &Driver{mountpath: mountpath}, nil
+}
+
+// NewCRUDDriver is a generator for Driver structs. It is used by the storage
+// framework to yield new drivers on every creation.
+func NewCRUDDriver() (storage.CRUDDriver, error) {
+	return &Driver{}, nil
+}
+
+// NewSnapshotDriver is a generator for Driver structs. It is used by the storage
+// framework to yield new drivers on every creation.
+func NewSnapshotDriver() (storage.SnapshotDriver, error) {
+	return &Driver{}, nil
+}
+
+// Name returns the btrfs backend string
+func (d *Driver) Name() string {
+	return BackendName
+}
+
+// subvolumePath returns the path to the subvolume of the volume.
+func (d *Driver) subvolumePath(volume storage.Volume) (string, error) {
+	policy, name, err := storage.SplitName(volume.Name)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(volume.Params["path"], policy, name), nil
+}
+
+// snapshotDir returns the directory which holds the snapshots of a volume.
+func (d *Driver) snapshotDir(volume storage.Volume) (string, error) {
+	subvol, err := d.subvolumePath(volume)
+	if err != nil {
+		return "", err
+	}
+
+	return subvol + snapshotSuffix, nil
+}
+
+func (d *Driver) snapshotPath(snapName string, volume storage.Volume) (string, error) {
+	if snapName == "" || snapName == "." || snapName == ".." || strings.Contains(snapName, "/") {
+		return "", errored.Errorf("Invalid snapshot name %q", snapName)
+	}
+
+	dir, err := d.snapshotDir(volume)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, snapName), nil
+}
+
+func isSubvolume(fi os.FileInfo) bool {
+	return fi.IsDir() && fi.Sys().(*syscall.Stat_t).Ino == subvolumeInode
+}
+
+// Create a volume. The name of this host is recorded in the parameters of
+// the volume.
+func (d *Driver) Create(do storage.DriverOptions) error {
+	subvol, err := d.subvolumePath(do.Volume)
+	if err != nil {
+		return err
+	}
+
+	if err := storage.ClaimHost(do.Volume); err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(subvol); err == nil {
+		return storage.ErrVolumeExist
+	}
+
+	if err := os.MkdirAll(filepath.Dir(subvol), 0700); err != nil {
+		return errored.Errorf("Creating policy directory for %q", do.Volume.Name).Combine(err)
+	}
+
+	if _, err := storage.RunCommand(exec.Command("btrfs", "subvolume", "create", subvol), do.Timeout); err != nil {
+		return errored.Errorf("Creating volume %q", do.Volume.Name).Combine(err)
+	}
+
+	// Size is in megabytes, just like it is for rbd.
+	if err := setLimit(do.Volume.Params["path"], subvol, strconv.FormatUint(do.Volume.Size, 10)+"M", do.Timeout); err != nil {
+		if _, err := storage.RunCommand(exec.Command("btrfs", "subvolume", "delete", subvol), do.Timeout); err != nil {
+			logrus.Errorf("Error while trying to remove subvolume after failed qgroup limit: %v", err)
+		}
+		return errored.Errorf("Sizing volume %q", do.Volume.Name).Combine(err)
+	}
+
+	return nil
+}
+
+// Format formats a created volume. Subvolumes are filesystems already, so
+// this does nothing.
+func (d *Driver) Format(do storage.DriverOptions) error {
+	return nil
+}
+
+// Destroy a volume.
+func (d *Driver) Destroy(do storage.DriverOptions) error {
+	if err := storage.CheckHost(do.Volume); err != nil {
+		return err
+	}
+
+	subvol, err := d.subvolumePath(do.Volume)
+	if err != nil {
+		return err
+	}
+
+	snapDir, err := d.snapshotDir(do.Volume)
+	if err != nil {
+		return err
+	}
+
+	snaps, err := d.ListSnapshots(do)
+	if err != nil {
+		return err
+	}
+
+	for _, snap := range snaps {
+		if err := d.RemoveSnapshot(snap.Name, do); err != nil {
+			return errored.Errorf("Destroying snapshots for volume %q", do.Volume.Name).Combine(err)
+		}
+	}
+
+	if err := os.RemoveAll(snapDir); err != nil {
+		return errored.Errorf("Destroying snapshots for volume %q", do.Volume.Name).Combine(err)
+	}
+
+	if _, err := storage.RunCommand(exec.Command("btrfs", "subvolume", "delete", subvol), do.Timeout); err != nil {
+		return errored.Errorf("Destroying volume %q", do.Volume.Name).Combine(err)
+	}
+
+	return nil
+}
+
+// List all volumes on this host.
+func (d *Driver) List(lo storage.ListOptions) ([]storage.Volume, error) {
+	root := lo.Params["path"]
+
+	host, err := storage.Hostname()
+	if err != nil {
+		return nil, errored.Errorf("Could not determine hostname").Combine(err)
+	}
+
+	entries, err := filepath.Glob(filepath.Join(root, "*", "*"))
+	if err != nil {
+		return nil, errored.Errorf("Listing subvolumes in %q", root).Combine(err)
+	}
+
+	list := []storage.Volume{}
+
+	for _, entry := range entries {
+		if strings.HasSuffix(entry, snapshotSuffix) {
+			continue
+		}
+
+		fi, err := os.Stat(entry)
+		if err != nil || !isSubvolume(fi) {
+			continue
+		}
+
+		rel, err := filepath.Rel(root, entry)
+		if err != nil {
+			logrus.Errorf("Invalid subvolume %q found in %q, skipping", entry, root)
+			continue
+		}
+
+		list = append(list, storage.Volume{Name: rel, Params: storage.Params{"path": root, storage.HostParam: host}})
+	}
+
+	return list, nil
+}
+
+// Exists returns true if the volume already exists. Volumes belonging to
+// other hosts cannot be looked at, and are assumed to exist.
+func (d *Driver) Exists(do storage.DriverOptions) (bool, error) {
+	if do.Volume.Params[storage.HostParam] != "" {
+		if err := storage.CheckHost(do.Volume); err != nil {
+			logrus.Warnf("Cannot check for volume %q on this host, assuming it exists: %v", do.Volume.Name, err)
+			return true, nil
+		}
+	}
+
+	subvol, err := d.subvolumePath(do.Volume)
+	if err != nil {
+		return false, err
+	}
+
+	if _, err := os.Stat(subvol); os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, errored.Errorf("Checking for subvolume %q", subvol).Combine(err)
+	}
+
+	return true, nil
+}
+
+// CreateSnapshot creates a named snapshot for the volume. Any error will be returned.
+func (d *Driver) CreateSnapshot(snapName string, do storage.DriverOptions) error {
+	if err := storage.CheckHost(do.Volume); err != nil {
+		return err
+	}
+
+	subvol, err := d.subvolumePath(do.Volume)
+	if err != nil {
+		return err
+	}
+
+	snapName = strings.Replace(snapName, " ", "-", -1)
+	snapPath, err := d.snapshotPath(snapName, do.Volume)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(snapPath), 0700); err != nil {
+		return errored.Errorf("Creating snapshot directory for volume %q", do.Volume.Name).Combine(err)
+	}
+
+	if _, err := storage.RunCommand(exec.Command("btrfs", "subvolume", "snapshot", "-r", subvol, snapPath), do.Timeout); err != nil {
+		return errored.Errorf("Creating snapshot %q (volume %q)", snapName, do.Volume.Name).Combine(err)
+	}
+
+	return nil
+}
+
+// RemoveSnapshot removes a named snapshot for the volume. Any error will be returned.
+func (d *Driver) RemoveSnapshot(snapName string, do storage.DriverOptions) error {
+	if err := storage.CheckHost(do.Volume); err != nil {
+		return err
+	}
+
+	snapPath, err := d.snapshotPath(snapName, do.Volume)
+	if err != nil {
+		return err
+	}
+
+	if _, err := storage.RunCommand(exec.Command("btrfs", "subvolume", "delete", snapPath), do.Timeout); err != nil {
+		return errored.Errorf("Removing snapshot %q (volume %q)", snapName, do.Volume.Name).Combine(err)
+	}
+
+	return nil
+}
+
+type snapshot struct {
+	name    string
+	id      uint64
+	created time.Time
+}
+
+type bySubvolumeID []snapshot
+
+func (b bySubvolumeID) Len() int           { return len(b) }
+func (b bySubvolumeID) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b bySubvolumeID) Less(i, j int) bool { return b[i].id < b[j].id }
+
+// RollbackSnapshot replaces the subvolume of the volume with a writable
+// snapshot of the snapshot, keeping the size limit of the volume.
+func (d *Driver) RollbackSnapshot(snapName string, do storage.DriverOptions) error {
+	if err := storage.CheckHost(do.Volume); err != nil {
+		return err
+	}
+
+	subvol, err := d.subvolumePath(do.Volume)
+	if err != nil {
+		return err
+	}
+
+	snapPath, err := d.snapshotPath(snapName, do.Volume)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(snapPath); err != nil {
+		return errored.Errorf("Snapshot %q (volume %q) could not be found", snapName, do.Volume.Name).Combine(errors.NotExists)
+	}
+
+	limit, err := getLimit(subvol, do.Timeout)
+	if err != nil {
+		return errored.Errorf("Rolling back volume %q to snapshot %q", do.Volume.Name, snapName).Combine(err)
+	}
+
+	tmpSubvol := subvol + rollbackSuffix
+	if _, err := storage.RunCommand(exec.Command("btrfs", "subvolume", "snapshot", snapPath, tmpSubvol), do.Timeout); err != nil {
+		return errored.Errorf("Rolling back volume %q to snapshot %q", do.Volume.Name, snapName).Combine(err)
+	}
+
+	if _, err := storage.RunCommand(exec.Command("btrfs", "subvolume", "delete", subvol), do.Timeout); err != nil {
+		if _, err := storage.RunCommand(exec.Command("btrfs", "subvolume", "delete", tmpSubvol), do.Timeout); err != nil {
+			logrus.Errorf("Could not remove partial rollback %q: %v", tmpSubvol, err)
+		}
+		return errored.Errorf("Rolling back volume %q to snapshot %q", do.Volume.Name, snapName).Combine(err)
+	}
+
+	if err := os.Rename(tmpSubvol, subvol); err != nil {
+		return errored.Errorf("Rolling back volume %q to snapshot %q", do.Volume.Name, snapName).Combine(err)
+	}
+
+	if err := setLimit(do.Volume.Params["path"], subvol, limit, do.Timeout); err != nil {
+		return errored.Errorf("Sizing volume %q rolled back to snapshot %q", do.Volume.Name, snapName).Combine(err)
+	}
+
+	return nil
+}
+
+// ListSnapshots returns the snapshots of the volume, oldest first. Any error
+// will be returned.
+func (d *Driver) ListSnapshots(do storage.DriverOptions) ([]storage.Snapshot, error) {
+	if err := storage.CheckHost(do.Volume); err != nil {
+		return nil, err
+	}
+
+	snapDir, err := d.snapshotDir(do.Volume)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []storage.Snapshot{}
+
+	dir, err := os.Open(snapDir)
+	if os.IsNotExist(err) {
+		return result, nil
+	} else if err != nil {
+		return nil, errored.Errorf("Listing snapshots for volume %q", do.Volume.Name).Combine(err)
+	}
+	defer dir.Close()
+
+	fis, err := dir.Readdir(-1)
+	if err != nil {
+		return nil, errored.Errorf("Listing snapshots for volume %q", do.Volume.Name).Combine(err)
+	}
+
+	// subvolume IDs are handed out in increasing order, so they give the
+	// order the snapshots were taken in, even within a second.
+	snaps := []snapshot{}
+
+	for _, fi := range fis {
+		if !isSubvolume(fi) {
+			continue
+		}
+
+		path := filepath.Join(snapDir, fi.Name())
+
+		id, err := subvolumeID(path, do.Timeout)
+		if err != nil {
+			return nil, err
+		}
+
+		created, err := subvolumeCreated(path, do.Timeout)
+		if err != nil {
+			return nil, err
+		}
+
+		snaps = append(snaps, snapshot{name: fi.Name(), id: id, created: created})
+	}
+
+	sort.Sort(bySubvolumeID(snaps))
+
+	for _, snap := range snaps {
+		result = append(result, storage.Snapshot{Name: snap.name, Created: snap.created})
+	}
+
+	return result, nil
+}
+
+// CopySnapshot copies a snapshot into a new volume. Takes a DriverOptions,
+// snap and volume name (string). Returns error on failure.
+func (d *Driver) CopySnapshot(do storage.DriverOptions, snapName, newName string) error {
+	if err := storage.CheckHost(do.Volume); err != nil {
+		return err
+	}
+
+	subvol, err := d.subvolumePath(do.Volume)
+	if err != nil {
+		return err
+	}
+
+	snapPath, err := d.snapshotPath(snapName, do.Volume)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(snapPath); err != nil {
+		return errored.Errorf("Snapshot %q (volume %q) could not be found", snapName, do.Volume.Name).Combine(errors.SnapshotCopy).Combine(err)
+	}
+
+	newSubvol, err := d.subvolumePath(storage.Volume{Name: newName, Params: do.Volume.Params})
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(newSubvol); err == nil {
+		return errored.Errorf("Volume %q already exists", newName).Combine(errors.Exists)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(newSubvol), 0700); err != nil {
+		return errored.Errorf("Creating policy directory for %q", newName).Combine(err)
+	}
+
+	if _, err := storage.RunCommand(exec.Command("btrfs", "subvolume", "snapshot", snapPath, newSubvol), do.Timeout); err != nil {
+		return errored.Errorf("Copying snapshot %q (volume %q) to %q", snapName, do.Volume.Name, newName).Combine(errors.SnapshotCopy).Combine(err)
+	}
+
+	// the copy is as large as the volume it came from.
+	limit, err := getLimit(subvol, do.Timeout)
+	if err == nil {
+		err = setLimit(do.Volume.Params["path"], newSubvol, limit, do.Timeout)
+	}
+
+	if err != nil {
+		return errored.Errorf("Sizing copy %q of snapshot %q (volume %q)", newName, snapName, do.Volume.Name).Combine(errors.SnapshotCopy).Combine(err)
+	}
+
+	return nil
+}
+
+// Export writes a tar archive of the snapshot of the volume to w.
+func (d *Driver) Export(do storage.DriverOptions, snapName string, w io.Writer) error {
+	if err := storage.CheckHost(do.Volume); err != nil {
+		return err
+	}
+
+	snapPath, err := d.snapshotPath(snapName, do.Volume)
+	if err != nil {
+		return err
+	}
+
+	if err := storage.ArchiveDirectory(snapPath, w, do.Timeout); err != nil {
+		return errored.Errorf("Exporting snapshot %q (volume %q)", snapName, do.Volume.Name).Combine(err)
+	}
+
+	return nil
+}
+
+// Import creates the volume and extracts a tar archive written by Export into
+// it.
+func (d *Driver) Import(do storage.DriverOptions, r io.Reader) error {
+	subvol, err := d.subvolumePath(do.Volume)
+	if err != nil {
+		return err
+	}
+
+	if err := d.Create(do); err != nil {
+		return err
+	}
+
+	if err := storage.ExtractArchive(subvol, r, do.Timeout); err != nil {
+		if err := d.Destroy(do); err != nil {
+			logrus.Errorf("Error cleaning up failed import of volume %q: %v", do.Volume.Name, err)
+		}
+
+		return errored.Errorf("Importing volume %q", do.Volume.Name).Combine(err)
+	}
+
+	return nil
+}
+
+// Validate validates the driver options to ensure they are compatible with the
+// btrfs storage driver.
+func (d *Driver) Validate(do *storage.DriverOptions) error {
+	// XXX check this first to guard against nil pointers ahead of time.
+	if err := do.Validate(); err != nil {
+		return err
+	}
+
+	path := do.Volume.Params["path"]
+
+	if path == "" {
+		return errored.Errorf("Path is missing in btrfs storage driver.")
+	}
+
+	if !filepath.IsAbs(path) {
+		return errored.Errorf("Path %q must be absolute in btrfs storage driver.", path)
+	}
+
+	return nil
+}
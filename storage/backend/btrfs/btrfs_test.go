@@ -0,0 +1,331 @@
+package btrfs
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	. "testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/contiv/volplugin/storage"
+	"github.com/contiv/volplugin/storage/mountscan"
+)
+
+const myMountpath = "/mnt"
+
+type btrfsSuite struct {
+	imageFile string
+	fsPath    string
+}
+
+var _ = Suite(&btrfsSuite{})
+
+func TestBtrfs(t *T) { TestingT(t) }
+
+func (s *btrfsSuite) driverOpts(name string) storage.DriverOptions {
+	return storage.DriverOptions{
+		Volume: storage.Volume{
+			Name:   name,
+			Size:   100,
+			Params: storage.Params{"path": s.fsPath},
+		},
+		Timeout: 30 * time.Second,
+	}
+}
+
+func run(c *C, name string, args ...string) string {
+	out, err := exec.Command(name, args...).CombinedOutput()
+	c.Assert(err, IsNil, Commentf("%s %v: %s", name, args, out))
+	return strings.TrimSpace(string(out))
+}
+
+// SetUpSuite builds and mounts a btrfs filesystem on top of a file, if btrfs
+// is available on this host.
+func (s *btrfsSuite) SetUpSuite(c *C) {
+	s.fsPath = "/volplugin-btrfs"
+
+	if _, err := exec.LookPath("mkfs.btrfs"); err != nil || os.Getuid() != 0 {
+		return
+	}
+
+	f, err := ioutil.TempFile("", "volplugin-btrfs")
+	c.Assert(err, IsNil)
+	c.Assert(f.Truncate(1024*1024*1024), IsNil)
+	c.Assert(f.Close(), IsNil)
+
+	s.imageFile = f.Name()
+	run(c, "mkfs.btrfs", "-f", s.imageFile)
+	c.Assert(os.MkdirAll(s.fsPath, 0700), IsNil)
+	run(c, "mount", "-o", "loop", s.imageFile, s.fsPath)
+}
+
+func (s *btrfsSuite) TearDownSuite(c *C) {
+	if s.imageFile == "" {
+		return
+	}
+
+	run(c, "umount", s.fsPath)
+	c.Assert(os.Remove(s.fsPath), IsNil)
+	c.Assert(os.Remove(s.imageFile), IsNil)
+}
+
+func (s *btrfsSuite) requireBtrfs(c *C) {
+	if s.imageFile == "" {
+		c.Skip("btrfs and root privileges are required for this test")
+	}
+}
+
+func (s *btrfsSuite) TestParseQgroupLimit(c *C) {
+	output := `qgroupid         rfer         excl     max_rfer
+--------         ----         ----     --------
+0/5              16384        16384         none
+0/257            16384        16384    104857600
+`
+
+	limit, err := parseQgroupLimit(output, "0/257")
+	c.Assert(err, IsNil)
+	c.Assert(limit, Equals, "104857600")
+
+	limit, err = parseQgroupLimit(output, "0/5")
+	c.Assert(err, IsNil)
+	c.Assert(limit, Equals, "none")
+
+	_, err = parseQgroupLimit(output, "0/258")
+	c.Assert(err, NotNil)
+
+	_, err = parseQgroupLimit("0/257            16384        16384    104857600", "0/257")
+	c.Assert(err, NotNil)
+}
+
+func (s *btrfsSuite) TestParseCreationTime(c *C) {
+	output := `policy1/test
+	Name: 			test
+	UUID: 			0f1e2d3c-4b5a-6978-8796-a5b4c3d2e1f0
+	Creation time: 		2017-01-02 15:04:05 +0100
+	Subvolume ID: 		257
+`
+
+	created, err := parseCreationTime(output)
+	c.Assert(err, IsNil)
+	c.Assert(created.Equal(time.Date(2017, 1, 2, 14, 4, 5, 0, time.UTC)), Equals, true)
+
+	_, err = parseCreationTime("policy1/test\n\tCreation time: \t\t-\n")
+	c.Assert(err, NotNil)
+	_, err = parseCreationTime("")
+	c.Assert(err, NotNil)
+}
+
+func (s *btrfsSuite) TestHostPath(c *C) {
+	base := &mountscan.MountInfo{Root: "/", MountPoint: "/volplugin-btrfs", MountSource: "/dev/loop0"}
+	other := &mountscan.MountInfo{Root: "/", MountPoint: "/other", MountSource: "/dev/sda1"}
+	vol := &mountscan.MountInfo{Root: "/policy1/test", MountPoint: "/mnt/btrfs/policy1/test", MountSource: "/dev/loop0"}
+
+	c.Assert(hostPath(vol, []*mountscan.MountInfo{other, vol, base}), Equals, "/volplugin-btrfs/policy1/test")
+	c.Assert(hostPath(vol, []*mountscan.MountInfo{other, vol}), Equals, "")
+
+	sub := &mountscan.MountInfo{Root: "/data", MountPoint: "/data", MountSource: "/dev/loop0"}
+	vol.Root = "/data/policy1/test"
+	c.Assert(hostPath(vol, []*mountscan.MountInfo{vol, sub}), Equals, "/data/policy1/test")
+}
+
+func (s *btrfsSuite) TestPaths(c *C) {
+	d := &Driver{mountpath: myMountpath}
+	do := s.driverOpts("policy1/test")
+
+	subvol, err := d.subvolumePath(do.Volume)
+	c.Assert(err, IsNil)
+	c.Assert(subvol, Equals, "/volplugin-btrfs/policy1/test")
+
+	snap, err := d.snapshotPath("snap", do.Volume)
+	c.Assert(err, IsNil)
+	c.Assert(snap, Equals, "/volplugin-btrfs/policy1/test.snapshots/snap")
+
+	_, err = d.snapshotPath("../test", do.Volume)
+	c.Assert(err, NotNil)
+
+	mp, err := d.MountPath(do)
+	c.Assert(err, IsNil)
+	c.Assert(mp, Equals, "/mnt/btrfs/policy1/test")
+}
+
+func (s *btrfsSuite) TestValidate(c *C) {
+	d := &Driver{}
+	do := s.driverOpts("policy1/test")
+	c.Assert(d.Validate(&do), IsNil)
+
+	do.Volume.Params["path"] = "relative"
+	c.Assert(d.Validate(&do), NotNil)
+
+	do.Volume.Params["path"] = ""
+	c.Assert(d.Validate(&do), NotNil)
+}
+
+func (s *btrfsSuite) TestCRUD(c *C) {
+	s.requireBtrfs(c)
+
+	d := &Driver{}
+	do := s.driverOpts("policy1/test")
+
+	c.Assert(d.Create(do), IsNil)
+	c.Assert(d.Create(do), Equals, storage.ErrVolumeExist)
+	c.Assert(d.Format(do), IsNil)
+
+	subvol, err := d.subvolumePath(do.Volume)
+	c.Assert(err, IsNil)
+	limit, err := getLimit(subvol, do.Timeout)
+	c.Assert(err, IsNil)
+	c.Assert(limit, Equals, "104857600")
+
+	host, err := os.Hostname()
+	c.Assert(err, IsNil)
+	c.Assert(do.Volume.Params[storage.HostParam], Equals, host)
+
+	list, err := d.List(storage.ListOptions{Params: do.Volume.Params})
+	c.Assert(err, IsNil)
+	c.Assert(list, DeepEquals, []storage.Volume{{Name: "policy1/test", Params: storage.Params{"path": s.fsPath, storage.HostParam: host}}})
+
+	// other hosts cannot reach the filesystem.
+	storage.Hostname = func() (string, error) { return "host2", nil }
+	err = d.Destroy(do)
+	exists, existsErr := d.Exists(do)
+	storage.Hostname = os.Hostname
+	c.Assert(err, ErrorMatches, `.*belongs to host.*`)
+	c.Assert(existsErr, IsNil)
+	c.Assert(exists, Equals, true)
+
+	c.Assert(d.Destroy(do), IsNil)
+
+	exists, err = d.Exists(do)
+	c.Assert(err, IsNil)
+	c.Assert(exists, Equals, false)
+}
+
+func (s *btrfsSuite) TestSnapshots(c *C) {
+	s.requireBtrfs(c)
+
+	d := &Driver{}
+	do := s.driverOpts("policy1/test")
+
+	c.Assert(d.Create(do), IsNil)
+	c.Assert(d.CreateSnapshot("test snap", do), IsNil)
+	c.Assert(d.CreateSnapshot("a-later-snap", do), IsNil)
+
+	list, err := d.ListSnapshots(do)
+	c.Assert(err, IsNil)
+	c.Assert(storage.SnapshotNames(list), DeepEquals, []string{"test-snap", "a-later-snap"})
+	c.Assert(list[0].Created.IsZero(), Equals, false)
+
+	// snapshots must not show up as volumes.
+	volumes, err := d.List(storage.ListOptions{Params: do.Volume.Params})
+	c.Assert(err, IsNil)
+	c.Assert(len(volumes), Equals, 1)
+
+	c.Assert(d.CopySnapshot(do, "test-snap", "policy1/copy"), IsNil)
+	c.Assert(d.CopySnapshot(do, "test-snap", "policy1/copy"), NotNil)
+	c.Assert(d.CopySnapshot(do, "nonexistent", "policy1/copy2"), NotNil)
+
+	copyDO := s.driverOpts("policy1/copy")
+	newSubvol, err := d.subvolumePath(copyDO.Volume)
+	c.Assert(err, IsNil)
+
+	// the copy must be writable, and as large as the original.
+	c.Assert(ioutil.WriteFile(filepath.Join(newSubvol, "test.txt"), []byte("Test string\n"), 0644), IsNil)
+	limit, err := getLimit(newSubvol, do.Timeout)
+	c.Assert(err, IsNil)
+	c.Assert(limit, Equals, "104857600")
+
+	// rolling back discards what was written since the snapshot, but keeps
+	// the later snapshots and the size.
+	subvol, err := d.subvolumePath(do.Volume)
+	c.Assert(err, IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(subvol, "test.txt"), []byte("Test string\n"), 0644), IsNil)
+	c.Assert(d.RollbackSnapshot("test-snap", do), IsNil)
+	c.Assert(d.RollbackSnapshot("nonexistent", do), NotNil)
+
+	_, err = os.Stat(filepath.Join(subvol, "test.txt"))
+	c.Assert(os.IsNotExist(err), Equals, true)
+	limit, err = getLimit(subvol, do.Timeout)
+	c.Assert(err, IsNil)
+	c.Assert(limit, Equals, "104857600")
+
+	list, err = d.ListSnapshots(do)
+	c.Assert(err, IsNil)
+	c.Assert(storage.SnapshotNames(list), DeepEquals, []string{"test-snap", "a-later-snap"})
+
+	c.Assert(d.RemoveSnapshot("test-snap", do), IsNil)
+	list, err = d.ListSnapshots(do)
+	c.Assert(err, IsNil)
+	c.Assert(storage.SnapshotNames(list), DeepEquals, []string{"a-later-snap"})
+
+	c.Assert(d.Destroy(do), IsNil)
+	c.Assert(d.Destroy(copyDO), IsNil)
+}
+
+func (s *btrfsSuite) TestExportImport(c *C) {
+	s.requireBtrfs(c)
+
+	d := &Driver{}
+	do := s.driverOpts("policy1/test")
+
+	c.Assert(d.Create(do), IsNil)
+	subvol, err := d.subvolumePath(do.Volume)
+	c.Assert(err, IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(subvol, "test.txt"), []byte("Test string\n"), 0644), IsNil)
+	c.Assert(d.CreateSnapshot("snap", do), IsNil)
+
+	buf := &bytes.Buffer{}
+	c.Assert(d.Export(do, "snap", buf), IsNil)
+	c.Assert(d.Export(do, "nonexistent", &bytes.Buffer{}), NotNil)
+
+	newDo := s.driverOpts("policy1/imported")
+	c.Assert(d.Import(newDo, bytes.NewReader(buf.Bytes())), IsNil)
+	c.Assert(d.Import(newDo, bytes.NewReader(buf.Bytes())), Equals, storage.ErrVolumeExist)
+
+	newSubvol, err := d.subvolumePath(newDo.Volume)
+	c.Assert(err, IsNil)
+	content, err := ioutil.ReadFile(filepath.Join(newSubvol, "test.txt"))
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Equals, "Test string\n")
+
+	c.Assert(d.Destroy(do), IsNil)
+	c.Assert(d.Destroy(newDo), IsNil)
+}
+
+func (s *btrfsSuite) TestMountUnmount(c *C) {
+	s.requireBtrfs(c)
+
+	crud, err := NewCRUDDriver()
+	c.Assert(err, IsNil)
+	mountD, err := NewMountDriver(myMountpath)
+	c.Assert(err, IsNil)
+
+	do := s.driverOpts("policy1/test")
+
+	c.Assert(crud.Create(do), IsNil)
+	c.Assert(crud.Format(do), IsNil)
+
+	mount, err := mountD.Mount(do)
+	c.Assert(err, IsNil)
+	c.Assert(mount.Path, Equals, "/mnt/btrfs/policy1/test")
+
+	mounts, err := mountD.Mounted(do.Timeout)
+	c.Assert(err, IsNil)
+	c.Assert(len(mounts), Equals, 1)
+	c.Assert(mounts[0].Volume.Name, Equals, "policy1/test")
+	c.Assert(mounts[0].Volume.Params, DeepEquals, do.Volume.Params)
+	c.Assert(mounts[0].DevMajor, Equals, mount.DevMajor)
+	c.Assert(mounts[0].DevMinor, Equals, mount.DevMinor)
+
+	c.Assert(mountD.Unmount(do), IsNil)
+
+	mounts, err = mountD.Mounted(do.Timeout)
+	c.Assert(err, IsNil)
+	c.Assert(len(mounts), Equals, 0)
+
+	c.Assert(crud.Destroy(do), IsNil)
+}
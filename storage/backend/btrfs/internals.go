@@ -0,0 +1,129 @@
+package btrfs
+
+import (
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/storage"
+)
+
+// subvolumeID returns the ID of the subvolume at path.
+func subvolumeID(path string, timeout time.Duration) (uint64, error) {
+	out, err := storage.RunCommand(exec.Command("btrfs", "inspect-internal", "rootid", path), timeout)
+	if err != nil {
+		return 0, errored.Errorf("Looking up subvolume ID of %q", path).Combine(err)
+	}
+
+	id, err := strconv.ParseUint(strings.TrimSpace(out), 10, 64)
+	if err != nil {
+		return 0, errored.Errorf("Invalid subvolume ID %q for %q", strings.TrimSpace(out), path).Combine(err)
+	}
+
+	return id, nil
+}
+
+// subvolumeCreated returns the time the subvolume at path was created.
+func subvolumeCreated(path string, timeout time.Duration) (time.Time, error) {
+	out, err := storage.RunCommand(exec.Command("btrfs", "subvolume", "show", path), timeout)
+	if err != nil {
+		return time.Time{}, errored.Errorf("Showing subvolume %q", path).Combine(err)
+	}
+
+	return parseCreationTime(out)
+}
+
+// parseCreationTime parses the output of `btrfs subvolume show` for the
+// creation time of the subvolume. Output looks like:
+//
+//	policy1/test
+//		Name:			test
+//		UUID:			0f1e2d3c-4b5a-6978-8796-a5b4c3d2e1f0
+//		Creation time:		2017-01-02 15:04:05 +0000
+//		Subvolume ID:		257
+func parseCreationTime(output string) (time.Time, error) {
+	for _, line := range strings.Split(output, "\n") {
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) != "Creation time" {
+			continue
+		}
+
+		created, err := time.Parse("2006-01-02 15:04:05 -0700", strings.TrimSpace(parts[1]))
+		if err != nil {
+			return time.Time{}, errored.Errorf("Invalid creation time %q in subvolume output", strings.TrimSpace(parts[1])).Combine(err)
+		}
+
+		return created, nil
+	}
+
+	return time.Time{}, errored.Errorf("Creation time not found in subvolume output")
+}
+
+// setLimit limits the space the subvolume may refer to. Quotas are enabled on
+// the filesystem at root if they are not already.
+func setLimit(root, subvol, limit string, timeout time.Duration) error {
+	if _, err := storage.RunCommand(exec.Command("btrfs", "quota", "enable", root), timeout); err != nil {
+		return errored.Errorf("Enabling quotas on %q", root).Combine(err)
+	}
+
+	if _, err := storage.RunCommand(exec.Command("btrfs", "qgroup", "limit", limit, subvol), timeout); err != nil {
+		return errored.Errorf("Limiting %q to %s", subvol, limit).Combine(err)
+	}
+
+	return nil
+}
+
+// getLimit returns the limit set on the subvolume, in bytes, or `none`.
+func getLimit(subvol string, timeout time.Duration) (string, error) {
+	id, err := subvolumeID(subvol, timeout)
+	if err != nil {
+		return "", err
+	}
+
+	out, err := storage.RunCommand(exec.Command("btrfs", "qgroup", "show", "-r", "--raw", "-f", subvol), timeout)
+	if err != nil {
+		return "", errored.Errorf("Showing qgroups of %q", subvol).Combine(err)
+	}
+
+	return parseQgroupLimit(out, "0/"+strconv.FormatUint(id, 10))
+}
+
+// parseQgroupLimit parses the output of `btrfs qgroup show -r --raw` for the
+// referenced-space limit of the qgroup. Output looks like:
+//
+//	qgroupid         rfer         excl     max_rfer
+//	--------         ----         ----     --------
+//	0/257           16384        16384    104857600
+func parseQgroupLimit(output, qgroupID string) (string, error) {
+	column := -1
+
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		if fields[0] == "qgroupid" {
+			for i, field := range fields {
+				if field == "max_rfer" {
+					column = i
+				}
+			}
+			continue
+		}
+
+		if fields[0] != qgroupID {
+			continue
+		}
+
+		if column < 0 || column >= len(fields) {
+			return "", errored.Errorf("Could not find the limit of qgroup %q in qgroup output", qgroupID)
+		}
+
+		return fields[column], nil
+	}
+
+	return "", errored.Errorf("Qgroup %q not found in qgroup output", qgroupID)
+}
@@ -0,0 +1,183 @@
+package btrfs
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/storage"
+	"github.com/contiv/volplugin/storage/mountscan"
+)
+
+// mountRoot is the directory under the mountpath that all btrfs volumes are
+// mounted in. Keeping them apart allows Mounted() to tell them from other
+// btrfs mounts on the host.
+func (d *Driver) mountRoot() string {
+	return filepath.Join(d.mountpath, BackendName)
+}
+
+func (d *Driver) mkMountPath(volName string) (string, error) {
+	policy, name, err := storage.SplitName(volName)
+	if err != nil {
+		return "", err
+	}
+
+	// Directory to mount the volume
+	volumePath := filepath.Join(d.mountRoot(), policy, name)
+	rel, err := filepath.Rel(d.mountRoot(), volumePath)
+	if err != nil || strings.Contains(rel, "..") {
+		return "", errors.MountFailed.Combine(errored.Errorf("Calculated volume path would escape subdir jail: %v", volumePath))
+	}
+
+	return volumePath, nil
+}
+
+// MountPath returns the path of a mount for a policy/volume.
+func (d *Driver) MountPath(do storage.DriverOptions) (string, error) {
+	return d.mkMountPath(do.Volume.Name)
+}
+
+// Mount a volume. Returns the mount information about the volume. The
+// subvolume is bind mounted into the mount path. Volumes belonging to other
+// hosts are refused.
+func (d *Driver) Mount(do storage.DriverOptions) (*storage.Mount, error) {
+	if err := storage.CheckHost(do.Volume); err != nil {
+		return nil, errors.MountFailed.Combine(err)
+	}
+
+	subvol, err := d.subvolumePath(do.Volume)
+	if err != nil {
+		return nil, err
+	}
+
+	volumePath, err := d.mkMountPath(do.Volume.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(volumePath, 0700); err != nil && !os.IsExist(err) {
+		return nil, errored.Errorf("error creating %q directory: %v", volumePath, err)
+	}
+
+	// Every subvolume has its own anonymous device number, which is what
+	// mountinfo reports for the mount as well.
+	fi, err := os.Stat(subvol)
+	if err != nil {
+		return nil, errored.Errorf("Failed to stat subvolume %q: %v", subvol, err)
+	}
+
+	major, minor := storage.DevNumbers(fi.Sys().(*syscall.Stat_t).Dev)
+
+	if err := unix.Mount(subvol, volumePath, "", unix.MS_BIND, ""); err != nil {
+		return nil, errored.Errorf("Failed to bind mount subvolume %q: %v", subvol, err)
+	}
+
+	return &storage.Mount{
+		Device:   subvol,
+		Path:     volumePath,
+		Volume:   do.Volume,
+		DevMajor: major,
+		DevMinor: minor,
+	}, nil
+}
+
+// Unmount a volume.
+func (d *Driver) Unmount(do storage.DriverOptions) error {
+	volumeDir, err := d.mkMountPath(do.Volume.Name)
+	if err != nil {
+		return err
+	}
+
+	var retries int
+	var lastErr error
+
+retry:
+	if retries < 3 {
+		if err := unix.Unmount(volumeDir, 0); err != nil && err != unix.ENOENT && err != unix.EINVAL {
+			lastErr = errored.Errorf("Failed to unmount %q (retrying): %v", volumeDir, err)
+			logrus.Error(lastErr)
+			retries++
+			time.Sleep(100 * time.Millisecond)
+			goto retry
+		}
+	} else {
+		return errored.Errorf("Failed to umount after 3 retries").Combine(lastErr)
+	}
+
+	if err := os.Remove(volumeDir); err != nil && !os.IsNotExist(err) {
+		logrus.Error(errored.Errorf("error removing %q directory: %v", volumeDir, err))
+	}
+
+	return nil
+}
+
+// hostPath finds where the subvolume mounted by volMount lives on the host,
+// by looking for another mount of the same filesystem which contains it.
+func hostPath(volMount *mountscan.MountInfo, hostMounts []*mountscan.MountInfo) string {
+	for _, hostMount := range hostMounts {
+		if hostMount == volMount || hostMount.MountSource != volMount.MountSource {
+			continue
+		}
+
+		rel, err := filepath.Rel(hostMount.Root, volMount.Root)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+
+		return filepath.Join(hostMount.MountPoint, rel)
+	}
+
+	return ""
+}
+
+// Mounted shows any volumes that belong to volplugin on the host, in
+// their native representation. They yield a *Mount.
+func (d *Driver) Mounted(timeout time.Duration) ([]*storage.Mount, error) {
+	mounts := []*storage.Mount{}
+
+	hostMounts, err := mountscan.GetMounts(&mountscan.GetMountsRequest{DriverName: BackendName, FsType: BackendName})
+	if err != nil {
+		return nil, err
+	}
+
+	host, err := storage.Hostname()
+	if err != nil {
+		return nil, errored.Errorf("Could not determine hostname").Combine(err)
+	}
+
+	for _, hostMount := range hostMounts {
+		rel, err := filepath.Rel(d.mountRoot(), hostMount.MountPoint)
+		if err != nil || strings.HasPrefix(rel, "..") || len(strings.Split(rel, "/")) != 2 {
+			// not one of ours.
+			continue
+		}
+
+		params := storage.Params{storage.HostParam: host}
+
+		if subvol := hostPath(hostMount, hostMounts); subvol != "" {
+			params["path"] = filepath.Dir(filepath.Dir(subvol))
+		} else {
+			logrus.Errorf("Could not determine the subvolume mounted at %q", hostMount.MountPoint)
+		}
+
+		mounts = append(mounts, &storage.Mount{
+			Device:   hostMount.MountSource,
+			DevMajor: hostMount.DeviceNumber.Major,
+			DevMinor: hostMount.DeviceNumber.Minor,
+			Path:     hostMount.MountPoint,
+			Volume: storage.Volume{
+				Name:   rel,
+				Params: params,
+			},
+		})
+	}
+
+	return mounts, nil
+}
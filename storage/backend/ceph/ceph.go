@@ -3,10 +3,10 @@ package ceph
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"regexp"
 	"strconv"
 	"strings"
 	"syscall"
@@ -28,8 +28,6 @@ const (
 	BackendName = "ceph"
 )
 
-var spaceSplitRegex = regexp.MustCompile(`\s+`)
-
 // Driver implements a ceph backed storage driver for volplugin.
 //
 // -- Pool naming
@@ -38,6 +36,20 @@ var spaceSplitRegex = regexp.MustCompile(`\s+`)
 // work. Therefore, if no pool is specified, the best error condition will be
 // raised.
 //
+// -- Image layout
+//
+// `features` is a comma-separated list of image features to enable instead of
+// the defaults of the cluster; layering must be among them. `object-size`,
+// `stripe-unit` and `stripe-count` set the layout of the objects, and
+// `data-pool` keeps the data of the image in another pool, such as an
+// erasure-coded one.
+//
+// -- Clusters
+//
+// The `cluster`, `conf`, `user` and `keyring` options select the cluster and
+// credentials every rbd command runs with, so policies can keep their volumes
+// on different clusters. They default to those of rbd.
+//
 type Driver struct {
 	mountpath string
 }
@@ -53,6 +65,22 @@ func (c *Driver) mkMountPath(poolName, intName string) (string, error) {
 	return volumePath, nil
 }
 
+// mountedVolumeName returns the name of the volume mounted at the mount point
+// made by mkMountPath.
+func (c *Driver) mountedVolumeName(mountPoint string) (string, bool) {
+	rel, err := filepath.Rel(c.mountpath, mountPoint)
+	if err != nil {
+		return "", false
+	}
+
+	parts := strings.Split(rel, "/")
+	if len(parts) != 2 || parts[0] == ".." || !strings.Contains(parts[1], ".") {
+		return "", false
+	}
+
+	return c.externalName(parts[1]), true
+}
+
 func mkpool(poolName, volumeName string) string {
 	return fmt.Sprintf("%s/%s", poolName, volumeName)
 }
@@ -108,14 +136,30 @@ func (c *Driver) internalName(s string) (string, error) {
 	return strings.Join(strs, "."), nil
 }
 
+// imageName returns the name of the image of the volume: the image it was
+// adopted from if it was, or its internal name.
+func (c *Driver) imageName(volume storage.Volume) (string, error) {
+	if image := volume.Params[storage.ImageParam]; image != "" {
+		return image, nil
+	}
+
+	return c.internalName(volume.Name)
+}
+
 // Create a volume.
 func (c *Driver) Create(do storage.DriverOptions) error {
-	intName, err := c.internalName(do.Volume.Name)
+	intName, err := c.imageName(do.Volume)
 	if err != nil {
 		return err
 	}
 
-	cmd := exec.Command("rbd", "create", mkpool(do.Volume.Params["pool"], intName), "--size", strconv.FormatUint(do.Volume.Size, 10))
+	layout, err := layoutArgs(do.Volume.Params)
+	if err != nil {
+		return err
+	}
+
+	args := append([]string{"create", mkpool(do.Volume.Params["pool"], intName), "--size", strconv.FormatUint(do.Volume.Size, 10)}, layout...)
+	cmd := rbdCommand(do.Volume.Params, args...)
 	er, err := runWithTimeout(cmd, do.Timeout)
 
 	if er != nil {
@@ -138,31 +182,43 @@ func (c *Driver) Format(do storage.DriverOptions) error {
 		return err
 	}
 
-	if err := c.mkfsVolume(do.FSOptions.CreateCommand, device, do.Timeout); err != nil {
+	fsDevice, err := storage.FormatCrypt(do.Volume.Name, device, do.Encryption, do.Timeout)
+	if err == nil {
+		err = c.mkfsVolume(do.FSOptions.CreateCommand, fsDevice, do.Timeout)
+	}
+
+	if err != nil {
+		if err := storage.CloseCrypt(do.Volume.Name, do.Timeout); err != nil {
+			logrus.Errorf("Error while trying to close encrypted device after failed filesystem creation: %v", err)
+		}
 		if err := c.unmapImage(do); err != nil {
 			logrus.Errorf("Error while trying to unmap after failed filesystem creation: %v", err)
 		}
 		return err
 	}
 
+	if err := storage.CloseCrypt(do.Volume.Name, do.Timeout); err != nil {
+		return err
+	}
+
 	return c.unmapImage(do)
 }
 
 // Destroy a volume.
 func (c *Driver) Destroy(do storage.DriverOptions) error {
 	poolName := do.Volume.Params["pool"]
-	intName, err := c.internalName(do.Volume.Name)
+	intName, err := c.imageName(do.Volume)
 	if err != nil {
 		return err
 	}
 
-	cmd := exec.Command("rbd", "snap", "purge", mkpool(poolName, intName))
+	cmd := rbdCommand(do.Volume.Params, "snap", "purge", mkpool(poolName, intName))
 	er, _ := runWithTimeout(cmd, do.Timeout)
 	if er.ExitStatus != 0 {
 		return errored.Errorf("Destroying snapshots for disk %q: %v", intName, er.Stderr)
 	}
 
-	cmd = exec.Command("rbd", "rm", mkpool(poolName, intName))
+	cmd = rbdCommand(do.Volume.Params, "rm", mkpool(poolName, intName))
 	er, _ = runWithTimeout(cmd, do.Timeout)
 	if er.ExitStatus != 0 {
 		return errored.Errorf("Destroying disk %q: %v (%v)", intName, er, er.Stdout)
@@ -171,12 +227,91 @@ func (c *Driver) Destroy(do storage.DriverOptions) error {
 	return nil
 }
 
-// List all volumes.
-func (c *Driver) List(lo storage.ListOptions) ([]storage.Volume, error) {
+// Rename renames the image with `rbd mv`. The image stays in its pool, and
+// keeps its snapshots and their clones.
+func (c *Driver) Rename(do storage.DriverOptions, newName string) error {
+	// the image of an adopted volume keeps its name, which moves along with
+	// the parameters of the volume.
+	if do.Volume.Params[storage.ImageParam] != "" {
+		return nil
+	}
+
+	intName, err := c.imageName(do.Volume)
+	if err != nil {
+		return err
+	}
+
+	intNewName, err := c.internalName(newName)
+	if err != nil {
+		return err
+	}
+
+	return c.moveImage(do, intName, intNewName)
+}
+
+func (c *Driver) moveImage(do storage.DriverOptions, intName, intNewName string) error {
+	poolName := do.Volume.Params["pool"]
+
+	cmd := rbdCommand(do.Volume.Params, "mv", mkpool(poolName, intName), mkpool(poolName, intNewName))
+	er, err := runWithTimeout(cmd, do.Timeout)
+	if er != nil && er.ExitStatus != 0 {
+		return errored.Errorf("Renaming disk %q to %q: %v (%v)", intName, intNewName, er, strings.TrimSpace(er.Stderr))
+	} else if err != nil {
+		return errored.Errorf("Renaming disk %q to %q", intName, intNewName).Combine(err)
+	}
+
+	return nil
+}
+
+// Images lists the images in the pool, as pool/image.
+func (c *Driver) Images(lo storage.ListOptions) ([]string, error) {
 	poolName := lo.Params["pool"]
 
+	names, err := c.listImages(lo.Params)
+	if err != nil {
+		return nil, err
+	}
+
+	images := []string{}
+	for _, name := range names {
+		images = append(images, mkpool(poolName, name))
+	}
+
+	return images, nil
+}
+
+// VolumeImage returns the image of the volume, as pool/image.
+func (c *Driver) VolumeImage(volume storage.Volume) (string, error) {
+	intName, err := c.imageName(volume)
+	if err != nil {
+		return "", err
+	}
+
+	return mkpool(volume.Params["pool"], intName), nil
+}
+
+// FileSystem maps the image to probe it for a filesystem. The image must not
+// be mapped already.
+func (c *Driver) FileSystem(do storage.DriverOptions) (string, error) {
+	device, err := c.mapImage(do)
+	if err != nil {
+		return "", err
+	}
+
+	fsType, err := storage.FileSystemType(device, do.Timeout)
+
+	if err := c.unmapImage(do); err != nil {
+		logrus.Errorf("Error while trying to unmap after probing for a filesystem: %v", err)
+	}
+
+	return fsType, err
+}
+
+func (c *Driver) listImages(params storage.Params) ([]string, error) {
+	poolName := params["pool"]
+
 retry:
-	er, err := executor.NewCapture(exec.Command("rbd", "ls", poolName, "--format", "json")).Run(context.Background())
+	er, err := executor.NewCapture(rbdCommand(params, "ls", poolName, "--format", "json")).Run(context.Background())
 	if err != nil {
 		return nil, err
 	}
@@ -193,10 +328,29 @@ retry:
 		goto retry
 	}
 
+	return textList, nil
+}
+
+// List all volumes.
+func (c *Driver) List(lo storage.ListOptions) ([]storage.Volume, error) {
+	poolName := lo.Params["pool"]
+
+	textList, err := c.listImages(lo.Params)
+	if err != nil {
+		return nil, err
+	}
+
 	list := []storage.Volume{}
 
 	for _, name := range textList {
-		list = append(list, storage.Volume{Name: c.externalName(strings.TrimSpace(name)), Params: storage.Params{"pool": poolName}})
+		params := storage.Params{"pool": poolName}
+		for _, option := range clusterOptions {
+			if value := lo.Params[option.param]; value != "" {
+				params[option.param] = value
+			}
+		}
+
+		list = append(list, storage.Volume{Name: c.externalName(strings.TrimSpace(name)), Params: params})
 	}
 
 	return list, nil
@@ -205,7 +359,8 @@ retry:
 // Mount a volume. Returns the rbd device and mounted filesystem path.
 // If you pass in the params what filesystem to use as `filesystem`, it will
 // prefer that to `ext4` which is the default.
-func (c *Driver) Mount(do storage.DriverOptions) (*storage.Mount, error) {
+func (c *Driver) Mount(do storage.DriverOptions) (_ *storage.Mount, err error) {
+	// mount points are named after the volume, not its image.
 	intName, err := c.internalName(do.Volume.Name)
 	if err != nil {
 		return nil, err
@@ -223,6 +378,26 @@ func (c *Driver) Mount(do storage.DriverOptions) (*storage.Mount, error) {
 		return nil, err
 	}
 
+	// volumes which fail to mount are left closed and unmapped.
+	defer func() {
+		if err == nil {
+			return
+		}
+
+		if err := storage.CloseCrypt(do.Volume.Name, do.Timeout); err != nil {
+			logrus.Errorf("Error while trying to close encrypted device after failed mount: %v", err)
+		}
+		if err := c.unmapImage(do); err != nil {
+			logrus.Errorf("Error while trying to unmap after failed mount: %v", err)
+		}
+	}()
+
+	// encrypted volumes are mounted from the dm-crypt mapping of the device.
+	devName, err = storage.OpenCrypt(do.Volume.Name, devName, do.Encryption, do.Timeout)
+	if err != nil {
+		return nil, err
+	}
+
 	// Create directory to mount
 	if err := os.MkdirAll(c.mountpath, 0700); err != nil && !os.IsExist(err) {
 		return nil, errored.Errorf("error creating %q directory: %v", c.mountpath, err)
@@ -232,20 +407,23 @@ func (c *Driver) Mount(do storage.DriverOptions) (*storage.Mount, error) {
 		return nil, errored.Errorf("error creating %q directory: %v", volumePath, err)
 	}
 
+	check, err := c.checkFilesystem(do, devName)
+	if err != nil {
+		return nil, err
+	}
+
 	// Obtain the major and minor node information about the device we're mounting.
 	// This is critical for tuning cgroups and obtaining metrics for this device only.
 	fi, err := os.Stat(devName)
 	if err != nil {
-		return nil, errored.Errorf("Failed to stat rbd device %q: %v", devName, err)
+		return nil, errored.Errorf("Failed to stat device %q: %v", devName, err)
 	}
 
-	rdev := fi.Sys().(*syscall.Stat_t).Rdev
-
-	major := rdev >> 8
-	minor := rdev & 0xFF
+	major, minor := storage.DevNumbers(fi.Sys().(*syscall.Stat_t).Rdev)
 
 	// Mount the RBD
-	if err := unix.Mount(devName, volumePath, do.FSOptions.Type, 0, ""); err != nil {
+	flags, data := storage.ParseMountOptions(do.FSOptions.MountOptions)
+	if err := unix.Mount(devName, volumePath, do.FSOptions.Type, flags, data); err != nil {
 		return nil, errored.Errorf("Failed to mount RBD dev %q: %v", devName, err)
 	}
 
@@ -253,14 +431,54 @@ func (c *Driver) Mount(do storage.DriverOptions) (*storage.Mount, error) {
 		Device:   devName,
 		Path:     volumePath,
 		Volume:   do.Volume,
-		DevMajor: uint(major),
-		DevMinor: uint(minor),
+		DevMajor: major,
+		DevMinor: minor,
+		FSCheck:  check,
 	}, nil
 }
 
+// checkFilesystem checks the filesystem on the mapped device as requested by
+// the check mode of the options. The result is nil if no check was made.
+// Filesystems with errors which were not repaired yield an error, so they are
+// not mounted.
+func (c *Driver) checkFilesystem(do storage.DriverOptions, devName string) (*storage.FSCheck, error) {
+	mode := do.FSOptions.CheckMode
+	if mode == "" || mode == storage.FSCheckOff {
+		return nil, nil
+	}
+
+	repair := mode == storage.FSCheckRepair
+
+	cmd, err := fsckCommand(do.FSOptions.Type, devName, repair)
+	if err != nil {
+		logrus.Warnf("Not checking filesystem of volume %q: %v", do.Volume.Name, err)
+		return nil, nil
+	}
+
+	logrus.Infof("Checking filesystem of volume %q on %q (%s)", do.Volume.Name, devName, mode)
+
+	er, err := runWithTimeout(cmd, do.Timeout)
+	if _, ok := err.(*exec.ExitError); err != nil && !ok {
+		return nil, errored.Errorf("Could not check filesystem on %q: %v", devName, er).Combine(err)
+	}
+
+	check := &storage.FSCheck{
+		Mode:   mode,
+		Status: fsckStatus(do.FSOptions.Type, repair, er.ExitStatus),
+		Output: strings.TrimSpace(er.Stdout + er.Stderr),
+	}
+
+	if check.Status == storage.FSCheckFailed {
+		return nil, errors.FSCheck.Combine(errored.Errorf("%v: %v", er, check.Output))
+	}
+
+	return check, nil
+}
+
 // Unmount a volume.
 func (c *Driver) Unmount(do storage.DriverOptions) error {
 	poolName := do.Volume.Params["pool"]
+	// mount points are named after the volume, not its image.
 	intName, err := c.internalName(do.Volume.Name)
 	if err != nil {
 		return err
@@ -295,6 +513,10 @@ retry:
 		goto retry
 	}
 
+	if err := storage.CloseCrypt(do.Volume.Name, do.Timeout); err != nil {
+		return err
+	}
+
 	if err := c.unmapImage(do); err != os.ErrNotExist {
 		return err
 	}
@@ -304,13 +526,18 @@ retry:
 
 // Exists returns true if the volume already exists.
 func (c *Driver) Exists(do storage.DriverOptions) (bool, error) {
-	volumes, err := c.List(storage.ListOptions{Params: do.Volume.Params})
+	intName, err := c.imageName(do.Volume)
 	if err != nil {
 		return false, err
 	}
 
-	for _, vol := range volumes {
-		if vol.Name == do.Volume.Name {
+	images, err := c.listImages(do.Volume.Params)
+	if err != nil {
+		return false, err
+	}
+
+	for _, image := range images {
+		if strings.TrimSpace(image) == intName {
 			return true, nil
 		}
 	}
@@ -320,7 +547,7 @@ func (c *Driver) Exists(do storage.DriverOptions) (bool, error) {
 
 // CreateSnapshot creates a named snapshot for the volume. Any error will be returned.
 func (c *Driver) CreateSnapshot(snapName string, do storage.DriverOptions) error {
-	intName, err := c.internalName(do.Volume.Name)
+	intName, err := c.imageName(do.Volume)
 	if err != nil {
 		return err
 	}
@@ -328,7 +555,7 @@ func (c *Driver) CreateSnapshot(snapName string, do storage.DriverOptions) error
 	poolName := do.Volume.Params["pool"]
 
 	snapName = strings.Replace(snapName, " ", "-", -1)
-	cmd := exec.Command("rbd", "snap", "create", mkpool(poolName, intName), "--snap", snapName)
+	cmd := rbdCommand(do.Volume.Params, "snap", "create", mkpool(poolName, intName), "--snap", snapName)
 	er, err := runWithTimeout(cmd, do.Timeout)
 	if err != nil {
 		return err
@@ -343,14 +570,20 @@ func (c *Driver) CreateSnapshot(snapName string, do storage.DriverOptions) error
 
 // RemoveSnapshot removes a named snapshot for the volume. Any error will be returned.
 func (c *Driver) RemoveSnapshot(snapName string, do storage.DriverOptions) error {
-	intName, err := c.internalName(do.Volume.Name)
+	intName, err := c.imageName(do.Volume)
 	if err != nil {
 		return err
 	}
 
 	poolName := do.Volume.Params["pool"]
 
-	cmd := exec.Command("rbd", "snap", "rm", mkpool(poolName, intName), "--snap", snapName)
+	// snapshots copies were cloned from stay protected until the copies are
+	// flattened, or removed.
+	if err := unprotectUnused(do.Volume.Params, mkpool(poolName, intName), snapName, do.Timeout); err != nil {
+		return err
+	}
+
+	cmd := rbdCommand(do.Volume.Params, "snap", "rm", mkpool(poolName, intName), "--snap", snapName)
 	er, err := runWithTimeout(cmd, do.Timeout)
 	if err != nil {
 		return err
@@ -363,17 +596,36 @@ func (c *Driver) RemoveSnapshot(snapName string, do storage.DriverOptions) error
 	return nil
 }
 
-// ListSnapshots returns an array of snapshot names provided a maximum number
-// of snapshots to be returned. Any error will be returned.
-func (c *Driver) ListSnapshots(do storage.DriverOptions) ([]string, error) {
-	intName, err := c.internalName(do.Volume.Name)
+// RollbackSnapshot restores the image to the named snapshot with `rbd snap
+// rollback`. Later snapshots are kept.
+func (c *Driver) RollbackSnapshot(snapName string, do storage.DriverOptions) error {
+	intName, err := c.imageName(do.Volume)
+	if err != nil {
+		return err
+	}
+
+	cmd := rbdCommand(do.Volume.Params, "snap", "rollback", mkpool(do.Volume.Params["pool"], intName), "--snap", snapName)
+	er, err := runWithTimeout(cmd, do.Timeout)
+	if er != nil && er.ExitStatus != 0 {
+		return errored.Errorf("Rolling back volume %q to snapshot %q: %v (%v)", intName, snapName, er, strings.TrimSpace(er.Stderr))
+	} else if err != nil {
+		return errored.Errorf("Rolling back volume %q to snapshot %q", intName, snapName).Combine(err)
+	}
+
+	return nil
+}
+
+// ListSnapshots returns the snapshots of the volume, oldest first. Any error
+// will be returned.
+func (c *Driver) ListSnapshots(do storage.DriverOptions) ([]storage.Snapshot, error) {
+	intName, err := c.imageName(do.Volume)
 	if err != nil {
 		return nil, err
 	}
 
 	poolName := do.Volume.Params["pool"]
 
-	cmd := exec.Command("rbd", "snap", "ls", mkpool(poolName, intName))
+	cmd := rbdCommand(do.Volume.Params, "snap", "ls", "--format", "json", mkpool(poolName, intName))
 	ctx, _ := context.WithTimeout(context.Background(), do.Timeout)
 	er, err := executor.NewCapture(cmd).Run(ctx)
 	if err != nil {
@@ -384,25 +636,11 @@ func (c *Driver) ListSnapshots(do storage.DriverOptions) ([]string, error) {
 		return nil, errored.Errorf("Listing snapshots for (volume %q): %v", intName, er)
 	}
 
-	names := []string{}
-
-	lines := strings.Split(er.Stdout, "\n")
-	if len(lines) > 1 {
-		for _, line := range lines[1:] {
-			parts := spaceSplitRegex.Split(line, -1)
-			if len(parts) < 3 {
-				continue
-			}
-
-			names = append(names, parts[2])
-		}
-	}
-
-	return names, nil
+	return parseSnapshots(er.Stdout, intName)
 }
 
 func (c *Driver) cleanupCopy(snapName, newName string, do storage.DriverOptions, errChan chan error) {
-	intOrigName, err := c.internalName(do.Volume.Name)
+	intOrigName, err := c.imageName(do.Volume)
 	if err != nil {
 		logrus.Error(err)
 		return
@@ -421,7 +659,7 @@ func (c *Driver) cleanupCopy(snapName, newName string, do storage.DriverOptions,
 		newerr, ok := err.(*errored.Error)
 		if ok && newerr.Contains(errors.SnapshotCopy) {
 			logrus.Warnf("Error received while copying snapshot %q: %v. Attempting to cleanup... Snapshot %q may still be protected!", do.Volume.Name, err, snapName)
-			cmd := exec.Command("rbd", "rm", mkpool(poolName, intNewName))
+			cmd := rbdCommand(do.Volume.Params, "rm", mkpool(poolName, intNewName))
 			if er, err := runWithTimeout(cmd, do.Timeout); err != nil || er.ExitStatus != 0 {
 				logrus.Errorf("Error encountered removing new volume %q for volume %q, snapshot %q: %v, %v", intNewName, intOrigName, snapName, err, er.Stderr)
 				return
@@ -430,7 +668,7 @@ func (c *Driver) cleanupCopy(snapName, newName string, do storage.DriverOptions,
 
 		if ok && newerr.Contains(errors.SnapshotProtect) {
 			logrus.Warnf("Error received protecting snapshot %q: %v. Attempting to cleanup.", do.Volume.Name, err)
-			cmd := exec.Command("rbd", "snap", "unprotect", mkpool(poolName, intOrigName), "--snap", snapName)
+			cmd := rbdCommand(do.Volume.Params, "snap", "unprotect", mkpool(poolName, intOrigName), "--snap", snapName)
 			if er, err := runWithTimeout(cmd, do.Timeout); err != nil || er.ExitStatus != 0 {
 				logrus.Errorf("Error encountered unprotecting new volume %q for volume %q, snapshot %q: %v, %v", newName, intOrigName, snapName, err, er.Stderr)
 				return
@@ -443,7 +681,7 @@ func (c *Driver) cleanupCopy(snapName, newName string, do storage.DriverOptions,
 // CopySnapshot copies a snapshot into a new volume. Takes a DriverOptions,
 // snap and volume name (string). Returns error on failure.
 func (c *Driver) CopySnapshot(do storage.DriverOptions, snapName, newName string) error {
-	intOrigName, err := c.internalName(do.Volume.Name)
+	intOrigName, err := c.imageName(do.Volume)
 	if err != nil {
 		return err
 	}
@@ -455,16 +693,21 @@ func (c *Driver) CopySnapshot(do storage.DriverOptions, snapName, newName string
 
 	poolName := do.Volume.Params["pool"]
 
-	list, err := c.List(storage.ListOptions{Params: storage.Params{"pool": poolName}})
+	list, err := c.List(storage.ListOptions{Params: do.Volume.Params})
+	if err != nil {
+		return err
+	}
+
 	for _, vol := range list {
-		if intNewName == vol.Name {
+		// images not named after volumes cannot clash with the new one.
+		if volName, err := c.internalName(vol.Name); err == nil && volName == intNewName {
 			return errored.Errorf("Volume %q already exists", vol.Name)
 		}
 	}
 
 	errChan := make(chan error, 1)
 
-	cmd := exec.Command("rbd", "snap", "protect", mkpool(poolName, intOrigName), "--snap", snapName)
+	cmd := rbdCommand(do.Volume.Params, "snap", "protect", mkpool(poolName, intOrigName), "--snap", snapName)
 	er, err := runWithTimeout(cmd, do.Timeout)
 
 	// EBUSY indicates that the snapshot is already protected.
@@ -478,7 +721,7 @@ func (c *Driver) CopySnapshot(do storage.DriverOptions, snapName, newName string
 
 	defer c.cleanupCopy(snapName, newName, do, errChan)
 
-	cmd = exec.Command("rbd", "clone", mkpool(poolName, intOrigName), mkpool(poolName, intNewName), "--snap", snapName)
+	cmd = rbdCommand(do.Volume.Params, "clone", mkpool(poolName, intOrigName), mkpool(poolName, intNewName), "--snap", snapName)
 	er, err = runWithTimeout(cmd, do.Timeout)
 	if err != nil && er.ExitStatus == 0 {
 		var err2 *errored.Error
@@ -503,16 +746,278 @@ func (c *Driver) CopySnapshot(do storage.DriverOptions, snapName, newName string
 	return nil
 }
 
+// Flatten copies the data of the parent snapshot into a clone, so the clone
+// no longer depends on it. The parent snapshot is unprotected once it has no
+// clones left, so it can be removed.
+func (c *Driver) Flatten(do storage.DriverOptions, progress func(int)) error {
+	intName, err := c.imageName(do.Volume)
+	if err != nil {
+		return err
+	}
+
+	image := mkpool(do.Volume.Params["pool"], intName)
+
+	er, err := runWithTimeout(rbdCommand(do.Volume.Params, "info", image, "--format", "json"), do.Timeout)
+	if er != nil && er.ExitStatus != 0 {
+		return errored.Errorf("Retrieving parent of disk %q: %v (%v)", intName, er, strings.TrimSpace(er.Stderr))
+	} else if err != nil {
+		return errored.Errorf("Retrieving parent of disk %q", intName).Combine(err)
+	}
+
+	parent, err := parseParent(er.Stdout, intName)
+	if err != nil || parent == nil {
+		return err
+	}
+
+	cmd := rbdCommand(do.Volume.Params, "flatten", image)
+	e := executor.NewIO(cmd)
+	if err := e.Start(); err != nil {
+		return errored.Errorf("Could not run %v", cmd.Args).Combine(err)
+	}
+
+	outputChan := make(chan string, 1)
+	go func() { outputChan <- scanProgress(e.Err(), progress) }()
+
+	ctx, _ := context.WithTimeout(context.Background(), do.Timeout)
+	er, err = e.Wait(ctx)
+	output := <-outputChan
+
+	if er != nil && er.ExitStatus != 0 {
+		return errored.Errorf("Flattening disk %q: %v (%v)", intName, er, output).Combine(errors.Flatten)
+	} else if err != nil {
+		return errored.Errorf("Flattening disk %q", intName).Combine(err).Combine(errors.Flatten)
+	}
+
+	return unprotectUnused(do.Volume.Params, mkpool(parent.Pool, parent.Image), parent.Snapshot, do.Timeout)
+}
+
+// unprotectUnused unprotects the snapshot of the image, named pool/image, once
+// it has no clones left. Snapshots which are not protected are left alone.
+func unprotectUnused(params storage.Params, image, snapName string, timeout time.Duration) error {
+	er, err := runWithTimeout(rbdCommand(params, "children", image, "--snap", snapName, "--format", "json"), timeout)
+	if er != nil && er.ExitStatus != 0 {
+		return errored.Errorf("Listing clones of snapshot %q (volume %q): %v (%v)", snapName, image, er, strings.TrimSpace(er.Stderr))
+	} else if err != nil {
+		return errored.Errorf("Listing clones of snapshot %q (volume %q)", snapName, image).Combine(err)
+	}
+
+	children := []json.RawMessage{}
+	if err := json.Unmarshal([]byte(er.Stdout), &children); err != nil {
+		return errored.Errorf("Could not parse RBD children output for %q", image).Combine(err)
+	}
+
+	if len(children) > 0 {
+		return nil
+	}
+
+	// EINVAL indicates that the snapshot is not protected.
+	er, err = runWithTimeout(rbdCommand(params, "snap", "unprotect", image, "--snap", snapName), timeout)
+	if er != nil && er.ExitStatus != 0 && er.ExitStatus != int(unix.EINVAL) {
+		return errored.Errorf("Unprotecting snapshot %q (volume %q): %v (%v)", snapName, image, er, strings.TrimSpace(er.Stderr))
+	} else if er == nil && err != nil {
+		return errored.Errorf("Unprotecting snapshot %q (volume %q)", snapName, image).Combine(err)
+	}
+
+	return nil
+}
+
+// Export writes the snapshot of the volume to w, as `rbd export` does.
+func (c *Driver) Export(do storage.DriverOptions, snapName string, w io.Writer) error {
+	intName, err := c.imageName(do.Volume)
+	if err != nil {
+		return err
+	}
+
+	cmd := rbdCommand(do.Volume.Params, "export", mkpool(do.Volume.Params["pool"], intName)+"@"+snapName, "-")
+	if err := storage.RunStreaming(cmd, nil, w, do.Timeout); err != nil {
+		return errored.Errorf("Exporting snapshot %q (volume %q)", snapName, intName).Combine(err)
+	}
+
+	return nil
+}
+
+// Import creates the volume from an image written by Export, laid out as the
+// driver options describe. The volume takes the size of the image.
+func (c *Driver) Import(do storage.DriverOptions, r io.Reader) error {
+	intName, err := c.imageName(do.Volume)
+	if err != nil {
+		return err
+	}
+
+	layout, err := layoutArgs(do.Volume.Params)
+	if err != nil {
+		return err
+	}
+
+	exists, err := c.Exists(do)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return storage.ErrVolumeExist
+	}
+
+	args := append([]string{"import", "-", mkpool(do.Volume.Params["pool"], intName)}, layout...)
+	if err := storage.RunStreaming(rbdCommand(do.Volume.Params, args...), r, nil, do.Timeout); err != nil {
+		if err := c.Destroy(do); err != nil {
+			logrus.Errorf("Error cleaning up failed import of volume %q: %v", intName, err)
+		}
+
+		return errored.Errorf("Importing volume %q", intName).Combine(err)
+	}
+
+	return nil
+}
+
+// ExportDiff writes the changes to the volume between the snapshots to w, as
+// `rbd export-diff` does.
+func (c *Driver) ExportDiff(do storage.DriverOptions, fromSnap, toSnap string, w io.Writer) error {
+	intName, err := c.imageName(do.Volume)
+	if err != nil {
+		return err
+	}
+
+	args := []string{"export-diff"}
+	if fromSnap != "" {
+		args = append(args, "--from-snap", fromSnap)
+	}
+	args = append(args, mkpool(do.Volume.Params["pool"], intName)+"@"+toSnap, "-")
+
+	if err := storage.RunStreaming(rbdCommand(do.Volume.Params, args...), nil, w, do.Timeout); err != nil {
+		return errored.Errorf("Exporting diff from snapshot %q to %q (volume %q)", fromSnap, toSnap, intName).Combine(err)
+	}
+
+	return nil
+}
+
+// ImportDiff applies a diff written by ExportDiff to the volume, as `rbd
+// import-diff` does. The volume is resized to the size of the snapshot the
+// diff was taken to.
+func (c *Driver) ImportDiff(do storage.DriverOptions, r io.Reader) error {
+	intName, err := c.imageName(do.Volume)
+	if err != nil {
+		return err
+	}
+
+	cmd := rbdCommand(do.Volume.Params, "import-diff", "-", mkpool(do.Volume.Params["pool"], intName))
+	if err := storage.RunStreaming(cmd, r, nil, do.Timeout); err != nil {
+		return errored.Errorf("Importing diff into volume %q", intName).Combine(err)
+	}
+
+	return nil
+}
+
+// Resize grows the volume to the size in the DriverOptions. rbd refuses to
+// shrink images.
+func (c *Driver) Resize(do storage.DriverOptions) error {
+	intName, err := c.imageName(do.Volume)
+	if err != nil {
+		return err
+	}
+
+	cmd := rbdCommand(do.Volume.Params, "resize", mkpool(do.Volume.Params["pool"], intName), "--size", strconv.FormatUint(do.Volume.Size, 10))
+	er, err := runWithTimeout(cmd, do.Timeout)
+	if er != nil && er.ExitStatus != 0 {
+		return errored.Errorf("Resizing disk %q: %v (%v)", intName, er, strings.TrimSpace(er.Stderr))
+	} else if err != nil {
+		return errored.Errorf("Resizing disk %q", intName).Combine(err)
+	}
+
+	return nil
+}
+
+// GrowFilesystem grows the filesystem of a volume mounted on this host to
+// fill the volume. The kernel notices the new size of the image by itself.
+func (c *Driver) GrowFilesystem(do storage.DriverOptions) error {
+	intName, err := c.imageName(do.Volume)
+	if err != nil {
+		return err
+	}
+
+	volumePath, err := c.MountPath(do)
+	if err != nil {
+		return err
+	}
+
+	rbdmap, err := c.showMapped(do.Volume.Params, do.Timeout)
+	if err != nil {
+		return err
+	}
+
+	var device string
+
+	for _, rbd := range rbdmap {
+		if rbd.Name == intName && rbd.Pool == do.Volume.Params["pool"] {
+			device = rbd.Device
+			break
+		}
+	}
+
+	if device == "" {
+		return errored.Errorf("Volume %s in pool %s is not mapped on this host", intName, do.Volume.Params["pool"])
+	}
+
+	// the dm-crypt mapping of encrypted volumes is grown along with the image.
+	device, err = storage.ResizeCrypt(do.Volume.Name, device, do.Timeout)
+	if err != nil {
+		return err
+	}
+
+	cmd, err := growCommand(do.FSOptions.Type, device, volumePath)
+	if err != nil {
+		return err
+	}
+
+	er, err := runWithTimeout(cmd, do.Timeout)
+	if err != nil {
+		return errored.Errorf("Error growing filesystem on %s", device).Combine(err)
+	} else if er.ExitStatus != 0 {
+		return errored.Errorf("Error growing filesystem on %s: %v (%v)", device, er, strings.TrimSpace(er.Stderr))
+	}
+
+	return nil
+}
+
+// Stats returns the capacity and usage of the image, as reported by `rbd du`.
+// Snapshots are not counted. Inode usage is not known.
+func (c *Driver) Stats(do storage.DriverOptions) (*storage.Stats, error) {
+	intName, err := c.imageName(do.Volume)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := rbdCommand(do.Volume.Params, "du", mkpool(do.Volume.Params["pool"], intName), "--format", "json")
+	er, err := runWithTimeout(cmd, do.Timeout)
+	if er != nil && er.ExitStatus != 0 {
+		return nil, errored.Errorf("Retrieving usage of disk %q: %v (%v)", intName, er, strings.TrimSpace(er.Stderr))
+	} else if err != nil {
+		return nil, errored.Errorf("Retrieving usage of disk %q", intName).Combine(err)
+	}
+
+	return parseDiskUsage(er.Stdout, intName)
+}
+
 // Mounted describes all the volumes currently mapped on to the host.
 func (c *Driver) Mounted(timeout time.Duration) ([]*storage.Mount, error) {
 	mounts := []*storage.Mount{}
+	hostMounts := []*mountscan.MountInfo{}
 
-	hostMounts, err := mountscan.GetMounts(&mountscan.GetMountsRequest{DriverName: "ceph", KernelDriver: "rbd"})
-	if err != nil {
-		if newerr, ok := err.(*errored.Error); ok && newerr.Contains(errors.ErrDevNotFound) {
-			return mounts, nil
+	// encrypted volumes are mounted from the dm-crypt mapping of their device.
+	for _, kernelDriver := range []string{"rbd", "device-mapper"} {
+		driverMounts, err := mountscan.GetMounts(&mountscan.GetMountsRequest{DriverName: "ceph", KernelDriver: kernelDriver})
+		if err != nil {
+			if newerr, ok := err.(*errored.Error); ok && newerr.Contains(errors.ErrDevNotFound) {
+				continue
+			}
+			return nil, err
 		}
-		return nil, err
+
+		hostMounts = append(hostMounts, driverMounts...)
+	}
+
+	if len(hostMounts) == 0 {
+		return mounts, nil
 	}
 
 	for _, mount := range hostMounts {
@@ -529,14 +1034,26 @@ func (c *Driver) Mounted(timeout time.Duration) ([]*storage.Mount, error) {
 	}
 
 	for _, hostMount := range hostMounts {
+		device := hostMount.MountSource
+		if _, backing, ok := storage.CryptMapping(hostMount.DeviceNumber.Major, hostMount.DeviceNumber.Minor); ok {
+			device = backing
+		}
+
 		for _, mappedMount := range mapped {
-			if hostMount.MountSource == mappedMount.Device {
+			if device == mappedMount.Device {
+				volume := mappedMount.Volume
+				// adopted volumes keep the names of their images, so the volume is
+				// named by the mount point.
+				if name, ok := c.mountedVolumeName(hostMount.MountPoint); ok {
+					volume.Name = name
+				}
+
 				mounts = append(mounts, &storage.Mount{
 					Device:   hostMount.MountSource,
 					DevMajor: hostMount.DeviceNumber.Major,
 					DevMinor: hostMount.DeviceNumber.Minor,
 					Path:     hostMount.MountPoint,
-					Volume:   mappedMount.Volume,
+					Volume:   volume,
 				})
 				break
 			}
@@ -558,5 +1075,16 @@ func (c *Driver) Validate(do *storage.DriverOptions) error {
 		return errored.Errorf("Pool is missing in ceph storage driver.")
 	}
 
-	return nil
+	if strings.Contains(do.Volume.Params["cluster"], "/") {
+		return errored.Errorf("Invalid cluster %q in ceph storage driver.", do.Volume.Params["cluster"])
+	}
+
+	for _, param := range []string{"conf", "keyring"} {
+		if value := do.Volume.Params[param]; value != "" && !filepath.IsAbs(value) {
+			return errored.Errorf("%s %q must be an absolute path in ceph storage driver.", param, value)
+		}
+	}
+
+	_, err := layoutArgs(do.Volume.Params)
+	return err
 }
@@ -5,6 +5,7 @@ import (
 	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strconv"
 	"strings"
 	. "testing"
@@ -12,6 +13,8 @@ import (
 
 	. "gopkg.in/check.v1"
 
+	"golang.org/x/sys/unix"
+
 	"github.com/Sirupsen/logrus"
 	"github.com/contiv/volplugin/storage"
 	"github.com/contiv/volplugin/storage/mountscan"
@@ -156,6 +159,394 @@ again:
 	goto again
 }
 
+func (s *cephSuite) TestResize(c *C) {
+	crudDriver, err := NewCRUDDriver()
+	c.Assert(err, IsNil)
+	mountDriver, err := NewMountDriver(myMountpath)
+	c.Assert(err, IsNil)
+
+	driverOpts := storage.DriverOptions{
+		Volume:    volumeSpec,
+		FSOptions: filesystems["ext4"],
+		Timeout:   5 * time.Second,
+	}
+
+	defer mountDriver.Unmount(driverOpts)
+	defer crudDriver.Destroy(driverOpts)
+
+	c.Assert(crudDriver.Create(driverOpts), IsNil)
+	c.Assert(crudDriver.Format(driverOpts), IsNil)
+	_, err = mountDriver.Mount(driverOpts)
+	c.Assert(err, IsNil)
+
+	mp, err := mountDriver.MountPath(driverOpts)
+	c.Assert(err, IsNil)
+
+	statfs := &unix.Statfs_t{}
+	c.Assert(unix.Statfs(mp, statfs), IsNil)
+	before := statfs.Blocks * uint64(statfs.Bsize)
+
+	driverOpts.Volume.Size = 20
+	c.Assert(crudDriver.(storage.ResizeDriver).Resize(driverOpts), IsNil)
+	c.Assert(mountDriver.(storage.ResizeDriver).GrowFilesystem(driverOpts), IsNil)
+
+	c.Assert(unix.Statfs(mp, statfs), IsNil)
+	c.Assert(statfs.Blocks*uint64(statfs.Bsize) > before, Equals, true)
+	s.readWriteTest(c, mp)
+
+	// images cannot shrink.
+	driverOpts.Volume.Size = 10
+	c.Assert(crudDriver.(storage.ResizeDriver).Resize(driverOpts), NotNil)
+
+	c.Assert(mountDriver.Unmount(driverOpts), IsNil)
+	c.Assert(crudDriver.Destroy(driverOpts), IsNil)
+}
+
+func (s *cephSuite) TestRename(c *C) {
+	crudDriver, err := NewCRUDDriver()
+	c.Assert(err, IsNil)
+	snapDriver, err := NewSnapshotDriver()
+	c.Assert(err, IsNil)
+
+	driverOpts := storage.DriverOptions{
+		Volume:    volumeSpec,
+		FSOptions: filesystems["ext4"],
+		Timeout:   5 * time.Second,
+	}
+
+	c.Assert(crudDriver.Create(driverOpts), IsNil)
+	c.Assert(snapDriver.CreateSnapshot("snap", driverOpts), IsNil)
+	c.Assert(crudDriver.(storage.RenameDriver).Rename(driverOpts, "test2/renamed"), IsNil)
+
+	exists, err := crudDriver.Exists(driverOpts)
+	c.Assert(err, IsNil)
+	c.Assert(exists, Equals, false)
+
+	driverOpts.Volume.Name = "test2/renamed"
+	exists, err = crudDriver.Exists(driverOpts)
+	c.Assert(err, IsNil)
+	c.Assert(exists, Equals, true)
+
+	// snapshots go along with the image.
+	snaps, err := snapDriver.ListSnapshots(driverOpts)
+	c.Assert(err, IsNil)
+	c.Assert(storage.SnapshotNames(snaps), DeepEquals, []string{"snap"})
+
+	c.Assert(crudDriver.(storage.RenameDriver).Rename(driverOpts, "test2/renamed"), NotNil)
+	c.Assert(crudDriver.Destroy(driverOpts), IsNil)
+}
+
+func hasImage(c *C, adopter storage.AdoptDriver, image string) bool {
+	images, err := adopter.Images(storage.ListOptions{Params: storage.Params{"pool": "rbd"}})
+	c.Assert(err, IsNil)
+
+	for _, name := range images {
+		if name == image {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *cephSuite) TestAdopt(c *C) {
+	crudDriver, err := NewCRUDDriver()
+	c.Assert(err, IsNil)
+	adopter := crudDriver.(storage.AdoptDriver)
+
+	c.Assert(exec.Command("rbd", "create", "adoptee.img", "--size", "10", "--pool", "rbd").Run(), IsNil)
+	defer exec.Command("rbd", "rm", "rbd/adoptee.img").Run()
+
+	c.Assert(hasImage(c, adopter, "rbd/adoptee.img"), Equals, true)
+
+	driverOpts := storage.DriverOptions{
+		Volume: storage.Volume{
+			Name:   "test/adopted",
+			Size:   10,
+			Params: storage.Params{"pool": "rbd", storage.ImageParam: "adoptee.img"},
+		},
+		FSOptions: filesystems["ext4"],
+		Timeout:   5 * time.Second,
+	}
+
+	image, err := adopter.VolumeImage(driverOpts.Volume)
+	c.Assert(err, IsNil)
+	c.Assert(image, Equals, "rbd/adoptee.img")
+
+	image, err = adopter.VolumeImage(volumeSpec)
+	c.Assert(err, IsNil)
+	c.Assert(image, Equals, "rbd/test.pithos")
+
+	exists, err := crudDriver.Exists(driverOpts)
+	c.Assert(err, IsNil)
+	c.Assert(exists, Equals, true)
+
+	fsType, err := adopter.FileSystem(driverOpts)
+	c.Assert(err, IsNil)
+	c.Assert(fsType, Equals, "")
+
+	c.Assert(crudDriver.Format(driverOpts), IsNil)
+
+	fsType, err = adopter.FileSystem(driverOpts)
+	c.Assert(err, IsNil)
+	c.Assert(fsType, Equals, "ext4")
+
+	// the image keeps its name through renames, and is mounted as the volume.
+	c.Assert(crudDriver.(storage.RenameDriver).Rename(driverOpts, "test/renamed"), IsNil)
+
+	c.Assert(hasImage(c, adopter, "rbd/adoptee.img"), Equals, true)
+	c.Assert(hasImage(c, adopter, "rbd/test.renamed"), Equals, false)
+
+	mountDriver, err := NewMountDriver(myMountpath)
+	c.Assert(err, IsNil)
+
+	mount, err := mountDriver.Mount(driverOpts)
+	c.Assert(err, IsNil)
+	c.Assert(mount.Path, Equals, filepath.Join(myMountpath, "rbd/test.adopted"))
+
+	mounts, err := mountDriver.Mounted(5 * time.Second)
+	c.Assert(err, IsNil)
+	c.Assert(mounts, HasLen, 1)
+	c.Assert(mounts[0].Volume.Name, Equals, "test/adopted")
+
+	c.Assert(mountDriver.Unmount(driverOpts), IsNil)
+}
+
+func (s *cephSuite) TestRBDCommand(c *C) {
+	cmd := rbdCommand(storage.Params{"pool": "rbd"}, "ls", "rbd")
+	c.Assert(cmd.Args, DeepEquals, []string{"rbd", "ls", "rbd"})
+
+	params := storage.Params{
+		"pool":    "rbd",
+		"cluster": "backup",
+		"conf":    "/etc/ceph/backup.conf",
+		"user":    "volplugin",
+		"keyring": "/etc/ceph/backup.client.volplugin.keyring",
+	}
+
+	cmd = rbdCommand(params, "map", "test.pithos", "--pool", "rbd")
+	c.Assert(cmd.Args, DeepEquals, []string{
+		"rbd", "map", "test.pithos", "--pool", "rbd",
+		"--cluster", "backup",
+		"--conf", "/etc/ceph/backup.conf",
+		"--id", "volplugin",
+		"--keyring", "/etc/ceph/backup.client.volplugin.keyring",
+	})
+
+	driver := &Driver{}
+	do := storage.DriverOptions{Volume: storage.Volume{Name: "policy/test", Size: 10, Params: params}, Timeout: time.Second}
+	c.Assert(driver.Validate(&do), IsNil)
+
+	do.Volume.Params = storage.Params{"pool": "rbd", "keyring": "backup.keyring"}
+	c.Assert(driver.Validate(&do), NotNil)
+	do.Volume.Params = storage.Params{"pool": "rbd", "cluster": "../backup"}
+	c.Assert(driver.Validate(&do), NotNil)
+}
+
+func (s *cephSuite) TestLayoutArgs(c *C) {
+	args, err := layoutArgs(storage.Params{"pool": "rbd"})
+	c.Assert(err, IsNil)
+	c.Assert(args, DeepEquals, []string{})
+
+	args, err = layoutArgs(storage.Params{
+		"features":     "layering,striping,exclusive-lock,object-map,fast-diff",
+		"object-size":  "8M",
+		"stripe-unit":  "64K",
+		"stripe-count": "16",
+		"data-pool":    "ecpool",
+	})
+	c.Assert(err, IsNil)
+	c.Assert(args, DeepEquals, []string{
+		"--image-feature", "layering",
+		"--image-feature", "striping",
+		"--image-feature", "exclusive-lock",
+		"--image-feature", "object-map",
+		"--image-feature", "fast-diff",
+		"--object-size", "8388608",
+		"--stripe-unit", "65536", "--stripe-count", "16",
+		"--data-pool", "ecpool",
+	})
+
+	// striping without explicit features is left to the cluster defaults.
+	args, err = layoutArgs(storage.Params{"stripe-unit": "1M", "stripe-count": "4"})
+	c.Assert(err, IsNil)
+	c.Assert(args, DeepEquals, []string{"--stripe-unit", "1048576", "--stripe-count", "4"})
+
+	for _, params := range []storage.Params{
+		{"features": "layering,teleportation"},
+		{"features": "layering,object-map"},
+		{"features": "layering,exclusive-lock,fast-diff"},
+		{"features": "exclusive-lock"},
+		{"features": "layering", "stripe-unit": "64K", "stripe-count": "2"},
+		{"object-size": "3M"},
+		{"object-size": "64M"},
+		{"object-size": "big"},
+		{"stripe-unit": "64K"},
+		{"stripe-count": "4"},
+		{"stripe-unit": "3K", "stripe-count": "4"},
+		{"stripe-unit": "64K", "stripe-count": "0"},
+		{"data-pool": "ec/pool"},
+	} {
+		_, err := layoutArgs(params)
+		c.Assert(err, NotNil, Commentf("%v", params))
+
+		params["pool"] = "rbd"
+		c.Assert((&Driver{}).Validate(&storage.DriverOptions{Volume: storage.Volume{Name: "policy/test", Params: params}, Timeout: time.Second}), NotNil)
+	}
+}
+
+func (s *cephSuite) TestGrowCommand(c *C) {
+	cmd, err := growCommand("ext4", "/dev/rbd0", "/mnt/ceph/rbd/test.pithos")
+	c.Assert(err, IsNil)
+	c.Assert(cmd.Args, DeepEquals, []string{"resize2fs", "/dev/rbd0"})
+
+	cmd, err = growCommand("xfs", "/dev/rbd0", "/mnt/ceph/rbd/test.pithos")
+	c.Assert(err, IsNil)
+	c.Assert(cmd.Args, DeepEquals, []string{"xfs_growfs", "/mnt/ceph/rbd/test.pithos"})
+
+	_, err = growCommand("vfat", "/dev/rbd0", "/mnt/ceph/rbd/test.pithos")
+	c.Assert(err, NotNil)
+}
+
+func (s *cephSuite) TestStats(c *C) {
+	crudDriver, err := NewCRUDDriver()
+	c.Assert(err, IsNil)
+
+	driverOpts := storage.DriverOptions{
+		Volume:    volumeSpec,
+		FSOptions: filesystems["ext4"],
+		Timeout:   5 * time.Second,
+	}
+
+	defer crudDriver.Destroy(driverOpts)
+
+	c.Assert(crudDriver.Create(driverOpts), IsNil)
+	c.Assert(crudDriver.Format(driverOpts), IsNil)
+
+	stats, err := crudDriver.(storage.StatsDriver).Stats(driverOpts)
+	c.Assert(err, IsNil)
+	c.Assert(stats.ProvisionedBytes, Equals, uint64(10*1024*1024))
+	c.Assert(stats.UsedBytes > 0, Equals, true)
+
+	c.Assert(crudDriver.Destroy(driverOpts), IsNil)
+}
+
+func (s *cephSuite) TestFSCheck(c *C) {
+	cmd, err := fsckCommand("ext4", "/dev/rbd0", false)
+	c.Assert(err, IsNil)
+	c.Assert(cmd.Args, DeepEquals, []string{"e2fsck", "-n", "/dev/rbd0"})
+
+	cmd, err = fsckCommand("xfs", "/dev/rbd0", true)
+	c.Assert(err, IsNil)
+	c.Assert(cmd.Args, DeepEquals, []string{"xfs_repair", "/dev/rbd0"})
+
+	cmd, err = fsckCommand("btrfs", "/dev/rbd0", true)
+	c.Assert(err, IsNil)
+	c.Assert(cmd.Args, DeepEquals, []string{"btrfs", "check", "--readonly", "/dev/rbd0"})
+
+	_, err = fsckCommand("vfat", "/dev/rbd0", false)
+	c.Assert(err, NotNil)
+
+	c.Assert(fsckStatus("ext4", true, 0), Equals, storage.FSCheckClean)
+	c.Assert(fsckStatus("ext4", true, 1), Equals, storage.FSCheckRepaired)
+	c.Assert(fsckStatus("ext4", true, 4), Equals, storage.FSCheckFailed)
+	c.Assert(fsckStatus("ext4", false, 8), Equals, storage.FSCheckFailed)
+	c.Assert(fsckStatus("xfs", false, 1), Equals, storage.FSCheckFailed)
+	c.Assert(fsckStatus("xfs", true, 2), Equals, storage.FSCheckClean)
+	c.Assert(fsckStatus("xfs", false, 2), Equals, storage.FSCheckFailed)
+	c.Assert(fsckStatus("btrfs", false, 1), Equals, storage.FSCheckFailed)
+}
+
+func (s *cephSuite) TestMountFSCheck(c *C) {
+	crudDriver, err := NewCRUDDriver()
+	c.Assert(err, IsNil)
+
+	mountDriver, err := NewMountDriver(myMountpath)
+	c.Assert(err, IsNil)
+
+	driverOpts := storage.DriverOptions{
+		Volume:    volumeSpec,
+		FSOptions: filesystems["ext4"],
+		Timeout:   5 * time.Second,
+	}
+
+	defer crudDriver.Destroy(driverOpts)
+
+	c.Assert(crudDriver.Create(driverOpts), IsNil)
+	c.Assert(crudDriver.Format(driverOpts), IsNil)
+
+	driverOpts.FSOptions.CheckMode = storage.FSCheckRepair
+	ms, err := mountDriver.Mount(driverOpts)
+	c.Assert(err, IsNil)
+	c.Assert(ms.FSCheck, NotNil)
+	c.Assert(ms.FSCheck.Mode, Equals, storage.FSCheckRepair)
+	c.Assert(ms.FSCheck.Status, Equals, storage.FSCheckClean)
+	c.Assert(mountDriver.Unmount(driverOpts), IsNil)
+
+	driverOpts.FSOptions.CheckMode = storage.FSCheckOff
+	ms, err = mountDriver.Mount(driverOpts)
+	c.Assert(err, IsNil)
+	c.Assert(ms.FSCheck, IsNil)
+	c.Assert(mountDriver.Unmount(driverOpts), IsNil)
+
+	c.Assert(crudDriver.Destroy(driverOpts), IsNil)
+}
+
+func (s *cephSuite) TestParseDiskUsage(c *C) {
+	out := `{"images":[{"name":"test.pithos","snapshot":"snap","provisioned_size":10485760,"used_size":4194304},{"name":"test.pithos","provisioned_size":20971520,"used_size":8388608}],"total_provisioned_size":20971520,"total_used_size":12582912}`
+
+	stats, err := parseDiskUsage(out, "test.pithos")
+	c.Assert(err, IsNil)
+	c.Assert(stats, DeepEquals, &storage.Stats{ProvisionedBytes: 20971520, UsedBytes: 8388608})
+
+	_, err = parseDiskUsage(out, "test.other")
+	c.Assert(err, NotNil)
+
+	_, err = parseDiskUsage("garbage", "test.pithos")
+	c.Assert(err, NotNil)
+}
+
+func (s *cephSuite) TestParseParent(c *C) {
+	parent, err := parseParent(`{"name":"test.copy","size":10485760,"parent":{"pool":"rbd","image":"test.pithos","snapshot":"snap","overlap":10485760}}`, "test.copy")
+	c.Assert(err, IsNil)
+	c.Assert(parent, DeepEquals, &rbdParent{Pool: "rbd", Image: "test.pithos", Snapshot: "snap"})
+
+	parent, err = parseParent(`{"name":"test.pithos","size":10485760}`, "test.pithos")
+	c.Assert(err, IsNil)
+	c.Assert(parent, IsNil)
+
+	_, err = parseParent("garbage", "test.pithos")
+	c.Assert(err, NotNil)
+}
+
+func (s *cephSuite) TestParseSnapshots(c *C) {
+	snaps, err := parseSnapshots(`[{"id":4,"name":"old","size":10485760},{"id":5,"name":"new","size":20971520,"protected":"true","timestamp":"Mon Jan  2 15:04:05 2017"}]`, "test.pithos")
+	c.Assert(err, IsNil)
+	c.Assert(snaps, DeepEquals, []storage.Snapshot{
+		{Name: "old", Size: 10485760},
+		{Name: "new", Size: 20971520, Protected: true, Created: time.Date(2017, 1, 2, 15, 4, 5, 0, time.Local)},
+	})
+
+	snaps, err = parseSnapshots("[]", "test.pithos")
+	c.Assert(err, IsNil)
+	c.Assert(snaps, DeepEquals, []storage.Snapshot{})
+
+	_, err = parseSnapshots(`[{"name":"new","timestamp":"yesterday"}]`, "test.pithos")
+	c.Assert(err, NotNil)
+	_, err = parseSnapshots("garbage", "test.pithos")
+	c.Assert(err, NotNil)
+}
+
+func (s *cephSuite) TestScanProgress(c *C) {
+	progress := []int{}
+	output := scanProgress(strings.NewReader("Image flatten: 0% complete...\rImage flatten: 50% complete...\rImage flatten: 100% complete...done.\nwarning: something\n"), func(percent int) {
+		progress = append(progress, percent)
+	})
+
+	c.Assert(progress, DeepEquals, []int{0, 50, 100})
+	c.Assert(output, Equals, "warning: something")
+}
+
 func (s *cephSuite) TestSnapshots(c *C) {
 	snapDrv, err := NewSnapshotDriver()
 	c.Assert(err, IsNil)
@@ -179,7 +570,7 @@ again:
 	list, err := snapDrv.ListSnapshots(driverOpts)
 	c.Assert(err, IsNil)
 	c.Assert(len(list), Equals, 1)
-	c.Assert(list, DeepEquals, []string{"hello"})
+	c.Assert(storage.SnapshotNames(list), DeepEquals, []string{"hello"})
 
 	c.Assert(snapDrv.RemoveSnapshot("hello", driverOpts), IsNil)
 	c.Assert(snapDrv.RemoveSnapshot("hello", driverOpts), NotNil)
@@ -250,15 +641,6 @@ again:
 	goto again
 }
 
-func (s *cephSuite) TestTemplateFSCmd(c *C) {
-	c.Assert(templateFSCmd("%", "foo"), Equals, "foo")
-	c.Assert(templateFSCmd("%%", "foo"), Equals, "%%")
-	c.Assert(templateFSCmd("%%%", "foo"), Equals, "%%foo")
-	c.Assert(templateFSCmd("% test % test %", "foo"), Equals, "foo test foo test foo")
-	c.Assert(templateFSCmd("% %% %", "foo"), Equals, "foo %% foo")
-	c.Assert(templateFSCmd("mkfs.ext4 -m0 %", "/dev/sda1"), Equals, "mkfs.ext4 -m0 /dev/sda1")
-}
-
 func (s *cephSuite) TestMounted(c *C) {
 	crudDrv, err := NewCRUDDriver()
 	c.Assert(err, IsNil)
@@ -1,9 +1,14 @@
 package ceph
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/json"
+	"io"
 	"os"
 	"os/exec"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -14,17 +19,267 @@ import (
 	"github.com/contiv/errored"
 	"github.com/contiv/executor"
 	"github.com/contiv/volplugin/storage"
+	"github.com/docker/go-units"
 )
 
+// rbdDiskUsage is the output of `rbd du --format json`.
+type rbdDiskUsage struct {
+	Images []struct {
+		Name            string `json:"name"`
+		Snapshot        string `json:"snapshot"`
+		ProvisionedSize uint64 `json:"provisioned_size"`
+		UsedSize        uint64 `json:"used_size"`
+	} `json:"images"`
+}
+
+func parseDiskUsage(out, intName string) (*storage.Stats, error) {
+	du := rbdDiskUsage{}
+	if err := json.Unmarshal([]byte(out), &du); err != nil {
+		return nil, errored.Errorf("Could not parse RBD du output for %q", intName).Combine(err)
+	}
+
+	for _, image := range du.Images {
+		if image.Name == intName && image.Snapshot == "" {
+			return &storage.Stats{ProvisionedBytes: image.ProvisionedSize, UsedBytes: image.UsedSize}, nil
+		}
+	}
+
+	return nil, errored.Errorf("Volume %s not found in RBD du output", intName)
+}
+
+// rbdParent is the parent snapshot of a clone in the output of `rbd info
+// --format json`.
+type rbdParent struct {
+	Pool     string `json:"pool"`
+	Image    string `json:"image"`
+	Snapshot string `json:"snapshot"`
+}
+
+// parseParent yields the parent snapshot of the image, or nil if it has none.
+func parseParent(out, intName string) (*rbdParent, error) {
+	info := struct {
+		Parent *rbdParent `json:"parent"`
+	}{}
+
+	if err := json.Unmarshal([]byte(out), &info); err != nil {
+		return nil, errored.Errorf("Could not parse RBD info output for %q", intName).Combine(err)
+	}
+
+	if info.Parent == nil || info.Parent.Image == "" {
+		return nil, nil
+	}
+
+	return info.Parent, nil
+}
+
+// parseSnapshots parses the output of `rbd snap ls --format json`, which lists
+// snapshots in the order they were taken. Older releases of ceph leave out
+// the protection and creation time of the snapshots.
+func parseSnapshots(out, intName string) ([]storage.Snapshot, error) {
+	list := []struct {
+		Name      string `json:"name"`
+		Size      uint64 `json:"size"`
+		Protected string `json:"protected"`
+		Timestamp string `json:"timestamp"`
+	}{}
+
+	if err := json.Unmarshal([]byte(out), &list); err != nil {
+		return nil, errored.Errorf("Could not parse RBD snapshot list output for %q", intName).Combine(err)
+	}
+
+	snaps := []storage.Snapshot{}
+
+	for _, item := range list {
+		snap := storage.Snapshot{
+			Name:      item.Name,
+			Size:      item.Size,
+			Protected: item.Protected == "true",
+		}
+
+		if item.Timestamp != "" {
+			created, err := time.ParseInLocation(time.ANSIC, item.Timestamp, time.Local)
+			if err != nil {
+				return nil, errored.Errorf("Invalid timestamp %q of snapshot %q (volume %q)", item.Timestamp, item.Name, intName).Combine(err)
+			}
+
+			snap.Created = created
+		}
+
+		snaps = append(snaps, snap)
+	}
+
+	return snaps, nil
+}
+
+var progressRegex = regexp.MustCompile(`(\d+)% complete`)
+
+// scanProgress calls progress with every percentage in the progress output of
+// rbd read from r, until r is exhausted. Other output is returned.
+func scanProgress(r io.Reader, progress func(int)) string {
+	output := []string{}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		// progress is written as lines ended with carriage returns.
+		if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+			return i + 1, data[:i], nil
+		}
+
+		if atEOF && len(data) > 0 {
+			return len(data), data, nil
+		}
+
+		return 0, nil, nil
+	})
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if match := progressRegex.FindStringSubmatch(line); match != nil {
+			percent, _ := strconv.Atoi(match[1])
+			progress(percent)
+		} else if line != "" {
+			output = append(output, line)
+		}
+	}
+
+	return strings.Join(output, "\n")
+}
+
 type rbdMap map[string]struct {
 	Pool   string `json:"pool"`
 	Name   string `json:"name"`
 	Device string `json:"device"`
 }
 
+const (
+	minObjectSize = 4 * units.KiB
+	maxObjectSize = 32 * units.MiB
+
+	// defaultObjectSize is the object size of images which do not set one.
+	defaultObjectSize = 4 * units.MiB
+)
+
+// imageFeatures are the image features which may be enabled, with the
+// features they need.
+var imageFeatures = map[string][]string{
+	"layering":       nil,
+	"striping":       nil,
+	"exclusive-lock": nil,
+	"object-map":     {"exclusive-lock"},
+	"fast-diff":      {"object-map"},
+	"deep-flatten":   nil,
+	"journaling":     {"exclusive-lock"},
+}
+
+// layoutArgs yields the arguments to `rbd create` which lay out the image as
+// the `features`, `object-size`, `stripe-unit`, `stripe-count` and
+// `data-pool` options of params describe. Invalid options yield an error.
+func layoutArgs(params storage.Params) ([]string, error) {
+	args := []string{}
+	features := map[string]bool{}
+
+	if params["features"] != "" {
+		for _, feature := range strings.Split(params["features"], ",") {
+			feature = strings.TrimSpace(feature)
+			if _, ok := imageFeatures[feature]; !ok {
+				return nil, errored.Errorf("Invalid image feature %q in ceph storage driver.", feature)
+			}
+
+			features[feature] = true
+			args = append(args, "--image-feature", feature)
+		}
+
+		for feature := range features {
+			for _, needed := range imageFeatures[feature] {
+				if !features[needed] {
+					return nil, errored.Errorf("Image feature %q requires %q in ceph storage driver.", feature, needed)
+				}
+			}
+		}
+
+		// snapshots are copied by cloning them.
+		if !features["layering"] {
+			return nil, errored.Errorf("Image feature %q is required in ceph storage driver.", "layering")
+		}
+	}
+
+	objectSize := int64(defaultObjectSize)
+
+	if params["object-size"] != "" {
+		size, err := units.RAMInBytes(params["object-size"])
+		if err != nil {
+			return nil, errored.Errorf("Invalid object size %q in ceph storage driver.", params["object-size"]).Combine(err)
+		}
+
+		if size < minObjectSize || size > maxObjectSize || size&(size-1) != 0 {
+			return nil, errored.Errorf("Object size %q must be a power of two between 4KiB and 32MiB in ceph storage driver.", params["object-size"])
+		}
+
+		objectSize = size
+		args = append(args, "--object-size", strconv.FormatInt(size, 10))
+	}
+
+	if (params["stripe-unit"] == "") != (params["stripe-count"] == "") {
+		return nil, errored.Errorf("Stripe unit and stripe count must be set together in ceph storage driver.")
+	}
+
+	if params["stripe-unit"] != "" {
+		unit, err := units.RAMInBytes(params["stripe-unit"])
+		if err != nil || unit <= 0 || objectSize%unit != 0 {
+			return nil, errored.Errorf("Stripe unit %q must evenly divide the object size in ceph storage driver.", params["stripe-unit"])
+		}
+
+		count, err := strconv.ParseUint(params["stripe-count"], 10, 32)
+		if err != nil || count == 0 {
+			return nil, errored.Errorf("Invalid stripe count %q in ceph storage driver.", params["stripe-count"])
+		}
+
+		if len(features) > 0 && !features["striping"] {
+			return nil, errored.Errorf("Image feature %q is required for striping in ceph storage driver.", "striping")
+		}
+
+		args = append(args, "--stripe-unit", strconv.FormatInt(unit, 10), "--stripe-count", strconv.FormatUint(count, 10))
+	}
+
+	if params["data-pool"] != "" {
+		if strings.Contains(params["data-pool"], "/") {
+			return nil, errored.Errorf("Invalid data pool %q in ceph storage driver.", params["data-pool"])
+		}
+
+		args = append(args, "--data-pool", params["data-pool"])
+	}
+
+	return args, nil
+}
+
+// clusterOptions are the driver options which select the cluster and the
+// credentials rbd uses, with the flags they translate to.
+var clusterOptions = []struct {
+	param string
+	flag  string
+}{
+	{"cluster", "--cluster"},
+	{"conf", "--conf"},
+	{"user", "--id"},
+	{"keyring", "--keyring"},
+}
+
+// rbdCommand yields an rbd command running args against the cluster selected
+// by params. Unset options leave the defaults of rbd alone: the `ceph` cluster
+// and the `admin` user.
+func rbdCommand(params storage.Params, args ...string) *exec.Cmd {
+	for _, option := range clusterOptions {
+		if value := params[option.param]; value != "" {
+			args = append(args, option.flag, value)
+		}
+	}
+
+	return exec.Command("rbd", args...)
+}
+
 func (c *Driver) mapImage(do storage.DriverOptions) (string, error) {
 	poolName := do.Volume.Params["pool"]
-	intName, err := c.internalName(do.Volume.Name)
+	intName, err := c.imageName(do.Volume)
 	if err != nil {
 		return "", err
 	}
@@ -32,7 +287,7 @@ func (c *Driver) mapImage(do storage.DriverOptions) (string, error) {
 	retries := 0
 
 retry:
-	cmd := exec.Command("rbd", "map", intName, "--pool", poolName)
+	cmd := rbdCommand(do.Volume.Params, "map", intName, "--pool", poolName)
 	er, err := runWithTimeout(cmd, do.Timeout)
 	if retries < 10 && err != nil {
 		logrus.Errorf("Error mapping image: %v (%v) (%v). Retrying.", intName, er, err)
@@ -46,7 +301,7 @@ retry:
 
 	var device string
 
-	rbdmap, err := c.showMapped(do.Timeout)
+	rbdmap, err := c.showMapped(do.Volume.Params, do.Timeout)
 	if err != nil {
 		return "", err
 	}
@@ -68,7 +323,7 @@ retry:
 }
 
 func (c *Driver) mkfsVolume(fscmd, devicePath string, timeout time.Duration) error {
-	cmd := exec.Command("/bin/sh", "-c", templateFSCmd(fscmd, devicePath))
+	cmd := exec.Command("/bin/sh", "-c", storage.TemplateFSCmd(fscmd, devicePath))
 	er, err := runWithTimeout(cmd, timeout)
 	if err != nil || er.ExitStatus != 0 {
 		return errored.Errorf("Error creating filesystem on %s with cmd: %q. Error: %v (%v) (%v) (%v)", devicePath, fscmd, er, err, strings.TrimSpace(er.Stdout), strings.TrimSpace(er.Stderr))
@@ -77,8 +332,62 @@ func (c *Driver) mkfsVolume(fscmd, devicePath string, timeout time.Duration) err
 	return nil
 }
 
+// growCommand yields the command which grows a mounted filesystem of type
+// fsType to fill its device.
+func growCommand(fsType, device, mountPath string) (*exec.Cmd, error) {
+	switch fsType {
+	case "ext2", "ext3", "ext4":
+		return exec.Command("resize2fs", device), nil
+	case "xfs":
+		return exec.Command("xfs_growfs", mountPath), nil
+	case "btrfs":
+		return exec.Command("btrfs", "filesystem", "resize", "max", mountPath), nil
+	}
+
+	return nil, errored.Errorf("Growing filesystem %q is not supported", fsType)
+}
+
+// fsckCommand yields the command which checks the filesystem of type fsType
+// on device, repairing what it safely can if repair is set. btrfs is only
+// ever checked, as its repair mode is not safe to run unattended.
+func fsckCommand(fsType, device string, repair bool) (*exec.Cmd, error) {
+	switch fsType {
+	case "ext2", "ext3", "ext4":
+		if repair {
+			return exec.Command("e2fsck", "-p", device), nil
+		}
+		return exec.Command("e2fsck", "-n", device), nil
+	case "xfs":
+		if repair {
+			return exec.Command("xfs_repair", device), nil
+		}
+		return exec.Command("xfs_repair", "-n", device), nil
+	case "btrfs":
+		return exec.Command("btrfs", "check", "--readonly", device), nil
+	}
+
+	return nil, errored.Errorf("Checking filesystem %q is not supported", fsType)
+}
+
+// fsckStatus interprets the exit status of the command from fsckCommand.
+func fsckStatus(fsType string, repair bool, exitStatus int) string {
+	switch {
+	case exitStatus == 0:
+		return storage.FSCheckClean
+	case (fsType == "ext2" || fsType == "ext3" || fsType == "ext4") && exitStatus < 4:
+		// 1 and 2 mean errors were corrected.
+		return storage.FSCheckRepaired
+	case fsType == "xfs" && repair && exitStatus == 2:
+		// the log is dirty and xfs_repair refuses to touch it. Mounting replays
+		// it, which is what the host would have done anyway.
+		return storage.FSCheckClean
+	}
+
+	return storage.FSCheckFailed
+}
+
 func (c *Driver) unmapImage(do storage.DriverOptions) error {
-	rbdmap, err := c.showMapped(do.Timeout)
+	rbdmap, err := c.showMapped(do.Volume.Params, do.Timeout)
 	if err != nil {
 		return err
 	}
@@ -103,7 +412,7 @@ func (c *Driver) unmapImage(do storage.DriverOptions) error {
 func (c *Driver) doUnmap(do storage.DriverOptions, rbdmap rbdMap) (bool, error) {
 	poolName := do.Volume.Params["pool"]
 
-	intName, err := c.internalName(do.Volume.Name)
+	intName, err := c.imageName(do.Volume)
 	if err != nil {
 		return false, err
 	}
@@ -117,7 +426,7 @@ func (c *Driver) doUnmap(do storage.DriverOptions, rbdmap rbdMap) (bool, error)
 				continue
 			}
 
-			cmd := exec.Command("rbd", "unmap", rbd.Device)
+			cmd := rbdCommand(do.Volume.Params, "unmap", rbd.Device)
 			er, err := runWithTimeout(cmd, do.Timeout)
 			if err != nil || er.ExitStatus != 0 {
 				logrus.Errorf("Could not unmap volume %q (device %q): %v (%v) (%v)", intName, rbd.Device, er, err, er.Stderr)
@@ -129,7 +438,7 @@ func (c *Driver) doUnmap(do storage.DriverOptions, rbdmap rbdMap) (bool, error)
 				return false, err
 			}
 
-			rbdmap2, err := c.showMapped(do.Timeout)
+			rbdmap2, err := c.showMapped(do.Volume.Params, do.Timeout)
 			if err != nil {
 				return false, err
 			}
@@ -147,7 +456,7 @@ func (c *Driver) doUnmap(do storage.DriverOptions, rbdmap rbdMap) (bool, error)
 	return false, nil
 }
 
-func (c *Driver) showMapped(timeout time.Duration) (rbdMap, error) {
+func (c *Driver) showMapped(params storage.Params, timeout time.Duration) (rbdMap, error) {
 	var (
 		er  *executor.ExecResult
 		err error
@@ -156,7 +465,7 @@ func (c *Driver) showMapped(timeout time.Duration) (rbdMap, error) {
 retry:
 	rbdmap := rbdMap{}
 
-	cmd := exec.Command("rbd", "showmapped", "--format", "json")
+	cmd := rbdCommand(params, "showmapped", "--format", "json")
 	ctx, _ := context.WithTimeout(context.Background(), timeout)
 	er, err = executor.NewCapture(cmd).Run(ctx)
 	if err != nil || er.ExitStatus != 0 || er.Stdout == "" {
@@ -175,7 +484,8 @@ retry:
 }
 
 func (c *Driver) getMapped(timeout time.Duration) ([]*storage.Mount, error) {
-	rbdmap, err := c.showMapped(timeout)
+	// mappings are kept by the kernel, so any cluster yields all of them.
+	rbdmap, err := c.showMapped(storage.Params{}, timeout)
 	if err != nil {
 		return nil, err
 	}
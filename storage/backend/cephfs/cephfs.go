@@ -0,0 +1,483 @@
+package cephfs
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/storage"
+	"github.com/docker/go-units"
+)
+
+const (
+	// BackendName is the name of the cephfs storage backend.
+	BackendName = "cephfs"
+
+	// DefaultRoot is the directory in the CephFS filesystem volumes are kept
+	// in when the `root` driver option is not set.
+	DefaultRoot = "/volplugin"
+
+	// DefaultUser is the ceph client used when the `user` driver option is
+	// not set.
+	DefaultUser = "admin"
+
+	// DefaultStagingPath is the directory the CephFS filesystems are mounted
+	// in to administer volumes.
+	DefaultStagingPath = "/var/lib/volplugin/cephfs"
+
+	quotaAttr = "ceph.quota.max_bytes"
+	snapDir   = ".snap"
+)
+
+// runner runs a command and returns its standard output. Everything which
+// needs a ceph cluster goes through it, so the tests can stand in for one.
+type runner func(timeout time.Duration, name string, args ...string) (string, error)
+
+// Driver implements a storage driver on top of CephFS.
+//
+// -- Layout
+//
+// A volume `policy/volume` is the directory `<root>/policy/volume` of the
+// filesystem, where root is the `root` driver option or DefaultRoot. Its size
+// is enforced with the ceph.quota.max_bytes attribute. Snapshots are CephFS
+// snapshots, taken in the `.snap` directory of the volume.
+//
+// -- Cluster access
+//
+// The `monitors` driver option lists the monitors to mount from, separated by
+// commas; mount.ceph finds them in ceph.conf when it is not set. The `user`
+// and `secretfile` options pick the ceph client to mount as.
+//
+// CephFS can be mounted by many hosts at once, so volumes may be shared by
+// creating them unlocked.
+type Driver struct {
+	mountpath string
+	staging   string
+	run       runner
+}
+
+// NewMountDriver is a generator for Driver structs. It is used by the storage
+// framework to yield new drivers on every creation.
+func NewMountDriver(mountpath string) (storage.MountDriver, error) {
+	return &Driver{mountpath: mountpath, staging: DefaultStagingPath, run: runCommand}, nil
+}
+
+// NewCRUDDriver is a generator for Driver structs. It is used by the storage
+// framework to yield new drivers on every creation.
+func NewCRUDDriver() (storage.CRUDDriver, error) {
+	return &Driver{staging: DefaultStagingPath, run: runCommand}, nil
+}
+
+// NewSnapshotDriver is a generator for Driver structs. It is used by the storage
+// framework to yield new drivers on every creation.
+func NewSnapshotDriver() (storage.SnapshotDriver, error) {
+	return &Driver{staging: DefaultStagingPath, run: runCommand}, nil
+}
+
+// Name returns the cephfs backend string
+func (d *Driver) Name() string {
+	return BackendName
+}
+
+// runCommand runs the commands of drivers which are not under test.
+func runCommand(timeout time.Duration, name string, args ...string) (string, error) {
+	return storage.RunCommand(exec.Command(name, args...), timeout)
+}
+
+// Create a volume.
+func (d *Driver) Create(do storage.DriverOptions) error {
+	return d.withFilesystem(do.Volume.Params, do.Timeout, func(fsRoot string) error {
+		dir, err := volumePath(fsRoot, do.Volume)
+		if err != nil {
+			return err
+		}
+
+		if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+			return errored.Errorf("Creating policy directory for %q", do.Volume.Name).Combine(err)
+		}
+
+		if err := os.Mkdir(dir, 0755); os.IsExist(err) {
+			return storage.ErrVolumeExist
+		} else if err != nil {
+			return errored.Errorf("Creating directory %q", dir).Combine(err)
+		}
+
+		// Size is in megabytes, just like it is for rbd.
+		if err := d.setQuota(dir, strconv.FormatUint(do.Volume.Size*units.MiB, 10), do.Timeout); err != nil {
+			if err := os.Remove(dir); err != nil {
+				logrus.Errorf("Error while trying to remove directory after failed quota: %v", err)
+			}
+			return errored.Errorf("Sizing volume %q", do.Volume.Name).Combine(err)
+		}
+
+		return nil
+	})
+}
+
+// Format formats a created volume. CephFS directories need no formatting, so
+// this does nothing.
+func (d *Driver) Format(do storage.DriverOptions) error {
+	return nil
+}
+
+// Destroy a volume.
+func (d *Driver) Destroy(do storage.DriverOptions) error {
+	return d.withFilesystem(do.Volume.Params, do.Timeout, func(fsRoot string) error {
+		dir, err := volumePath(fsRoot, do.Volume)
+		if err != nil {
+			return err
+		}
+
+		snaps, err := listSnapshots(dir)
+		if err != nil {
+			return err
+		}
+
+		for _, snap := range snaps {
+			if err := os.Remove(filepath.Join(dir, snapDir, snap.Name)); err != nil {
+				return errored.Errorf("Destroying snapshots for volume %q", do.Volume.Name).Combine(err)
+			}
+		}
+
+		if err := os.RemoveAll(dir); err != nil {
+			return errored.Errorf("Destroying directory for volume %q", do.Volume.Name).Combine(err)
+		}
+
+		return nil
+	})
+}
+
+// List all volumes.
+func (d *Driver) List(lo storage.ListOptions) ([]storage.Volume, error) {
+	list := []storage.Volume{}
+
+	err := d.withFilesystem(lo.Params, listTimeout, func(fsRoot string) error {
+		root := filepath.Join(fsRoot, volumeRoot(lo.Params))
+
+		dirs, err := filepath.Glob(filepath.Join(root, "*", "*"))
+		if err != nil {
+			return errored.Errorf("Listing directories in %q", root).Combine(err)
+		}
+
+		for _, dir := range dirs {
+			if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+				continue
+			}
+
+			rel, err := filepath.Rel(root, dir)
+			if err != nil {
+				logrus.Errorf("Invalid directory %q found in %q, skipping", dir, root)
+				continue
+			}
+
+			params := storage.Params{}
+			for key, value := range lo.Params {
+				params[key] = value
+			}
+
+			list = append(list, storage.Volume{Name: rel, Params: params})
+		}
+
+		return nil
+	})
+
+	return list, err
+}
+
+// Exists returns true if the volume already exists.
+func (d *Driver) Exists(do storage.DriverOptions) (bool, error) {
+	var exists bool
+
+	err := d.withFilesystem(do.Volume.Params, do.Timeout, func(fsRoot string) error {
+		dir, err := volumePath(fsRoot, do.Volume)
+		if err != nil {
+			return err
+		}
+
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return errored.Errorf("Checking for directory %q", dir).Combine(err)
+		}
+
+		exists = true
+		return nil
+	})
+
+	return exists, err
+}
+
+// snapshotName sanitizes a snapshot name for CephFS, which does not allow
+// slashes. Names starting with an underscore are how CephFS shows the
+// snapshots of parent directories, so they are avoided as well. This is
+// idempotent, so names returned by ListSnapshots() may be passed back in.
+func snapshotName(snapName string) string {
+	return strings.TrimLeft(strings.NewReplacer(" ", "-", "/", "-").Replace(snapName), "_")
+}
+
+// CreateSnapshot creates a named snapshot for the volume. Any error will be returned.
+func (d *Driver) CreateSnapshot(snapName string, do storage.DriverOptions) error {
+	snapName = snapshotName(snapName)
+
+	return d.withFilesystem(do.Volume.Params, do.Timeout, func(fsRoot string) error {
+		snapPath, err := snapshotPath(fsRoot, snapName, do.Volume)
+		if err != nil {
+			return err
+		}
+
+		if err := os.Mkdir(snapPath, 0755); err != nil {
+			return errored.Errorf("Creating snapshot %q (volume %q)", snapName, do.Volume.Name).Combine(err)
+		}
+
+		return nil
+	})
+}
+
+// RemoveSnapshot removes a named snapshot for the volume. Any error will be returned.
+func (d *Driver) RemoveSnapshot(snapName string, do storage.DriverOptions) error {
+	return d.withFilesystem(do.Volume.Params, do.Timeout, func(fsRoot string) error {
+		snapPath, err := snapshotPath(fsRoot, snapName, do.Volume)
+		if err != nil {
+			return err
+		}
+
+		if err := os.Remove(snapPath); err != nil {
+			return errored.Errorf("Removing snapshot %q (volume %q)", snapName, do.Volume.Name).Combine(err)
+		}
+
+		return nil
+	})
+}
+
+type byModTime []os.FileInfo
+
+func (b byModTime) Len() int      { return len(b) }
+func (b byModTime) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+
+func (b byModTime) Less(i, j int) bool {
+	if b[i].ModTime().Equal(b[j].ModTime()) {
+		return b[i].Name() < b[j].Name()
+	}
+
+	return b[i].ModTime().Before(b[j].ModTime())
+}
+
+// listSnapshots lists the snapshots of the volume directory, oldest first.
+func listSnapshots(dir string) ([]storage.Snapshot, error) {
+	snaps := []storage.Snapshot{}
+
+	f, err := os.Open(filepath.Join(dir, snapDir))
+	if os.IsNotExist(err) {
+		return snaps, nil
+	} else if err != nil {
+		return nil, errored.Errorf("Listing snapshots of %q", dir).Combine(err)
+	}
+	defer f.Close()
+
+	fis, err := f.Readdir(-1)
+	if err != nil {
+		return nil, errored.Errorf("Listing snapshots of %q", dir).Combine(err)
+	}
+
+	sort.Sort(byModTime(fis))
+
+	for _, fi := range fis {
+		// snapshots of parent directories show up as _name_inode; they are
+		// not ours to list.
+		if strings.HasPrefix(fi.Name(), "_") {
+			continue
+		}
+
+		snaps = append(snaps, storage.Snapshot{Name: fi.Name(), Created: fi.ModTime()})
+	}
+
+	return snaps, nil
+}
+
+// RollbackSnapshot replaces the contents of the volume directory with those
+// of the snapshot. The directory itself is kept, as its snapshots live in it.
+func (d *Driver) RollbackSnapshot(snapName string, do storage.DriverOptions) error {
+	return d.withFilesystem(do.Volume.Params, do.Timeout, func(fsRoot string) error {
+		dir, err := volumePath(fsRoot, do.Volume)
+		if err != nil {
+			return err
+		}
+
+		snapPath, err := snapshotPath(fsRoot, snapName, do.Volume)
+		if err != nil {
+			return err
+		}
+
+		if _, err := os.Stat(snapPath); err != nil {
+			return errored.Errorf("Snapshot %q (volume %q) could not be found", snapName, do.Volume.Name).Combine(errors.NotExists)
+		}
+
+		fis, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return errored.Errorf("Reading directory %q", dir).Combine(err)
+		}
+
+		for _, fi := range fis {
+			if fi.Name() == snapDir {
+				continue
+			}
+
+			if err := os.RemoveAll(filepath.Join(dir, fi.Name())); err != nil {
+				return errored.Errorf("Rolling back volume %q to snapshot %q", do.Volume.Name, snapName).Combine(err)
+			}
+		}
+
+		if _, err := d.run(do.Timeout, "cp", "-a", snapPath+"/.", dir); err != nil {
+			return errored.Errorf("Rolling back volume %q to snapshot %q", do.Volume.Name, snapName).Combine(err)
+		}
+
+		return nil
+	})
+}
+
+// ListSnapshots returns the snapshots of the volume, oldest first. Any error
+// will be returned.
+func (d *Driver) ListSnapshots(do storage.DriverOptions) ([]storage.Snapshot, error) {
+	var snaps []storage.Snapshot
+
+	err := d.withFilesystem(do.Volume.Params, do.Timeout, func(fsRoot string) error {
+		dir, err := volumePath(fsRoot, do.Volume)
+		if err != nil {
+			return err
+		}
+
+		snaps, err = listSnapshots(dir)
+		return err
+	})
+
+	return snaps, err
+}
+
+// CopySnapshot copies a snapshot into a new volume. Takes a DriverOptions,
+// snap and volume name (string). Returns error on failure.
+func (d *Driver) CopySnapshot(do storage.DriverOptions, snapName, newName string) error {
+	return d.withFilesystem(do.Volume.Params, do.Timeout, func(fsRoot string) error {
+		dir, err := volumePath(fsRoot, do.Volume)
+		if err != nil {
+			return err
+		}
+
+		snapPath, err := snapshotPath(fsRoot, snapName, do.Volume)
+		if err != nil {
+			return err
+		}
+
+		if _, err := os.Stat(snapPath); err != nil {
+			return errored.Errorf("Snapshot %q (volume %q) could not be found", snapName, do.Volume.Name).Combine(errors.SnapshotCopy).Combine(err)
+		}
+
+		newDir, err := volumePath(fsRoot, storage.Volume{Name: newName, Params: do.Volume.Params})
+		if err != nil {
+			return err
+		}
+
+		if err := os.MkdirAll(filepath.Dir(newDir), 0755); err != nil {
+			return errored.Errorf("Creating policy directory for %q", newName).Combine(err)
+		}
+
+		if err := os.Mkdir(newDir, 0755); os.IsExist(err) {
+			return errored.Errorf("Volume %q already exists", newName).Combine(errors.Exists)
+		} else if err != nil {
+			return errored.Errorf("Creating directory %q", newDir).Combine(err)
+		}
+
+		// the copy is as large as the volume it came from.
+		quota, err := d.getQuota(dir, do.Timeout)
+		if err == nil {
+			err = d.setQuota(newDir, quota, do.Timeout)
+		}
+
+		if err == nil {
+			_, err = d.run(do.Timeout, "cp", "-a", snapPath+"/.", newDir)
+		}
+
+		if err != nil {
+			if err := os.RemoveAll(newDir); err != nil {
+				logrus.Errorf("Could not remove partial copy %q: %v", newDir, err)
+			}
+			return errored.Errorf("Copying snapshot %q (volume %q) to %q", snapName, do.Volume.Name, newName).Combine(errors.SnapshotCopy).Combine(err)
+		}
+
+		return nil
+	})
+}
+
+// Export writes a tar archive of the snapshot of the volume to w.
+func (d *Driver) Export(do storage.DriverOptions, snapName string, w io.Writer) error {
+	return d.withFilesystem(do.Volume.Params, do.Timeout, func(fsRoot string) error {
+		snapPath, err := snapshotPath(fsRoot, snapName, do.Volume)
+		if err != nil {
+			return err
+		}
+
+		if _, err := os.Stat(snapPath); err != nil {
+			return errored.Errorf("Snapshot %q (volume %q) could not be found", snapName, do.Volume.Name).Combine(err)
+		}
+
+		if err := storage.ArchiveDirectory(snapPath, w, do.Timeout); err != nil {
+			return errored.Errorf("Exporting snapshot %q (volume %q)", snapName, do.Volume.Name).Combine(err)
+		}
+
+		return nil
+	})
+}
+
+// Import creates the volume and extracts a tar archive written by Export into
+// it.
+func (d *Driver) Import(do storage.DriverOptions, r io.Reader) error {
+	if err := d.Create(do); err != nil {
+		return err
+	}
+
+	err := d.withFilesystem(do.Volume.Params, do.Timeout, func(fsRoot string) error {
+		dir, err := volumePath(fsRoot, do.Volume)
+		if err != nil {
+			return err
+		}
+
+		return storage.ExtractArchive(dir, r, do.Timeout)
+	})
+
+	if err != nil {
+		if err := d.Destroy(do); err != nil {
+			logrus.Errorf("Error cleaning up failed import of volume %q: %v", do.Volume.Name, err)
+		}
+
+		return errored.Errorf("Importing volume %q", do.Volume.Name).Combine(err)
+	}
+
+	return nil
+}
+
+// Validate validates the driver options to ensure they are compatible with the
+// cephfs storage driver.
+func (d *Driver) Validate(do *storage.DriverOptions) error {
+	// XXX check this first to guard against nil pointers ahead of time.
+	if err := do.Validate(); err != nil {
+		return err
+	}
+
+	if root := do.Volume.Params["root"]; root != "" && !filepath.IsAbs(root) {
+		return errored.Errorf("Root %q must be absolute in cephfs storage driver.", root)
+	}
+
+	if strings.Contains(do.Volume.Params["monitors"], "/") {
+		return errored.Errorf("Invalid monitors %q in cephfs storage driver.", do.Volume.Params["monitors"])
+	}
+
+	return nil
+}
@@ -0,0 +1,281 @@
+package cephfs
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	. "testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/storage"
+)
+
+// fakeCluster stands in for a ceph cluster. Mounts do nothing, so the
+// filesystem is just the staging directory on local disk.
+type fakeCluster struct {
+	calls  [][]string
+	quotas map[string]string
+	mounts map[string]string
+}
+
+func newFakeCluster() *fakeCluster {
+	return &fakeCluster{quotas: map[string]string{}, mounts: map[string]string{}}
+}
+
+func (f *fakeCluster) run(timeout time.Duration, name string, args ...string) (string, error) {
+	f.calls = append(f.calls, append([]string{name}, args...))
+
+	switch name {
+	case "mount":
+		f.mounts[args[3]] = args[2]
+	case "umount":
+		if _, ok := f.mounts[args[0]]; !ok {
+			return "", errored.Errorf("%s: not mounted", args[0])
+		}
+		delete(f.mounts, args[0])
+	case "setfattr":
+		f.quotas[args[4]] = args[3]
+	case "getfattr":
+		return f.quotas[args[3]], nil
+	default:
+		out, err := exec.Command(name, args...).CombinedOutput()
+		if err != nil {
+			return "", errored.Errorf("%s %v: %s", name, args, out).Combine(err)
+		}
+	}
+
+	return "", nil
+}
+
+type cephfsSuite struct {
+	dir     string
+	cluster *fakeCluster
+}
+
+var _ = Suite(&cephfsSuite{})
+
+func TestCephFS(t *T) { TestingT(t) }
+
+func (s *cephfsSuite) SetUpTest(c *C) {
+	var err error
+	s.dir, err = ioutil.TempDir("", "volplugin-cephfs")
+	c.Assert(err, IsNil)
+	s.cluster = newFakeCluster()
+}
+
+func (s *cephfsSuite) TearDownTest(c *C) {
+	c.Assert(os.RemoveAll(s.dir), IsNil)
+}
+
+func (s *cephfsSuite) driver() *Driver {
+	return &Driver{
+		mountpath: filepath.Join(s.dir, "mnt"),
+		staging:   filepath.Join(s.dir, "staging"),
+		run:       s.cluster.run,
+	}
+}
+
+// fsPath is where the fake filesystem keeps path.
+func (s *cephfsSuite) fsPath(path string) string {
+	return filepath.Join(s.dir, "staging", "mon1_6789", path)
+}
+
+func driverOpts(name string) storage.DriverOptions {
+	return storage.DriverOptions{
+		Volume: storage.Volume{
+			Name:   name,
+			Size:   100,
+			Params: storage.Params{"monitors": "mon1:6789"},
+		},
+		Timeout: 5 * time.Second,
+	}
+}
+
+func (s *cephfsSuite) TestSource(c *C) {
+	params := storage.Params{"monitors": "mon1:6789,mon2:6789"}
+	c.Assert(source(params, "/volplugin/policy1/test"), Equals, "mon1:6789,mon2:6789:/volplugin/policy1/test")
+	c.Assert(source(storage.Params{}, "/"), Equals, ":/")
+
+	monitors, path, ok := parseSource("mon1:6789,mon2:6789:/volplugin/policy1/test")
+	c.Assert(ok, Equals, true)
+	c.Assert(monitors, Equals, "mon1:6789,mon2:6789")
+	c.Assert(path, Equals, "/volplugin/policy1/test")
+
+	_, _, ok = parseSource("/dev/sda1")
+	c.Assert(ok, Equals, false)
+
+	c.Assert(mountOptions(storage.Params{}), Equals, "name=admin")
+	c.Assert(mountOptions(storage.Params{"user": "volplugin", "secretfile": "/etc/ceph/volplugin.secret"}), Equals, "name=volplugin,secretfile=/etc/ceph/volplugin.secret")
+
+	d := &Driver{staging: DefaultStagingPath}
+	c.Assert(d.stagingPath(params), Equals, "/var/lib/volplugin/cephfs/mon1_6789_mon2_6789")
+	c.Assert(d.stagingPath(storage.Params{}), Equals, "/var/lib/volplugin/cephfs/default")
+}
+
+func (s *cephfsSuite) TestNames(c *C) {
+	c.Assert(snapshotName("2016-01-02 15:04:05.999 +0000 UTC"), Equals, "2016-01-02-15:04:05.999-+0000-UTC")
+	c.Assert(snapshotName("_a/b"), Equals, "a-b")
+	c.Assert(snapshotName(snapshotName("a b")), Equals, "a-b")
+
+	_, err := snapshotPath("/", "..", storage.Volume{Name: "policy1/test", Params: storage.Params{}})
+	c.Assert(err, NotNil)
+
+	d := &Driver{mountpath: "/mnt"}
+	mp, err := d.MountPath(driverOpts("policy1/test"))
+	c.Assert(err, IsNil)
+	c.Assert(mp, Equals, "/mnt/cephfs/policy1/test")
+}
+
+func (s *cephfsSuite) TestValidate(c *C) {
+	d := &Driver{}
+
+	do := driverOpts("policy1/test")
+	c.Assert(d.Validate(&do), IsNil)
+
+	do.Volume.Params["root"] = "relative"
+	c.Assert(d.Validate(&do), NotNil)
+
+	do = driverOpts("policy1/test")
+	do.Volume.Params["monitors"] = "mon1:/path"
+	c.Assert(d.Validate(&do), NotNil)
+}
+
+func (s *cephfsSuite) TestCRUD(c *C) {
+	d := s.driver()
+	do := driverOpts("policy1/test")
+
+	c.Assert(d.Create(do), IsNil)
+	c.Assert(d.Create(do), Equals, storage.ErrVolumeExist)
+	c.Assert(d.Format(do), IsNil)
+
+	dir := s.fsPath("volplugin/policy1/test")
+	c.Assert(s.cluster.quotas[dir], Equals, "104857600")
+	c.Assert(s.cluster.calls[0], DeepEquals, []string{"mount", "-t", "ceph", "mon1:6789:/", s.fsPath(""), "-o", "name=admin"})
+	c.Assert(len(s.cluster.mounts), Equals, 0)
+
+	exists, err := d.Exists(do)
+	c.Assert(err, IsNil)
+	c.Assert(exists, Equals, true)
+
+	list, err := d.List(storage.ListOptions{Params: do.Volume.Params})
+	c.Assert(err, IsNil)
+	c.Assert(list, DeepEquals, []storage.Volume{{Name: "policy1/test", Params: storage.Params{"monitors": "mon1:6789"}}})
+
+	c.Assert(d.Destroy(do), IsNil)
+
+	exists, err = d.Exists(do)
+	c.Assert(err, IsNil)
+	c.Assert(exists, Equals, false)
+}
+
+func (s *cephfsSuite) TestSnapshots(c *C) {
+	d := s.driver()
+	do := driverOpts("policy1/test")
+
+	c.Assert(d.Create(do), IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(s.fsPath("volplugin/policy1/test"), "test.txt"), []byte("Test string\n"), 0644), IsNil)
+
+	// the fake has no real snapshots; .snap is an ordinary directory, and
+	// the snapshot needs something to copy.
+	c.Assert(os.Mkdir(s.fsPath("volplugin/policy1/test/.snap"), 0755), IsNil)
+	c.Assert(d.CreateSnapshot("test snap", do), IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(s.fsPath("volplugin/policy1/test/.snap/test-snap"), "test.txt"), []byte("Test string\n"), 0644), IsNil)
+
+	later := time.Now().Add(time.Minute)
+	c.Assert(d.CreateSnapshot("a-later-snap", do), IsNil)
+	c.Assert(os.Chtimes(s.fsPath("volplugin/policy1/test/.snap/a-later-snap"), later, later), IsNil)
+
+	// parent snapshots are not listed.
+	c.Assert(os.Mkdir(s.fsPath("volplugin/policy1/test/.snap/_parent_1099511627776"), 0755), IsNil)
+
+	list, err := d.ListSnapshots(do)
+	c.Assert(err, IsNil)
+	c.Assert(storage.SnapshotNames(list), DeepEquals, []string{"test-snap", "a-later-snap"})
+	c.Assert(list[0].Created.IsZero(), Equals, false)
+
+	c.Assert(d.CopySnapshot(do, "test-snap", "policy1/copy"), IsNil)
+	c.Assert(d.CopySnapshot(do, "test-snap", "policy1/copy"), NotNil)
+	c.Assert(d.CopySnapshot(do, "nonexistent", "policy1/copy2"), NotNil)
+
+	content, err := ioutil.ReadFile(filepath.Join(s.fsPath("volplugin/policy1/copy"), "test.txt"))
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Equals, "Test string\n")
+	c.Assert(s.cluster.quotas[s.fsPath("volplugin/policy1/copy")], Equals, "104857600")
+
+	// rolling back replaces everything but the snapshots.
+	c.Assert(ioutil.WriteFile(filepath.Join(s.fsPath("volplugin/policy1/test"), "test.txt"), []byte("Changed\n"), 0644), IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(s.fsPath("volplugin/policy1/test"), "new.txt"), []byte("New\n"), 0644), IsNil)
+	c.Assert(d.RollbackSnapshot("test-snap", do), IsNil)
+	c.Assert(d.RollbackSnapshot("nonexistent", do), NotNil)
+
+	content, err = ioutil.ReadFile(filepath.Join(s.fsPath("volplugin/policy1/test"), "test.txt"))
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Equals, "Test string\n")
+	_, err = os.Stat(filepath.Join(s.fsPath("volplugin/policy1/test"), "new.txt"))
+	c.Assert(os.IsNotExist(err), Equals, true)
+
+	c.Assert(os.Remove(s.fsPath("volplugin/policy1/test/.snap/test-snap/test.txt")), IsNil)
+	c.Assert(d.RemoveSnapshot("test-snap", do), IsNil)
+	list, err = d.ListSnapshots(do)
+	c.Assert(err, IsNil)
+	c.Assert(storage.SnapshotNames(list), DeepEquals, []string{"a-later-snap"})
+}
+
+func (s *cephfsSuite) TestExportImport(c *C) {
+	d := s.driver()
+	do := driverOpts("policy1/test")
+
+	c.Assert(d.Create(do), IsNil)
+	c.Assert(os.MkdirAll(s.fsPath("volplugin/policy1/test/.snap/snap"), 0755), IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(s.fsPath("volplugin/policy1/test/.snap/snap"), "test.txt"), []byte("Test string\n"), 0644), IsNil)
+
+	buf := &bytes.Buffer{}
+	c.Assert(d.Export(do, "snap", buf), IsNil)
+	c.Assert(d.Export(do, "nonexistent", &bytes.Buffer{}), NotNil)
+
+	newDo := driverOpts("policy1/imported")
+	c.Assert(d.Import(newDo, bytes.NewReader(buf.Bytes())), IsNil)
+	c.Assert(d.Import(newDo, bytes.NewReader(buf.Bytes())), Equals, storage.ErrVolumeExist)
+
+	content, err := ioutil.ReadFile(filepath.Join(s.fsPath("volplugin/policy1/imported"), "test.txt"))
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Equals, "Test string\n")
+	c.Assert(s.cluster.quotas[s.fsPath("volplugin/policy1/imported")], Equals, "104857600")
+
+	// a broken image leaves nothing behind.
+	brokenDo := driverOpts("policy1/broken")
+	c.Assert(d.Import(brokenDo, strings.NewReader("not an archive")), NotNil)
+	exists, err := d.Exists(brokenDo)
+	c.Assert(err, IsNil)
+	c.Assert(exists, Equals, false)
+}
+
+func (s *cephfsSuite) TestMountUnmount(c *C) {
+	d := s.driver()
+	do := driverOpts("policy1/test")
+	do.Volume.Params["root"] = "/shared"
+
+	mount, err := d.Mount(do)
+	c.Assert(err, IsNil)
+	c.Assert(mount.Path, Equals, filepath.Join(s.dir, "mnt/cephfs/policy1/test"))
+	c.Assert(mount.Device, Equals, "mon1:6789:/shared/policy1/test")
+
+	last := s.cluster.calls[len(s.cluster.calls)-1]
+	c.Assert(strings.Join(last, " "), Equals, "mount -t ceph mon1:6789:/shared/policy1/test "+mount.Path+" -o name=admin")
+	c.Assert(s.cluster.mounts[mount.Path], Equals, mount.Device)
+
+	c.Assert(d.Unmount(do), IsNil)
+	c.Assert(len(s.cluster.mounts), Equals, 0)
+
+	_, err = os.Stat(mount.Path)
+	c.Assert(os.IsNotExist(err), Equals, true)
+
+	// unmounting twice is harmless.
+	c.Assert(d.Unmount(do), IsNil)
+}
@@ -0,0 +1,146 @@
+package cephfs
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/storage"
+)
+
+// listTimeout bounds the List operation, which is not given a timeout. It
+// matches the default global timeout.
+const listTimeout = 10 * time.Minute
+
+func volumeRoot(params storage.Params) string {
+	if params["root"] == "" {
+		return DefaultRoot
+	}
+
+	return params["root"]
+}
+
+// volumePath returns the path of the volume directory relative to fsRoot,
+// where the CephFS filesystem is mounted.
+func volumePath(fsRoot string, volume storage.Volume) (string, error) {
+	policy, name, err := storage.SplitName(volume.Name)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(fsRoot, volumeRoot(volume.Params), policy, name), nil
+}
+
+func snapshotPath(fsRoot, snapName string, volume storage.Volume) (string, error) {
+	if snapName == "" || snapName == "." || snapName == ".." || strings.Contains(snapName, "/") {
+		return "", errored.Errorf("Invalid snapshot name %q", snapName)
+	}
+
+	dir, err := volumePath(fsRoot, volume)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, snapDir, snapName), nil
+}
+
+// source returns the mount source for path in the CephFS filesystem.
+func source(params storage.Params, path string) string {
+	return params["monitors"] + ":" + path
+}
+
+// parseSource splits a mount source into its monitors and path. ok is false
+// if the source is not a CephFS mount source.
+func parseSource(src string) (monitors, path string, ok bool) {
+	i := strings.LastIndex(src, ":/")
+	if i < 0 {
+		return "", "", false
+	}
+
+	return src[:i], src[i+1:], true
+}
+
+// mountOptions returns the options to mount CephFS with.
+func mountOptions(params storage.Params) string {
+	user := params["user"]
+	if user == "" {
+		user = DefaultUser
+	}
+
+	opts := []string{"name=" + user}
+
+	if params["secretfile"] != "" {
+		opts = append(opts, "secretfile="+params["secretfile"])
+	}
+
+	return strings.Join(opts, ",")
+}
+
+// stagingPath returns the directory the filesystem described by params is
+// mounted at to administer it. Every cluster gets its own.
+func (d *Driver) stagingPath(params storage.Params) string {
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '.' {
+			return r
+		}
+		return '_'
+	}, params["monitors"])
+
+	if name == "" {
+		name = "default"
+	}
+
+	return filepath.Join(d.staging, name)
+}
+
+// withFilesystem mounts the root of the CephFS filesystem, runs fn with the
+// path it was mounted at, and unmounts it again.
+func (d *Driver) withFilesystem(params storage.Params, timeout time.Duration, fn func(string) error) error {
+	fsRoot := d.stagingPath(params)
+
+	if err := os.MkdirAll(fsRoot, 0700); err != nil {
+		return errored.Errorf("Creating staging directory %q", fsRoot).Combine(err)
+	}
+
+	if _, err := d.run(timeout, "mount", "-t", "ceph", source(params, "/"), fsRoot, "-o", mountOptions(params)); err != nil {
+		return errored.Errorf("Mounting CephFS at %q", fsRoot).Combine(err)
+	}
+
+	fnErr := fn(fsRoot)
+
+	if _, err := d.run(timeout, "umount", fsRoot); err != nil {
+		logrus.Errorf("Could not unmount CephFS at %q: %v", fsRoot, err)
+		return fnErr
+	}
+
+	// XXX this is not RemoveAll on purpose; if the filesystem is still mounted
+	//     (e.g. by a concurrent operation), it must be left alone.
+	if err := os.Remove(fsRoot); err != nil && !os.IsNotExist(err) {
+		logrus.Debugf("Could not remove staging directory %q: %v", fsRoot, err)
+	}
+
+	return fnErr
+}
+
+// setQuota limits the bytes the directory may hold.
+func (d *Driver) setQuota(dir, bytes string, timeout time.Duration) error {
+	_, err := d.run(timeout, "setfattr", "-n", quotaAttr, "-v", bytes, dir)
+	return err
+}
+
+// getQuota returns the bytes the directory may hold, or 0 if it is unlimited.
+func (d *Driver) getQuota(dir string, timeout time.Duration) (string, error) {
+	out, err := d.run(timeout, "getfattr", "--only-values", "-n", quotaAttr, dir)
+	if err != nil {
+		return "", err
+	}
+
+	if quota := strings.TrimSpace(out); quota != "" {
+		return quota, nil
+	}
+
+	return "0", nil
+}
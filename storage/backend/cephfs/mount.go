@@ -0,0 +1,158 @@
+package cephfs
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/storage"
+	"github.com/contiv/volplugin/storage/mountscan"
+)
+
+// mountRoot is the directory under the mountpath that all cephfs volumes are
+// mounted in. Keeping them apart allows Mounted() to tell them from the
+// mounts of other drivers.
+func (d *Driver) mountRoot() string {
+	return filepath.Join(d.mountpath, BackendName)
+}
+
+func (d *Driver) mkMountPath(volName string) (string, error) {
+	policy, name, err := storage.SplitName(volName)
+	if err != nil {
+		return "", err
+	}
+
+	// Directory to mount the volume
+	volumePath := filepath.Join(d.mountRoot(), policy, name)
+	rel, err := filepath.Rel(d.mountRoot(), volumePath)
+	if err != nil || strings.Contains(rel, "..") {
+		return "", errors.MountFailed.Combine(errored.Errorf("Calculated volume path would escape subdir jail: %v", volumePath))
+	}
+
+	return volumePath, nil
+}
+
+// MountPath returns the path of a mount for a policy/volume.
+func (d *Driver) MountPath(do storage.DriverOptions) (string, error) {
+	return d.mkMountPath(do.Volume.Name)
+}
+
+// Mount a volume. Returns the mount information about the volume. Only the
+// directory of the volume is mounted.
+func (d *Driver) Mount(do storage.DriverOptions) (*storage.Mount, error) {
+	dir, err := volumePath("/", do.Volume)
+	if err != nil {
+		return nil, err
+	}
+
+	mountPath, err := d.mkMountPath(do.Volume.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(mountPath, 0700); err != nil && !os.IsExist(err) {
+		return nil, errored.Errorf("error creating %q directory: %v", mountPath, err)
+	}
+
+	src := source(do.Volume.Params, dir)
+
+	if _, err := d.run(do.Timeout, "mount", "-t", "ceph", src, mountPath, "-o", mountOptions(do.Volume.Params)); err != nil {
+		return nil, errors.MountFailed.Combine(err)
+	}
+
+	// CephFS mounts get an anonymous device number.
+	fi, err := os.Stat(mountPath)
+	if err != nil {
+		return nil, errored.Errorf("Failed to stat mount %q: %v", mountPath, err)
+	}
+
+	major, minor := storage.DevNumbers(fi.Sys().(*syscall.Stat_t).Dev)
+
+	return &storage.Mount{
+		Device:   src,
+		Path:     mountPath,
+		Volume:   do.Volume,
+		DevMajor: major,
+		DevMinor: minor,
+	}, nil
+}
+
+// Unmount a volume.
+func (d *Driver) Unmount(do storage.DriverOptions) error {
+	volumeDir, err := d.mkMountPath(do.Volume.Name)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(volumeDir); os.IsNotExist(err) {
+		return nil
+	}
+
+	var retries int
+	var lastErr error
+
+retry:
+	if retries < 3 {
+		if _, err := d.run(do.Timeout, "umount", volumeDir); err != nil {
+			lastErr = errored.Errorf("Failed to unmount %q (retrying)", volumeDir).Combine(err)
+			logrus.Error(lastErr)
+			retries++
+			time.Sleep(100 * time.Millisecond)
+			goto retry
+		}
+	} else {
+		return errored.Errorf("Failed to umount after 3 retries").Combine(lastErr)
+	}
+
+	if err := os.Remove(volumeDir); err != nil && !os.IsNotExist(err) {
+		logrus.Error(errored.Errorf("error removing %q directory: %v", volumeDir, err))
+	}
+
+	return nil
+}
+
+// Mounted shows any volumes that belong to volplugin on the host, in
+// their native representation. They yield a *Mount.
+func (d *Driver) Mounted(timeout time.Duration) ([]*storage.Mount, error) {
+	mounts := []*storage.Mount{}
+
+	hostMounts, err := mountscan.GetMounts(&mountscan.GetMountsRequest{DriverName: BackendName, FsType: "ceph"})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, hostMount := range hostMounts {
+		rel, err := filepath.Rel(d.mountRoot(), hostMount.MountPoint)
+		if err != nil || strings.HasPrefix(rel, "..") || len(strings.Split(rel, "/")) != 2 {
+			// not one of ours.
+			continue
+		}
+
+		params := storage.Params{}
+
+		if monitors, path, ok := parseSource(hostMount.MountSource); ok {
+			params["monitors"] = monitors
+			params["root"] = filepath.Dir(filepath.Dir(path))
+		} else {
+			logrus.Errorf("Could not parse CephFS mount source %q", hostMount.MountSource)
+		}
+
+		mounts = append(mounts, &storage.Mount{
+			Device:   hostMount.MountSource,
+			DevMajor: hostMount.DeviceNumber.Major,
+			DevMinor: hostMount.DeviceNumber.Minor,
+			Path:     hostMount.MountPoint,
+			Volume: storage.Volume{
+				Name:   rel,
+				Params: params,
+			},
+		})
+	}
+
+	return mounts, nil
+}
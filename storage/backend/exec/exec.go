@@ -0,0 +1,339 @@
+package exec
+
+import (
+	"bytes"
+	"encoding/json"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/contiv/errored"
+	"github.com/contiv/executor"
+	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/storage"
+)
+
+const (
+	// BackendName is the name of the exec storage backend.
+	BackendName = "exec"
+
+	// DefaultPluginPath is the directory executables named without a path are
+	// found in.
+	DefaultPluginPath = "/usr/libexec/volplugin"
+
+	// listTimeout bounds the List operation, which is not given a timeout. It
+	// matches the default global timeout.
+	listTimeout = 10 * time.Minute
+)
+
+// Error codes a plugin may answer with. They are translated to the errors
+// the rest of volplugin expects.
+const (
+	CodeExists    = "exists"
+	CodeNotExists = "notexists"
+)
+
+// Request is written to the standard input of the plugin as JSON. Only the
+// fields the method needs are set.
+type Request struct {
+	// Options are the driver options of the volume the method acts on.
+	Options *storage.DriverOptions `json:"options,omitempty"`
+
+	// ListOptions are set for the `list` method.
+	ListOptions *storage.ListOptions `json:"list_options,omitempty"`
+
+	// Snapshot is the name of the snapshot for the snapshot methods.
+	Snapshot string `json:"snapshot,omitempty"`
+
+	// Target is the name of the new volume for `copy-snapshot`.
+	Target string `json:"target,omitempty"`
+
+	// MountPath is the directory to mount the volume at for `mount` and
+	// `unmount`, and the directory all mounts live in for `mounted`.
+	MountPath string `json:"mountpath,omitempty"`
+}
+
+// Response is read from the standard output of the plugin as JSON. Only the
+// fields the method yields need to be set.
+type Response struct {
+	// Error is the failure of the method. An empty error is success.
+	Error string `json:"error,omitempty"`
+
+	// Code classifies the error. See CodeExists and CodeNotExists.
+	Code string `json:"code,omitempty"`
+
+	Exists    bool             `json:"exists,omitempty"`
+	Volumes   []storage.Volume `json:"volumes,omitempty"`
+	Snapshots []Snapshot       `json:"snapshots,omitempty"`
+	Mount     *storage.Mount   `json:"mount,omitempty"`
+	Mounts    []*storage.Mount `json:"mounts,omitempty"`
+}
+
+// Snapshot is a snapshot yielded by `list-snapshots`. Plugins may answer with
+// a storage.Snapshot, or only the name of the snapshot.
+type Snapshot struct {
+	storage.Snapshot
+}
+
+// UnmarshalJSON accepts both forms of a snapshot.
+func (s *Snapshot) UnmarshalJSON(content []byte) error {
+	var name string
+	if err := json.Unmarshal(content, &name); err == nil {
+		s.Name = name
+		return nil
+	}
+
+	return json.Unmarshal(content, &s.Snapshot)
+}
+
+// executables holds the absolute executables used by the process, so
+// Mounted() can ask them about their mounts.
+var executables = struct {
+	sync.Mutex
+	paths map[string]struct{}
+}{paths: map[string]struct{}{}}
+
+// Driver implements a storage driver which hands every operation to an
+// external executable, so backends can be shipped without building them into
+// volplugin.
+//
+// -- Plugins
+//
+// The `executable` driver option names the plugin. A name without a slash is
+// looked up in DefaultPluginPath, anything else must be an absolute path. The
+// plugin must be installed on every host the policy is used on.
+//
+// -- Protocol
+//
+// The plugin is run with the method as its only argument: `create`,
+// `format`, `destroy`, `exists`, `list`, `create-snapshot`,
+// `remove-snapshot`, `rollback-snapshot`, `list-snapshots`, `copy-snapshot`,
+// `mount`, `unmount` or `mounted`. A Request is written to its standard
+// input, and it must write a Response to its standard output and exit.
+// Methods which fail set the error of the response; a non-zero exit status is
+// a failure as well, with the standard error as the reason. The plugin is
+// killed when the timeout of the operation runs out. `list-snapshots` may
+// answer with bare snapshot names; see Snapshot.
+//
+// Mount directories are created before `mount` and removed after `unmount`
+// by volplugin. `mounted` is asked of every plugin in DefaultPluginPath and
+// every other plugin this process has used, and must only answer with
+// mounts below the given mountpath.
+type Driver struct {
+	mountpath  string
+	pluginPath string
+}
+
+// NewMountDriver is a generator for Driver structs. It is used by the storage
+// framework to yield new drivers on every creation.
+func NewMountDriver(mountpath string) (storage.MountDriver, error) {
+	return &Driver{mountpath: mountpath, pluginPath: DefaultPluginPath}, nil
+}
+
+// NewCRUDDriver is a generator for Driver structs. It is used by the storage
+// framework to yield new drivers on every creation.
+func NewCRUDDriver() (storage.CRUDDriver, error) {
+	return &Driver{pluginPath: DefaultPluginPath}, nil
+}
+
+// NewSnapshotDriver is a generator for Driver structs. It is used by the storage
+// framework to yield new drivers on every creation.
+func NewSnapshotDriver() (storage.SnapshotDriver, error) {
+	return &Driver{pluginPath: DefaultPluginPath}, nil
+}
+
+// Name returns the exec backend string
+func (d *Driver) Name() string {
+	return BackendName
+}
+
+// executable returns the path of the plugin named by params.
+func (d *Driver) executable(params storage.Params) (string, error) {
+	name := params["executable"]
+
+	switch {
+	case name == "":
+		return "", errored.Errorf("No executable was provided. Set `executable` in the driver options.")
+	case !strings.Contains(name, "/"):
+		return filepath.Join(d.pluginPath, name), nil
+	case filepath.IsAbs(name):
+		return filepath.Clean(name), nil
+	default:
+		return "", errored.Errorf("Executable %q must be a plain name or an absolute path in exec storage driver.", name)
+	}
+}
+
+// call runs method of the plugin with req and returns the response.
+func call(executable, method string, req Request, timeout time.Duration) (*Response, error) {
+	content, err := json.Marshal(req)
+	if err != nil {
+		return nil, errored.Errorf("Marshalling request for %q", method).Combine(err)
+	}
+
+	cmd := exec.Command(executable, method)
+	e := executor.NewCapture(cmd)
+	e.Stdin = bytes.NewReader(content)
+
+	ctx, _ := context.WithTimeout(context.Background(), timeout)
+	er, err := e.Run(ctx)
+	if err != nil {
+		if er == nil {
+			return nil, errored.Errorf("Could not run %v", cmd.Args).Combine(err)
+		}
+
+		return nil, errored.Errorf("Error running %v: %v (%v)", cmd.Args, er, strings.TrimSpace(er.Stderr)).Combine(err)
+	}
+
+	resp := &Response{}
+	if err := json.Unmarshal([]byte(er.Stdout), resp); err != nil {
+		return nil, errored.Errorf("Invalid response from %v: %q", cmd.Args, er.Stdout).Combine(err)
+	}
+
+	if resp.Error == "" {
+		return resp, nil
+	}
+
+	respErr := errored.Errorf("%v: %v", cmd.Args, resp.Error)
+
+	switch resp.Code {
+	case CodeExists:
+		return resp, respErr.Combine(errors.Exists)
+	case CodeNotExists:
+		return resp, respErr.Combine(errors.NotExists)
+	}
+
+	return resp, respErr
+}
+
+// callVolume runs method of the plugin named by the options of the volume.
+func (d *Driver) callVolume(method string, do storage.DriverOptions, req Request) (*Response, error) {
+	executable, err := d.executable(do.Volume.Params)
+	if err != nil {
+		return nil, err
+	}
+
+	if filepath.Dir(executable) != d.pluginPath {
+		executables.Lock()
+		executables.paths[executable] = struct{}{}
+		executables.Unlock()
+	}
+
+	req.Options = &do
+	return call(executable, method, req, do.Timeout)
+}
+
+// Create a volume.
+func (d *Driver) Create(do storage.DriverOptions) error {
+	resp, err := d.callVolume("create", do, Request{})
+	if err != nil && resp != nil && resp.Code == CodeExists {
+		return storage.ErrVolumeExist
+	}
+
+	return err
+}
+
+// Format a volume.
+func (d *Driver) Format(do storage.DriverOptions) error {
+	_, err := d.callVolume("format", do, Request{})
+	return err
+}
+
+// Destroy a volume.
+func (d *Driver) Destroy(do storage.DriverOptions) error {
+	_, err := d.callVolume("destroy", do, Request{})
+	return err
+}
+
+// List Volumes. The `executable` list option names the plugin to ask.
+func (d *Driver) List(lo storage.ListOptions) ([]storage.Volume, error) {
+	executable, err := d.executable(lo.Params)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := call(executable, "list", Request{ListOptions: &lo}, listTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.Volumes == nil {
+		return []storage.Volume{}, nil
+	}
+
+	return resp.Volumes, nil
+}
+
+// Exists returns true if the volume already exists.
+func (d *Driver) Exists(do storage.DriverOptions) (bool, error) {
+	resp, err := d.callVolume("exists", do, Request{})
+	if err != nil {
+		return false, err
+	}
+
+	return resp.Exists, nil
+}
+
+// CreateSnapshot creates a named snapshot for the volume. Any error will be returned.
+func (d *Driver) CreateSnapshot(snapName string, do storage.DriverOptions) error {
+	_, err := d.callVolume("create-snapshot", do, Request{Snapshot: snapName})
+	return err
+}
+
+// RemoveSnapshot removes a named snapshot for the volume. Any error will be returned.
+func (d *Driver) RemoveSnapshot(snapName string, do storage.DriverOptions) error {
+	_, err := d.callVolume("remove-snapshot", do, Request{Snapshot: snapName})
+	return err
+}
+
+// RollbackSnapshot restores the volume to the named snapshot. Any error will
+// be returned.
+func (d *Driver) RollbackSnapshot(snapName string, do storage.DriverOptions) error {
+	_, err := d.callVolume("rollback-snapshot", do, Request{Snapshot: snapName})
+	return err
+}
+
+// ListSnapshots returns the snapshots of the volume, oldest first. Snapshots
+// the plugin yields without a creation time keep the order they were yielded
+// in.
+func (d *Driver) ListSnapshots(do storage.DriverOptions) ([]storage.Snapshot, error) {
+	resp, err := d.callVolume("list-snapshots", do, Request{})
+	if err != nil {
+		return nil, err
+	}
+
+	snaps := []storage.Snapshot{}
+	for _, snap := range resp.Snapshots {
+		snaps = append(snaps, snap.Snapshot)
+	}
+
+	storage.SortSnapshots(snaps)
+	return snaps, nil
+}
+
+// CopySnapshot copies a snapshot into a new volume. Takes a DriverOptions,
+// snap and volume name (string). Returns error on failure.
+func (d *Driver) CopySnapshot(do storage.DriverOptions, snapName, newName string) error {
+	resp, err := d.callVolume("copy-snapshot", do, Request{Snapshot: snapName, Target: newName})
+	if err != nil && (resp == nil || resp.Code != CodeExists) {
+		return errors.SnapshotCopy.Combine(err)
+	}
+
+	return err
+}
+
+// Validate validates the driver options to ensure they are compatible with the
+// exec storage driver. The plugin is not consulted, as it may not be
+// installed where volumes are validated.
+func (d *Driver) Validate(do *storage.DriverOptions) error {
+	// XXX check this first to guard against nil pointers ahead of time.
+	if err := do.Validate(); err != nil {
+		return err
+	}
+
+	_, err := d.executable(do.Volume.Params)
+	return err
+}
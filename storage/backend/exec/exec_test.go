@@ -0,0 +1,264 @@
+package exec
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	. "testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/storage"
+)
+
+// pluginEnv makes the test binary act as a plugin keeping its volumes in the
+// directory it names.
+const pluginEnv = "VOLPLUGIN_EXEC_TEST_PLUGIN"
+
+type execSuite struct {
+	dir string
+}
+
+var _ = Suite(&execSuite{})
+
+func TestMain(m *M) {
+	if dir := os.Getenv(pluginEnv); dir != "" {
+		os.Exit(fakePlugin(dir, os.Args[1]))
+	}
+
+	os.Exit(m.Run())
+}
+
+func TestExec(t *T) { TestingT(t) }
+
+// fakePlugin implements enough of the protocol to test the driver with. Each
+// volume is a directory, each snapshot and mount a file in it.
+func fakePlugin(dir, method string) int {
+	req := Request{}
+	if err := json.NewDecoder(os.Stdin).Decode(&req); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	resp := Response{}
+	var volDir string
+
+	if req.Options != nil {
+		volDir = filepath.Join(dir, req.Options.Volume.Name)
+	}
+
+	switch method {
+	case "create":
+		if _, err := os.Stat(volDir); err == nil {
+			resp.Error, resp.Code = "volume exists", CodeExists
+		} else if err := os.MkdirAll(volDir, 0700); err != nil {
+			resp.Error = err.Error()
+		}
+	case "format":
+	case "destroy":
+		os.RemoveAll(volDir)
+	case "exists":
+		_, err := os.Stat(volDir)
+		resp.Exists = err == nil
+	case "list":
+		dirs, _ := filepath.Glob(filepath.Join(dir, "*", "*"))
+		for _, d := range dirs {
+			rel, _ := filepath.Rel(dir, d)
+			resp.Volumes = append(resp.Volumes, storage.Volume{Name: rel, Params: req.ListOptions.Params})
+		}
+	case "create-snapshot":
+		ioutil.WriteFile(filepath.Join(volDir, "snap-"+req.Snapshot), nil, 0600)
+	case "list-snapshots":
+		snaps, _ := filepath.Glob(filepath.Join(volDir, "snap-*"))
+		for _, snap := range snaps {
+			fi, _ := os.Stat(snap)
+			resp.Snapshots = append(resp.Snapshots, Snapshot{storage.Snapshot{Name: filepath.Base(snap)[len("snap-"):], Created: fi.ModTime()}})
+		}
+	case "rollback-snapshot":
+		if _, err := os.Stat(filepath.Join(volDir, "snap-"+req.Snapshot)); err != nil {
+			resp.Error, resp.Code = "no such snapshot", CodeNotExists
+		}
+	case "copy-snapshot":
+		resp.Error, resp.Code = "no such snapshot", CodeNotExists
+	case "mount":
+		content, _ := json.Marshal(storage.Mount{Device: "/dev/fake", Path: req.MountPath, Volume: req.Options.Volume, DevMajor: 1, DevMinor: 2})
+		ioutil.WriteFile(filepath.Join(volDir, "mount"), content, 0600)
+		resp.Mount = &storage.Mount{Device: "/dev/fake", DevMajor: 1, DevMinor: 2}
+	case "unmount":
+		os.Remove(filepath.Join(volDir, "mount"))
+	case "mounted":
+		files, _ := filepath.Glob(filepath.Join(dir, "*", "*", "mount"))
+		for _, file := range files {
+			content, _ := ioutil.ReadFile(file)
+			mount := &storage.Mount{}
+			json.Unmarshal(content, mount)
+			resp.Mounts = append(resp.Mounts, mount)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "unknown method %q\n", method)
+		return 1
+	}
+
+	json.NewEncoder(os.Stdout).Encode(resp)
+	return 0
+}
+
+func (s *execSuite) SetUpTest(c *C) {
+	var err error
+	s.dir, err = ioutil.TempDir("", "volplugin-exec")
+	c.Assert(err, IsNil)
+
+	self, err := filepath.Abs(os.Args[0])
+	c.Assert(err, IsNil)
+
+	c.Assert(os.MkdirAll(filepath.Join(s.dir, "plugins"), 0700), IsNil)
+	script := fmt.Sprintf("#!/bin/sh\n%s=%s exec %s \"$@\"\n", pluginEnv, filepath.Join(s.dir, "volumes"), self)
+	c.Assert(ioutil.WriteFile(filepath.Join(s.dir, "plugins", "fake"), []byte(script), 0700), IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(s.dir, "plugins", "broken"), []byte("#!/bin/sh\necho broken >&2\nexit 1\n"), 0700), IsNil)
+}
+
+func (s *execSuite) TearDownTest(c *C) {
+	c.Assert(os.RemoveAll(s.dir), IsNil)
+}
+
+func (s *execSuite) driver() *Driver {
+	return &Driver{mountpath: filepath.Join(s.dir, "mnt"), pluginPath: filepath.Join(s.dir, "plugins")}
+}
+
+func driverOpts(name string) storage.DriverOptions {
+	return storage.DriverOptions{
+		Volume: storage.Volume{
+			Name:   name,
+			Size:   10,
+			Params: storage.Params{"executable": "fake"},
+		},
+		Timeout: 10 * time.Second,
+	}
+}
+
+func (s *execSuite) TestExecutable(c *C) {
+	d := s.driver()
+
+	path, err := d.executable(storage.Params{"executable": "fake"})
+	c.Assert(err, IsNil)
+	c.Assert(path, Equals, filepath.Join(s.dir, "plugins", "fake"))
+
+	path, err = d.executable(storage.Params{"executable": "/opt/array/bin/../volplugin"})
+	c.Assert(err, IsNil)
+	c.Assert(path, Equals, "/opt/array/volplugin")
+
+	_, err = d.executable(storage.Params{"executable": "bin/plugin"})
+	c.Assert(err, NotNil)
+	_, err = d.executable(storage.Params{})
+	c.Assert(err, NotNil)
+
+	do := driverOpts("policy1/test")
+	c.Assert(d.Validate(&do), IsNil)
+	do.Volume.Params = storage.Params{}
+	c.Assert(d.Validate(&do), NotNil)
+}
+
+func (s *execSuite) TestCRUD(c *C) {
+	d := s.driver()
+	do := driverOpts("policy1/test")
+
+	c.Assert(d.Create(do), IsNil)
+	c.Assert(d.Create(do), Equals, storage.ErrVolumeExist)
+	c.Assert(d.Format(do), IsNil)
+
+	exists, err := d.Exists(do)
+	c.Assert(err, IsNil)
+	c.Assert(exists, Equals, true)
+
+	list, err := d.List(storage.ListOptions{Params: do.Volume.Params})
+	c.Assert(err, IsNil)
+	c.Assert(list, DeepEquals, []storage.Volume{{Name: "policy1/test", Params: storage.Params{"executable": "fake"}}})
+
+	c.Assert(d.Destroy(do), IsNil)
+
+	exists, err = d.Exists(do)
+	c.Assert(err, IsNil)
+	c.Assert(exists, Equals, false)
+
+	do.Volume.Params["executable"] = "broken"
+	err = d.Create(do)
+	c.Assert(err, NotNil)
+	c.Assert(err, ErrorMatches, "(?s).*broken.*")
+
+	do.Volume.Params["executable"] = "nonexistent"
+	c.Assert(d.Create(do), NotNil)
+}
+
+func (s *execSuite) TestSnapshots(c *C) {
+	d := s.driver()
+	do := driverOpts("policy1/test")
+
+	c.Assert(d.Create(do), IsNil)
+	c.Assert(d.CreateSnapshot("snap", do), IsNil)
+
+	list, err := d.ListSnapshots(do)
+	c.Assert(err, IsNil)
+	c.Assert(storage.SnapshotNames(list), DeepEquals, []string{"snap"})
+	c.Assert(list[0].Created.IsZero(), Equals, false)
+
+	c.Assert(d.RollbackSnapshot("snap", do), IsNil)
+	err = d.RollbackSnapshot("nonexistent", do)
+	c.Assert(err, NotNil)
+	c.Assert(err.(*errored.Error).Contains(errors.NotExists), Equals, true)
+
+	err = d.CopySnapshot(do, "nonexistent", "policy1/copy")
+	c.Assert(err, NotNil)
+	c.Assert(err.(*errored.Error).Contains(errors.SnapshotCopy), Equals, true)
+	c.Assert(err.(*errored.Error).Contains(errors.NotExists), Equals, true)
+
+	// unknown methods fail with the standard error of the plugin.
+	c.Assert(d.RemoveSnapshot("snap", do), ErrorMatches, "(?s).*unknown method.*")
+}
+
+func (s *execSuite) TestMountUnmount(c *C) {
+	d := s.driver()
+	do := driverOpts("policy1/test")
+
+	c.Assert(d.Create(do), IsNil)
+
+	mount, err := d.Mount(do)
+	c.Assert(err, IsNil)
+	c.Assert(mount.Path, Equals, filepath.Join(s.dir, "mnt/exec/policy1/test"))
+	c.Assert(mount.Device, Equals, "/dev/fake")
+	c.Assert(mount.DevMajor, Equals, uint(1))
+	c.Assert(mount.DevMinor, Equals, uint(2))
+
+	fi, err := os.Stat(mount.Path)
+	c.Assert(err, IsNil)
+	c.Assert(fi.IsDir(), Equals, true)
+
+	// the broken plugin is skipped.
+	mounts, err := d.Mounted(10 * time.Second)
+	c.Assert(err, IsNil)
+	c.Assert(mounts, DeepEquals, []*storage.Mount{mount})
+
+	c.Assert(d.Unmount(do), IsNil)
+
+	_, err = os.Stat(mount.Path)
+	c.Assert(os.IsNotExist(err), Equals, true)
+
+	mounts, err = d.Mounted(10 * time.Second)
+	c.Assert(err, IsNil)
+	c.Assert(len(mounts), Equals, 0)
+}
+
+func (s *execSuite) TestSnapshotUnmarshal(c *C) {
+	snaps := []Snapshot{}
+	c.Assert(json.Unmarshal([]byte(`["old", {"name": "new", "size": 10}]`), &snaps), IsNil)
+	c.Assert(snaps, DeepEquals, []Snapshot{
+		{storage.Snapshot{Name: "old"}},
+		{storage.Snapshot{Name: "new", Size: 10}},
+	})
+
+	c.Assert(json.Unmarshal([]byte(`[1]`), &snaps), NotNil)
+}
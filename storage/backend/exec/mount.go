@@ -0,0 +1,144 @@
+package exec
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/storage"
+)
+
+// mountRoot is the directory under the mountpath that all exec volumes are
+// mounted in. Keeping them apart allows Mounted() to tell them from the
+// mounts of other drivers.
+func (d *Driver) mountRoot() string {
+	return filepath.Join(d.mountpath, BackendName)
+}
+
+func (d *Driver) mkMountPath(volName string) (string, error) {
+	policy, name, err := storage.SplitName(volName)
+	if err != nil {
+		return "", err
+	}
+
+	// Directory to mount the volume
+	volumePath := filepath.Join(d.mountRoot(), policy, name)
+	rel, err := filepath.Rel(d.mountRoot(), volumePath)
+	if err != nil || strings.Contains(rel, "..") {
+		return "", errors.MountFailed.Combine(errored.Errorf("Calculated volume path would escape subdir jail: %v", volumePath))
+	}
+
+	return volumePath, nil
+}
+
+// MountPath returns the path of a mount for a policy/volume.
+func (d *Driver) MountPath(do storage.DriverOptions) (string, error) {
+	return d.mkMountPath(do.Volume.Name)
+}
+
+// Mount a volume. Returns the mount information about the volume.
+func (d *Driver) Mount(do storage.DriverOptions) (*storage.Mount, error) {
+	volumePath, err := d.mkMountPath(do.Volume.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(volumePath, 0700); err != nil && !os.IsExist(err) {
+		return nil, errored.Errorf("error creating %q directory: %v", volumePath, err)
+	}
+
+	resp, err := d.callVolume("mount", do, Request{MountPath: volumePath})
+	if err != nil {
+		return nil, errors.MountFailed.Combine(err)
+	}
+
+	mount := &storage.Mount{Path: volumePath, Volume: do.Volume}
+	if resp.Mount != nil {
+		mount.Device = resp.Mount.Device
+		mount.DevMajor = resp.Mount.DevMajor
+		mount.DevMinor = resp.Mount.DevMinor
+	}
+
+	return mount, nil
+}
+
+// Unmount a volume.
+func (d *Driver) Unmount(do storage.DriverOptions) error {
+	volumePath, err := d.mkMountPath(do.Volume.Name)
+	if err != nil {
+		return err
+	}
+
+	if _, err := d.callVolume("unmount", do, Request{MountPath: volumePath}); err != nil {
+		return errored.Errorf("Failed to unmount %q", volumePath).Combine(err)
+	}
+
+	if err := os.Remove(volumePath); err != nil && !os.IsNotExist(err) {
+		logrus.Error(errored.Errorf("error removing %q directory: %v", volumePath, err))
+	}
+
+	return nil
+}
+
+// plugins returns every plugin which may hold mounts: the ones installed in
+// the plugin path and the others used by this process.
+func (d *Driver) plugins() ([]string, error) {
+	plugins := []string{}
+
+	fis, err := ioutil.ReadDir(d.pluginPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errored.Errorf("Reading plugin directory %q", d.pluginPath).Combine(err)
+	}
+
+	for _, fi := range fis {
+		if fi.Mode().IsRegular() && fi.Mode()&0111 != 0 {
+			plugins = append(plugins, filepath.Join(d.pluginPath, fi.Name()))
+		}
+	}
+
+	executables.Lock()
+	defer executables.Unlock()
+
+	for path := range executables.paths {
+		plugins = append(plugins, path)
+	}
+
+	return plugins, nil
+}
+
+// Mounted shows any volumes that belong to volplugin on the host, in
+// their native representation. They yield a *Mount.
+func (d *Driver) Mounted(timeout time.Duration) ([]*storage.Mount, error) {
+	mounts := []*storage.Mount{}
+
+	plugins, err := d.plugins()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, plugin := range plugins {
+		resp, err := call(plugin, "mounted", Request{MountPath: d.mountRoot()}, timeout)
+		if err != nil {
+			// one broken plugin must not hide the mounts of the others.
+			logrus.Errorf("Could not list mounts of plugin %q: %v", plugin, err)
+			continue
+		}
+
+		for _, mount := range resp.Mounts {
+			rel, err := filepath.Rel(d.mountRoot(), mount.Path)
+			if err != nil || strings.HasPrefix(rel, "..") || len(strings.Split(rel, "/")) != 2 {
+				logrus.Errorf("Plugin %q yielded mount %q outside of %q, skipping", plugin, mount.Path, d.mountRoot())
+				continue
+			}
+
+			mounts = append(mounts, mount)
+		}
+	}
+
+	return mounts, nil
+}
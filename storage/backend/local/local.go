@@ -0,0 +1,247 @@
+package local
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/storage"
+)
+
+const (
+	// BackendName is the name of the local storage backend.
+	BackendName = "local"
+
+	// DefaultPath is the directory volumes are kept in when the `path` driver
+	// option is not set.
+	DefaultPath = "/var/lib/volplugin/local"
+)
+
+// Driver implements a storage driver on top of plain directories on the host.
+// Nothing leaves the host, so it is meant for scratch data which still wants
+// volplugin's locking and policies.
+//
+// -- Layout
+//
+// A volume `policy/volume` is the directory `<path>/policy/volume`, where
+// path is the `path` driver option or DefaultPath. It is bind mounted to be
+// used.
+//
+// -- Sizes
+//
+// Sizes are enforced with XFS project quotas if the directory is on XFS
+// mounted with `prjquota`. Each volume is made a project of its own, which is
+// recorded in the `project` parameter of the volume, and limited to its size.
+// Resizing the volume changes the limit, and Stats reports the quota. Sizes
+// are not enforced on other filesystems. Quotas can only be changed and read
+// on the host the volume belongs to, so volplugin there applies new sizes and
+// publishes the usage of its volumes.
+//
+// -- Host pinning
+//
+// Create records the host the volume was created on in the `host` parameter
+// of the volume, which is published with it. Mount refuses volumes that
+// belong to any other host.
+type Driver struct {
+	mountpath string
+}
+
+// NewMountDriver is a generator for Driver structs. It is used by the storage
+// framework to yield new drivers on every creation.
+func NewMountDriver(mountpath string) (storage.MountDriver, error) {
+	return &Driver{mountpath: mountpath}, nil
+}
+
+// NewCRUDDriver is a generator for Driver structs. It is used by the storage
+// framework to yield new drivers on every creation.
+func NewCRUDDriver() (storage.CRUDDriver, error) {
+	return &Driver{}, nil
+}
+
+// Name returns the local backend string
+func (d *Driver) Name() string {
+	return BackendName
+}
+
+func volumeRoot(params storage.Params) string {
+	if params["path"] == "" {
+		return DefaultPath
+	}
+
+	return params["path"]
+}
+
+// volumePath returns the path to the directory of the volume.
+func (d *Driver) volumePath(volume storage.Volume) (string, error) {
+	policy, name, err := storage.SplitName(volume.Name)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(volumeRoot(volume.Params), policy, name), nil
+}
+
+// Create a volume. The name of this host, and the project of the quota of the
+// volume if it has one, are recorded in the parameters of the volume.
+func (d *Driver) Create(do storage.DriverOptions) error {
+	if err := storage.ClaimHost(do.Volume); err != nil {
+		return err
+	}
+
+	dir, err := d.volumePath(do.Volume)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dir), 0700); err != nil {
+		return errored.Errorf("Creating policy directory for %q", do.Volume.Name).Combine(err)
+	}
+
+	if err := os.Mkdir(dir, 0755); os.IsExist(err) {
+		return storage.ErrVolumeExist
+	} else if err != nil {
+		return errored.Errorf("Creating directory %q", dir).Combine(err)
+	}
+
+	if err := storage.SetVolumeQuota(do, dir); err != nil {
+		if err := os.Remove(dir); err != nil {
+			logrus.Errorf("Error while trying to remove directory %q after failed quota setup: %v", dir, err)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Format formats a created volume. Directories need no formatting, so this
+// does nothing.
+func (d *Driver) Format(do storage.DriverOptions) error {
+	return nil
+}
+
+// Destroy a volume. Only the host the volume belongs to can destroy it.
+func (d *Driver) Destroy(do storage.DriverOptions) error {
+	if err := storage.CheckHost(do.Volume); err != nil {
+		return err
+	}
+
+	dir, err := d.volumePath(do.Volume)
+	if err != nil {
+		return err
+	}
+
+	if err := storage.ClearVolumeQuota(do, dir); err != nil {
+		logrus.Warnf("Could not lift the quota of volume %q, removing it anyway: %v", do.Volume.Name, err)
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		return errored.Errorf("Destroying directory for volume %q", do.Volume.Name).Combine(err)
+	}
+
+	return nil
+}
+
+// Rename moves the directory of the volume. Only the host the volume belongs
+// to can rename it.
+func (d *Driver) Rename(do storage.DriverOptions, newName string) error {
+	if err := storage.CheckHost(do.Volume); err != nil {
+		return err
+	}
+
+	dir, err := d.volumePath(do.Volume)
+	if err != nil {
+		return err
+	}
+
+	newDir, err := d.volumePath(storage.Volume{Name: newName, Params: do.Volume.Params})
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(newDir); err == nil {
+		return storage.ErrVolumeExist
+	}
+
+	if err := os.MkdirAll(filepath.Dir(newDir), 0700); err != nil {
+		return errored.Errorf("Creating policy directory for %q", newName).Combine(err)
+	}
+
+	if err := os.Rename(dir, newDir); err != nil {
+		return errored.Errorf("Renaming directory %q to %q", dir, newDir).Combine(err)
+	}
+
+	return nil
+}
+
+// List all volumes on this host.
+func (d *Driver) List(lo storage.ListOptions) ([]storage.Volume, error) {
+	root := volumeRoot(lo.Params)
+
+	host, err := storage.Hostname()
+	if err != nil {
+		return nil, errored.Errorf("Could not determine hostname").Combine(err)
+	}
+
+	dirs, err := filepath.Glob(filepath.Join(root, "*", "*"))
+	if err != nil {
+		return nil, errored.Errorf("Listing directories in %q", root).Combine(err)
+	}
+
+	list := []storage.Volume{}
+
+	for _, dir := range dirs {
+		if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+			continue
+		}
+
+		rel, err := filepath.Rel(root, dir)
+		if err != nil {
+			logrus.Errorf("Invalid directory %q found in %q, skipping", dir, root)
+			continue
+		}
+
+		list = append(list, storage.Volume{Name: rel, Params: storage.Params{"path": root, storage.HostParam: host}})
+	}
+
+	return list, nil
+}
+
+// Exists returns true if the volume already exists. Volumes belonging to
+// other hosts cannot be looked at, and are assumed to exist.
+func (d *Driver) Exists(do storage.DriverOptions) (bool, error) {
+	if do.Volume.Params[storage.HostParam] != "" {
+		if err := storage.CheckHost(do.Volume); err != nil {
+			logrus.Warnf("Cannot check for volume %q on this host, assuming it exists: %v", do.Volume.Name, err)
+			return true, nil
+		}
+	}
+
+	dir, err := d.volumePath(do.Volume)
+	if err != nil {
+		return false, err
+	}
+
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, errored.Errorf("Checking for directory %q", dir).Combine(err)
+	}
+
+	return true, nil
+}
+
+// Validate validates the driver options to ensure they are compatible with the
+// local storage driver.
+func (d *Driver) Validate(do *storage.DriverOptions) error {
+	// XXX check this first to guard against nil pointers ahead of time.
+	if err := do.Validate(); err != nil {
+		return err
+	}
+
+	if path := do.Volume.Params["path"]; path != "" && !filepath.IsAbs(path) {
+		return errored.Errorf("Path %q must be absolute in local storage driver.", path)
+	}
+
+	return nil
+}
@@ -0,0 +1,210 @@
+package local
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	. "testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/contiv/volplugin/storage"
+	"github.com/contiv/volplugin/storage/mountscan"
+)
+
+const (
+	myMountpath = "/mnt"
+	testHost    = "host1"
+)
+
+type localSuite struct {
+	path string
+}
+
+var _ = Suite(&localSuite{})
+
+func TestLocal(t *T) { TestingT(t) }
+
+func (s *localSuite) SetUpTest(c *C) {
+	storage.Hostname = func() (string, error) { return testHost, nil }
+
+	var err error
+	s.path, err = ioutil.TempDir("", "volplugin-local")
+	c.Assert(err, IsNil)
+}
+
+func (s *localSuite) TearDownTest(c *C) {
+	storage.Hostname = os.Hostname
+	c.Assert(os.RemoveAll(s.path), IsNil)
+}
+
+func (s *localSuite) driverOpts(name string) storage.DriverOptions {
+	return storage.DriverOptions{
+		Volume: storage.Volume{
+			Name:   name,
+			Size:   100,
+			Params: storage.Params{"path": s.path},
+		},
+		Timeout: 5 * time.Second,
+	}
+}
+
+func (s *localSuite) TestPaths(c *C) {
+	d := &Driver{mountpath: myMountpath}
+	do := s.driverOpts("policy1/test")
+
+	dir, err := d.volumePath(do.Volume)
+	c.Assert(err, IsNil)
+	c.Assert(dir, Equals, filepath.Join(s.path, "policy1/test"))
+
+	dir, err = d.volumePath(storage.Volume{Name: "policy1/test", Params: storage.Params{}})
+	c.Assert(err, IsNil)
+	c.Assert(dir, Equals, "/var/lib/volplugin/local/policy1/test")
+
+	_, err = d.volumePath(storage.Volume{Name: "test", Params: storage.Params{}})
+	c.Assert(err, NotNil)
+
+	mp, err := d.MountPath(do)
+	c.Assert(err, IsNil)
+	c.Assert(mp, Equals, "/mnt/local/policy1/test")
+}
+
+func (s *localSuite) TestValidate(c *C) {
+	d := &Driver{}
+	do := s.driverOpts("policy1/test")
+	c.Assert(d.Validate(&do), IsNil)
+
+	do.Volume.Params["path"] = ""
+	c.Assert(d.Validate(&do), IsNil)
+
+	do.Volume.Params["path"] = "relative"
+	c.Assert(d.Validate(&do), NotNil)
+}
+
+func (s *localSuite) TestHostPath(c *C) {
+	root := &mountscan.MountInfo{DeviceNumber: &mountscan.DeviceNumber{Major: 8, Minor: 1}, Root: "/", MountPoint: "/"}
+	other := &mountscan.MountInfo{DeviceNumber: &mountscan.DeviceNumber{Major: 0, Minor: 40}, Root: "/", MountPoint: "/tmp"}
+	vol := &mountscan.MountInfo{DeviceNumber: &mountscan.DeviceNumber{Major: 8, Minor: 1}, Root: "/var/lib/volplugin/local/policy1/test", MountPoint: "/mnt/local/policy1/test"}
+
+	c.Assert(hostPath(vol, []*mountscan.MountInfo{other, vol, root}), Equals, "/var/lib/volplugin/local/policy1/test")
+	c.Assert(hostPath(vol, []*mountscan.MountInfo{other, vol}), Equals, "")
+}
+
+func (s *localSuite) TestCRUD(c *C) {
+	d := &Driver{}
+	do := s.driverOpts("policy1/test")
+
+	c.Assert(d.Create(do), IsNil)
+	c.Assert(do.Volume.Params["host"], Equals, testHost)
+	c.Assert(d.Create(do), Equals, storage.ErrVolumeExist)
+	c.Assert(d.Format(do), IsNil)
+
+	exists, err := d.Exists(do)
+	c.Assert(err, IsNil)
+	c.Assert(exists, Equals, true)
+
+	list, err := d.List(storage.ListOptions{Params: storage.Params{"path": s.path}})
+	c.Assert(err, IsNil)
+	c.Assert(list, DeepEquals, []storage.Volume{{Name: "policy1/test", Params: storage.Params{"path": s.path, "host": testHost}}})
+
+	c.Assert(d.Destroy(do), IsNil)
+
+	exists, err = d.Exists(do)
+	c.Assert(err, IsNil)
+	c.Assert(exists, Equals, false)
+}
+
+func (s *localSuite) TestRename(c *C) {
+	d := &Driver{}
+	do := s.driverOpts("policy1/test")
+	c.Assert(d.Create(do), IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(s.path, "policy1/test/data"), []byte("data"), 0600), IsNil)
+
+	other := s.driverOpts("policy2/other")
+	c.Assert(d.Create(other), IsNil)
+	c.Assert(d.Rename(do, "policy2/other"), Equals, storage.ErrVolumeExist)
+
+	c.Assert(d.Rename(do, "policy2/test"), IsNil)
+
+	exists, err := d.Exists(do)
+	c.Assert(err, IsNil)
+	c.Assert(exists, Equals, false)
+
+	content, err := ioutil.ReadFile(filepath.Join(s.path, "policy2/test/data"))
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Equals, "data")
+
+	storage.Hostname = func() (string, error) { return "host2", nil }
+	do.Volume.Name = "policy2/test"
+	c.Assert(d.Rename(do, "policy2/moved"), NotNil)
+}
+
+func (s *localSuite) TestOtherHost(c *C) {
+	crud := &Driver{}
+	mountD := &Driver{mountpath: myMountpath}
+
+	do := s.driverOpts("policy1/test")
+	do.Volume.Params["host"] = "host2"
+
+	c.Assert(crud.Create(do), NotNil)
+
+	do.Volume.Params["host"] = ""
+	c.Assert(crud.Create(do), IsNil)
+
+	storage.Hostname = func() (string, error) { return "host2", nil }
+
+	_, err := mountD.Mount(do)
+	c.Assert(err, ErrorMatches, `.*Volume "policy1/test" belongs to host "host1", not "host2".*`)
+	c.Assert(crud.Destroy(do), NotNil)
+
+	exists, err := crud.Exists(do)
+	c.Assert(err, IsNil)
+	c.Assert(exists, Equals, true)
+
+	// volumes without an owner are refused as well.
+	do.Volume.Params["host"] = ""
+	_, err = mountD.Mount(do)
+	c.Assert(err, NotNil)
+}
+
+func (s *localSuite) TestMountUnmount(c *C) {
+	if os.Getuid() != 0 {
+		c.Skip("root privileges are required for this test")
+	}
+
+	crud, err := NewCRUDDriver()
+	c.Assert(err, IsNil)
+	mountD, err := NewMountDriver(myMountpath)
+	c.Assert(err, IsNil)
+
+	do := s.driverOpts("policy1/test")
+
+	c.Assert(crud.Create(do), IsNil)
+
+	mount, err := mountD.Mount(do)
+	c.Assert(err, IsNil)
+	c.Assert(mount.Path, Equals, "/mnt/local/policy1/test")
+
+	mounts, err := mountD.Mounted(do.Timeout)
+	c.Assert(err, IsNil)
+	c.Assert(len(mounts), Equals, 1)
+	c.Assert(mounts[0].Volume.Name, Equals, "policy1/test")
+	c.Assert(mounts[0].Volume.Params, DeepEquals, do.Volume.Params)
+	c.Assert(mounts[0].DevMajor, Equals, mount.DevMajor)
+	c.Assert(mounts[0].DevMinor, Equals, mount.DevMinor)
+
+	c.Assert(ioutil.WriteFile(filepath.Join(mount.Path, "test.txt"), []byte("Test string\n"), 0644), IsNil)
+
+	content, err := ioutil.ReadFile(filepath.Join(s.path, "policy1/test/test.txt"))
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Equals, "Test string\n")
+
+	c.Assert(mountD.Unmount(do), IsNil)
+
+	mounts, err = mountD.Mounted(do.Timeout)
+	c.Assert(err, IsNil)
+	c.Assert(len(mounts), Equals, 0)
+
+	c.Assert(crud.Destroy(do), IsNil)
+}
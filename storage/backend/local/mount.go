@@ -0,0 +1,182 @@
+package local
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/storage"
+	"github.com/contiv/volplugin/storage/mountscan"
+)
+
+// mountRoot is the directory under the mountpath that all local volumes are
+// mounted in. Keeping them apart allows Mounted() to tell them from the
+// mounts of other drivers.
+func (d *Driver) mountRoot() string {
+	return filepath.Join(d.mountpath, BackendName)
+}
+
+func (d *Driver) mkMountPath(volName string) (string, error) {
+	policy, name, err := storage.SplitName(volName)
+	if err != nil {
+		return "", err
+	}
+
+	// Directory to mount the volume
+	volumePath := filepath.Join(d.mountRoot(), policy, name)
+	rel, err := filepath.Rel(d.mountRoot(), volumePath)
+	if err != nil || strings.Contains(rel, "..") {
+		return "", errors.MountFailed.Combine(errored.Errorf("Calculated volume path would escape subdir jail: %v", volumePath))
+	}
+
+	return volumePath, nil
+}
+
+// MountPath returns the path of a mount for a policy/volume.
+func (d *Driver) MountPath(do storage.DriverOptions) (string, error) {
+	return d.mkMountPath(do.Volume.Name)
+}
+
+// Mount a volume. Returns the mount information about the volume. Volumes
+// belonging to other hosts are refused.
+func (d *Driver) Mount(do storage.DriverOptions) (*storage.Mount, error) {
+	if err := storage.CheckHost(do.Volume); err != nil {
+		return nil, errors.MountFailed.Combine(err)
+	}
+
+	dir, err := d.volumePath(do.Volume)
+	if err != nil {
+		return nil, err
+	}
+
+	volumePath, err := d.mkMountPath(do.Volume.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return nil, errored.Errorf("Failed to stat directory %q: %v", dir, err)
+	}
+
+	if err := os.MkdirAll(volumePath, 0700); err != nil && !os.IsExist(err) {
+		return nil, errored.Errorf("error creating %q directory: %v", volumePath, err)
+	}
+
+	// The directory is on whatever device holds the path, which is what
+	// mountinfo reports for the bind mount as well.
+	major, minor := storage.DevNumbers(fi.Sys().(*syscall.Stat_t).Dev)
+
+	if err := unix.Mount(dir, volumePath, "", unix.MS_BIND, ""); err != nil {
+		return nil, errored.Errorf("Failed to bind mount directory %q: %v", dir, err)
+	}
+
+	return &storage.Mount{
+		Device:   dir,
+		Path:     volumePath,
+		Volume:   do.Volume,
+		DevMajor: major,
+		DevMinor: minor,
+	}, nil
+}
+
+// Unmount a volume.
+func (d *Driver) Unmount(do storage.DriverOptions) error {
+	volumeDir, err := d.mkMountPath(do.Volume.Name)
+	if err != nil {
+		return err
+	}
+
+	var retries int
+	var lastErr error
+
+retry:
+	if retries < 3 {
+		if err := unix.Unmount(volumeDir, 0); err != nil && err != unix.ENOENT && err != unix.EINVAL {
+			lastErr = errored.Errorf("Failed to unmount %q (retrying): %v", volumeDir, err)
+			logrus.Error(lastErr)
+			retries++
+			time.Sleep(100 * time.Millisecond)
+			goto retry
+		}
+	} else {
+		return errored.Errorf("Failed to umount after 3 retries").Combine(lastErr)
+	}
+
+	if err := os.Remove(volumeDir); err != nil && !os.IsNotExist(err) {
+		logrus.Error(errored.Errorf("error removing %q directory: %v", volumeDir, err))
+	}
+
+	return nil
+}
+
+// hostPath finds where the directory mounted by volMount lives on the host,
+// by looking for another mount of the same device which contains it.
+func hostPath(volMount *mountscan.MountInfo, hostMounts []*mountscan.MountInfo) string {
+	for _, hostMount := range hostMounts {
+		if hostMount == volMount || *hostMount.DeviceNumber != *volMount.DeviceNumber {
+			continue
+		}
+
+		rel, err := filepath.Rel(hostMount.Root, volMount.Root)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+
+		return filepath.Join(hostMount.MountPoint, rel)
+	}
+
+	return ""
+}
+
+// Mounted shows any volumes that belong to volplugin on the host, in
+// their native representation. They yield a *Mount.
+func (d *Driver) Mounted(timeout time.Duration) ([]*storage.Mount, error) {
+	mounts := []*storage.Mount{}
+
+	host, err := storage.Hostname()
+	if err != nil {
+		return nil, errored.Errorf("Could not determine hostname").Combine(err)
+	}
+
+	hostMounts, err := mountscan.GetMounts(&mountscan.GetMountsRequest{DriverName: BackendName})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, hostMount := range hostMounts {
+		rel, err := filepath.Rel(d.mountRoot(), hostMount.MountPoint)
+		if err != nil || strings.HasPrefix(rel, "..") || len(strings.Split(rel, "/")) != 2 {
+			// not one of ours.
+			continue
+		}
+
+		params := storage.Params{storage.HostParam: host}
+
+		if dir := hostPath(hostMount, hostMounts); dir != "" {
+			params["path"] = filepath.Dir(filepath.Dir(dir))
+		} else {
+			logrus.Errorf("Could not determine the directory mounted at %q", hostMount.MountPoint)
+		}
+
+		mounts = append(mounts, &storage.Mount{
+			Device:   hostMount.MountSource,
+			DevMajor: hostMount.DeviceNumber.Major,
+			DevMinor: hostMount.DeviceNumber.Minor,
+			Path:     hostMount.MountPoint,
+			Volume: storage.Volume{
+				Name:   rel,
+				Params: params,
+			},
+		})
+	}
+
+	return mounts, nil
+}
@@ -0,0 +1,43 @@
+package local
+
+import (
+	"github.com/contiv/volplugin/storage"
+)
+
+// Resize changes the limit of the project quota of the volume to its size.
+// Volumes without one are given one if their directory is now on XFS with
+// project quotas enforced.
+func (d *Driver) Resize(do storage.DriverOptions) error {
+	if err := storage.CheckHost(do.Volume); err != nil {
+		return err
+	}
+
+	dir, err := d.volumePath(do.Volume)
+	if err != nil {
+		return err
+	}
+
+	return storage.ResizeVolumeQuota(do, dir)
+}
+
+// GrowFilesystem does nothing; the limit of the quota is all there is to
+// grow.
+func (d *Driver) GrowFilesystem(do storage.DriverOptions) error {
+	return nil
+}
+
+// Stats returns the limit and usage of the project quota of the volume.
+// Volumes without one yield errors.NoActionTaken, as only the filesystem they
+// are on can tell.
+func (d *Driver) Stats(do storage.DriverOptions) (*storage.Stats, error) {
+	if err := storage.CheckHost(do.Volume); err != nil {
+		return nil, err
+	}
+
+	dir, err := d.volumePath(do.Volume)
+	if err != nil {
+		return nil, err
+	}
+
+	return storage.VolumeQuotaStats(do, dir)
+}
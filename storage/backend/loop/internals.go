@@ -0,0 +1,122 @@
+package loop
+
+import (
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/storage"
+)
+
+// parseLosetup parses the output of `losetup -j <image>`, yielding the loop
+// devices the image is attached to. Lines look like:
+//
+//	/dev/loop0: [64769]:1179686 (/var/lib/volplugin/loop/policy1/test.img)
+func parseLosetup(output string) []string {
+	devices := []string{}
+
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 || !strings.HasPrefix(parts[0], "/dev/") {
+			logrus.Debugf("Invalid losetup output line %q, skipping", line)
+			continue
+		}
+
+		devices = append(devices, parts[0])
+	}
+
+	return devices
+}
+
+// attached returns the loop devices the volume's image is attached to.
+func (d *Driver) attached(do storage.DriverOptions) ([]string, error) {
+	image, err := d.imagePath(do.Volume)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := storage.RunCommand(exec.Command("losetup", "-j", image), do.Timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseLosetup(out), nil
+}
+
+// attach attaches the volume's image to a loop device, reusing an existing
+// attachment if there is one. The device path is returned.
+func (d *Driver) attach(do storage.DriverOptions) (string, error) {
+	devices, err := d.attached(do)
+	if err != nil {
+		return "", err
+	}
+
+	if len(devices) > 0 {
+		logrus.Debugf("Volume %q is already attached to %q", do.Volume.Name, devices[0])
+		return devices[0], nil
+	}
+
+	image, err := d.imagePath(do.Volume)
+	if err != nil {
+		return "", err
+	}
+
+	out, err := storage.RunCommand(exec.Command("losetup", "--find", "--show", image), do.Timeout)
+	if err != nil {
+		return "", errored.Errorf("Could not attach volume %q", do.Volume.Name).Combine(err)
+	}
+
+	device := strings.TrimSpace(out)
+	if device == "" {
+		return "", errored.Errorf("Attaching volume %q yielded no loop device", do.Volume.Name)
+	}
+
+	logrus.Debugf("attached volume %q as %q", do.Volume.Name, device)
+
+	return device, nil
+}
+
+// detach releases every loop device the volume's image is attached to.
+func (d *Driver) detach(do storage.DriverOptions) error {
+	devices, err := d.attached(do)
+	if err != nil {
+		return err
+	}
+
+	for _, device := range devices {
+		logrus.Debugf("Detaching volume %q from device %q", do.Volume.Name, device)
+		if _, err := storage.RunCommand(exec.Command("losetup", "-d", device), do.Timeout); err != nil {
+			return errored.Errorf("Could not detach volume %q (device %q)", do.Volume.Name, device).Combine(err)
+		}
+	}
+
+	return nil
+}
+
+// backingFile returns the image backing a loop device, via sysfs.
+func backingFile(device string) (string, error) {
+	content, err := ioutil.ReadFile(filepath.Join("/sys/block", filepath.Base(device), "loop", "backing_file"))
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(content)), nil
+}
+
+func (d *Driver) mkfsVolume(fscmd, devicePath string, timeout time.Duration) error {
+	cmd := exec.Command("/bin/sh", "-c", storage.TemplateFSCmd(fscmd, devicePath))
+	if _, err := storage.RunCommand(cmd, timeout); err != nil {
+		return errored.Errorf("Error creating filesystem on %s with cmd: %q", devicePath, fscmd).Combine(err)
+	}
+
+	return nil
+}
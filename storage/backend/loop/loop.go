@@ -0,0 +1,456 @@
+package loop
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/storage"
+	"github.com/docker/go-units"
+)
+
+const (
+	// BackendName is the name of the loop storage backend.
+	BackendName = "loop"
+
+	// DefaultImagePath is the directory images are kept in when the `path`
+	// driver option is not set.
+	DefaultImagePath = "/var/lib/volplugin/loop"
+
+	imageSuffix    = ".img"
+	snapshotSuffix = ".snapshots"
+	rollbackSuffix = ".rollback"
+)
+
+// Driver implements a storage driver backed by sparse image files attached
+// to loop devices. It needs nothing but a linux kernel with loop support, so
+// it is well suited to development machines.
+//
+// -- Layout
+//
+// Images live in the directory provided by the `path` driver option, or
+// DefaultImagePath. A volume `policy/volume` is stored as
+// `<path>/policy/volume.img`, and its snapshots are stored as copies in
+// `<path>/policy/volume.snapshots/`. Copies are made with `cp --reflink=auto`
+// so they are cheap on filesystems that support it (btrfs, xfs).
+type Driver struct {
+	mountpath string
+}
+
+// NewMountDriver is a generator for Driver structs. It is used by the storage
+// framework to yield new drivers on every creation.
+func NewMountDriver(mountpath string) (storage.MountDriver, error) {
+	return &Driver{mountpath: mountpath}, nil
+}
+
+// NewCRUDDriver is a generator for Driver structs. It is used by the storage
+// framework to yield new drivers on every creation.
+func NewCRUDDriver() (storage.CRUDDriver, error) {
+	return &Driver{}, nil
+}
+
+// NewSnapshotDriver is a generator for Driver structs. It is used by the storage
+// framework to yield new drivers on every creation.
+func NewSnapshotDriver() (storage.SnapshotDriver, error) {
+	return &Driver{}, nil
+}
+
+// Name returns the loop backend string
+func (d *Driver) Name() string {
+	return BackendName
+}
+
+func imageRoot(params storage.Params) string {
+	if params["path"] == "" {
+		return DefaultImagePath
+	}
+
+	return params["path"]
+}
+
+// imagePath returns the path to the image file for the volume.
+func (d *Driver) imagePath(volume storage.Volume) (string, error) {
+	policy, name, err := storage.SplitName(volume.Name)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(imageRoot(volume.Params), policy, name+imageSuffix), nil
+}
+
+// snapshotDir returns the directory which holds the snapshots of a volume.
+func (d *Driver) snapshotDir(volume storage.Volume) (string, error) {
+	policy, name, err := storage.SplitName(volume.Name)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(imageRoot(volume.Params), policy, name+snapshotSuffix), nil
+}
+
+func (d *Driver) snapshotPath(snapName string, volume storage.Volume) (string, error) {
+	if snapName == "" || snapName == "." || snapName == ".." || strings.Contains(snapName, "/") {
+		return "", errored.Errorf("Invalid snapshot name %q", snapName)
+	}
+
+	dir, err := d.snapshotDir(volume)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, snapName), nil
+}
+
+// copyImage copies an image, sharing blocks with the source where the
+// filesystem allows it and preserving holes otherwise.
+func copyImage(source, target string, timeout time.Duration) error {
+	cmd := exec.Command("cp", "--reflink=auto", "--sparse=always", source, target)
+	if _, err := storage.RunCommand(cmd, timeout); err != nil {
+		if rmErr := os.Remove(target); rmErr != nil && !os.IsNotExist(rmErr) {
+			logrus.Errorf("Could not remove partial copy %q: %v", target, rmErr)
+		}
+
+		return errored.Errorf("Copying %q to %q", source, target).Combine(err)
+	}
+
+	return nil
+}
+
+// Create a volume.
+func (d *Driver) Create(do storage.DriverOptions) error {
+	image, err := d.imagePath(do.Volume)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(image), 0700); err != nil {
+		return errored.Errorf("Creating image directory for %q", do.Volume.Name).Combine(err)
+	}
+
+	f, err := os.OpenFile(image, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if os.IsExist(err) {
+		return storage.ErrVolumeExist
+	} else if err != nil {
+		return errored.Errorf("Creating image %q", image).Combine(err)
+	}
+	defer f.Close()
+
+	// Size is in megabytes, just like it is for rbd.
+	if err := f.Truncate(int64(do.Volume.Size) * units.MiB); err != nil {
+		os.Remove(image)
+		return errored.Errorf("Sizing image %q", image).Combine(err)
+	}
+
+	return nil
+}
+
+// Format formats a created volume.
+func (d *Driver) Format(do storage.DriverOptions) error {
+	device, err := d.attach(do)
+	if err != nil {
+		return err
+	}
+
+	fsDevice, err := storage.FormatCrypt(do.Volume.Name, device, do.Encryption, do.Timeout)
+	if err == nil {
+		err = d.mkfsVolume(do.FSOptions.CreateCommand, fsDevice, do.Timeout)
+	}
+
+	if err != nil {
+		if err := storage.CloseCrypt(do.Volume.Name, do.Timeout); err != nil {
+			logrus.Errorf("Error while trying to close encrypted device after failed filesystem creation: %v", err)
+		}
+		if err := d.detach(do); err != nil {
+			logrus.Errorf("Error while trying to detach after failed filesystem creation: %v", err)
+		}
+		return err
+	}
+
+	if err := storage.CloseCrypt(do.Volume.Name, do.Timeout); err != nil {
+		return err
+	}
+
+	return d.detach(do)
+}
+
+// Destroy a volume.
+func (d *Driver) Destroy(do storage.DriverOptions) error {
+	image, err := d.imagePath(do.Volume)
+	if err != nil {
+		return err
+	}
+
+	snapDir, err := d.snapshotDir(do.Volume)
+	if err != nil {
+		return err
+	}
+
+	if err := os.RemoveAll(snapDir); err != nil {
+		return errored.Errorf("Destroying snapshots for volume %q", do.Volume.Name).Combine(err)
+	}
+
+	if err := os.Remove(image); err != nil {
+		return errored.Errorf("Destroying image for volume %q", do.Volume.Name).Combine(err)
+	}
+
+	return nil
+}
+
+// List all volumes.
+func (d *Driver) List(lo storage.ListOptions) ([]storage.Volume, error) {
+	root := imageRoot(lo.Params)
+
+	images, err := filepath.Glob(filepath.Join(root, "*", "*"+imageSuffix))
+	if err != nil {
+		return nil, errored.Errorf("Listing images in %q", root).Combine(err)
+	}
+
+	list := []storage.Volume{}
+
+	for _, image := range images {
+		rel, err := filepath.Rel(root, strings.TrimSuffix(image, imageSuffix))
+		if err != nil {
+			logrus.Errorf("Invalid image %q found in %q, skipping", image, root)
+			continue
+		}
+
+		list = append(list, storage.Volume{Name: rel, Params: storage.Params{"path": root}})
+	}
+
+	return list, nil
+}
+
+// Exists returns true if the volume already exists.
+func (d *Driver) Exists(do storage.DriverOptions) (bool, error) {
+	image, err := d.imagePath(do.Volume)
+	if err != nil {
+		return false, err
+	}
+
+	if _, err := os.Stat(image); os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, errored.Errorf("Checking for image %q", image).Combine(err)
+	}
+
+	return true, nil
+}
+
+// CreateSnapshot creates a named snapshot for the volume. Any error will be returned.
+func (d *Driver) CreateSnapshot(snapName string, do storage.DriverOptions) error {
+	image, err := d.imagePath(do.Volume)
+	if err != nil {
+		return err
+	}
+
+	snapName = strings.Replace(snapName, " ", "-", -1)
+	snapPath, err := d.snapshotPath(snapName, do.Volume)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(snapPath), 0700); err != nil {
+		return errored.Errorf("Creating snapshot directory for volume %q", do.Volume.Name).Combine(err)
+	}
+
+	if _, err := os.Stat(snapPath); err == nil {
+		return errored.Errorf("Snapshot %q (volume %q) already exists", snapName, do.Volume.Name).Combine(errors.Exists)
+	}
+
+	return copyImage(image, snapPath, do.Timeout)
+}
+
+// RemoveSnapshot removes a named snapshot for the volume. Any error will be returned.
+func (d *Driver) RemoveSnapshot(snapName string, do storage.DriverOptions) error {
+	snapPath, err := d.snapshotPath(snapName, do.Volume)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(snapPath); err != nil {
+		return errored.Errorf("Removing snapshot %q (volume %q)", snapName, do.Volume.Name).Combine(err)
+	}
+
+	return nil
+}
+
+type byModTime []os.FileInfo
+
+func (b byModTime) Len() int      { return len(b) }
+func (b byModTime) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+
+func (b byModTime) Less(i, j int) bool {
+	if b[i].ModTime().Equal(b[j].ModTime()) {
+		return b[i].Name() < b[j].Name()
+	}
+
+	return b[i].ModTime().Before(b[j].ModTime())
+}
+
+// RollbackSnapshot replaces the image of the volume with a copy of the
+// snapshot. The image is only replaced once the copy is complete.
+func (d *Driver) RollbackSnapshot(snapName string, do storage.DriverOptions) error {
+	image, err := d.imagePath(do.Volume)
+	if err != nil {
+		return err
+	}
+
+	snapPath, err := d.snapshotPath(snapName, do.Volume)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(snapPath); err != nil {
+		return errored.Errorf("Snapshot %q (volume %q) could not be found", snapName, do.Volume.Name).Combine(errors.NotExists)
+	}
+
+	tmpImage := image + rollbackSuffix
+	if err := copyImage(snapPath, tmpImage, do.Timeout); err != nil {
+		return errored.Errorf("Rolling back volume %q to snapshot %q", do.Volume.Name, snapName).Combine(err)
+	}
+
+	if err := os.Rename(tmpImage, image); err != nil {
+		return errored.Errorf("Rolling back volume %q to snapshot %q", do.Volume.Name, snapName).Combine(err)
+	}
+
+	return nil
+}
+
+// ListSnapshots returns the snapshots of the volume, oldest first. Any error
+// will be returned.
+func (d *Driver) ListSnapshots(do storage.DriverOptions) ([]storage.Snapshot, error) {
+	snapDir, err := d.snapshotDir(do.Volume)
+	if err != nil {
+		return nil, err
+	}
+
+	snaps := []storage.Snapshot{}
+
+	dir, err := os.Open(snapDir)
+	if os.IsNotExist(err) {
+		return snaps, nil
+	} else if err != nil {
+		return nil, errored.Errorf("Listing snapshots for volume %q", do.Volume.Name).Combine(err)
+	}
+	defer dir.Close()
+
+	fis, err := dir.Readdir(-1)
+	if err != nil {
+		return nil, errored.Errorf("Listing snapshots for volume %q", do.Volume.Name).Combine(err)
+	}
+
+	sort.Sort(byModTime(fis))
+
+	// snapshot images are written once, when they are taken.
+	for _, fi := range fis {
+		snaps = append(snaps, storage.Snapshot{
+			Name:    fi.Name(),
+			Created: fi.ModTime(),
+			Size:    uint64(fi.Size()),
+		})
+	}
+
+	return snaps, nil
+}
+
+// CopySnapshot copies a snapshot into a new volume. Takes a DriverOptions,
+// snap and volume name (string). Returns error on failure.
+func (d *Driver) CopySnapshot(do storage.DriverOptions, snapName, newName string) error {
+	snapPath, err := d.snapshotPath(snapName, do.Volume)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(snapPath); err != nil {
+		return errored.Errorf("Snapshot %q (volume %q) could not be found", snapName, do.Volume.Name).Combine(errors.SnapshotCopy).Combine(err)
+	}
+
+	newImage, err := d.imagePath(storage.Volume{Name: newName, Params: do.Volume.Params})
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(newImage); err == nil {
+		return errored.Errorf("Volume %q already exists", newName).Combine(errors.Exists)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(newImage), 0700); err != nil {
+		return errored.Errorf("Creating image directory for %q", newName).Combine(err)
+	}
+
+	if err := copyImage(snapPath, newImage, do.Timeout); err != nil {
+		return errors.SnapshotCopy.Combine(err)
+	}
+
+	return nil
+}
+
+// Export writes the image of the snapshot of the volume to w.
+func (d *Driver) Export(do storage.DriverOptions, snapName string, w io.Writer) error {
+	snapPath, err := d.snapshotPath(snapName, do.Volume)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(snapPath)
+	if err != nil {
+		return errored.Errorf("Exporting snapshot %q (volume %q)", snapName, do.Volume.Name).Combine(err)
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(w, f); err != nil {
+		return errored.Errorf("Exporting snapshot %q (volume %q)", snapName, do.Volume.Name).Combine(err)
+	}
+
+	return nil
+}
+
+// Import creates the volume from an image written by Export. The volume takes
+// the size of the image.
+func (d *Driver) Import(do storage.DriverOptions, r io.Reader) error {
+	image, err := d.imagePath(do.Volume)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(image), 0700); err != nil {
+		return errored.Errorf("Creating image directory for %q", do.Volume.Name).Combine(err)
+	}
+
+	f, err := os.OpenFile(image, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if os.IsExist(err) {
+		return storage.ErrVolumeExist
+	} else if err != nil {
+		return errored.Errorf("Creating image %q", image).Combine(err)
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, r); err != nil {
+		os.Remove(image)
+		return errored.Errorf("Importing volume %q", do.Volume.Name).Combine(err)
+	}
+
+	return nil
+}
+
+// Validate validates the driver options to ensure they are compatible with the
+// loop storage driver.
+func (d *Driver) Validate(do *storage.DriverOptions) error {
+	// XXX check this first to guard against nil pointers ahead of time.
+	if err := do.Validate(); err != nil {
+		return err
+	}
+
+	if path := do.Volume.Params["path"]; path != "" && !filepath.IsAbs(path) {
+		return errored.Errorf("Image path %q must be absolute in loop storage driver.", path)
+	}
+
+	return nil
+}
@@ -0,0 +1,240 @@
+package loop
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	. "testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/contiv/volplugin/storage"
+)
+
+const myMountpath = "/mnt"
+
+type loopSuite struct {
+	imagePath string
+}
+
+var _ = Suite(&loopSuite{})
+
+func TestLoop(t *T) { TestingT(t) }
+
+func (s *loopSuite) SetUpTest(c *C) {
+	var err error
+	s.imagePath, err = ioutil.TempDir("", "volplugin-loop")
+	c.Assert(err, IsNil)
+}
+
+func (s *loopSuite) TearDownTest(c *C) {
+	c.Assert(os.RemoveAll(s.imagePath), IsNil)
+}
+
+func (s *loopSuite) driverOpts(name string) storage.DriverOptions {
+	return storage.DriverOptions{
+		Volume: storage.Volume{
+			Name:   name,
+			Size:   100,
+			Params: storage.Params{"path": s.imagePath},
+		},
+		FSOptions: storage.FSOptions{
+			Type:          "ext4",
+			CreateCommand: "mkfs.ext4 -F -m0 %",
+		},
+		Timeout: 10 * time.Second,
+	}
+}
+
+func (s *loopSuite) TestParseLosetup(c *C) {
+	c.Assert(parseLosetup(""), DeepEquals, []string{})
+	c.Assert(parseLosetup("/dev/loop0: [64769]:1179686 (/var/lib/volplugin/loop/policy1/test.img)\n"), DeepEquals, []string{"/dev/loop0"})
+	c.Assert(parseLosetup("/dev/loop0: [64769]:1 (/a.img)\n/dev/loop3: [64769]:1 (/a.img)\n"), DeepEquals, []string{"/dev/loop0", "/dev/loop3"})
+	c.Assert(parseLosetup("garbage\n"), DeepEquals, []string{})
+}
+
+func (s *loopSuite) TestPaths(c *C) {
+	d := &Driver{mountpath: myMountpath}
+	do := s.driverOpts("policy1/test")
+
+	image, err := d.imagePath(do.Volume)
+	c.Assert(err, IsNil)
+	c.Assert(image, Equals, filepath.Join(s.imagePath, "policy1", "test.img"))
+
+	image, err = d.imagePath(storage.Volume{Name: "policy1/test", Params: storage.Params{}})
+	c.Assert(err, IsNil)
+	c.Assert(image, Equals, filepath.Join(DefaultImagePath, "policy1", "test.img"))
+
+	_, err = d.imagePath(storage.Volume{Name: "test"})
+	c.Assert(err, NotNil)
+
+	mp, err := d.MountPath(do)
+	c.Assert(err, IsNil)
+	c.Assert(mp, Equals, "/mnt/loop/policy1/test")
+
+	_, err = d.snapshotPath("../test.img", do.Volume)
+	c.Assert(err, NotNil)
+	_, err = d.snapshotPath("..", do.Volume)
+	c.Assert(err, NotNil)
+}
+
+func (s *loopSuite) TestValidate(c *C) {
+	d := &Driver{}
+	do := s.driverOpts("policy1/test")
+	c.Assert(d.Validate(&do), IsNil)
+
+	do.Volume.Params["path"] = "relative/path"
+	c.Assert(d.Validate(&do), NotNil)
+
+	do.Volume.Params["path"] = ""
+	c.Assert(d.Validate(&do), IsNil)
+}
+
+func (s *loopSuite) TestCRUD(c *C) {
+	d := &Driver{}
+	do := s.driverOpts("policy1/test")
+
+	exists, err := d.Exists(do)
+	c.Assert(err, IsNil)
+	c.Assert(exists, Equals, false)
+
+	c.Assert(d.Create(do), IsNil)
+	c.Assert(d.Create(do), Equals, storage.ErrVolumeExist)
+
+	fi, err := os.Stat(filepath.Join(s.imagePath, "policy1", "test.img"))
+	c.Assert(err, IsNil)
+	c.Assert(fi.Size(), Equals, int64(100*1024*1024))
+
+	exists, err = d.Exists(do)
+	c.Assert(err, IsNil)
+	c.Assert(exists, Equals, true)
+
+	list, err := d.List(storage.ListOptions{Params: do.Volume.Params})
+	c.Assert(err, IsNil)
+	c.Assert(list, DeepEquals, []storage.Volume{{Name: "policy1/test", Params: storage.Params{"path": s.imagePath}}})
+
+	c.Assert(d.Destroy(do), IsNil)
+
+	exists, err = d.Exists(do)
+	c.Assert(err, IsNil)
+	c.Assert(exists, Equals, false)
+}
+
+func (s *loopSuite) TestSnapshots(c *C) {
+	d := &Driver{}
+	do := s.driverOpts("policy1/test")
+
+	c.Assert(d.Create(do), IsNil)
+	c.Assert(d.CreateSnapshot("test snap", do), IsNil)
+	c.Assert(d.CreateSnapshot("test snap", do), NotNil)
+	c.Assert(d.CreateSnapshot("test2", do), IsNil)
+
+	list, err := d.ListSnapshots(do)
+	c.Assert(err, IsNil)
+	c.Assert(storage.SnapshotNames(list), DeepEquals, []string{"test-snap", "test2"})
+	c.Assert(list[0].Created.IsZero(), Equals, false)
+	c.Assert(list[0].Size, Equals, uint64(100*1024*1024))
+
+	c.Assert(d.CopySnapshot(do, "test-snap", "policy1/copy"), IsNil)
+	c.Assert(d.CopySnapshot(do, "test-snap", "policy1/copy"), NotNil)
+	c.Assert(d.CopySnapshot(do, "nonexistent", "policy1/copy2"), NotNil)
+
+	exists, err := d.Exists(s.driverOpts("policy1/copy"))
+	c.Assert(err, IsNil)
+	c.Assert(exists, Equals, true)
+
+	// rolling back discards what was written since the snapshot.
+	image, err := d.imagePath(do.Volume)
+	c.Assert(err, IsNil)
+	c.Assert(ioutil.WriteFile(image, []byte("Test string\n"), 0600), IsNil)
+	c.Assert(d.RollbackSnapshot("test2", do), IsNil)
+	c.Assert(d.RollbackSnapshot("nonexistent", do), NotNil)
+
+	fi, err := os.Stat(image)
+	c.Assert(err, IsNil)
+	c.Assert(fi.Size(), Equals, int64(100*1024*1024))
+
+	volumes, err := d.List(storage.ListOptions{Params: do.Volume.Params})
+	c.Assert(err, IsNil)
+	c.Assert(len(volumes), Equals, 2)
+
+	c.Assert(d.RemoveSnapshot("test-snap", do), IsNil)
+	list, err = d.ListSnapshots(do)
+	c.Assert(err, IsNil)
+	c.Assert(storage.SnapshotNames(list), DeepEquals, []string{"test2"})
+
+	c.Assert(d.Destroy(do), IsNil)
+	list, err = d.ListSnapshots(do)
+	c.Assert(err, IsNil)
+	c.Assert(list, DeepEquals, []storage.Snapshot{})
+}
+
+func (s *loopSuite) TestExportImport(c *C) {
+	d := &Driver{}
+	do := s.driverOpts("policy1/test")
+	do.Volume.Size = 1
+
+	c.Assert(d.Create(do), IsNil)
+
+	image, err := d.imagePath(do.Volume)
+	c.Assert(err, IsNil)
+	c.Assert(ioutil.WriteFile(image, []byte("Test string\n"), 0600), IsNil)
+	c.Assert(d.CreateSnapshot("snap", do), IsNil)
+
+	buf := &bytes.Buffer{}
+	c.Assert(d.Export(do, "snap", buf), IsNil)
+	c.Assert(d.Export(do, "nonexistent", &bytes.Buffer{}), NotNil)
+
+	importDO := s.driverOpts("policy1/imported")
+	c.Assert(d.Import(importDO, bytes.NewReader(buf.Bytes())), IsNil)
+	c.Assert(d.Import(importDO, bytes.NewReader(buf.Bytes())), Equals, storage.ErrVolumeExist)
+
+	imported, err := d.imagePath(importDO.Volume)
+	c.Assert(err, IsNil)
+	content, err := ioutil.ReadFile(imported)
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Equals, "Test string\n")
+
+	c.Assert(d.Destroy(do), IsNil)
+	c.Assert(d.Destroy(importDO), IsNil)
+}
+
+func (s *loopSuite) TestMountUnmount(c *C) {
+	if os.Getuid() != 0 {
+		c.Skip("mounting loop devices requires root")
+	}
+
+	crud, err := NewCRUDDriver()
+	c.Assert(err, IsNil)
+	mountD, err := NewMountDriver(myMountpath)
+	c.Assert(err, IsNil)
+
+	do := s.driverOpts("policy1/test")
+
+	c.Assert(crud.Create(do), IsNil)
+	c.Assert(crud.Format(do), IsNil)
+
+	mount, err := mountD.Mount(do)
+	c.Assert(err, IsNil)
+	c.Assert(mount.Path, Equals, "/mnt/loop/policy1/test")
+
+	mounts, err := mountD.Mounted(do.Timeout)
+	c.Assert(err, IsNil)
+	c.Assert(len(mounts), Equals, 1)
+	c.Assert(mounts[0].Volume.Name, Equals, "policy1/test")
+	c.Assert(mounts[0].Volume.Params["path"], Equals, s.imagePath)
+	c.Assert(mounts[0].DevMajor, Equals, mount.DevMajor)
+	c.Assert(mounts[0].DevMinor, Equals, mount.DevMinor)
+
+	c.Assert(ioutil.WriteFile(filepath.Join(mount.Path, "test.txt"), []byte("Test string\n"), 0644), IsNil)
+
+	c.Assert(mountD.Unmount(do), IsNil)
+
+	mounts, err = mountD.Mounted(do.Timeout)
+	c.Assert(err, IsNil)
+	c.Assert(len(mounts), Equals, 0)
+
+	c.Assert(crud.Destroy(do), IsNil)
+}
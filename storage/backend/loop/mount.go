@@ -0,0 +1,192 @@
+package loop
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/storage"
+	"github.com/contiv/volplugin/storage/mountscan"
+)
+
+// mountRoot is the directory under the mountpath that all loop volumes are
+// mounted in. Keeping them apart allows Mounted() to tell them from the
+// mounts of other drivers.
+func (d *Driver) mountRoot() string {
+	return filepath.Join(d.mountpath, BackendName)
+}
+
+func (d *Driver) mkMountPath(volName string) (string, error) {
+	policy, name, err := storage.SplitName(volName)
+	if err != nil {
+		return "", err
+	}
+
+	// Directory to mount the volume
+	volumePath := filepath.Join(d.mountRoot(), policy, name)
+	rel, err := filepath.Rel(d.mountRoot(), volumePath)
+	if err != nil || strings.Contains(rel, "..") {
+		return "", errors.MountFailed.Combine(errored.Errorf("Calculated volume path would escape subdir jail: %v", volumePath))
+	}
+
+	return volumePath, nil
+}
+
+// MountPath returns the path of a mount for a policy/volume.
+func (d *Driver) MountPath(do storage.DriverOptions) (string, error) {
+	return d.mkMountPath(do.Volume.Name)
+}
+
+// Mount a volume. Returns the mount information about the volume.
+func (d *Driver) Mount(do storage.DriverOptions) (_ *storage.Mount, err error) {
+	volumePath, err := d.mkMountPath(do.Volume.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	devName, err := d.attach(do)
+	if err != nil {
+		return nil, err
+	}
+
+	// volumes which fail to mount are left closed and detached.
+	defer func() {
+		if err == nil {
+			return
+		}
+
+		if err := storage.CloseCrypt(do.Volume.Name, do.Timeout); err != nil {
+			logrus.Errorf("Error while trying to close encrypted device after failed mount: %v", err)
+		}
+		if err := d.detach(do); err != nil {
+			logrus.Errorf("Error while trying to detach after failed mount: %v", err)
+		}
+	}()
+
+	// encrypted volumes are mounted from the dm-crypt mapping of the device.
+	devName, err = storage.OpenCrypt(do.Volume.Name, devName, do.Encryption, do.Timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(volumePath, 0700); err != nil && !os.IsExist(err) {
+		return nil, errored.Errorf("error creating %q directory: %v", volumePath, err)
+	}
+
+	// Obtain the major and minor node information about the device we're mounting.
+	// This is critical for tuning cgroups and obtaining metrics for this device only.
+	fi, err := os.Stat(devName)
+	if err != nil {
+		return nil, errored.Errorf("Failed to stat device %q: %v", devName, err)
+	}
+
+	major, minor := storage.DevNumbers(fi.Sys().(*syscall.Stat_t).Rdev)
+
+	flags, data := storage.ParseMountOptions(do.FSOptions.MountOptions)
+	if err := unix.Mount(devName, volumePath, do.FSOptions.Type, flags, data); err != nil {
+		return nil, errored.Errorf("Failed to mount loop dev %q: %v", devName, err)
+	}
+
+	return &storage.Mount{
+		Device:   devName,
+		Path:     volumePath,
+		Volume:   do.Volume,
+		DevMajor: major,
+		DevMinor: minor,
+	}, nil
+}
+
+// Unmount a volume.
+func (d *Driver) Unmount(do storage.DriverOptions) error {
+	volumeDir, err := d.mkMountPath(do.Volume.Name)
+	if err != nil {
+		return err
+	}
+
+	var retries int
+	var lastErr error
+
+retry:
+	if retries < 3 {
+		if err := unix.Unmount(volumeDir, 0); err != nil && err != unix.ENOENT && err != unix.EINVAL {
+			lastErr = errored.Errorf("Failed to unmount %q (retrying): %v", volumeDir, err)
+			logrus.Error(lastErr)
+			retries++
+			time.Sleep(100 * time.Millisecond)
+			goto retry
+		}
+	} else {
+		return errored.Errorf("Failed to umount after 3 retries").Combine(lastErr)
+	}
+
+	if err := os.Remove(volumeDir); err != nil && !os.IsNotExist(err) {
+		logrus.Error(errored.Errorf("error removing %q directory: %v", volumeDir, err))
+	}
+
+	if err := storage.CloseCrypt(do.Volume.Name, do.Timeout); err != nil {
+		return err
+	}
+
+	return d.detach(do)
+}
+
+// Mounted shows any volumes that belong to volplugin on the host, in
+// their native representation. They yield a *Mount.
+func (d *Driver) Mounted(timeout time.Duration) ([]*storage.Mount, error) {
+	mounts := []*storage.Mount{}
+	hostMounts := []*mountscan.MountInfo{}
+
+	// encrypted volumes are mounted from the dm-crypt mapping of their device.
+	for _, kernelDriver := range []string{"loop", "device-mapper"} {
+		driverMounts, err := mountscan.GetMounts(&mountscan.GetMountsRequest{DriverName: BackendName, KernelDriver: kernelDriver})
+		if err != nil {
+			if newerr, ok := err.(*errored.Error); ok && newerr.Contains(errors.ErrDevNotFound) {
+				continue
+			}
+			return nil, err
+		}
+
+		hostMounts = append(hostMounts, driverMounts...)
+	}
+
+	for _, hostMount := range hostMounts {
+		rel, err := filepath.Rel(d.mountRoot(), hostMount.MountPoint)
+		if err != nil || strings.HasPrefix(rel, "..") || len(strings.Split(rel, "/")) != 2 {
+			// not one of ours; loop devices are used for plenty of other things.
+			continue
+		}
+
+		device := hostMount.MountSource
+		if _, cryptDevice, ok := storage.CryptMapping(hostMount.DeviceNumber.Major, hostMount.DeviceNumber.Minor); ok {
+			device = cryptDevice
+		}
+
+		params := storage.Params{}
+
+		if backing, err := backingFile(device); err != nil {
+			logrus.Errorf("Could not determine backing file for %q: %v", device, err)
+		} else {
+			params["path"] = filepath.Dir(filepath.Dir(backing))
+		}
+
+		mounts = append(mounts, &storage.Mount{
+			Device:   hostMount.MountSource,
+			DevMajor: hostMount.DeviceNumber.Major,
+			DevMinor: hostMount.DeviceNumber.Minor,
+			Path:     hostMount.MountPoint,
+			Volume: storage.Volume{
+				Name:   rel,
+				Params: params,
+			},
+		})
+	}
+
+	return mounts, nil
+}
@@ -0,0 +1,129 @@
+package lvm
+
+import (
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/storage"
+)
+
+// lvsFields are the columns requested from lvs, in order.
+var lvsFields = []string{"vg_name", "lv_name", "lv_tags", "origin", "pool_lv", "lv_kernel_major", "lv_kernel_minor", "lv_time", "lv_size"}
+
+// lvTimeFormat is the format lvs prints lv_time in.
+const lvTimeFormat = "2006-01-02 15:04:05 -0700"
+
+// logicalVolume is a logical volume as reported by lvs.
+type logicalVolume struct {
+	Group   string
+	Name    string
+	Tags    []string
+	Origin  string
+	Pool    string
+	Major   int // -1 if inactive
+	Minor   int // -1 if inactive
+	Created time.Time
+	Size    uint64
+}
+
+func (lv *logicalVolume) hasTag(tag string) bool {
+	for _, t := range lv.Tags {
+		if t == tag {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (lv *logicalVolume) isVolume() bool {
+	return lv.hasTag(volumeTag) && !lv.hasTag(snapshotTag)
+}
+
+func (lv *logicalVolume) isSnapshot() bool {
+	return lv.hasTag(snapshotTag)
+}
+
+// listLVs lists the logical volumes in the volume group, oldest first. If the
+// group is empty, all logical volumes on the host are listed.
+func listLVs(group string, timeout time.Duration) ([]*logicalVolume, error) {
+	args := []string{
+		"--noheadings",
+		"--separator", "|",
+		"--sort", "lv_time",
+		"--units", "b",
+		"--nosuffix",
+		"-o", strings.Join(lvsFields, ","),
+	}
+
+	if group != "" {
+		args = append(args, group)
+	}
+
+	out, err := storage.RunCommand(exec.Command("lvs", args...), timeout)
+	if err != nil {
+		return nil, errored.Errorf("Listing logical volumes in volume group %q", group).Combine(err)
+	}
+
+	return parseLVS(out)
+}
+
+// parseLVS parses the output of lvs, requested with lvsFields and `|` as the
+// separator.
+func parseLVS(output string) ([]*logicalVolume, error) {
+	lvs := []*logicalVolume{}
+
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		parts := strings.Split(line, "|")
+		if len(parts) != len(lvsFields) {
+			return nil, errored.Errorf("Invalid lvs output line %q", line)
+		}
+
+		major, err := strconv.Atoi(strings.TrimSpace(parts[5]))
+		if err != nil {
+			return nil, errored.Errorf("Invalid major number in lvs output line %q", line).Combine(err)
+		}
+
+		minor, err := strconv.Atoi(strings.TrimSpace(parts[6]))
+		if err != nil {
+			return nil, errored.Errorf("Invalid minor number in lvs output line %q", line).Combine(err)
+		}
+
+		created, err := time.Parse(lvTimeFormat, strings.TrimSpace(parts[7]))
+		if err != nil {
+			return nil, errored.Errorf("Invalid creation time in lvs output line %q", line).Combine(err)
+		}
+
+		size, err := strconv.ParseUint(strings.TrimSpace(parts[8]), 10, 64)
+		if err != nil {
+			return nil, errored.Errorf("Invalid size in lvs output line %q", line).Combine(err)
+		}
+
+		tags := []string{}
+		if parts[2] != "" {
+			tags = strings.Split(parts[2], ",")
+		}
+
+		lvs = append(lvs, &logicalVolume{
+			Group:   parts[0],
+			Name:    parts[1],
+			Tags:    tags,
+			Origin:  parts[3],
+			Pool:    parts[4],
+			Major:   major,
+			Minor:   minor,
+			Created: created,
+			Size:    size,
+		})
+	}
+
+	return lvs, nil
+}
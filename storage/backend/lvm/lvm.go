@@ -0,0 +1,556 @@
+package lvm
+
+import (
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/storage"
+)
+
+const (
+	// BackendName is the name of the LVM storage backend.
+	BackendName = "lvm"
+
+	// volumeTag is set on every logical volume volplugin creates for a volume.
+	volumeTag = "volplugin"
+	// snapshotTag is set on every logical volume volplugin creates for a snapshot.
+	snapshotTag = "volplugin_snapshot"
+	// snapshotSeparator separates the volume name from the snapshot name in
+	// the logical volume names of snapshots.
+	snapshotSeparator = "_snap_"
+
+	// listTimeout is used for listing volumes, where the caller provides no
+	// timeout. It matches the default command timeout in the global config.
+	listTimeout = 10 * time.Minute
+)
+
+// LVM is picky about the characters in logical volume names.
+var invalidNameRegex = regexp.MustCompile(`[^A-Za-z0-9+_.-]`)
+
+// Driver implements a storage driver on top of LVM thin provisioning.
+//
+// -- Layout
+//
+// Volumes are thin logical volumes in the thin pool named by the `pool`
+// driver option, inside the volume group named by the `group` driver option.
+// A volume `policy/volume` is named `policy.volume`, just like it is in ceph.
+//
+// Snapshots are thin snapshots of the volume, named
+// `policy.volume_snap_<snapshot>`. Volumes and snapshots are tagged so they
+// can be told apart from each other and from logical volumes volplugin does
+// not own.
+//
+// -- Hosts
+//
+// Volume groups are local to a host, so volumes belong to the host they were
+// created on, which is recorded in the `host` driver option. Other hosts
+// refuse to work on them: volsupervisor and the apiserver can only snapshot,
+// copy or roll back volumes when they run on that host.
+type Driver struct {
+	mountpath string
+}
+
+// NewMountDriver is a generator for Driver structs. It is used by the storage
+// framework to yield new drivers on every creation.
+func NewMountDriver(mountpath string) (storage.MountDriver, error) {
+	return &Driver{mountpath: mountpath}, nil
+}
+
+// NewCRUDDriver is a generator for Driver structs. It is used by the storage
+// framework to yield new drivers on every creation.
+func NewCRUDDriver() (storage.CRUDDriver, error) {
+	return &Driver{}, nil
+}
+
+// NewSnapshotDriver is a generator for Driver structs. It is used by the storage
+// framework to yield new drivers on every creation.
+func NewSnapshotDriver() (storage.SnapshotDriver, error) {
+	return &Driver{}, nil
+}
+
+// Name returns the lvm backend string
+func (d *Driver) Name() string {
+	return BackendName
+}
+
+func (d *Driver) externalName(s string) string {
+	return strings.Join(strings.SplitN(s, ".", 2), "/")
+}
+
+// internalName translates a volplugin `policy/volume` name to a logical
+// volume name. Yields an error if impossible.
+func (d *Driver) internalName(s string) (string, error) {
+	policy, volume, err := storage.SplitName(s)
+	if err != nil {
+		return "", err
+	}
+
+	if strings.Contains(policy, ".") {
+		return "", errored.Errorf("Invalid policy name %q, cannot contain '.'", policy)
+	}
+
+	if strings.Contains(volume, "/") {
+		return "", errored.Errorf("Invalid volume name %q, cannot contain '/'", volume)
+	}
+
+	intName := policy + "." + volume
+	if invalidNameRegex.MatchString(intName) || strings.HasPrefix(intName, "-") {
+		return "", errored.Errorf("Invalid volume name %q, may only contain the characters [A-Za-z0-9+_.-]", s)
+	}
+
+	return intName, nil
+}
+
+// snapshotName translates a snapshot name into one suitable for a logical
+// volume. This is idempotent, so names returned by ListSnapshots() may be
+// passed back in.
+func snapshotName(snapName string) string {
+	return invalidNameRegex.ReplaceAllString(snapName, "-")
+}
+
+func snapshotLVName(intName, snapName string) string {
+	return intName + snapshotSeparator + snapshotName(snapName)
+}
+
+func lvPath(group, name string) string {
+	return group + "/" + name
+}
+
+func devicePath(group, name string) string {
+	return "/dev/" + lvPath(group, name)
+}
+
+func (d *Driver) activate(group, name string, timeout time.Duration) error {
+	// -K ignores the activation skip flag, which is set on thin snapshots.
+	if _, err := storage.RunCommand(exec.Command("lvchange", "-ay", "-K", lvPath(group, name)), timeout); err != nil {
+		return errored.Errorf("Activating logical volume %q", lvPath(group, name)).Combine(err)
+	}
+
+	return nil
+}
+
+func (d *Driver) deactivate(group, name string, timeout time.Duration) error {
+	if _, err := storage.RunCommand(exec.Command("lvchange", "-an", lvPath(group, name)), timeout); err != nil {
+		return errored.Errorf("Deactivating logical volume %q", lvPath(group, name)).Combine(err)
+	}
+
+	return nil
+}
+
+func (d *Driver) mkfsVolume(fscmd, devicePath string, timeout time.Duration) error {
+	cmd := exec.Command("/bin/sh", "-c", storage.TemplateFSCmd(fscmd, devicePath))
+	if _, err := storage.RunCommand(cmd, timeout); err != nil {
+		return errored.Errorf("Error creating filesystem on %s with cmd: %q", devicePath, fscmd).Combine(err)
+	}
+
+	return nil
+}
+
+// Create a volume. The name of this host is recorded in the parameters of
+// the volume.
+func (d *Driver) Create(do storage.DriverOptions) error {
+	intName, err := d.internalName(do.Volume.Name)
+	if err != nil {
+		return err
+	}
+
+	if err := storage.ClaimHost(do.Volume); err != nil {
+		return err
+	}
+
+	exists, err := d.Exists(do)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return storage.ErrVolumeExist
+	}
+
+	group := do.Volume.Params["group"]
+
+	cmd := exec.Command(
+		"lvcreate",
+		"--thin", lvPath(group, do.Volume.Params["pool"]),
+		"--virtualsize", strconv.FormatUint(do.Volume.Size, 10)+"m",
+		"--name", intName,
+		"--addtag", volumeTag,
+	)
+
+	if _, err := storage.RunCommand(cmd, do.Timeout); err != nil {
+		return errored.Errorf("Creating volume %q", do.Volume.Name).Combine(err)
+	}
+
+	return nil
+}
+
+// Format formats a created volume.
+func (d *Driver) Format(do storage.DriverOptions) error {
+	intName, err := d.internalName(do.Volume.Name)
+	if err != nil {
+		return err
+	}
+
+	group := do.Volume.Params["group"]
+
+	if err := d.activate(group, intName, do.Timeout); err != nil {
+		return err
+	}
+
+	fsDevice, err := storage.FormatCrypt(do.Volume.Name, devicePath(group, intName), do.Encryption, do.Timeout)
+	if err == nil {
+		err = d.mkfsVolume(do.FSOptions.CreateCommand, fsDevice, do.Timeout)
+	}
+
+	if err != nil {
+		if err := storage.CloseCrypt(do.Volume.Name, do.Timeout); err != nil {
+			logrus.Errorf("Error while trying to close encrypted device after failed filesystem creation: %v", err)
+		}
+		if err := d.deactivate(group, intName, do.Timeout); err != nil {
+			logrus.Errorf("Error while trying to deactivate after failed filesystem creation: %v", err)
+		}
+		return err
+	}
+
+	if err := storage.CloseCrypt(do.Volume.Name, do.Timeout); err != nil {
+		return err
+	}
+
+	return d.deactivate(group, intName, do.Timeout)
+}
+
+// Destroy a volume.
+func (d *Driver) Destroy(do storage.DriverOptions) error {
+	if err := storage.CheckHost(do.Volume); err != nil {
+		return err
+	}
+
+	intName, err := d.internalName(do.Volume.Name)
+	if err != nil {
+		return err
+	}
+
+	group := do.Volume.Params["group"]
+
+	// thin snapshots outlive their origin, so they must be removed explicitly.
+	snaps, err := d.snapshots(group, intName, do.Timeout)
+	if err != nil {
+		return err
+	}
+
+	for _, snap := range snaps {
+		if _, err := storage.RunCommand(exec.Command("lvremove", "-f", lvPath(group, snap.Name)), do.Timeout); err != nil {
+			return errored.Errorf("Destroying snapshots for volume %q", do.Volume.Name).Combine(err)
+		}
+	}
+
+	if _, err := storage.RunCommand(exec.Command("lvremove", "-f", lvPath(group, intName)), do.Timeout); err != nil {
+		return errored.Errorf("Destroying volume %q", do.Volume.Name).Combine(err)
+	}
+
+	return nil
+}
+
+// List all volumes on this host.
+func (d *Driver) List(lo storage.ListOptions) ([]storage.Volume, error) {
+	host, err := storage.Hostname()
+	if err != nil {
+		return nil, errored.Errorf("Could not determine hostname").Combine(err)
+	}
+
+	lvs, err := listLVs(lo.Params["group"], listTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	list := []storage.Volume{}
+
+	for _, lv := range lvs {
+		if !lv.isVolume() {
+			continue
+		}
+
+		if lo.Params["pool"] != "" && lv.Pool != lo.Params["pool"] {
+			continue
+		}
+
+		list = append(list, storage.Volume{
+			Name:   d.externalName(lv.Name),
+			Params: storage.Params{"group": lv.Group, "pool": lv.Pool, storage.HostParam: host},
+		})
+	}
+
+	return list, nil
+}
+
+// Exists returns true if the volume already exists. Volumes belonging to
+// other hosts cannot be looked at, and are assumed to exist.
+func (d *Driver) Exists(do storage.DriverOptions) (bool, error) {
+	if do.Volume.Params[storage.HostParam] != "" {
+		if err := storage.CheckHost(do.Volume); err != nil {
+			logrus.Warnf("Cannot check for volume %q on this host, assuming it exists: %v", do.Volume.Name, err)
+			return true, nil
+		}
+	}
+
+	volumes, err := d.List(storage.ListOptions{Params: do.Volume.Params})
+	if err != nil {
+		return false, err
+	}
+
+	for _, vol := range volumes {
+		if vol.Name == do.Volume.Name {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// snapshots returns the snapshot logical volumes of the volume, oldest first.
+func (d *Driver) snapshots(group, intName string, timeout time.Duration) ([]*logicalVolume, error) {
+	lvs, err := listLVs(group, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	snaps := []*logicalVolume{}
+
+	for _, lv := range lvs {
+		if lv.isSnapshot() && lv.Origin == intName && strings.HasPrefix(lv.Name, intName+snapshotSeparator) {
+			snaps = append(snaps, lv)
+		}
+	}
+
+	return snaps, nil
+}
+
+// CreateSnapshot creates a named snapshot for the volume. Any error will be returned.
+func (d *Driver) CreateSnapshot(snapName string, do storage.DriverOptions) error {
+	if err := storage.CheckHost(do.Volume); err != nil {
+		return err
+	}
+
+	intName, err := d.internalName(do.Volume.Name)
+	if err != nil {
+		return err
+	}
+
+	group := do.Volume.Params["group"]
+
+	cmd := exec.Command(
+		"lvcreate",
+		"--snapshot", lvPath(group, intName),
+		"--name", snapshotLVName(intName, snapName),
+		"--addtag", snapshotTag,
+	)
+
+	if _, err := storage.RunCommand(cmd, do.Timeout); err != nil {
+		return errored.Errorf("Creating snapshot %q (volume %q)", snapName, do.Volume.Name).Combine(err)
+	}
+
+	return nil
+}
+
+// RemoveSnapshot removes a named snapshot for the volume. Any error will be returned.
+func (d *Driver) RemoveSnapshot(snapName string, do storage.DriverOptions) error {
+	if err := storage.CheckHost(do.Volume); err != nil {
+		return err
+	}
+
+	intName, err := d.internalName(do.Volume.Name)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command("lvremove", "-f", lvPath(do.Volume.Params["group"], snapshotLVName(intName, snapName)))
+	if _, err := storage.RunCommand(cmd, do.Timeout); err != nil {
+		return errored.Errorf("Removing snapshot %q (volume %q)", snapName, do.Volume.Name).Combine(err)
+	}
+
+	return nil
+}
+
+// RollbackSnapshot copies the snapshot over the volume. Removing the volume
+// and replacing it with a snapshot of the snapshot would be cheaper, but thin
+// snapshots are only found through their origin, so the other snapshots of the
+// volume would be lost.
+func (d *Driver) RollbackSnapshot(snapName string, do storage.DriverOptions) error {
+	if err := storage.CheckHost(do.Volume); err != nil {
+		return err
+	}
+
+	intName, err := d.internalName(do.Volume.Name)
+	if err != nil {
+		return err
+	}
+
+	group := do.Volume.Params["group"]
+	snapLV := snapshotLVName(intName, snapName)
+
+	snaps, err := d.snapshots(group, intName, do.Timeout)
+	if err != nil {
+		return err
+	}
+
+	var found bool
+	for _, snap := range snaps {
+		if snap.Name == snapLV {
+			found = true
+			break
+		}
+	}
+
+	if !found {
+		return errored.Errorf("Snapshot %q (volume %q) could not be found", snapName, do.Volume.Name).Combine(errors.NotExists)
+	}
+
+	for _, name := range []string{intName, snapLV} {
+		if err := d.activate(group, name, do.Timeout); err != nil {
+			return err
+		}
+
+		defer func(name string) {
+			if err := d.deactivate(group, name, do.Timeout); err != nil {
+				logrus.Error(err)
+			}
+		}(name)
+	}
+
+	// the blocks of the volume are discarded first, so that the zeros of the
+	// snapshot can be skipped instead of provisioning all of the volume from
+	// the thin pool.
+	if _, err := storage.RunCommand(exec.Command("blkdiscard", devicePath(group, intName)), do.Timeout); err != nil {
+		return errored.Errorf("Discarding the blocks of volume %q before rolling it back", do.Volume.Name).Combine(err)
+	}
+
+	cmd := exec.Command(
+		"dd",
+		"if="+devicePath(group, snapLV),
+		"of="+devicePath(group, intName),
+		"bs=4M",
+		"conv=sparse,fsync",
+	)
+
+	if _, err := storage.RunCommand(cmd, do.Timeout); err != nil {
+		return errored.Errorf("Rolling back volume %q to snapshot %q", do.Volume.Name, snapName).Combine(err)
+	}
+
+	return nil
+}
+
+// ListSnapshots returns the snapshots of the volume, oldest first. Any error
+// will be returned.
+func (d *Driver) ListSnapshots(do storage.DriverOptions) ([]storage.Snapshot, error) {
+	if err := storage.CheckHost(do.Volume); err != nil {
+		return nil, err
+	}
+
+	intName, err := d.internalName(do.Volume.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	snaps, err := d.snapshots(do.Volume.Params["group"], intName, do.Timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []storage.Snapshot{}
+
+	for _, snap := range snaps {
+		result = append(result, storage.Snapshot{
+			Name:    strings.TrimPrefix(snap.Name, intName+snapshotSeparator),
+			Created: snap.Created,
+			Size:    snap.Size,
+		})
+	}
+
+	return result, nil
+}
+
+// CopySnapshot copies a snapshot into a new volume. Takes a DriverOptions,
+// snap and volume name (string). Returns error on failure.
+func (d *Driver) CopySnapshot(do storage.DriverOptions, snapName, newName string) error {
+	if err := storage.CheckHost(do.Volume); err != nil {
+		return err
+	}
+
+	intOrigName, err := d.internalName(do.Volume.Name)
+	if err != nil {
+		return err
+	}
+
+	intNewName, err := d.internalName(newName)
+	if err != nil {
+		return err
+	}
+
+	group := do.Volume.Params["group"]
+	snapLV := snapshotLVName(intOrigName, snapName)
+
+	lvs, err := listLVs(group, do.Timeout)
+	if err != nil {
+		return err
+	}
+
+	var found bool
+
+	for _, lv := range lvs {
+		switch lv.Name {
+		case intNewName:
+			return errored.Errorf("Volume %q already exists", newName).Combine(errors.Exists)
+		case snapLV:
+			found = true
+		}
+	}
+
+	if !found {
+		return errored.Errorf("Snapshot %q (volume %q) could not be found", snapName, do.Volume.Name).Combine(errors.SnapshotCopy)
+	}
+
+	// A writable snapshot of the snapshot is the new volume. It must not be
+	// skipped on activation, and must not keep the snapshot tag if it inherited it.
+	cmd := exec.Command(
+		"lvcreate",
+		"--snapshot", lvPath(group, snapLV),
+		"--setactivationskip", "n",
+		"--name", intNewName,
+		"--addtag", volumeTag,
+	)
+
+	if _, err := storage.RunCommand(cmd, do.Timeout); err != nil {
+		return errored.Errorf("Copying snapshot %q (volume %q) to %q", snapName, do.Volume.Name, newName).Combine(errors.SnapshotCopy).Combine(err)
+	}
+
+	if _, err := storage.RunCommand(exec.Command("lvchange", "--deltag", snapshotTag, lvPath(group, intNewName)), do.Timeout); err != nil {
+		return errored.Errorf("Copying snapshot %q (volume %q) to %q", snapName, do.Volume.Name, newName).Combine(errors.SnapshotCopy).Combine(err)
+	}
+
+	return nil
+}
+
+// Validate validates the driver options to ensure they are compatible with the
+// LVM storage driver.
+func (d *Driver) Validate(do *storage.DriverOptions) error {
+	// XXX check this first to guard against nil pointers ahead of time.
+	if err := do.Validate(); err != nil {
+		return err
+	}
+
+	if do.Volume.Params["group"] == "" {
+		return errored.Errorf("Volume group is missing in lvm storage driver.")
+	}
+
+	if do.Volume.Params["pool"] == "" {
+		return errored.Errorf("Thin pool is missing in lvm storage driver.")
+	}
+
+	return nil
+}
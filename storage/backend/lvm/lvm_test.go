@@ -0,0 +1,289 @@
+package lvm
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	. "testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/contiv/volplugin/storage"
+)
+
+const (
+	myMountpath = "/mnt"
+	testGroup   = "volplugin-test"
+	testPool    = "thinpool"
+)
+
+type lvmSuite struct {
+	imageFile string
+	device    string
+}
+
+var _ = Suite(&lvmSuite{})
+
+func TestLVM(t *T) { TestingT(t) }
+
+var volumeSpec = storage.Volume{
+	Name:   "policy1/test",
+	Size:   100,
+	Params: storage.Params{"group": testGroup, "pool": testPool},
+}
+
+func driverOpts(volume storage.Volume) storage.DriverOptions {
+	return storage.DriverOptions{
+		Volume: volume,
+		FSOptions: storage.FSOptions{
+			Type:          "ext4",
+			CreateCommand: "mkfs.ext4 -F -m0 %",
+		},
+		Timeout: 30 * time.Second,
+	}
+}
+
+func run(c *C, name string, args ...string) string {
+	out, err := exec.Command(name, args...).CombinedOutput()
+	c.Assert(err, IsNil, Commentf("%s %v: %s", name, args, out))
+	return strings.TrimSpace(string(out))
+}
+
+// SetUpSuite builds a volume group with a thin pool on top of a loop device,
+// if LVM is available on this host.
+func (s *lvmSuite) SetUpSuite(c *C) {
+	if _, err := exec.LookPath("lvcreate"); err != nil || os.Getuid() != 0 {
+		return
+	}
+
+	f, err := ioutil.TempFile("", "volplugin-lvm")
+	c.Assert(err, IsNil)
+	c.Assert(f.Truncate(1024*1024*1024), IsNil)
+	c.Assert(f.Close(), IsNil)
+
+	s.imageFile = f.Name()
+	s.device = run(c, "losetup", "--find", "--show", s.imageFile)
+	run(c, "vgcreate", testGroup, s.device)
+	run(c, "lvcreate", "--type", "thin-pool", "-L", "512m", "-n", testPool, testGroup)
+}
+
+func (s *lvmSuite) TearDownSuite(c *C) {
+	if s.device == "" {
+		return
+	}
+
+	run(c, "vgremove", "-f", testGroup)
+	run(c, "losetup", "-d", s.device)
+	c.Assert(os.Remove(s.imageFile), IsNil)
+}
+
+func (s *lvmSuite) requireLVM(c *C) {
+	if s.device == "" {
+		c.Skip("LVM and root privileges are required for this test")
+	}
+}
+
+func (s *lvmSuite) TestParseLVS(c *C) {
+	lvs, err := parseLVS("")
+	c.Assert(err, IsNil)
+	c.Assert(lvs, DeepEquals, []*logicalVolume{})
+
+	output := `  vg0|thinpool||||-1|-1|2016-01-01 10:00:00 +0000|1073741824
+  vg0|policy1.test|volplugin||thinpool|253|4|2016-01-01 11:00:00 +0100|104857600
+  vg0|policy1.test_snap_2016-01-01|volplugin_snapshot,volplugin|policy1.test|thinpool|-1|-1|2016-01-01 12:00:00 +0000|104857600
+`
+
+	lvs, err = parseLVS(output)
+	c.Assert(err, IsNil)
+	c.Assert(len(lvs), Equals, 3)
+
+	c.Assert(lvs[0].isVolume(), Equals, false)
+	c.Assert(lvs[0].isSnapshot(), Equals, false)
+	c.Assert(lvs[0].Major, Equals, -1)
+
+	c.Assert(lvs[1].Created.Equal(time.Date(2016, 1, 1, 10, 0, 0, 0, time.UTC)), Equals, true)
+	lvs[1].Created = time.Time{}
+
+	c.Assert(lvs[1], DeepEquals, &logicalVolume{
+		Group: "vg0",
+		Name:  "policy1.test",
+		Tags:  []string{"volplugin"},
+		Pool:  "thinpool",
+		Major: 253,
+		Minor: 4,
+		Size:  104857600,
+	})
+	c.Assert(lvs[1].isVolume(), Equals, true)
+
+	c.Assert(lvs[2].Origin, Equals, "policy1.test")
+	c.Assert(lvs[2].isVolume(), Equals, false)
+	c.Assert(lvs[2].isSnapshot(), Equals, true)
+
+	_, err = parseLVS("vg0|policy1.test")
+	c.Assert(err, NotNil)
+	_, err = parseLVS("vg0|policy1.test|volplugin||thinpool|foo|4|2016-01-01 10:00:00 +0000|104857600")
+	c.Assert(err, NotNil)
+	_, err = parseLVS("vg0|policy1.test|volplugin||thinpool|253|4|yesterday|104857600")
+	c.Assert(err, NotNil)
+}
+
+func (s *lvmSuite) TestNames(c *C) {
+	d := &Driver{mountpath: myMountpath}
+
+	intName, err := d.internalName("policy1/test")
+	c.Assert(err, IsNil)
+	c.Assert(intName, Equals, "policy1.test")
+	c.Assert(d.externalName(intName), Equals, "policy1/test")
+
+	for _, name := range []string{"test", "policy.1/test", "policy1/te st", "-policy/test"} {
+		_, err := d.internalName(name)
+		c.Assert(err, NotNil, Commentf("%s", name))
+	}
+
+	c.Assert(snapshotLVName("policy1.test", "2016-01-02 15:04:05.999 +0000 UTC"), Equals, "policy1.test_snap_2016-01-02-15-04-05.999-+0000-UTC")
+	c.Assert(snapshotName(snapshotName("a b:c")), Equals, "a-b-c")
+
+	mp, err := d.MountPath(driverOpts(volumeSpec))
+	c.Assert(err, IsNil)
+	c.Assert(mp, Equals, "/mnt/lvm/volplugin-test/policy1.test")
+}
+
+func (s *lvmSuite) TestValidate(c *C) {
+	d := &Driver{}
+	do := driverOpts(storage.Volume{Name: "policy1/test", Params: storage.Params{"group": testGroup, "pool": testPool}})
+	c.Assert(d.Validate(&do), IsNil)
+
+	do.Volume.Params = storage.Params{"pool": testPool}
+	c.Assert(d.Validate(&do), NotNil)
+
+	do.Volume.Params = storage.Params{"group": testGroup}
+	c.Assert(d.Validate(&do), NotNil)
+}
+
+func (s *lvmSuite) TestCRUD(c *C) {
+	s.requireLVM(c)
+
+	d := &Driver{}
+	do := driverOpts(volumeSpec)
+
+	c.Assert(d.Create(do), IsNil)
+	c.Assert(d.Create(do), Equals, storage.ErrVolumeExist)
+
+	exists, err := d.Exists(do)
+	c.Assert(err, IsNil)
+	c.Assert(exists, Equals, true)
+
+	host, err := os.Hostname()
+	c.Assert(err, IsNil)
+	c.Assert(do.Volume.Params[storage.HostParam], Equals, host)
+
+	list, err := d.List(storage.ListOptions{Params: volumeSpec.Params})
+	c.Assert(err, IsNil)
+	c.Assert(list, DeepEquals, []storage.Volume{{Name: "policy1/test", Params: storage.Params{"group": testGroup, "pool": testPool, storage.HostParam: host}}})
+
+	c.Assert(d.Format(do), IsNil)
+
+	// other hosts cannot reach the volume group.
+	storage.Hostname = func() (string, error) { return "host2", nil }
+	err = d.Destroy(do)
+	exists, existsErr := d.Exists(do)
+	storage.Hostname = os.Hostname
+	c.Assert(err, ErrorMatches, `.*belongs to host.*`)
+	c.Assert(existsErr, IsNil)
+	c.Assert(exists, Equals, true)
+
+	c.Assert(d.Destroy(do), IsNil)
+
+	exists, err = d.Exists(do)
+	c.Assert(err, IsNil)
+	c.Assert(exists, Equals, false)
+}
+
+func (s *lvmSuite) TestSnapshots(c *C) {
+	s.requireLVM(c)
+
+	d := &Driver{}
+	do := driverOpts(volumeSpec)
+
+	c.Assert(d.Create(do), IsNil)
+	c.Assert(d.CreateSnapshot("test snap", do), IsNil)
+	c.Assert(d.CreateSnapshot("test2", do), IsNil)
+
+	list, err := d.ListSnapshots(do)
+	c.Assert(err, IsNil)
+	c.Assert(storage.SnapshotNames(list), DeepEquals, []string{"test-snap", "test2"})
+	c.Assert(list[0].Created.IsZero(), Equals, false)
+
+	c.Assert(d.CopySnapshot(do, "test-snap", "policy1/copy"), IsNil)
+	c.Assert(d.CopySnapshot(do, "test-snap", "policy1/copy"), NotNil)
+	c.Assert(d.CopySnapshot(do, "nonexistent", "policy1/copy2"), NotNil)
+
+	copyDO := driverOpts(storage.Volume{Name: "policy1/copy", Params: volumeSpec.Params})
+	exists, err := d.Exists(copyDO)
+	c.Assert(err, IsNil)
+	c.Assert(exists, Equals, true)
+
+	// snapshots must not show up as volumes.
+	volumes, err := d.List(storage.ListOptions{Params: volumeSpec.Params})
+	c.Assert(err, IsNil)
+	c.Assert(len(volumes), Equals, 2)
+
+	// the snapshots survive a rollback.
+	c.Assert(d.RollbackSnapshot("test-snap", do), IsNil)
+	c.Assert(d.RollbackSnapshot("nonexistent", do), NotNil)
+	list, err = d.ListSnapshots(do)
+	c.Assert(err, IsNil)
+	c.Assert(storage.SnapshotNames(list), DeepEquals, []string{"test-snap", "test2"})
+
+	c.Assert(d.RemoveSnapshot("test-snap", do), IsNil)
+	list, err = d.ListSnapshots(do)
+	c.Assert(err, IsNil)
+	c.Assert(storage.SnapshotNames(list), DeepEquals, []string{"test2"})
+
+	c.Assert(d.Destroy(do), IsNil)
+	c.Assert(d.Destroy(copyDO), IsNil)
+
+	lvs, err := listLVs(testGroup, do.Timeout)
+	c.Assert(err, IsNil)
+	c.Assert(len(lvs), Equals, 1) // the thin pool
+}
+
+func (s *lvmSuite) TestMountUnmount(c *C) {
+	s.requireLVM(c)
+
+	crud, err := NewCRUDDriver()
+	c.Assert(err, IsNil)
+	mountD, err := NewMountDriver(myMountpath)
+	c.Assert(err, IsNil)
+
+	do := driverOpts(volumeSpec)
+
+	c.Assert(crud.Create(do), IsNil)
+	c.Assert(crud.Format(do), IsNil)
+
+	mount, err := mountD.Mount(do)
+	c.Assert(err, IsNil)
+	c.Assert(mount.Path, Equals, "/mnt/lvm/volplugin-test/policy1.test")
+	c.Assert(mount.DevMajor, Not(Equals), uint(0))
+
+	mounts, err := mountD.Mounted(do.Timeout)
+	c.Assert(err, IsNil)
+	c.Assert(len(mounts), Equals, 1)
+	c.Assert(mounts[0].Volume.Name, Equals, "policy1/test")
+	c.Assert(mounts[0].Volume.Params, DeepEquals, volumeSpec.Params)
+	c.Assert(mounts[0].DevMajor, Equals, mount.DevMajor)
+	c.Assert(mounts[0].DevMinor, Equals, mount.DevMinor)
+
+	c.Assert(ioutil.WriteFile(filepath.Join(mount.Path, "test.txt"), []byte("Test string\n"), 0644), IsNil)
+
+	c.Assert(mountD.Unmount(do), IsNil)
+
+	mounts, err = mountD.Mounted(do.Timeout)
+	c.Assert(err, IsNil)
+	c.Assert(len(mounts), Equals, 0)
+
+	c.Assert(crud.Destroy(do), IsNil)
+}
@@ -0,0 +1,218 @@
+package lvm
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/storage"
+	"github.com/contiv/volplugin/storage/mountscan"
+)
+
+func (d *Driver) mkMountPath(group, intName string) (string, error) {
+	// Directory to mount the volume
+	volumePath := filepath.Join(d.mountpath, BackendName, group, intName)
+	rel, err := filepath.Rel(d.mountpath, volumePath)
+	if err != nil || strings.Contains(rel, "..") {
+		return "", errors.MountFailed.Combine(errored.Errorf("Calculated volume path would escape subdir jail: %v", volumePath))
+	}
+
+	return volumePath, nil
+}
+
+// MountPath returns the path of a mount for a group/volume.
+func (d *Driver) MountPath(do storage.DriverOptions) (string, error) {
+	intName, err := d.internalName(do.Volume.Name)
+	if err != nil {
+		return "", err
+	}
+
+	return d.mkMountPath(do.Volume.Params["group"], intName)
+}
+
+// Mount a volume. Returns the mount information about the volume. Volumes
+// belonging to other hosts are refused.
+func (d *Driver) Mount(do storage.DriverOptions) (_ *storage.Mount, err error) {
+	if err := storage.CheckHost(do.Volume); err != nil {
+		return nil, errors.MountFailed.Combine(err)
+	}
+
+	intName, err := d.internalName(do.Volume.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	group := do.Volume.Params["group"]
+
+	volumePath, err := d.mkMountPath(group, intName)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := d.activate(group, intName, do.Timeout); err != nil {
+		return nil, err
+	}
+
+	// volumes which fail to mount are left closed and deactivated.
+	defer func() {
+		if err == nil {
+			return
+		}
+
+		if err := storage.CloseCrypt(do.Volume.Name, do.Timeout); err != nil {
+			logrus.Errorf("Error while trying to close encrypted device after failed mount: %v", err)
+		}
+		if err := d.deactivate(group, intName, do.Timeout); err != nil {
+			logrus.Errorf("Error while trying to deactivate after failed mount: %v", err)
+		}
+	}()
+
+	// encrypted volumes are mounted from the dm-crypt mapping of the LV.
+	devName, err := storage.OpenCrypt(do.Volume.Name, devicePath(group, intName), do.Encryption, do.Timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(volumePath, 0700); err != nil && !os.IsExist(err) {
+		return nil, errored.Errorf("error creating %q directory: %v", volumePath, err)
+	}
+
+	// Obtain the major and minor node information about the device we're mounting.
+	// This is critical for tuning cgroups and obtaining metrics for this device only.
+	fi, err := os.Stat(devName)
+	if err != nil {
+		return nil, errored.Errorf("Failed to stat device %q: %v", devName, err)
+	}
+
+	major, minor := storage.DevNumbers(fi.Sys().(*syscall.Stat_t).Rdev)
+
+	flags, data := storage.ParseMountOptions(do.FSOptions.MountOptions)
+	if err := unix.Mount(devName, volumePath, do.FSOptions.Type, flags, data); err != nil {
+		return nil, errored.Errorf("Failed to mount lvm dev %q: %v", devName, err)
+	}
+
+	return &storage.Mount{
+		Device:   devName,
+		Path:     volumePath,
+		Volume:   do.Volume,
+		DevMajor: major,
+		DevMinor: minor,
+	}, nil
+}
+
+// Unmount a volume.
+func (d *Driver) Unmount(do storage.DriverOptions) error {
+	intName, err := d.internalName(do.Volume.Name)
+	if err != nil {
+		return err
+	}
+
+	group := do.Volume.Params["group"]
+
+	volumeDir, err := d.mkMountPath(group, intName)
+	if err != nil {
+		return err
+	}
+
+	var retries int
+	var lastErr error
+
+retry:
+	if retries < 3 {
+		if err := unix.Unmount(volumeDir, 0); err != nil && err != unix.ENOENT && err != unix.EINVAL {
+			lastErr = errored.Errorf("Failed to unmount %q (retrying): %v", volumeDir, err)
+			logrus.Error(lastErr)
+			retries++
+			time.Sleep(100 * time.Millisecond)
+			goto retry
+		}
+	} else {
+		return errored.Errorf("Failed to umount after 3 retries").Combine(lastErr)
+	}
+
+	if err := os.Remove(volumeDir); err != nil && !os.IsNotExist(err) {
+		logrus.Error(errored.Errorf("error removing %q directory: %v", volumeDir, err))
+	}
+
+	if err := storage.CloseCrypt(do.Volume.Name, do.Timeout); err != nil {
+		return err
+	}
+
+	return d.deactivate(group, intName, do.Timeout)
+}
+
+// Mounted shows any volumes that belong to volplugin on the host, in
+// their native representation. They yield a *Mount.
+func (d *Driver) Mounted(timeout time.Duration) ([]*storage.Mount, error) {
+	mounts := []*storage.Mount{}
+
+	hostMounts, err := mountscan.GetMounts(&mountscan.GetMountsRequest{DriverName: BackendName, KernelDriver: "device-mapper"})
+	if err != nil {
+		if newerr, ok := err.(*errored.Error); ok && newerr.Contains(errors.ErrDevNotFound) {
+			return mounts, nil
+		}
+		return nil, err
+	}
+
+	if len(hostMounts) == 0 {
+		return mounts, nil
+	}
+
+	if _, err := exec.LookPath("lvs"); err != nil {
+		// device-mapper is used without LVM too; there is nothing of ours mounted.
+		return mounts, nil
+	}
+
+	host, err := storage.Hostname()
+	if err != nil {
+		return nil, errored.Errorf("Could not determine hostname").Combine(err)
+	}
+
+	lvs, err := listLVs("", timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, hostMount := range hostMounts {
+		major, minor := hostMount.DeviceNumber.Major, hostMount.DeviceNumber.Minor
+
+		// encrypted volumes are mounted from the dm-crypt mapping of their LV.
+		if _, backing, ok := storage.CryptMapping(major, minor); ok {
+			fi, err := os.Stat(backing)
+			if err != nil {
+				logrus.Errorf("Could not stat device %q of encrypted mount %q: %v", backing, hostMount.MountPoint, err)
+				continue
+			}
+
+			major, minor = storage.DevNumbers(fi.Sys().(*syscall.Stat_t).Rdev)
+		}
+
+		for _, lv := range lvs {
+			if !lv.isVolume() || lv.Major < 0 || uint(lv.Major) != major || uint(lv.Minor) != minor {
+				continue
+			}
+
+			mounts = append(mounts, &storage.Mount{
+				Device:   hostMount.MountSource,
+				DevMajor: hostMount.DeviceNumber.Major,
+				DevMinor: hostMount.DeviceNumber.Minor,
+				Path:     hostMount.MountPoint,
+				Volume: storage.Volume{
+					Name:   d.externalName(lv.Name),
+					Params: storage.Params{"group": lv.Group, "pool": lv.Pool, storage.HostParam: host},
+				},
+			})
+			break
+		}
+	}
+
+	return mounts, nil
+}
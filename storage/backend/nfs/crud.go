@@ -0,0 +1,280 @@
+package nfs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/storage"
+)
+
+// NewCRUDDriver constructs a new NFS driver which manages volumes as
+// subdirectories of the export named by the `export` driver option.
+//
+// A volume `policy/volume` is the directory `policy/volume` in the export,
+// and is mounted from there unless the volume has a mount source of its own.
+//
+// Quotas can only be set on the NFS server. If the apiserver runs there, the
+// `quota-path` driver option may name the directory the export serves, and
+// sizes are enforced with XFS project quotas if it is on XFS mounted with
+// `prjquota`. Each volume is made a project of its own, which is recorded in
+// the `project` parameter of the volume, and limited to its size. Resizing the
+// volume changes the limit, and Stats reports the quota. Without `quota-path`
+// sizes are not enforced, and volumes can neither be resized nor report
+// statistics of their own.
+func NewCRUDDriver() (storage.CRUDDriver, error) {
+	return &Driver{}, nil
+}
+
+// volumeSource returns the mount source of the volume's subdirectory in the
+// export.
+func volumeSource(volume storage.Volume) (string, error) {
+	policy, name, err := storage.SplitName(volume.Name)
+	if err != nil {
+		return "", err
+	}
+
+	export := volume.Params["export"]
+	if export == "" {
+		return "", errored.Errorf("No export was provided for volume %q. Set `export` in the driver options.", volume.Name)
+	}
+
+	return strings.TrimSuffix(export, "/") + "/" + policy + "/" + name, nil
+}
+
+// withExport mounts the export root, runs fn with the path it was mounted
+// at, and unmounts it again.
+func (d *Driver) withExport(volume storage.Volume, fn func(string) error) error {
+	export := volume.Params["export"]
+	if export == "" {
+		return errored.Errorf("No export was provided. Set `export` in the driver options.")
+	}
+
+	opts, err := d.mkOpts(storage.DriverOptions{Source: export, Volume: volume})
+	if err != nil {
+		return err
+	}
+
+	dir, err := ioutil.TempDir("", "volplugin-nfs")
+	if err != nil {
+		return errored.Errorf("Creating directory to mount NFS export %q", export).Combine(err)
+	}
+
+	if err := unix.Mount(export, dir, "nfs", 0, opts); err != nil {
+		os.Remove(dir)
+		return errored.Errorf("Error mounting NFS export %q at %q", export, dir).Combine(err)
+	}
+
+	fnErr := fn(dir)
+
+	if err := unix.Unmount(dir, 0); err != nil {
+		logrus.Errorf("Could not unmount NFS export %q at %q: %v", export, dir, err)
+		return fnErr
+	}
+
+	// XXX this is not RemoveAll on purpose; if the export is somehow still
+	//     mounted, it must be left alone.
+	if err := os.Remove(dir); err != nil {
+		logrus.Errorf("Could not remove directory %q: %v", dir, err)
+	}
+
+	return fnErr
+}
+
+func volumeDir(root string, volume storage.Volume) (string, error) {
+	policy, name, err := storage.SplitName(volume.Name)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(root, policy, name), nil
+}
+
+// quotaDir returns the directory of the volume under the `quota-path` driver
+// option, or an empty string if it is not set.
+func quotaDir(volume storage.Volume) (string, error) {
+	root := volume.Params["quota-path"]
+	if root == "" {
+		return "", nil
+	}
+
+	return volumeDir(root, volume)
+}
+
+// Create a volume. The project of the quota of the volume, if it has one, is
+// recorded in the parameters of the volume.
+func (d *Driver) Create(do storage.DriverOptions) error {
+	qdir, err := quotaDir(do.Volume)
+	if err != nil {
+		return err
+	}
+
+	return d.withExport(do.Volume, func(root string) error {
+		dir, err := volumeDir(root, do.Volume)
+		if err != nil {
+			return err
+		}
+
+		if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+			return errored.Errorf("Creating policy directory for %q", do.Volume.Name).Combine(err)
+		}
+
+		if err := os.Mkdir(dir, 0777); os.IsExist(err) {
+			return storage.ErrVolumeExist
+		} else if err != nil {
+			return errored.Errorf("Creating directory for volume %q", do.Volume.Name).Combine(err)
+		}
+
+		if qdir == "" {
+			return nil
+		}
+
+		if err := storage.SetVolumeQuota(do, qdir); err != nil {
+			if err := os.Remove(dir); err != nil {
+				logrus.Errorf("Error while trying to remove directory %q after failed quota setup: %v", dir, err)
+			}
+			return err
+		}
+
+		return nil
+	})
+}
+
+// Format formats a created volume. NFS directories need no formatting, so
+// this does nothing.
+func (d *Driver) Format(do storage.DriverOptions) error {
+	return nil
+}
+
+// Destroy a volume.
+func (d *Driver) Destroy(do storage.DriverOptions) error {
+	qdir, err := quotaDir(do.Volume)
+	if err != nil {
+		return err
+	}
+
+	return d.withExport(do.Volume, func(root string) error {
+		dir, err := volumeDir(root, do.Volume)
+		if err != nil {
+			return err
+		}
+
+		if qdir != "" {
+			if err := storage.ClearVolumeQuota(do, qdir); err != nil {
+				logrus.Errorf("Error clearing quota of volume %q: %v", do.Volume.Name, err)
+			}
+		}
+
+		if err := os.RemoveAll(dir); err != nil {
+			return errored.Errorf("Destroying directory for volume %q", do.Volume.Name).Combine(err)
+		}
+
+		return nil
+	})
+}
+
+// List all volumes in the export.
+func (d *Driver) List(lo storage.ListOptions) ([]storage.Volume, error) {
+	list := []storage.Volume{}
+
+	err := d.withExport(storage.Volume{Params: lo.Params}, func(root string) error {
+		dirs, err := filepath.Glob(filepath.Join(root, "*", "*"))
+		if err != nil {
+			return errored.Errorf("Listing directories in export %q", lo.Params["export"]).Combine(err)
+		}
+
+		for _, dir := range dirs {
+			if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+				continue
+			}
+
+			rel, err := filepath.Rel(root, dir)
+			if err != nil {
+				logrus.Errorf("Invalid directory %q found in export %q, skipping", dir, lo.Params["export"])
+				continue
+			}
+
+			params := storage.Params{}
+			for key, value := range lo.Params {
+				params[key] = value
+			}
+
+			list = append(list, storage.Volume{Name: rel, Params: params})
+		}
+
+		return nil
+	})
+
+	return list, err
+}
+
+// Exists returns true if the volume already exists.
+func (d *Driver) Exists(do storage.DriverOptions) (bool, error) {
+	var exists bool
+
+	err := d.withExport(do.Volume, func(root string) error {
+		dir, err := volumeDir(root, do.Volume)
+		if err != nil {
+			return err
+		}
+
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return errored.Errorf("Checking for directory of volume %q", do.Volume.Name).Combine(err)
+		}
+
+		exists = true
+		return nil
+	})
+
+	return exists, err
+}
+
+// Resize changes the limit of the project quota of the volume to its size.
+// Volumes without `quota-path` cannot be resized, as their sizes are not
+// enforced.
+func (d *Driver) Resize(do storage.DriverOptions) error {
+	qdir, err := quotaDir(do.Volume)
+	if err != nil {
+		return err
+	}
+
+	if qdir == "" {
+		return errors.ResizeUnsupported.Combine(errored.New(BackendName))
+	}
+
+	return storage.ResizeVolumeQuota(do, qdir)
+}
+
+// GrowFilesystem does nothing; the filesystem is the NFS server's.
+func (d *Driver) GrowFilesystem(do storage.DriverOptions) error {
+	return nil
+}
+
+// Stats returns the limit and usage of the project quota of the volume.
+// Volumes without one cannot tell: the filesystem of a mounted volume is the
+// whole export, whose capacity and usage are not the volume's.
+func (d *Driver) Stats(do storage.DriverOptions) (*storage.Stats, error) {
+	qdir, err := quotaDir(do.Volume)
+	if err != nil {
+		return nil, err
+	}
+
+	if qdir == "" {
+		return nil, errors.StatsUnsupported.Combine(errored.New(do.Volume.Name))
+	}
+
+	stats, err := storage.VolumeQuotaStats(do, qdir)
+	if err == errors.NoActionTaken {
+		return nil, errors.StatsUnsupported.Combine(errored.New(do.Volume.Name))
+	}
+
+	return stats, err
+}
@@ -167,13 +167,20 @@ func readNetlink(mapOpts map[string]string, host string) error {
 	return errored.Errorf("Could not find a suitable clientaddr for mount")
 }
 
-// Mount a Volume
+// Mount a Volume. Volumes without a mount source of their own are mounted
+// from their subdirectory of the export.
 func (d *Driver) Mount(do storage.DriverOptions) (*storage.Mount, error) {
 	mp, err := d.MountPath(do)
 	if err != nil {
 		return nil, err
 	}
 
+	if do.Source == "" {
+		if do.Source, err = volumeSource(do.Volume); err != nil {
+			return nil, err
+		}
+	}
+
 	if err := os.MkdirAll(mp, 0755); err != nil && !os.IsExist(err) {
 		return nil, errored.Errorf("Error creating directory %q while preparing NFS mount for %q", mp, do.Source).Combine(err)
 	}
@@ -240,8 +247,12 @@ func (d *Driver) MountPath(do storage.DriverOptions) (string, error) {
 
 // Validate validates the NFS drivers implementation of handling storage.DriverOptions.
 func (d *Driver) Validate(do *storage.DriverOptions) error {
-	if do.Volume.Name == "" || do.Source == "" {
-		return errored.Errorf("No source or volume supplied, cannot mount this volume")
+	if do.Volume.Name == "" || (do.Source == "" && do.Volume.Params["export"] == "") {
+		return errored.Errorf("No source, export or volume supplied, cannot mount this volume")
+	}
+
+	if quotaPath := do.Volume.Params["quota-path"]; quotaPath != "" && !path.IsAbs(quotaPath) {
+		return errored.Errorf("Quota path %q must be absolute in nfs storage driver.", quotaPath)
 	}
 
 	return nil
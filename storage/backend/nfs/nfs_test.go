@@ -289,3 +289,77 @@ func (s *nfsSuite) TestMountScan(c *C) {
 	c.Assert(mountD.Unmount(do), IsNil)
 	c.Assert(found, Equals, true)
 }
+
+func (s *nfsSuite) TestVolumeSource(c *C) {
+	src, err := volumeSource(storage.Volume{Name: "policy1/test", Params: storage.Params{"export": "localhost:/export/"}})
+	c.Assert(err, IsNil)
+	c.Assert(src, Equals, "localhost:/export/policy1/test")
+
+	_, err = volumeSource(storage.Volume{Name: "policy1/test", Params: storage.Params{}})
+	c.Assert(err, NotNil)
+
+	_, err = volumeSource(storage.Volume{Name: "test", Params: storage.Params{"export": "localhost:/export"}})
+	c.Assert(err, NotNil)
+
+	d := &Driver{}
+	do := storage.DriverOptions{Volume: storage.Volume{Name: "policy1/test", Params: storage.Params{"export": "localhost:/export"}}}
+	c.Assert(d.Validate(&do), IsNil)
+	do.Volume.Params["quota-path"] = "export"
+	c.Assert(d.Validate(&do), NotNil)
+	do.Volume.Params["quota-path"] = "/export"
+	c.Assert(d.Validate(&do), IsNil)
+	do.Volume.Params = storage.Params{}
+	c.Assert(d.Validate(&do), NotNil)
+}
+
+func (s *nfsSuite) TestCRUD(c *C) {
+	makeExport(c, "crud", "rw,no_root_squash")
+
+	crud, err := NewCRUDDriver()
+	c.Assert(err, IsNil)
+	mountD, err := NewMountDriver(mountPath)
+	c.Assert(err, IsNil)
+
+	do := storage.DriverOptions{
+		Volume: storage.Volume{
+			Name:   "policy1/test",
+			Params: storage.Params{"export": nfsMount("crud")},
+		},
+	}
+
+	c.Assert(crud.Create(do), IsNil)
+	c.Assert(crud.Create(do), Equals, storage.ErrVolumeExist)
+	c.Assert(crud.Format(do), IsNil)
+
+	_, err = os.Stat(path.Join(mkPath("crud"), "policy1/test"))
+	c.Assert(err, IsNil)
+
+	exists, err := crud.Exists(do)
+	c.Assert(err, IsNil)
+	c.Assert(exists, Equals, true)
+
+	list, err := crud.List(storage.ListOptions{Params: do.Volume.Params})
+	c.Assert(err, IsNil)
+	c.Assert(list, DeepEquals, []storage.Volume{{Name: "policy1/test", Params: do.Volume.Params}})
+
+	// sizes are only enforced with a quota path.
+	c.Assert(crud.(storage.ResizeDriver).Resize(do), NotNil)
+	_, err = crud.(storage.StatsDriver).Stats(do)
+	c.Assert(err, NotNil)
+
+	// the volume is mounted from its own subdirectory.
+	m, err := mountD.Mount(do)
+	c.Assert(err, IsNil)
+	c.Assert(m.Device, Equals, nfsMount("crud")+"/policy1/test")
+	c.Assert(ioutil.WriteFile(path.Join(m.Path, "foo"), []byte("foo"), 0644), IsNil)
+	c.Assert(mountD.Unmount(do), IsNil)
+
+	_, err = os.Stat(path.Join(mkPath("crud"), "policy1/test/foo"))
+	c.Assert(err, IsNil)
+
+	c.Assert(crud.Destroy(do), IsNil)
+
+	exists, err = crud.Exists(do)
+	c.Assert(err, IsNil)
+	c.Assert(exists, Equals, false)
+}
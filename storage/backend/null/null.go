@@ -1,38 +1,106 @@
-// +build nope
-
 package null
 
 import (
+	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/errors"
 	"github.com/contiv/volplugin/storage"
+	"github.com/docker/go-units"
+)
+
+const (
+	// BackendName is the name of the driver
+	BackendName = "null"
+
+	// ProcessParam is the parameter recording the process a volume was
+	// created in.
+	ProcessParam = "process"
 )
 
-// Driver for null operations. Does nothing.
+// process identifies this process in the ProcessParam of the volumes created
+// in it.
+var process = processName()
+
+func processName() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+
+	return fmt.Sprintf("%s:%d", host, os.Getpid())
+}
+
+// volume is the state the store keeps for each volume.
+type volume struct {
+	size      uint64
+	params    storage.Params
+	snapshots []storage.Snapshot
+}
+
+// store holds the volumes, snapshots and mounts of all null drivers in the
+// process.
+var store = struct {
+	sync.Mutex
+	volumes map[string]*volume
+	mounts  map[string]*storage.Mount
+}{
+	volumes: map[string]*volume{},
+	mounts:  map[string]*storage.Mount{},
+}
+
+// Driver implements a storage driver which keeps all state in memory. Volumes
+// and snapshots hold no data; a mounted volume is a plain directory.
+//
+// All drivers in a process share their state, so a volume created with one
+// driver can be mounted and snapshotted with others. Nothing survives the
+// process, so this is intended for testing volplugin without real storage.
+//
+// -- Processes
+//
+// The state is not shared between processes, so volplugin, volsupervisor and
+// the apiserver each see a store of their own. The process a volume is
+// created in is recorded in the `process` parameter of the volume, and
+// Validate refuses the volume in any other process. Everything using null
+// volumes must therefore run in one process, like the unit tests do.
 type Driver struct {
 	mountpath string
 }
 
-// BackendName is the name of the driver
-var BackendName = "null"
-
-// NewCRUDDriver is a null form of the CRUD driver, that does nothing.
+// NewCRUDDriver is a generator for Driver structs. It is used by the storage
+// framework to yield new drivers on every creation.
 func NewCRUDDriver() (storage.CRUDDriver, error) {
 	return &Driver{}, nil
 }
 
-// NewSnapshotDriver creates a new null snapshot driver.
+// NewSnapshotDriver is a generator for Driver structs. It is used by the
+// storage framework to yield new drivers on every creation.
 func NewSnapshotDriver() (storage.SnapshotDriver, error) {
 	return &Driver{}, nil
 }
 
-// NewMountDriver constructs a storage.MountDriver
-func NewMountDriver(mountPath string) (storage.MountDriver, error) {
-	return &Driver{mountpath: mountPath}, nil
+// NewMountDriver is a generator for Driver structs. It is used by the storage
+// framework to yield new drivers on every creation.
+func NewMountDriver(mountpath string) (storage.MountDriver, error) {
+	return &Driver{mountpath: mountpath}, nil
+}
+
+// Reset forgets all volumes, snapshots and mounts. Mount directories are left
+// alone.
+func Reset() {
+	store.Lock()
+	defer store.Unlock()
+
+	store.volumes = map[string]*volume{}
+	store.mounts = map[string]*storage.Mount{}
 }
 
 // Name is the name of the driver
@@ -40,124 +108,450 @@ func (d *Driver) Name() string {
 	return BackendName
 }
 
-// Create creates nothing.
-func (d *Driver) Create(storage.DriverOptions) error {
+func copyParams(params storage.Params) storage.Params {
+	newParams := storage.Params{}
+	for key, value := range params {
+		newParams[key] = value
+	}
+
+	return newParams
+}
+
+// Create a volume. This process is recorded in the parameters of the volume.
+func (d *Driver) Create(do storage.DriverOptions) error {
+	if _, _, err := storage.SplitName(do.Volume.Name); err != nil {
+		return err
+	}
+
+	if err := checkProcess(do.Volume); err != nil {
+		return err
+	}
+
+	do.Volume.Params[ProcessParam] = process
+
+	store.Lock()
+	defer store.Unlock()
+
+	if _, ok := store.volumes[do.Volume.Name]; ok {
+		return storage.ErrVolumeExist
+	}
+
+	store.volumes[do.Volume.Name] = &volume{size: do.Volume.Size, params: copyParams(do.Volume.Params)}
+	return nil
+}
+
+// Format formats a created volume. Null volumes hold no data, so this does
+// nothing.
+func (d *Driver) Format(do storage.DriverOptions) error {
+	return nil
+}
+
+// Destroy a volume. Its snapshots go with it.
+func (d *Driver) Destroy(do storage.DriverOptions) error {
+	store.Lock()
+	defer store.Unlock()
+
+	if _, ok := store.volumes[do.Volume.Name]; !ok {
+		return errored.Errorf("Volume %q does not exist", do.Volume.Name).Combine(errors.NotExists)
+	}
+
+	delete(store.volumes, do.Volume.Name)
+	return nil
+}
+
+// Exists returns true if the volume already exists.
+func (d *Driver) Exists(do storage.DriverOptions) (bool, error) {
+	store.Lock()
+	defer store.Unlock()
+
+	_, ok := store.volumes[do.Volume.Name]
+	return ok, nil
+}
+
+// List all volumes, sorted by name.
+func (d *Driver) List(lo storage.ListOptions) ([]storage.Volume, error) {
+	store.Lock()
+	defer store.Unlock()
+
+	list := []storage.Volume{}
+
+	for name, vol := range store.volumes {
+		list = append(list, storage.Volume{Name: name, Size: vol.size, Params: copyParams(vol.params)})
+	}
+
+	sort.Sort(byName(list))
+	return list, nil
+}
+
+type byName []storage.Volume
+
+func (b byName) Len() int           { return len(b) }
+func (b byName) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byName) Less(i, j int) bool { return b[i].Name < b[j].Name }
+
+// lookup returns the stored volume. The store must be locked.
+func lookup(name string) (*volume, error) {
+	vol, ok := store.volumes[name]
+	if !ok {
+		return nil, errored.Errorf("Volume %q does not exist", name).Combine(errors.NotExists)
+	}
+
+	return vol, nil
+}
+
+func snapshotIndex(vol *volume, snapName string) int {
+	for i, snap := range vol.snapshots {
+		if snap.Name == snapName {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// CreateSnapshot creates a named snapshot for the volume. Any error will be returned.
+func (d *Driver) CreateSnapshot(snapName string, do storage.DriverOptions) error {
+	store.Lock()
+	defer store.Unlock()
+
+	vol, err := lookup(do.Volume.Name)
+	if err != nil {
+		return err
+	}
+
+	if snapshotIndex(vol, snapName) >= 0 {
+		return errored.Errorf("Snapshot %q (volume %q) already exists", snapName, do.Volume.Name).Combine(errors.Exists)
+	}
+
+	vol.snapshots = append(vol.snapshots, storage.Snapshot{
+		Name:    snapName,
+		Created: time.Now(),
+		Size:    vol.size,
+	})
 	return nil
 }
 
-// Format formats nothing.
-func (d *Driver) Format(storage.DriverOptions) error {
+// RemoveSnapshot removes a named snapshot for the volume. Any error will be returned.
+func (d *Driver) RemoveSnapshot(snapName string, do storage.DriverOptions) error {
+	store.Lock()
+	defer store.Unlock()
+
+	vol, err := lookup(do.Volume.Name)
+	if err != nil {
+		return err
+	}
+
+	i := snapshotIndex(vol, snapName)
+	if i < 0 {
+		return errored.Errorf("Snapshot %q (volume %q) does not exist", snapName, do.Volume.Name).Combine(errors.NotExists)
+	}
+
+	vol.snapshots = append(vol.snapshots[:i], vol.snapshots[i+1:]...)
 	return nil
 }
 
-// Destroy destroys nothing.
-func (d *Driver) Destroy(storage.DriverOptions) error {
+// RollbackSnapshot restores the volume to the named snapshot. Null volumes
+// hold no data, so only the snapshot must exist.
+func (d *Driver) RollbackSnapshot(snapName string, do storage.DriverOptions) error {
+	store.Lock()
+	defer store.Unlock()
+
+	vol, err := lookup(do.Volume.Name)
+	if err != nil {
+		return err
+	}
+
+	if snapshotIndex(vol, snapName) < 0 {
+		return errored.Errorf("Snapshot %q (volume %q) does not exist", snapName, do.Volume.Name).Combine(errors.NotExists)
+	}
+
+	return nil
+}
+
+// ListSnapshots returns the snapshots of the volume, oldest first.
+func (d *Driver) ListSnapshots(do storage.DriverOptions) ([]storage.Snapshot, error) {
+	store.Lock()
+	defer store.Unlock()
+
+	vol, err := lookup(do.Volume.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]storage.Snapshot{}, vol.snapshots...), nil
+}
+
+// CopySnapshot copies a snapshot into a new volume. Takes a DriverOptions,
+// snap and volume name (string). Returns error on failure.
+func (d *Driver) CopySnapshot(do storage.DriverOptions, snapName, newName string) error {
+	if _, _, err := storage.SplitName(newName); err != nil {
+		return err
+	}
+
+	store.Lock()
+	defer store.Unlock()
+
+	vol, err := lookup(do.Volume.Name)
+	if err != nil {
+		return errors.SnapshotCopy.Combine(err)
+	}
+
+	if snapshotIndex(vol, snapName) < 0 {
+		return errored.Errorf("Snapshot %q (volume %q) could not be found", snapName, do.Volume.Name).Combine(errors.SnapshotCopy)
+	}
+
+	if _, ok := store.volumes[newName]; ok {
+		return errored.Errorf("Volume %q already exists", newName).Combine(errors.Exists)
+	}
+
+	store.volumes[newName] = &volume{size: vol.size, params: copyParams(vol.params)}
 	return nil
 }
 
-// Exists does nothing.
-func (d *Driver) Exists(storage.DriverOptions) (bool, error) {
-	return false, nil
+// Flatten does nothing, as null copies share nothing with their snapshots.
+// The volume must exist.
+func (d *Driver) Flatten(do storage.DriverOptions, progress func(int)) error {
+	store.Lock()
+	defer store.Unlock()
+
+	if _, err := lookup(do.Volume.Name); err != nil {
+		return errors.Flatten.Combine(err)
+	}
+
+	progress(100)
+	return nil
 }
 
-// List does nothing.
-func (d *Driver) List(storage.ListOptions) ([]storage.Volume, error) {
-	return []storage.Volume{}, nil
+// Resize grows the volume to the size in the DriverOptions.
+func (d *Driver) Resize(do storage.DriverOptions) error {
+	store.Lock()
+	defer store.Unlock()
+
+	vol, err := lookup(do.Volume.Name)
+	if err != nil {
+		return err
+	}
+
+	if do.Volume.Size < vol.size {
+		return errored.Errorf("Volume %q cannot shrink from %dMB to %dMB", do.Volume.Name, vol.size, do.Volume.Size)
+	}
+
+	vol.size = do.Volume.Size
+	return nil
 }
 
-// CreateSnapshot does nothing.
-func (d *Driver) CreateSnapshot(string, storage.DriverOptions) error {
+// GrowFilesystem does nothing, as null volumes have no filesystem.
+func (d *Driver) GrowFilesystem(do storage.DriverOptions) error {
 	return nil
 }
 
-// RemoveSnapshot removes nothing.
-func (d *Driver) RemoveSnapshot(string, storage.DriverOptions) error {
+// Stats returns the capacity of the volume. Null volumes hold no data, so
+// nothing is ever used.
+func (d *Driver) Stats(do storage.DriverOptions) (*storage.Stats, error) {
+	store.Lock()
+	defer store.Unlock()
+
+	vol, err := lookup(do.Volume.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &storage.Stats{ProvisionedBytes: vol.size * units.MiB}, nil
+}
+
+// Export writes an empty image, as null volumes hold no data. The snapshot
+// must exist.
+func (d *Driver) Export(do storage.DriverOptions, snapName string, w io.Writer) error {
+	store.Lock()
+	defer store.Unlock()
+
+	vol, err := lookup(do.Volume.Name)
+	if err != nil {
+		return errors.ExportVolume.Combine(err)
+	}
+
+	if snapshotIndex(vol, snapName) < 0 {
+		return errored.Errorf("Snapshot %q (volume %q) could not be found", snapName, do.Volume.Name).Combine(errors.ExportVolume)
+	}
+
 	return nil
 }
 
-// ListSnapshots lists nothing.
-func (d *Driver) ListSnapshots(storage.DriverOptions) ([]string, error) {
-	return []string{}, nil
+// Import creates the volume. The image is read and thrown away.
+func (d *Driver) Import(do storage.DriverOptions, r io.Reader) error {
+	if _, err := io.Copy(ioutil.Discard, r); err != nil {
+		return errors.ImportVolume.Combine(err)
+	}
+
+	return d.Create(do)
+}
+
+// ExportDiff writes the names of the snapshots, as null volumes hold no data.
+// Both snapshots must exist.
+func (d *Driver) ExportDiff(do storage.DriverOptions, fromSnap, toSnap string, w io.Writer) error {
+	store.Lock()
+	defer store.Unlock()
+
+	vol, err := lookup(do.Volume.Name)
+	if err != nil {
+		return err
+	}
+
+	for _, snapName := range []string{fromSnap, toSnap} {
+		if snapName != "" && snapshotIndex(vol, snapName) < 0 {
+			return errored.Errorf("Snapshot %q (volume %q) does not exist", snapName, do.Volume.Name).Combine(errors.NotExists)
+		}
+	}
+
+	_, err = fmt.Fprintf(w, "%s\n%s\n", fromSnap, toSnap)
+	return err
 }
 
-// CopySnapshot copies nothing.
-func (d *Driver) CopySnapshot(storage.DriverOptions, string, string) error {
+// ImportDiff takes the snapshot the diff was taken to. The snapshot it was
+// taken from must exist.
+func (d *Driver) ImportDiff(do storage.DriverOptions, r io.Reader) error {
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	names := strings.Split(string(content), "\n")
+	if len(names) != 3 || names[1] == "" {
+		return errored.Errorf("Invalid diff for volume %q", do.Volume.Name)
+	}
+
+	store.Lock()
+	defer store.Unlock()
+
+	vol, err := lookup(do.Volume.Name)
+	if err != nil {
+		return err
+	}
+
+	if names[0] != "" && snapshotIndex(vol, names[0]) < 0 {
+		return errored.Errorf("Snapshot %q (volume %q) the diff applies onto does not exist", names[0], do.Volume.Name).Combine(errors.NotExists)
+	}
+
+	if snapshotIndex(vol, names[1]) < 0 {
+		vol.snapshots = append(vol.snapshots, storage.Snapshot{
+			Name:    names[1],
+			Created: time.Now(),
+			Size:    vol.size,
+		})
+	}
+
 	return nil
 }
 
-// Validate validates storaage.DriverOptions
-func (d *Driver) Validate(storage.DriverOptions) error {
+// checkProcess returns an error if the volume was created in another process.
+func checkProcess(volume storage.Volume) error {
+	if owner := volume.Params[ProcessParam]; owner != "" && owner != process {
+		return errored.Errorf("Volume %q was created in process %q, not %q; null volumes only exist in the process that created them", volume.Name, owner, process)
+	}
+
 	return nil
 }
 
+// Validate validates the driver options to ensure they are compatible with the
+// null storage driver. Volumes created in other processes are refused.
+func (d *Driver) Validate(do *storage.DriverOptions) error {
+	// XXX check this first to guard against nil pointers ahead of time.
+	if err := do.Validate(); err != nil {
+		return err
+	}
+
+	return checkProcess(do.Volume)
+}
+
+// mountRoot is the directory under the mountpath that all null volumes are
+// mounted in.
+func (d *Driver) mountRoot() string {
+	return filepath.Join(d.mountpath, BackendName)
+}
+
 // MountPath describes the path at which the volume should be mounted.
 func (d *Driver) MountPath(do storage.DriverOptions) (string, error) {
-	return filepath.Join(d.mountpath, do.Volume.Name), nil
+	policy, name, err := storage.SplitName(do.Volume.Name)
+	if err != nil {
+		return "", err
+	}
+
+	volumePath := filepath.Join(d.mountRoot(), policy, name)
+	rel, err := filepath.Rel(d.mountRoot(), volumePath)
+	if err != nil || strings.Contains(rel, "..") {
+		return "", errors.MountFailed.Combine(errored.Errorf("Calculated volume path would escape subdir jail: %v", volumePath))
+	}
+
+	return volumePath, nil
 }
 
 // Mounted shows any volumes that belong to volplugin on the host, in
 // their native representation. They yield a *Mount.
 func (d *Driver) Mounted(time.Duration) ([]*storage.Mount, error) {
+	store.Lock()
+	defer store.Unlock()
+
 	mounts := []*storage.Mount{}
-	fis, err := ioutil.ReadDir(d.mountpath)
-	if os.IsNotExist(err) {
-		return mounts, os.MkdirAll(d.mountpath, 0700)
-	} else if err != nil {
-		return nil, errored.Errorf("Reading policy tree for mounts").Combine(err)
-	}
 
-	for _, fi := range fis {
-		volumes, err := ioutil.ReadDir(filepath.Join(d.mountpath, fi.Name()))
-		if err != nil {
-			return nil, errored.Errorf("Reading mounted volumes for policy %q", fi.Name()).Combine(err)
+	for _, mount := range store.mounts {
+		if filepath.Dir(filepath.Dir(mount.Path)) != d.mountRoot() {
+			continue
 		}
 
-		for _, vol := range volumes {
-			rel := filepath.Join(d.mountpath, fi.Name(), vol.Name())
-			if err != nil {
-				return nil, errored.Errorf("Calculating mount information for %q/%q", fi.Name(), vol.Name()).Combine(err)
-			}
-
-			mounts = append(mounts, &storage.Mount{
-				Path: rel,
-				Volume: storage.Volume{
-					Name:   rel,
-					Source: "null",
-				},
-			})
-		}
+		m := *mount
+		mounts = append(mounts, &m)
 	}
 
 	return mounts, nil
 }
 
-// Mount a Volume
+// Mount a volume. The volume must exist. Returns the mount information about
+// the volume.
 func (d *Driver) Mount(do storage.DriverOptions) (*storage.Mount, error) {
 	mp, err := d.MountPath(do)
 	if err != nil {
-		return nil, errored.Errorf("Calculating mount path for %q", do.Volume.Name).Combine(err)
+		return nil, err
+	}
+
+	store.Lock()
+	defer store.Unlock()
+
+	if _, err := lookup(do.Volume.Name); err != nil {
+		return nil, errors.MountFailed.Combine(err)
+	}
+
+	if _, ok := store.mounts[mp]; ok {
+		return nil, errors.MountFailed.Combine(errored.Errorf("Volume %q is already mounted at %q", do.Volume.Name, mp))
 	}
 
 	if err := os.MkdirAll(mp, 0700); err != nil {
 		return nil, errored.Errorf("Making mount path for %q", do.Volume.Name).Combine(err)
 	}
 
-	return &storage.Mount{
-		Path: mp,
-		Volume: storage.Volume{
-			Name:   do.Volume.Name,
-			Source: "null",
-		},
-	}, nil
+	mount := &storage.Mount{
+		Device: BackendName,
+		Path:   mp,
+		Volume: do.Volume,
+	}
+
+	store.mounts[mp] = mount
+
+	m := *mount
+	return &m, nil
 }
 
-// Unmount a volume
+// Unmount a volume. The mount directory is removed with everything in it.
 func (d *Driver) Unmount(do storage.DriverOptions) error {
 	mp, err := d.MountPath(do)
 	if err != nil {
-		return errored.Errorf("Calculating mount path for %q", do.Volume.Name).Combine(err)
+		return err
 	}
 
+	store.Lock()
+	defer store.Unlock()
+
+	delete(store.mounts, mp)
+
 	if err := os.RemoveAll(mp); err != nil {
 		return errored.Errorf("Removing mount path for %q", do.Volume.Name).Combine(err)
 	}
@@ -0,0 +1,264 @@
+package null
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	. "testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/contiv/volplugin/storage"
+)
+
+type nullSuite struct {
+	dir string
+}
+
+var _ = Suite(&nullSuite{})
+
+func TestNull(t *T) { TestingT(t) }
+
+func (s *nullSuite) SetUpTest(c *C) {
+	var err error
+	s.dir, err = ioutil.TempDir("", "volplugin-null")
+	c.Assert(err, IsNil)
+	Reset()
+}
+
+func (s *nullSuite) TearDownTest(c *C) {
+	c.Assert(os.RemoveAll(s.dir), IsNil)
+}
+
+func driverOpts(name string) storage.DriverOptions {
+	return storage.DriverOptions{
+		Volume: storage.Volume{
+			Name:   name,
+			Size:   10,
+			Params: storage.Params{"pool": "rbd"},
+		},
+		Timeout: 5 * time.Second,
+	}
+}
+
+func (s *nullSuite) TestCRUD(c *C) {
+	crud, err := NewCRUDDriver()
+	c.Assert(err, IsNil)
+	do := driverOpts("policy1/test")
+
+	c.Assert(crud.Validate(&do), IsNil)
+	c.Assert(crud.Create(do), IsNil)
+	c.Assert(crud.Create(do), Equals, storage.ErrVolumeExist)
+	c.Assert(crud.Format(do), IsNil)
+	c.Assert(crud.Create(driverOpts("nopolicy")), NotNil)
+
+	// the state is shared by all drivers.
+	other, err := NewCRUDDriver()
+	c.Assert(err, IsNil)
+
+	exists, err := other.Exists(do)
+	c.Assert(err, IsNil)
+	c.Assert(exists, Equals, true)
+
+	c.Assert(crud.Create(driverOpts("policy1/another")), IsNil)
+	list, err := other.List(storage.ListOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(list, DeepEquals, []storage.Volume{
+		{Name: "policy1/another", Size: 10, Params: storage.Params{"pool": "rbd", ProcessParam: process}},
+		{Name: "policy1/test", Size: 10, Params: storage.Params{"pool": "rbd", ProcessParam: process}},
+	})
+
+	c.Assert(crud.Destroy(do), IsNil)
+	c.Assert(crud.Destroy(do), NotNil)
+
+	exists, err = crud.Exists(do)
+	c.Assert(err, IsNil)
+	c.Assert(exists, Equals, false)
+
+	Reset()
+	list, err = crud.List(storage.ListOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(len(list), Equals, 0)
+}
+
+func (s *nullSuite) TestOtherProcess(c *C) {
+	d := &Driver{}
+	do := driverOpts("policy1/test")
+
+	c.Assert(d.Create(do), IsNil)
+	c.Assert(do.Volume.Params[ProcessParam], Equals, process)
+	c.Assert(d.Validate(&do), IsNil)
+
+	do = driverOpts("policy1/other")
+	do.Volume.Params[ProcessParam] = "host2:1"
+	c.Assert(d.Validate(&do), ErrorMatches, `.*null volumes only exist in the process that created them.*`)
+	c.Assert(d.Create(do), NotNil)
+}
+
+func (s *nullSuite) TestResize(c *C) {
+	d := &Driver{}
+	do := driverOpts("policy1/test")
+
+	c.Assert(d.Resize(do), NotNil)
+	c.Assert(d.Create(do), IsNil)
+
+	do.Volume.Size = 20
+	c.Assert(d.Resize(do), IsNil)
+	c.Assert(d.GrowFilesystem(do), IsNil)
+
+	list, err := d.List(storage.ListOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(list[0].Size, Equals, uint64(20))
+
+	stats, err := d.Stats(do)
+	c.Assert(err, IsNil)
+	c.Assert(stats, DeepEquals, &storage.Stats{ProvisionedBytes: 20 * 1024 * 1024})
+
+	do.Volume.Size = 10
+	c.Assert(d.Resize(do), NotNil)
+}
+
+func (s *nullSuite) TestSnapshots(c *C) {
+	d := &Driver{}
+	do := driverOpts("policy1/test")
+
+	c.Assert(d.CreateSnapshot("snap", do), NotNil)
+	c.Assert(d.Create(do), IsNil)
+
+	c.Assert(d.CreateSnapshot("snap", do), IsNil)
+	c.Assert(d.CreateSnapshot("snap", do), NotNil)
+	c.Assert(d.CreateSnapshot("a-later-snap", do), IsNil)
+
+	list, err := d.ListSnapshots(do)
+	c.Assert(err, IsNil)
+	c.Assert(storage.SnapshotNames(list), DeepEquals, []string{"snap", "a-later-snap"})
+	c.Assert(list[0].Created.IsZero(), Equals, false)
+	c.Assert(list[0].Size, Equals, do.Volume.Size)
+
+	c.Assert(d.CopySnapshot(do, "snap", "policy1/copy"), IsNil)
+	c.Assert(d.CopySnapshot(do, "snap", "policy1/copy"), NotNil)
+	c.Assert(d.CopySnapshot(do, "nonexistent", "policy1/copy2"), NotNil)
+
+	exists, err := d.Exists(driverOpts("policy1/copy"))
+	c.Assert(err, IsNil)
+	c.Assert(exists, Equals, true)
+
+	progress := []int{}
+	c.Assert(d.Flatten(driverOpts("policy1/copy"), func(percent int) { progress = append(progress, percent) }), IsNil)
+	c.Assert(progress, DeepEquals, []int{100})
+	c.Assert(d.Flatten(driverOpts("policy1/copy2"), func(int) {}), NotNil)
+
+	c.Assert(d.RollbackSnapshot("snap", do), IsNil)
+	c.Assert(d.RollbackSnapshot("nonexistent", do), NotNil)
+
+	c.Assert(d.RemoveSnapshot("snap", do), IsNil)
+	c.Assert(d.RemoveSnapshot("snap", do), NotNil)
+
+	list, err = d.ListSnapshots(do)
+	c.Assert(err, IsNil)
+	c.Assert(storage.SnapshotNames(list), DeepEquals, []string{"a-later-snap"})
+
+	c.Assert(d.Destroy(do), IsNil)
+	_, err = d.ListSnapshots(do)
+	c.Assert(err, NotNil)
+}
+
+func (s *nullSuite) TestExportImport(c *C) {
+	d := &Driver{}
+	do := driverOpts("policy1/test")
+
+	c.Assert(d.Create(do), IsNil)
+	c.Assert(d.CreateSnapshot("snap", do), IsNil)
+
+	buf := &bytes.Buffer{}
+	c.Assert(d.Export(do, "snap", buf), IsNil)
+	c.Assert(d.Export(do, "nonexistent", buf), NotNil)
+	c.Assert(d.Export(driverOpts("policy1/nonexistent"), "snap", buf), NotNil)
+
+	newDo := driverOpts("policy1/imported")
+	c.Assert(d.Import(newDo, buf), IsNil)
+	c.Assert(d.Import(newDo, buf), Equals, storage.ErrVolumeExist)
+
+	exists, err := d.Exists(newDo)
+	c.Assert(err, IsNil)
+	c.Assert(exists, Equals, true)
+}
+
+func (s *nullSuite) TestDiffs(c *C) {
+	d := &Driver{}
+	do := driverOpts("policy1/test")
+
+	c.Assert(d.Create(do), IsNil)
+	c.Assert(d.CreateSnapshot("snap1", do), IsNil)
+	c.Assert(d.CreateSnapshot("snap2", do), IsNil)
+
+	full, incr := &bytes.Buffer{}, &bytes.Buffer{}
+	c.Assert(d.ExportDiff(do, "", "snap1", full), IsNil)
+	c.Assert(d.ExportDiff(do, "snap1", "snap2", incr), IsNil)
+	c.Assert(d.ExportDiff(do, "snap1", "nonexistent", &bytes.Buffer{}), NotNil)
+
+	newDo := driverOpts("policy1/restored")
+	c.Assert(d.Create(newDo), IsNil)
+
+	// diffs apply onto the snapshot they were taken from.
+	c.Assert(d.ImportDiff(newDo, bytes.NewReader(incr.Bytes())), NotNil)
+	c.Assert(d.ImportDiff(newDo, full), IsNil)
+	c.Assert(d.ImportDiff(newDo, incr), IsNil)
+	c.Assert(d.ImportDiff(newDo, strings.NewReader("garbage")), NotNil)
+
+	list, err := d.ListSnapshots(newDo)
+	c.Assert(err, IsNil)
+	c.Assert(storage.SnapshotNames(list), DeepEquals, []string{"snap1", "snap2"})
+}
+
+func (s *nullSuite) TestMountUnmount(c *C) {
+	md, err := NewMountDriver(s.dir)
+	c.Assert(err, IsNil)
+	do := driverOpts("policy1/test")
+
+	_, err = md.Mount(do)
+	c.Assert(err, NotNil)
+
+	c.Assert((&Driver{}).Create(do), IsNil)
+
+	mp, err := md.MountPath(do)
+	c.Assert(err, IsNil)
+	c.Assert(mp, Equals, filepath.Join(s.dir, "null/policy1/test"))
+
+	mount, err := md.Mount(do)
+	c.Assert(err, IsNil)
+	c.Assert(mount.Path, Equals, mp)
+	c.Assert(mount.Volume, DeepEquals, do.Volume)
+
+	_, err = md.Mount(do)
+	c.Assert(err, NotNil)
+
+	fi, err := os.Stat(mp)
+	c.Assert(err, IsNil)
+	c.Assert(fi.IsDir(), Equals, true)
+
+	mounts, err := md.Mounted(time.Second)
+	c.Assert(err, IsNil)
+	c.Assert(mounts, DeepEquals, []*storage.Mount{mount})
+
+	// drivers with other mountpaths do not see it.
+	other, err := NewMountDriver(filepath.Join(s.dir, "other"))
+	c.Assert(err, IsNil)
+	mounts, err = other.Mounted(time.Second)
+	c.Assert(err, IsNil)
+	c.Assert(len(mounts), Equals, 0)
+
+	c.Assert(md.Unmount(do), IsNil)
+	_, err = os.Stat(mp)
+	c.Assert(os.IsNotExist(err), Equals, true)
+
+	mounts, err = md.Mounted(time.Second)
+	c.Assert(err, IsNil)
+	c.Assert(len(mounts), Equals, 0)
+
+	// unmounting twice is harmless.
+	c.Assert(md.Unmount(do), IsNil)
+}
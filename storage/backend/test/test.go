@@ -232,10 +232,16 @@ func (d *Driver) CopySnapshot(do storage.DriverOptions, s, s2 string) error {
 	return nil
 }
 
+// RollbackSnapshot is a noop.
+func (d *Driver) RollbackSnapshot(s string, do storage.DriverOptions) error {
+	d.logStat(getFunctionName())
+	return nil
+}
+
 // ListSnapshots returns an empty list.
-func (d *Driver) ListSnapshots(do storage.DriverOptions) ([]string, error) {
+func (d *Driver) ListSnapshots(do storage.DriverOptions) ([]storage.Snapshot, error) {
 	d.logStat(getFunctionName())
-	return []string{}, nil
+	return []storage.Snapshot{}, nil
 }
 
 // Mounted returns an empty list.
@@ -0,0 +1,113 @@
+package zfs
+
+import (
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/storage"
+)
+
+// dataset is a dataset or zvol owned by volplugin, as reported by zfs list.
+type dataset struct {
+	Name   string // the zfs name
+	Type   string // filesystem or volume
+	Volume string // the volplugin name
+}
+
+// volume yields the volplugin volume, recovering the pool from the dataset
+// name, which is always `<pool>/policy/volume`.
+func (ds *dataset) volume() storage.Volume {
+	mode := ModeDataset
+	if ds.Type == "volume" {
+		mode = ModeZvol
+	}
+
+	return storage.Volume{
+		Name:   ds.Volume,
+		Params: storage.Params{"pool": path.Dir(path.Dir(ds.Name)), "mode": mode},
+	}
+}
+
+// listDatasets lists the datasets and zvols volplugin owns under the pool. If
+// the pool is empty, all datasets on the host are listed.
+func listDatasets(pool string, timeout time.Duration) ([]*dataset, error) {
+	args := []string{"list", "-H", "-r", "-t", "filesystem,volume", "-o", "name,type," + volumeProperty}
+	if pool != "" {
+		args = append(args, pool)
+	}
+
+	out, err := storage.RunCommand(exec.Command("zfs", args...), timeout)
+	if err != nil {
+		return nil, errored.Errorf("Listing datasets in pool %q", pool).Combine(err)
+	}
+
+	return parseDatasets(out)
+}
+
+// parseDatasets parses the output of `zfs list -H -o name,type,volplugin:volume`.
+// Datasets without the property are skipped.
+func parseDatasets(output string) ([]*dataset, error) {
+	datasets := []*dataset{}
+
+	for _, line := range strings.Split(output, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		parts := strings.Split(line, "\t")
+		if len(parts) != 3 {
+			return nil, errored.Errorf("Invalid zfs list output line %q", line)
+		}
+
+		// unset user properties are shown as "-".
+		if parts[2] == "-" || parts[2] == "" {
+			continue
+		}
+
+		datasets = append(datasets, &dataset{Name: parts[0], Type: parts[1], Volume: parts[2]})
+	}
+
+	return datasets, nil
+}
+
+// parseSnapshots parses the output of `zfs list -H -p -t snapshot -o
+// name,creation,referenced,clones` for the snapshots of the dataset.
+func parseSnapshots(output, dataset string) ([]storage.Snapshot, error) {
+	snaps := []storage.Snapshot{}
+
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, dataset+"@") {
+			continue
+		}
+
+		parts := strings.Split(line, "\t")
+		if len(parts) != 4 {
+			return nil, errored.Errorf("Invalid zfs output line %q", line)
+		}
+
+		created, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return nil, errored.Errorf("Invalid creation time in zfs output line %q", line).Combine(err)
+		}
+
+		size, err := strconv.ParseUint(parts[2], 10, 64)
+		if err != nil {
+			return nil, errored.Errorf("Invalid size in zfs output line %q", line).Combine(err)
+		}
+
+		snaps = append(snaps, storage.Snapshot{
+			Name:    strings.TrimPrefix(parts[0], dataset+"@"),
+			Created: time.Unix(created, 0),
+			Size:    size,
+			// snapshots cannot be destroyed while they have clones.
+			Protected: parts[3] != "" && parts[3] != "-",
+		})
+	}
+
+	return snaps, nil
+}
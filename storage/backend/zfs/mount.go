@@ -0,0 +1,206 @@
+package zfs
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/storage"
+	"github.com/contiv/volplugin/storage/mountscan"
+)
+
+func (d *Driver) mkMountPath(dataset string) (string, error) {
+	// Directory to mount the volume
+	volumePath := filepath.Join(d.mountpath, BackendName, dataset)
+	rel, err := filepath.Rel(d.mountpath, volumePath)
+	if err != nil || strings.Contains(rel, "..") {
+		return "", errors.MountFailed.Combine(errored.Errorf("Calculated volume path would escape subdir jail: %v", volumePath))
+	}
+
+	return volumePath, nil
+}
+
+// MountPath returns the path of a mount for a pool/volume.
+func (d *Driver) MountPath(do storage.DriverOptions) (string, error) {
+	dataset, err := datasetName(do.Volume.Name, do.Volume.Params)
+	if err != nil {
+		return "", err
+	}
+
+	return d.mkMountPath(dataset)
+}
+
+// Mount a volume. Returns the mount information about the volume. Volumes
+// belonging to other hosts are refused.
+func (d *Driver) Mount(do storage.DriverOptions) (*storage.Mount, error) {
+	if err := storage.CheckHost(do.Volume); err != nil {
+		return nil, errors.MountFailed.Combine(err)
+	}
+
+	dataset, err := datasetName(do.Volume.Name, do.Volume.Params)
+	if err != nil {
+		return nil, err
+	}
+
+	volumePath, err := d.mkMountPath(dataset)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(volumePath, 0700); err != nil && !os.IsExist(err) {
+		return nil, errored.Errorf("error creating %q directory: %v", volumePath, err)
+	}
+
+	var (
+		devName, fsType string
+		major, minor    uint
+	)
+
+	switch mode(do.Volume.Params) {
+	case ModeZvol:
+		devName, fsType = zvolDevice(dataset), do.FSOptions.Type
+
+		// Obtain the major and minor node information about the device we're mounting.
+		// This is critical for tuning cgroups and obtaining metrics for this device only.
+		fi, err := os.Stat(devName)
+		if err != nil {
+			return nil, errored.Errorf("Failed to stat zvol device %q: %v", devName, err)
+		}
+
+		major, minor = storage.DevNumbers(fi.Sys().(*syscall.Stat_t).Rdev)
+	default:
+		devName, fsType = dataset, BackendName
+	}
+
+	flags, data := storage.ParseMountOptions(do.FSOptions.MountOptions)
+	if err := unix.Mount(devName, volumePath, fsType, flags, data); err != nil {
+		return nil, errored.Errorf("Failed to mount zfs volume %q: %v", devName, err)
+	}
+
+	if mode(do.Volume.Params) != ModeZvol {
+		// datasets live on anonymous devices, which are only known after the mount.
+		fi, err := os.Stat(volumePath)
+		if err != nil {
+			return nil, errored.Errorf("Failed to stat mounted dataset %q: %v", volumePath, err)
+		}
+
+		major, minor = storage.DevNumbers(fi.Sys().(*syscall.Stat_t).Dev)
+	}
+
+	return &storage.Mount{
+		Device:   devName,
+		Path:     volumePath,
+		Volume:   do.Volume,
+		DevMajor: major,
+		DevMinor: minor,
+	}, nil
+}
+
+// Unmount a volume.
+func (d *Driver) Unmount(do storage.DriverOptions) error {
+	dataset, err := datasetName(do.Volume.Name, do.Volume.Params)
+	if err != nil {
+		return err
+	}
+
+	volumeDir, err := d.mkMountPath(dataset)
+	if err != nil {
+		return err
+	}
+
+	var retries int
+	var lastErr error
+
+retry:
+	if retries < 3 {
+		if err := unix.Unmount(volumeDir, 0); err != nil && err != unix.ENOENT && err != unix.EINVAL {
+			lastErr = errored.Errorf("Failed to unmount %q (retrying): %v", volumeDir, err)
+			logrus.Error(lastErr)
+			retries++
+			time.Sleep(100 * time.Millisecond)
+			goto retry
+		}
+	} else {
+		return errored.Errorf("Failed to umount after 3 retries").Combine(lastErr)
+	}
+
+	if err := os.Remove(volumeDir); err != nil && !os.IsNotExist(err) {
+		logrus.Error(errored.Errorf("error removing %q directory: %v", volumeDir, err))
+	}
+
+	return nil
+}
+
+// Mounted shows any volumes that belong to volplugin on the host, in
+// their native representation. They yield a *Mount.
+func (d *Driver) Mounted(timeout time.Duration) ([]*storage.Mount, error) {
+	mounts := []*storage.Mount{}
+
+	datasetMounts, err := mountscan.GetMounts(&mountscan.GetMountsRequest{DriverName: BackendName, FsType: BackendName})
+	if err != nil {
+		return nil, err
+	}
+
+	zvolMounts, err := mountscan.GetMounts(&mountscan.GetMountsRequest{DriverName: ModeZvol, KernelDriver: ModeZvol})
+	if err != nil {
+		if newerr, ok := err.(*errored.Error); !ok || !newerr.Contains(errors.ErrDevNotFound) {
+			return nil, err
+		}
+	}
+
+	if len(datasetMounts) == 0 && len(zvolMounts) == 0 {
+		return mounts, nil
+	}
+
+	host, err := storage.Hostname()
+	if err != nil {
+		return nil, errored.Errorf("Could not determine hostname").Combine(err)
+	}
+
+	datasets, err := listDatasets("", timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ds := range datasets {
+		candidates, sources := datasetMounts, []string{ds.Name}
+
+		if ds.Type == "volume" {
+			// zvols are mounted either by their /dev/zvol link or the /dev/zdN
+			// device it points at.
+			candidates, sources = zvolMounts, []string{zvolDevice(ds.Name)}
+			if device, err := filepath.EvalSymlinks(zvolDevice(ds.Name)); err == nil {
+				sources = append(sources, device)
+			}
+		}
+
+		for _, hostMount := range candidates {
+			for _, source := range sources {
+				if hostMount.MountSource != source {
+					continue
+				}
+
+				volume := ds.volume()
+				volume.Params[storage.HostParam] = host
+
+				mounts = append(mounts, &storage.Mount{
+					Device:   hostMount.MountSource,
+					DevMajor: hostMount.DeviceNumber.Major,
+					DevMinor: hostMount.DeviceNumber.Minor,
+					Path:     hostMount.MountPoint,
+					Volume:   volume,
+				})
+				break
+			}
+		}
+	}
+
+	return mounts, nil
+}
@@ -0,0 +1,428 @@
+package zfs
+
+import (
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/storage"
+)
+
+const (
+	// BackendName is the name of the ZFS storage backend.
+	BackendName = "zfs"
+
+	// ModeDataset stores volumes as native ZFS filesystems, sized with a quota.
+	ModeDataset = "dataset"
+	// ModeZvol stores volumes as zvols, which are formatted like any other
+	// block device.
+	ModeZvol = "zvol"
+
+	// volumeProperty is the user property set on every dataset or zvol
+	// volplugin creates. It holds the volplugin name of the volume.
+	volumeProperty = "volplugin:volume"
+
+	// listTimeout is used for listing volumes, where the caller provides no
+	// timeout. It matches the default command timeout in the global config.
+	listTimeout = 10 * time.Minute
+)
+
+// ZFS is picky about the characters in dataset and snapshot names.
+var invalidNameRegex = regexp.MustCompile(`[^A-Za-z0-9_.:-]`)
+
+// Driver implements a storage driver on top of ZFS.
+//
+// -- Layout
+//
+// Volumes are created under the dataset named by the `pool` driver option; a
+// volume `policy/volume` is stored as `<pool>/policy/volume`. The `mode`
+// driver option selects between datasets (the default) and zvols. Datasets
+// are mounted directly and need no filesystem to be created; zvols are
+// formatted with the policy's filesystem like any other block device.
+//
+// Snapshots are ZFS snapshots, and copies of them are ZFS clones.
+//
+// -- Hosts
+//
+// Pools are local to a host, so volumes belong to the host they were created
+// on, which is recorded in the `host` driver option. Other hosts refuse to
+// work on them: volsupervisor and the apiserver can only snapshot, copy or
+// roll back volumes when they run on that host.
+type Driver struct {
+	mountpath string
+}
+
+// NewMountDriver is a generator for Driver structs. It is used by the storage
+// framework to yield new drivers on every creation.
+func NewMountDriver(mountpath string) (storage.MountDriver, error) {
+	return &Driver{mountpath: mountpath}, nil
+}
+
+// NewCRUDDriver is a generator for Driver structs. It is used by the storage
+// framework to yield new drivers on every creation.
+func NewCRUDDriver() (storage.CRUDDriver, error) {
+	return &Driver{}, nil
+}
+
+// NewSnapshotDriver is a generator for Driver structs. It is used by the storage
+// framework to yield new drivers on every creation.
+func NewSnapshotDriver() (storage.SnapshotDriver, error) {
+	return &Driver{}, nil
+}
+
+// Name returns the zfs backend string
+func (d *Driver) Name() string {
+	return BackendName
+}
+
+func mode(params storage.Params) string {
+	if params["mode"] == "" {
+		return ModeDataset
+	}
+
+	return params["mode"]
+}
+
+// datasetName translates a volplugin `policy/volume` name to the name of the
+// dataset or zvol. Yields an error if impossible.
+func datasetName(volName string, params storage.Params) (string, error) {
+	policy, volume, err := storage.SplitName(volName)
+	if err != nil {
+		return "", err
+	}
+
+	if invalidNameRegex.MatchString(policy) || invalidNameRegex.MatchString(volume) {
+		return "", errored.Errorf("Invalid volume name %q, may only contain the characters [A-Za-z0-9_.:-]", volName)
+	}
+
+	return strings.Join([]string{params["pool"], policy, volume}, "/"), nil
+}
+
+// snapshotName translates a snapshot name into one suitable for ZFS. This is
+// idempotent, so names returned by ListSnapshots() may be passed back in.
+func snapshotName(snapName string) string {
+	return invalidNameRegex.ReplaceAllString(snapName, "-")
+}
+
+func zvolDevice(dataset string) string {
+	return "/dev/zvol/" + dataset
+}
+
+// waitForDevice waits for udev to create the device node of a new zvol.
+func waitForDevice(device string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		_, err := os.Stat(device)
+		if err == nil {
+			return nil
+		}
+
+		if !os.IsNotExist(err) || time.Now().After(deadline) {
+			return errored.Errorf("Waiting for device %q", device).Combine(err)
+		}
+
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func (d *Driver) mkfsVolume(fscmd, devicePath string, timeout time.Duration) error {
+	cmd := exec.Command("/bin/sh", "-c", storage.TemplateFSCmd(fscmd, devicePath))
+	if _, err := storage.RunCommand(cmd, timeout); err != nil {
+		return errored.Errorf("Error creating filesystem on %s with cmd: %q", devicePath, fscmd).Combine(err)
+	}
+
+	return nil
+}
+
+// Create a volume. The name of this host is recorded in the parameters of
+// the volume.
+func (d *Driver) Create(do storage.DriverOptions) error {
+	dataset, err := datasetName(do.Volume.Name, do.Volume.Params)
+	if err != nil {
+		return err
+	}
+
+	if err := storage.ClaimHost(do.Volume); err != nil {
+		return err
+	}
+
+	exists, err := d.Exists(do)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return storage.ErrVolumeExist
+	}
+
+	// Size is in megabytes, just like it is for rbd.
+	size := strconv.FormatUint(do.Volume.Size, 10) + "M"
+
+	args := []string{"create", "-p", "-o", volumeProperty + "=" + do.Volume.Name}
+
+	switch mode(do.Volume.Params) {
+	case ModeZvol:
+		args = append(args, "-V", size)
+	default:
+		args = append(args, "-o", "quota="+size, "-o", "mountpoint=legacy")
+	}
+
+	if _, err := storage.RunCommand(exec.Command("zfs", append(args, dataset)...), do.Timeout); err != nil {
+		return errored.Errorf("Creating volume %q", do.Volume.Name).Combine(err)
+	}
+
+	return nil
+}
+
+// Format formats a created volume. Datasets are already filesystems, so only
+// zvols are formatted.
+func (d *Driver) Format(do storage.DriverOptions) error {
+	if mode(do.Volume.Params) != ModeZvol {
+		return nil
+	}
+
+	dataset, err := datasetName(do.Volume.Name, do.Volume.Params)
+	if err != nil {
+		return err
+	}
+
+	device := zvolDevice(dataset)
+
+	if err := waitForDevice(device, do.Timeout); err != nil {
+		return err
+	}
+
+	return d.mkfsVolume(do.FSOptions.CreateCommand, device, do.Timeout)
+}
+
+// Destroy a volume.
+func (d *Driver) Destroy(do storage.DriverOptions) error {
+	if err := storage.CheckHost(do.Volume); err != nil {
+		return err
+	}
+
+	dataset, err := datasetName(do.Volume.Name, do.Volume.Params)
+	if err != nil {
+		return err
+	}
+
+	// -r takes the snapshots with it.
+	if _, err := storage.RunCommand(exec.Command("zfs", "destroy", "-r", dataset), do.Timeout); err != nil {
+		return errored.Errorf("Destroying volume %q", do.Volume.Name).Combine(err)
+	}
+
+	return nil
+}
+
+// List all volumes on this host.
+func (d *Driver) List(lo storage.ListOptions) ([]storage.Volume, error) {
+	host, err := storage.Hostname()
+	if err != nil {
+		return nil, errored.Errorf("Could not determine hostname").Combine(err)
+	}
+
+	datasets, err := listDatasets(lo.Params["pool"], listTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	list := []storage.Volume{}
+
+	for _, ds := range datasets {
+		volume := ds.volume()
+		volume.Params[storage.HostParam] = host
+		list = append(list, volume)
+	}
+
+	return list, nil
+}
+
+// Exists returns true if the volume already exists. Volumes belonging to
+// other hosts cannot be looked at, and are assumed to exist.
+func (d *Driver) Exists(do storage.DriverOptions) (bool, error) {
+	if do.Volume.Params[storage.HostParam] != "" {
+		if err := storage.CheckHost(do.Volume); err != nil {
+			logrus.Warnf("Cannot check for volume %q on this host, assuming it exists: %v", do.Volume.Name, err)
+			return true, nil
+		}
+	}
+
+	volumes, err := d.List(storage.ListOptions{Params: do.Volume.Params})
+	if err != nil {
+		return false, err
+	}
+
+	for _, vol := range volumes {
+		if vol.Name == do.Volume.Name {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// CreateSnapshot creates a named snapshot for the volume. Any error will be returned.
+func (d *Driver) CreateSnapshot(snapName string, do storage.DriverOptions) error {
+	if err := storage.CheckHost(do.Volume); err != nil {
+		return err
+	}
+
+	dataset, err := datasetName(do.Volume.Name, do.Volume.Params)
+	if err != nil {
+		return err
+	}
+
+	if _, err := storage.RunCommand(exec.Command("zfs", "snapshot", dataset+"@"+snapshotName(snapName)), do.Timeout); err != nil {
+		return errored.Errorf("Creating snapshot %q (volume %q)", snapName, do.Volume.Name).Combine(err)
+	}
+
+	return nil
+}
+
+// RemoveSnapshot removes a named snapshot for the volume. Any error will be returned.
+func (d *Driver) RemoveSnapshot(snapName string, do storage.DriverOptions) error {
+	if err := storage.CheckHost(do.Volume); err != nil {
+		return err
+	}
+
+	dataset, err := datasetName(do.Volume.Name, do.Volume.Params)
+	if err != nil {
+		return err
+	}
+
+	if _, err := storage.RunCommand(exec.Command("zfs", "destroy", dataset+"@"+snapshotName(snapName)), do.Timeout); err != nil {
+		return errored.Errorf("Removing snapshot %q (volume %q)", snapName, do.Volume.Name).Combine(err)
+	}
+
+	return nil
+}
+
+// RollbackSnapshot rolls the dataset back to the snapshot. zfs only rolls
+// back to the latest snapshot without destroying the later ones, so rolling
+// back to an earlier snapshot fails until the later snapshots are removed.
+func (d *Driver) RollbackSnapshot(snapName string, do storage.DriverOptions) error {
+	if err := storage.CheckHost(do.Volume); err != nil {
+		return err
+	}
+
+	dataset, err := datasetName(do.Volume.Name, do.Volume.Params)
+	if err != nil {
+		return err
+	}
+
+	if _, err := storage.RunCommand(exec.Command("zfs", "rollback", dataset+"@"+snapshotName(snapName)), do.Timeout); err != nil {
+		return errored.Errorf("Rolling back volume %q to snapshot %q", do.Volume.Name, snapName).Combine(err)
+	}
+
+	return nil
+}
+
+// ListSnapshots returns the snapshots of the volume, oldest first. Any error
+// will be returned.
+func (d *Driver) ListSnapshots(do storage.DriverOptions) ([]storage.Snapshot, error) {
+	if err := storage.CheckHost(do.Volume); err != nil {
+		return nil, err
+	}
+
+	dataset, err := datasetName(do.Volume.Name, do.Volume.Params)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := storage.RunCommand(exec.Command("zfs", "list", "-H", "-p", "-t", "snapshot", "-o", "name,creation,referenced,clones", "-s", "creation", "-d", "1", dataset), do.Timeout)
+	if err != nil {
+		return nil, errored.Errorf("Listing snapshots for volume %q", do.Volume.Name).Combine(err)
+	}
+
+	snaps, err := parseSnapshots(out, dataset)
+	if err != nil {
+		return nil, errored.Errorf("Listing snapshots for volume %q", do.Volume.Name).Combine(err)
+	}
+
+	return snaps, nil
+}
+
+// CopySnapshot copies a snapshot into a new volume. Takes a DriverOptions,
+// snap and volume name (string). Returns error on failure.
+func (d *Driver) CopySnapshot(do storage.DriverOptions, snapName, newName string) error {
+	if err := storage.CheckHost(do.Volume); err != nil {
+		return err
+	}
+
+	dataset, err := datasetName(do.Volume.Name, do.Volume.Params)
+	if err != nil {
+		return err
+	}
+
+	newDataset, err := datasetName(newName, do.Volume.Params)
+	if err != nil {
+		return err
+	}
+
+	snapshots, err := d.ListSnapshots(do)
+	if err != nil {
+		return errors.SnapshotCopy.Combine(err)
+	}
+
+	var found bool
+	for _, snap := range snapshots {
+		if snap.Name == snapshotName(snapName) {
+			found = true
+			break
+		}
+	}
+
+	if !found {
+		return errored.Errorf("Snapshot %q (volume %q) could not be found", snapName, do.Volume.Name).Combine(errors.SnapshotCopy)
+	}
+
+	exists, err := d.Exists(storage.DriverOptions{Volume: storage.Volume{Name: newName, Params: do.Volume.Params}})
+	if err != nil {
+		return errors.SnapshotCopy.Combine(err)
+	}
+
+	if exists {
+		return errored.Errorf("Volume %q already exists", newName).Combine(errors.Exists)
+	}
+
+	args := []string{"clone", "-p", "-o", volumeProperty + "=" + newName}
+	if mode(do.Volume.Params) != ModeZvol {
+		args = append(args, "-o", "mountpoint=legacy")
+	}
+
+	args = append(args, dataset+"@"+snapshotName(snapName), newDataset)
+
+	if _, err := storage.RunCommand(exec.Command("zfs", args...), do.Timeout); err != nil {
+		return errored.Errorf("Copying snapshot %q (volume %q) to %q", snapName, do.Volume.Name, newName).Combine(errors.SnapshotCopy).Combine(err)
+	}
+
+	return nil
+}
+
+// Validate validates the driver options to ensure they are compatible with the
+// ZFS storage driver.
+func (d *Driver) Validate(do *storage.DriverOptions) error {
+	// XXX check this first to guard against nil pointers ahead of time.
+	if err := do.Validate(); err != nil {
+		return err
+	}
+
+	if do.Volume.Params["pool"] == "" {
+		return errored.Errorf("Pool is missing in zfs storage driver.")
+	}
+
+	switch mode(do.Volume.Params) {
+	case ModeDataset, ModeZvol:
+	default:
+		return errored.Errorf("Invalid mode %q in zfs storage driver, must be %q or %q.", do.Volume.Params["mode"], ModeDataset, ModeZvol)
+	}
+
+	return nil
+}
@@ -0,0 +1,267 @@
+package zfs
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	. "testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/contiv/volplugin/storage"
+)
+
+const (
+	myMountpath = "/mnt"
+	testPool    = "volplugin-test"
+)
+
+type zfsSuite struct {
+	imageFile string
+}
+
+var _ = Suite(&zfsSuite{})
+
+func TestZFS(t *T) { TestingT(t) }
+
+func driverOpts(name, mode string) storage.DriverOptions {
+	return storage.DriverOptions{
+		Volume: storage.Volume{
+			Name:   name,
+			Size:   100,
+			Params: storage.Params{"pool": testPool, "mode": mode},
+		},
+		FSOptions: storage.FSOptions{
+			Type:          "ext4",
+			CreateCommand: "mkfs.ext4 -F -m0 %",
+		},
+		Timeout: 30 * time.Second,
+	}
+}
+
+func run(c *C, name string, args ...string) string {
+	out, err := exec.Command(name, args...).CombinedOutput()
+	c.Assert(err, IsNil, Commentf("%s %v: %s", name, args, out))
+	return strings.TrimSpace(string(out))
+}
+
+// SetUpSuite builds a zpool on top of a file, if ZFS is available on this host.
+func (s *zfsSuite) SetUpSuite(c *C) {
+	if _, err := exec.LookPath("zpool"); err != nil || os.Getuid() != 0 {
+		return
+	}
+
+	f, err := ioutil.TempFile("", "volplugin-zfs")
+	c.Assert(err, IsNil)
+	c.Assert(f.Truncate(1024*1024*1024), IsNil)
+	c.Assert(f.Close(), IsNil)
+
+	s.imageFile = f.Name()
+	run(c, "zpool", "create", "-m", "none", testPool, s.imageFile)
+}
+
+func (s *zfsSuite) TearDownSuite(c *C) {
+	if s.imageFile == "" {
+		return
+	}
+
+	run(c, "zpool", "destroy", "-f", testPool)
+	c.Assert(os.Remove(s.imageFile), IsNil)
+}
+
+func (s *zfsSuite) requireZFS(c *C) {
+	if s.imageFile == "" {
+		c.Skip("ZFS and root privileges are required for this test")
+	}
+}
+
+func (s *zfsSuite) TestParse(c *C) {
+	output := "volplugin-test\tfilesystem\t-\n" +
+		"volplugin-test/policy1\tfilesystem\t-\n" +
+		"volplugin-test/policy1/test\tfilesystem\tpolicy1/test\n" +
+		"volplugin-test/policy1/block\tvolume\tpolicy1/block\n"
+
+	datasets, err := parseDatasets(output)
+	c.Assert(err, IsNil)
+	c.Assert(datasets, DeepEquals, []*dataset{
+		{Name: "volplugin-test/policy1/test", Type: "filesystem", Volume: "policy1/test"},
+		{Name: "volplugin-test/policy1/block", Type: "volume", Volume: "policy1/block"},
+	})
+
+	c.Assert(datasets[0].volume(), DeepEquals, storage.Volume{Name: "policy1/test", Params: storage.Params{"pool": testPool, "mode": ModeDataset}})
+	c.Assert(datasets[1].volume(), DeepEquals, storage.Volume{Name: "policy1/block", Params: storage.Params{"pool": testPool, "mode": ModeZvol}})
+
+	_, err = parseDatasets("volplugin-test filesystem -")
+	c.Assert(err, NotNil)
+
+	snaps, err := parseSnapshots("volplugin-test/policy1/test@one\t1000\t4096\t-\nvolplugin-test/policy1/test@two\t2000\t8192\tvolplugin-test/policy1/copy\n", "volplugin-test/policy1/test")
+	c.Assert(err, IsNil)
+	c.Assert(snaps, DeepEquals, []storage.Snapshot{
+		{Name: "one", Created: time.Unix(1000, 0), Size: 4096},
+		{Name: "two", Created: time.Unix(2000, 0), Size: 8192, Protected: true},
+	})
+
+	snaps, err = parseSnapshots("", "volplugin-test/policy1/test")
+	c.Assert(err, IsNil)
+	c.Assert(snaps, DeepEquals, []storage.Snapshot{})
+
+	_, err = parseSnapshots("volplugin-test/policy1/test@one\tyesterday\t4096\t-", "volplugin-test/policy1/test")
+	c.Assert(err, NotNil)
+	_, err = parseSnapshots("volplugin-test/policy1/test@one", "volplugin-test/policy1/test")
+	c.Assert(err, NotNil)
+}
+
+func (s *zfsSuite) TestNames(c *C) {
+	d := &Driver{mountpath: myMountpath}
+
+	name, err := datasetName("policy1/test", storage.Params{"pool": "tank/volplugin"})
+	c.Assert(err, IsNil)
+	c.Assert(name, Equals, "tank/volplugin/policy1/test")
+
+	for _, name := range []string{"test", "policy1/te st", "policy1/te@st"} {
+		_, err := datasetName(name, storage.Params{"pool": testPool})
+		c.Assert(err, NotNil, Commentf("%s", name))
+	}
+
+	c.Assert(snapshotName("2016-01-02 15:04:05.999 +0000 UTC"), Equals, "2016-01-02-15:04:05.999--0000-UTC")
+	c.Assert(snapshotName(snapshotName("a b")), Equals, "a-b")
+
+	mp, err := d.MountPath(driverOpts("policy1/test", ""))
+	c.Assert(err, IsNil)
+	c.Assert(mp, Equals, "/mnt/zfs/volplugin-test/policy1/test")
+}
+
+func (s *zfsSuite) TestValidate(c *C) {
+	d := &Driver{}
+
+	for _, mode := range []string{"", ModeDataset, ModeZvol} {
+		do := driverOpts("policy1/test", mode)
+		c.Assert(d.Validate(&do), IsNil)
+	}
+
+	do := driverOpts("policy1/test", "raw")
+	c.Assert(d.Validate(&do), NotNil)
+
+	do = driverOpts("policy1/test", "")
+	do.Volume.Params = storage.Params{}
+	c.Assert(d.Validate(&do), NotNil)
+}
+
+func (s *zfsSuite) testCRUD(c *C, mode string) {
+	d := &Driver{}
+	do := driverOpts("policy1/test", mode)
+
+	c.Assert(d.Create(do), IsNil)
+	c.Assert(d.Create(do), Equals, storage.ErrVolumeExist)
+	c.Assert(d.Format(do), IsNil)
+
+	host, err := os.Hostname()
+	c.Assert(err, IsNil)
+	c.Assert(do.Volume.Params[storage.HostParam], Equals, host)
+
+	list, err := d.List(storage.ListOptions{Params: storage.Params{"pool": testPool}})
+	c.Assert(err, IsNil)
+	c.Assert(list, DeepEquals, []storage.Volume{{Name: "policy1/test", Params: storage.Params{"pool": testPool, "mode": mode, storage.HostParam: host}}})
+
+	// other hosts cannot reach the pool.
+	storage.Hostname = func() (string, error) { return "host2", nil }
+	err = d.Destroy(do)
+	exists, existsErr := d.Exists(do)
+	storage.Hostname = os.Hostname
+	c.Assert(err, ErrorMatches, `.*belongs to host.*`)
+	c.Assert(existsErr, IsNil)
+	c.Assert(exists, Equals, true)
+
+	c.Assert(d.Destroy(do), IsNil)
+
+	exists, err = d.Exists(do)
+	c.Assert(err, IsNil)
+	c.Assert(exists, Equals, false)
+}
+
+func (s *zfsSuite) TestCRUD(c *C) {
+	s.requireZFS(c)
+	s.testCRUD(c, ModeDataset)
+	s.testCRUD(c, ModeZvol)
+}
+
+func (s *zfsSuite) TestSnapshots(c *C) {
+	s.requireZFS(c)
+
+	d := &Driver{}
+	do := driverOpts("policy1/test", ModeDataset)
+
+	c.Assert(d.Create(do), IsNil)
+	c.Assert(d.CreateSnapshot("test snap", do), IsNil)
+	c.Assert(d.CreateSnapshot("test2", do), IsNil)
+
+	list, err := d.ListSnapshots(do)
+	c.Assert(err, IsNil)
+	c.Assert(storage.SnapshotNames(list), DeepEquals, []string{"test-snap", "test2"})
+	c.Assert(list[0].Created.IsZero(), Equals, false)
+
+	c.Assert(d.CopySnapshot(do, "test-snap", "policy1/copy"), IsNil)
+	c.Assert(d.CopySnapshot(do, "test-snap", "policy1/copy"), NotNil)
+	c.Assert(d.CopySnapshot(do, "nonexistent", "policy1/copy2"), NotNil)
+
+	copyDO := driverOpts("policy1/copy", ModeDataset)
+	exists, err := d.Exists(copyDO)
+	c.Assert(err, IsNil)
+	c.Assert(exists, Equals, true)
+
+	// only the latest snapshot can be rolled back to.
+	c.Assert(d.RollbackSnapshot("test-snap", do), NotNil)
+	c.Assert(d.RollbackSnapshot("test2", do), IsNil)
+
+	c.Assert(d.RemoveSnapshot("test2", do), IsNil)
+	list, err = d.ListSnapshots(do)
+	c.Assert(err, IsNil)
+	c.Assert(storage.SnapshotNames(list), DeepEquals, []string{"test-snap"})
+
+	// the clone depends on the snapshot, so it goes first.
+	c.Assert(d.Destroy(copyDO), IsNil)
+	c.Assert(d.Destroy(do), IsNil)
+}
+
+func (s *zfsSuite) testMountUnmount(c *C, mode string) {
+	crud, err := NewCRUDDriver()
+	c.Assert(err, IsNil)
+	mountD, err := NewMountDriver(myMountpath)
+	c.Assert(err, IsNil)
+
+	do := driverOpts("policy1/test", mode)
+
+	c.Assert(crud.Create(do), IsNil)
+	c.Assert(crud.Format(do), IsNil)
+
+	mount, err := mountD.Mount(do)
+	c.Assert(err, IsNil)
+	c.Assert(mount.Path, Equals, "/mnt/zfs/volplugin-test/policy1/test")
+
+	mounts, err := mountD.Mounted(do.Timeout)
+	c.Assert(err, IsNil)
+	c.Assert(len(mounts), Equals, 1)
+	c.Assert(mounts[0].Volume.Name, Equals, "policy1/test")
+	c.Assert(mounts[0].Volume.Params, DeepEquals, do.Volume.Params)
+	c.Assert(mounts[0].DevMajor, Equals, mount.DevMajor)
+	c.Assert(mounts[0].DevMinor, Equals, mount.DevMinor)
+
+	c.Assert(ioutil.WriteFile(filepath.Join(mount.Path, "test.txt"), []byte("Test string\n"), 0644), IsNil)
+
+	c.Assert(mountD.Unmount(do), IsNil)
+
+	mounts, err = mountD.Mounted(do.Timeout)
+	c.Assert(err, IsNil)
+	c.Assert(len(mounts), Equals, 0)
+
+	c.Assert(crud.Destroy(do), IsNil)
+}
+
+func (s *zfsSuite) TestMountUnmount(c *C) {
+	s.requireZFS(c)
+	s.testMountUnmount(c, ModeDataset)
+	s.testMountUnmount(c, ModeZvol)
+}
@@ -1,6 +1,7 @@
 package control
 
 import (
+	"io"
 	"time"
 
 	"github.com/Sirupsen/logrus"
@@ -44,6 +45,9 @@ func CreateVolume(policy *config.Policy, config *config.Volume, timeout time.Dur
 		return storage.DriverOptions{}, err
 	}
 
+	// XXX the params are shared with the volume configuration, so anything the
+	//     driver records in them during Create (e.g. the owning host of a local
+	//     volume) is published along with the volume.
 	driverOpts := storage.DriverOptions{
 		Volume: storage.Volume{
 			Name:   config.String(),
@@ -61,7 +65,8 @@ func CreateVolume(policy *config.Policy, config *config.Volume, timeout time.Dur
 	return driverOpts, driver.Create(driverOpts)
 }
 
-// FormatVolume formats an existing volume.
+// FormatVolume formats an existing volume. Volumes formatted with the key of
+// an encryption are encrypted first; see storage.Encryption.
 func FormatVolume(config *config.Volume, do storage.DriverOptions) error {
 	actualSize, err := config.CreateOptions.ActualSize()
 	if err != nil {
@@ -78,7 +83,7 @@ func FormatVolume(config *config.Volume, do storage.DriverOptions) error {
 		return err
 	}
 
-	logrus.Infof("Formatting volume %v (filesystem %q) with size %d", config, config.CreateOptions.FileSystem, actualSize)
+	logrus.Infof("Formatting volume %v (filesystem %q, encrypted: %v) with size %d", config, config.CreateOptions.FileSystem, do.Encryption.Enabled(), actualSize)
 	return driver.Format(do)
 }
 
@@ -129,3 +134,300 @@ func RemoveVolume(config *config.Volume, timeout time.Duration) error {
 
 	return driver.Destroy(driverOpts)
 }
+
+// ResizeVolume grows a volume to the size in its configuration. Volumes of
+// host-local backends are left to the host they belong to.
+func ResizeVolume(config *config.Volume, timeout time.Duration) error {
+	if config.Backends.CRUD == "" {
+		logrus.Debugf("Not resizing volume %q, backend is unspecified", config)
+		return errors.NoActionTaken
+	}
+
+	driver, err := backend.NewCRUDDriver(config.Backends.CRUD)
+	if err != nil {
+		return err
+	}
+
+	resizer, ok := driver.(storage.ResizeDriver)
+	if !ok {
+		return errors.ResizeUnsupported.Combine(errored.New(config.Backends.CRUD))
+	}
+
+	driverOpts, err := config.ToDriverOptions(timeout)
+	if err != nil {
+		return err
+	}
+
+	// the storage of host-local backends can only be reached from the host the
+	// volume belongs to. volplugin there applies the new size when it sees
+	// the updated volume.
+	if owner := driverOpts.Volume.Params[storage.HostParam]; owner != "" {
+		if err := storage.CheckHost(driverOpts.Volume); err != nil {
+			logrus.Infof("Leaving the resize of volume %v to host %q", config, owner)
+			return nil
+		}
+	}
+
+	logrus.Infof("Resizing volume %v to size %d", config, driverOpts.Volume.Size)
+
+	return resizer.Resize(driverOpts)
+}
+
+// RenameVolume renames a volume in its backend to newName, named
+// policy/volume.
+func RenameVolume(config *config.Volume, newName string, timeout time.Duration) error {
+	if config.Backends.CRUD == "" {
+		logrus.Debugf("Not renaming volume %q, backend is unspecified", config)
+		return errors.NoActionTaken
+	}
+
+	driver, err := backend.NewCRUDDriver(config.Backends.CRUD)
+	if err != nil {
+		return err
+	}
+
+	renamer, ok := driver.(storage.RenameDriver)
+	if !ok {
+		return errors.RenameUnsupported.Combine(errored.New(config.Backends.CRUD))
+	}
+
+	driverOpts, err := config.ToDriverOptions(timeout)
+	if err != nil {
+		return err
+	}
+
+	logrus.Infof("Renaming volume %v to %v", config, newName)
+
+	return renamer.Rename(driverOpts, newName)
+}
+
+// adoptDriver returns the named CRUD driver if it can adopt images.
+func adoptDriver(crud string) (storage.AdoptDriver, error) {
+	if crud == "" {
+		logrus.Debug("Not adopting images, backend is unspecified")
+		return nil, errors.NoActionTaken
+	}
+
+	driver, err := backend.NewCRUDDriver(crud)
+	if err != nil {
+		return nil, err
+	}
+
+	adopter, ok := driver.(storage.AdoptDriver)
+	if !ok {
+		return nil, errors.AdoptUnsupported.Combine(errored.New(crud))
+	}
+
+	return adopter, nil
+}
+
+// imageVolumes maps the images of the volumes on the adopting driver to the
+// volumes.
+func imageVolumes(crud string, adopter storage.AdoptDriver, volumes []*config.Volume) map[string]string {
+	images := map[string]string{}
+
+	for _, vc := range volumes {
+		if vc.Backends == nil || vc.Backends.CRUD != crud {
+			continue
+		}
+
+		image, err := adopter.VolumeImage(storage.Volume{Name: vc.String(), Params: vc.DriverOptions})
+		if err != nil {
+			logrus.Warnf("Cannot tell the image of volume %q: %v", vc, err)
+			continue
+		}
+
+		images[image] = vc.String()
+	}
+
+	return images
+}
+
+// ListImages lists the images where params place the volumes of the policy,
+// along with the volumes among volumes which use them. params scope the
+// listing as the driver options of volumes do, e.g. to a pool.
+func ListImages(policy *config.Policy, params storage.Params, volumes []*config.Volume) ([]storage.Image, error) {
+	if policy.Backends == nil {
+		return nil, errors.AdoptUnsupported.Combine(errored.Errorf("Policy %q has no backends", policy.Name))
+	}
+
+	adopter, err := adoptDriver(policy.Backends.CRUD)
+	if err != nil {
+		return nil, err
+	}
+
+	names, err := adopter.Images(storage.ListOptions{Params: params})
+	if err != nil {
+		return nil, err
+	}
+
+	used := imageVolumes(policy.Backends.CRUD, adopter, volumes)
+
+	images := []storage.Image{}
+	for _, name := range names {
+		images = append(images, storage.Image{Name: name, Volume: used[name]})
+	}
+
+	return images, nil
+}
+
+// AdoptVolume makes the volume use an image made in its backend outside
+// volplugin, which is neither created nor formatted, and keeps its name. The
+// image is recorded in the driver options of the volume, and looked up with
+// them. Images used by any of volumes cannot be adopted.
+func AdoptVolume(config *config.Volume, image string, volumes []*config.Volume, timeout time.Duration) error {
+	adopter, err := adoptDriver(config.Backends.CRUD)
+	if err != nil {
+		return err
+	}
+
+	driver, err := backend.NewCRUDDriver(config.Backends.CRUD)
+	if err != nil {
+		return err
+	}
+
+	config.DriverOptions[storage.ImageParam] = image
+
+	driverOpts, err := config.ToDriverOptions(timeout)
+	if err != nil {
+		return err
+	}
+
+	qualified, err := adopter.VolumeImage(driverOpts.Volume)
+	if err != nil {
+		return err
+	}
+
+	if volume, ok := imageVolumes(config.Backends.CRUD, adopter, volumes)[qualified]; ok {
+		return errors.Exists.Combine(errored.Errorf("Image %q is used by volume %q", qualified, volume))
+	}
+
+	exists, err := driver.Exists(driverOpts)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return errors.NotExists.Combine(errored.Errorf("Image %q", qualified))
+	}
+
+	// images already named as the volume would be need not be recorded.
+	delete(config.DriverOptions, storage.ImageParam)
+	if own, err := adopter.VolumeImage(driverOpts.Volume); err != nil || own != qualified {
+		config.DriverOptions[storage.ImageParam] = image
+	}
+
+	logrus.Infof("Adopting image %q as volume %v", qualified, config)
+
+	return nil
+}
+
+// VolumeFileSystem returns the type of the filesystem on a volume, or an
+// empty string if it has none. The volume must not be mounted.
+func VolumeFileSystem(config *config.Volume, timeout time.Duration) (string, error) {
+	adopter, err := adoptDriver(config.Backends.CRUD)
+	if err != nil {
+		return "", err
+	}
+
+	driverOpts, err := config.ToDriverOptions(timeout)
+	if err != nil {
+		return "", err
+	}
+
+	return adopter.FileSystem(driverOpts)
+}
+
+// exportDriver returns the CRUD driver of the volume if it can export and
+// import volumes.
+func exportDriver(config *config.Volume) (storage.ExportDriver, error) {
+	if config.Backends.CRUD == "" {
+		logrus.Debugf("Not transferring volume %q, backend is unspecified", config)
+		return nil, errors.NoActionTaken
+	}
+
+	driver, err := backend.NewCRUDDriver(config.Backends.CRUD)
+	if err != nil {
+		return nil, err
+	}
+
+	exporter, ok := driver.(storage.ExportDriver)
+	if !ok {
+		return nil, errors.ExportUnsupported.Combine(errored.New(config.Backends.CRUD))
+	}
+
+	return exporter, nil
+}
+
+// ExportVolume writes an image of the named snapshot of a volume to w.
+func ExportVolume(config *config.Volume, snapName string, w io.Writer, timeout time.Duration) error {
+	exporter, err := exportDriver(config)
+	if err != nil {
+		return err
+	}
+
+	driverOpts, err := config.ToDriverOptions(timeout)
+	if err != nil {
+		return err
+	}
+
+	logrus.Infof("Exporting snapshot %q of volume %v", snapName, config)
+
+	return exporter.Export(driverOpts, snapName, w)
+}
+
+// ImportVolume creates a volume from an image read from r. It stands in for
+// CreateVolume and FormatVolume.
+func ImportVolume(config *config.Volume, r io.Reader, timeout time.Duration) error {
+	exporter, err := exportDriver(config)
+	if err != nil {
+		return err
+	}
+
+	driverOpts, err := config.ToDriverOptions(timeout)
+	if err != nil {
+		return err
+	}
+
+	logrus.Infof("Importing volume %v with size %d", config, driverOpts.Volume.Size)
+
+	return exporter.Import(driverOpts, r)
+}
+
+// VolumeStats returns the capacity and usage of a volume. The CRUD driver is
+// asked if it can report them; otherwise the stats volplugin reported from
+// the host which has the volume mounted are used. reported is nil if there
+// are none. Volumes of host-local backends can only be measured on the host
+// they belong to, so only reported stats are used for them.
+func VolumeStats(config *config.Volume, reported *storage.Stats, timeout time.Duration) (*storage.Stats, error) {
+	driverOpts, err := config.ToDriverOptions(timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Backends.CRUD != "" && driverOpts.Volume.Params[storage.HostParam] == "" {
+		driver, err := backend.NewCRUDDriver(config.Backends.CRUD)
+		if err != nil {
+			return nil, err
+		}
+
+		// drivers which cannot tell for this volume leave it to the filesystem.
+		if statser, ok := driver.(storage.StatsDriver); ok {
+			stats, err := statser.Stats(driverOpts)
+			if err == nil && stats.Inodes == 0 && reported != nil {
+				// images know nothing of the inodes of their filesystems.
+				stats.Inodes, stats.InodesUsed = reported.Inodes, reported.InodesUsed
+			}
+
+			if err != errors.NoActionTaken {
+				return stats, err
+			}
+		}
+	}
+
+	if reported != nil {
+		return reported, nil
+	}
+
+	return nil, errors.StatsUnsupported.Combine(errored.New(config.String()))
+}
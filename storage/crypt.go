@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/contiv/errored"
+)
+
+// cryptPrefix starts the names of the dm-crypt mappings of volumes, which
+// tells them from the mappings of other users of device-mapper. Policy and
+// volume names cannot hold dots, so the name of the volume follows, dotted.
+const cryptPrefix = "volplugin."
+
+var (
+	mapperDir   = "/dev/mapper"
+	sysDevBlock = "/sys/dev/block"
+)
+
+// Encryption is how a volume is encrypted at rest with LUKS. Volumes without
+// a key are not encrypted. An empty cipher is the default of cryptsetup.
+type Encryption struct {
+	Cipher string
+	Key    []byte
+}
+
+// Enabled tells if the volume is encrypted.
+func (e Encryption) Enabled() bool {
+	return len(e.Key) > 0
+}
+
+// CryptName returns the name of the dm-crypt mapping of the volume, named
+// policy/volume.
+func CryptName(volume string) string {
+	return cryptPrefix + strings.Replace(volume, "/", ".", -1)
+}
+
+func cryptVolume(name string) (string, bool) {
+	if !strings.HasPrefix(name, cryptPrefix) {
+		return "", false
+	}
+
+	parts := strings.Split(strings.TrimPrefix(name, cryptPrefix), ".")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", false
+	}
+
+	return strings.Join(parts, "/"), true
+}
+
+func runCryptsetup(key []byte, timeout time.Duration, args ...string) error {
+	var stdin io.Reader
+	if key != nil {
+		// the key is passed on stdin so it never shows in the process list.
+		stdin = bytes.NewReader(key)
+		args = append([]string{"--key-file", "-"}, args...)
+	}
+
+	cmd := exec.Command("cryptsetup", append([]string{"--batch-mode"}, args...)...)
+	return RunStreaming(cmd, stdin, nil, timeout)
+}
+
+// FormatCrypt writes a LUKS header keyed with the key of the encryption to
+// the device of the volume and opens it. It returns the device to create the
+// filesystem on, which is the device itself for unencrypted volumes.
+func FormatCrypt(volume, device string, enc Encryption, timeout time.Duration) (string, error) {
+	if !enc.Enabled() {
+		return device, nil
+	}
+
+	args := []string{"luksFormat"}
+	if enc.Cipher != "" {
+		args = append(args, "--cipher", enc.Cipher)
+	}
+
+	if err := runCryptsetup(enc.Key, timeout, append(args, device)...); err != nil {
+		return "", errored.Errorf("Encrypting %q for volume %q", device, volume).Combine(err)
+	}
+
+	return OpenCrypt(volume, device, enc, timeout)
+}
+
+// OpenCrypt opens the dm-crypt mapping of the device of the volume, if it is
+// not open yet. It returns the device the filesystem is on, which is the
+// device itself for unencrypted volumes.
+func OpenCrypt(volume, device string, enc Encryption, timeout time.Duration) (string, error) {
+	if !enc.Enabled() {
+		return device, nil
+	}
+
+	name := CryptName(volume)
+	mapped := filepath.Join(mapperDir, name)
+
+	if _, err := os.Stat(mapped); err == nil {
+		return mapped, nil
+	}
+
+	if err := runCryptsetup(enc.Key, timeout, "luksOpen", device, name); err != nil {
+		return "", errored.Errorf("Opening encrypted device %q for volume %q", device, volume).Combine(err)
+	}
+
+	return mapped, nil
+}
+
+// CloseCrypt closes the dm-crypt mapping of the volume, if it is open.
+func CloseCrypt(volume string, timeout time.Duration) error {
+	name := CryptName(volume)
+
+	if _, err := os.Stat(filepath.Join(mapperDir, name)); os.IsNotExist(err) {
+		return nil
+	}
+
+	if err := runCryptsetup(nil, timeout, "luksClose", name); err != nil {
+		return errored.Errorf("Closing encrypted device for volume %q", volume).Combine(err)
+	}
+
+	return nil
+}
+
+// ResizeCrypt grows the dm-crypt mapping of the volume, if it is open, to fill
+// the device once it has been grown. It returns the device the filesystem is
+// on, which is the device itself for unencrypted volumes.
+func ResizeCrypt(volume, device string, timeout time.Duration) (string, error) {
+	name := CryptName(volume)
+	mapped := filepath.Join(mapperDir, name)
+
+	if _, err := os.Stat(mapped); os.IsNotExist(err) {
+		return device, nil
+	}
+
+	if err := runCryptsetup(nil, timeout, "resize", name); err != nil {
+		return "", errored.Errorf("Resizing encrypted device for volume %q", volume).Combine(err)
+	}
+
+	return mapped, nil
+}
+
+// CryptMapping tells if the device numbered major:minor is the dm-crypt
+// mapping of a volume, as opened by OpenCrypt. If it is, the volume and the
+// path of the device the mapping is on are returned.
+func CryptMapping(major, minor uint) (string, string, bool) {
+	dir := filepath.Join(sysDevBlock, fmt.Sprintf("%d:%d", major, minor))
+
+	name, err := ioutil.ReadFile(filepath.Join(dir, "dm", "name"))
+	if err != nil {
+		return "", "", false
+	}
+
+	volume, ok := cryptVolume(strings.TrimSpace(string(name)))
+	if !ok {
+		return "", "", false
+	}
+
+	slaves, err := ioutil.ReadDir(filepath.Join(dir, "slaves"))
+	if err != nil || len(slaves) != 1 {
+		return "", "", false
+	}
+
+	return volume, filepath.Join("/dev", slaves[0].Name()), true
+}
@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *storageSuite) TestCryptName(c *C) {
+	c.Assert(CryptName("policy1/test"), Equals, "volplugin.policy1.test")
+
+	volume, ok := cryptVolume(CryptName("policy-with-dashes/quux"))
+	c.Assert(ok, Equals, true)
+	c.Assert(volume, Equals, "policy-with-dashes/quux")
+
+	for _, name := range []string{"volplugin.test", "volplugin..test", "volplugin.a.b.c", "vg0-lv0", "policy1.test"} {
+		_, ok := cryptVolume(name)
+		c.Assert(ok, Equals, false, Commentf("%q", name))
+	}
+}
+
+func (s *storageSuite) TestCryptUnencrypted(c *C) {
+	c.Assert(Encryption{Cipher: "aes-xts-plain64"}.Enabled(), Equals, false)
+	c.Assert(Encryption{Key: []byte("key")}.Enabled(), Equals, true)
+
+	// unencrypted volumes are left on their device, and nothing is run.
+	device, err := FormatCrypt("policy1/test", "/dev/loop7", Encryption{}, time.Second)
+	c.Assert(err, IsNil)
+	c.Assert(device, Equals, "/dev/loop7")
+
+	device, err = OpenCrypt("policy1/test", "/dev/loop7", Encryption{}, time.Second)
+	c.Assert(err, IsNil)
+	c.Assert(device, Equals, "/dev/loop7")
+
+	c.Assert(CloseCrypt("policy1/nonexistent", time.Second), IsNil)
+
+	device, err = ResizeCrypt("policy1/nonexistent", "/dev/loop7", time.Second)
+	c.Assert(err, IsNil)
+	c.Assert(device, Equals, "/dev/loop7")
+}
+
+func (s *storageSuite) TestCryptMapping(c *C) {
+	dir, err := ioutil.TempDir("", "volplugin-sysfs")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+
+	oldSysDevBlock := sysDevBlock
+	sysDevBlock = dir
+	defer func() { sysDevBlock = oldSysDevBlock }()
+
+	mkdev := func(dev, name string, slaves ...string) {
+		c.Assert(os.MkdirAll(filepath.Join(dir, dev, "dm"), 0700), IsNil)
+		c.Assert(ioutil.WriteFile(filepath.Join(dir, dev, "dm", "name"), []byte(name+"\n"), 0600), IsNil)
+		c.Assert(os.MkdirAll(filepath.Join(dir, dev, "slaves"), 0700), IsNil)
+		for _, slave := range slaves {
+			c.Assert(ioutil.WriteFile(filepath.Join(dir, dev, "slaves", slave), nil, 0600), IsNil)
+		}
+	}
+
+	mkdev("253:0", "volplugin.policy1.test", "rbd0")
+	mkdev("253:1", "vg0-lv0", "sda2")
+	mkdev("253:2", "volplugin.policy1.striped", "rbd1", "rbd2")
+
+	volume, backing, ok := CryptMapping(253, 0)
+	c.Assert(ok, Equals, true)
+	c.Assert(volume, Equals, "policy1/test")
+	c.Assert(backing, Equals, "/dev/rbd0")
+
+	_, _, ok = CryptMapping(253, 1)
+	c.Assert(ok, Equals, false)
+	_, _, ok = CryptMapping(253, 2)
+	c.Assert(ok, Equals, false)
+	_, _, ok = CryptMapping(8, 0)
+	c.Assert(ok, Equals, false)
+}
@@ -2,6 +2,8 @@ package storage
 
 import (
 	"errors"
+	"io"
+	"sort"
 	"time"
 
 	"github.com/contiv/errored"
@@ -15,29 +17,68 @@ var (
 // Params are parameters that relate directly to the location of the storage.
 type Params map[string]string
 
-// A Mount is the resulting attributes of a Mount or Unmount operation.
+// Modes of the filesystem check run before mounting. An empty mode is off.
+const (
+	FSCheckOff    = "off"
+	FSCheckOnly   = "check"
+	FSCheckRepair = "repair"
+)
+
+// Outcomes of a filesystem check.
+const (
+	FSCheckClean    = "clean"
+	FSCheckRepaired = "repaired"
+	FSCheckFailed   = "failed"
+)
+
+// Origins of a snapshot.
+const (
+	SnapshotScheduled = "scheduled"
+	SnapshotManual    = "manual"
+	SnapshotPreCopy   = "pre-copy"
+	SnapshotBackup    = "backup"
+)
+
+// A Mount is the resulting attributes of a Mount or Unmount operation. Device
+// and its numbers are of the device the filesystem is mounted from, which for
+// encrypted volumes is their dm-crypt mapping; cgroup limits apply to it.
 type Mount struct {
 	Device   string
 	Path     string
 	DevMajor uint
 	DevMinor uint
 	Volume   Volume
+	FSCheck  *FSCheck
+}
+
+// FSCheck is the result of checking a filesystem before it was mounted.
+type FSCheck struct {
+	Mode   string `json:"mode"`
+	Status string `json:"status"`
+	Output string `json:"output,omitempty"`
 }
 
 // FSOptions encapsulates the parameters to create and manipulate filesystems.
+// CheckMode is one of the FSCheck modes; drivers which cannot check the
+// filesystem ignore it. MountOptions are comma-separated, as in fstab; see
+// ParseMountOptions.
 type FSOptions struct {
 	Type          string
 	CreateCommand string
+	CheckMode     string
+	MountOptions  string
 }
 
 // DriverOptions are options frequently passed as the keystone for operations.
-// See Driver for more information.
+// See Driver for more information. Encryption is only needed to format and
+// mount encrypted volumes; see Encryption.
 type DriverOptions struct {
-	Source    string
-	Volume    Volume
-	FSOptions FSOptions
-	Timeout   time.Duration
-	Options   map[string]string
+	Source     string
+	Volume     Volume
+	FSOptions  FSOptions
+	Encryption Encryption
+	Timeout    time.Duration
+	Options    map[string]string
 }
 
 // ListOptions is a set of parameters used for the List operation of Driver.
@@ -52,6 +93,50 @@ type Volume struct {
 	Params Params
 }
 
+// Stats are the capacity and usage of a volume. Inode counts are zero when
+// the driver cannot tell.
+type Stats struct {
+	ProvisionedBytes uint64 `json:"provisioned-bytes"`
+	UsedBytes        uint64 `json:"used-bytes"`
+	Inodes           uint64 `json:"inodes,omitempty"`
+	InodesUsed       uint64 `json:"inodes-used,omitempty"`
+}
+
+// Snapshot is a snapshot of a volume. Drivers fill in what the backend knows
+// of it and leave the rest zero. Parent, Origin and Labels are kept by
+// volplugin, not the driver.
+type Snapshot struct {
+	Name      string            `json:"name"`
+	Created   time.Time         `json:"created"`
+	Size      uint64            `json:"size,omitempty"`
+	Protected bool              `json:"protected,omitempty"`
+	Parent    bool              `json:"parent,omitempty"`
+	Origin    string            `json:"origin,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+type byCreated []Snapshot
+
+func (b byCreated) Len() int           { return len(b) }
+func (b byCreated) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byCreated) Less(i, j int) bool { return b[i].Created.Before(b[j].Created) }
+
+// SortSnapshots sorts snapshots oldest first. Snapshots taken at the same
+// time, or whose time is not known, keep their order.
+func SortSnapshots(snaps []Snapshot) {
+	sort.Stable(byCreated(snaps))
+}
+
+// SnapshotNames returns the names of the snapshots, in order.
+func SnapshotNames(snaps []Snapshot) []string {
+	names := []string{}
+	for _, snap := range snaps {
+		names = append(names, snap.Name)
+	}
+
+	return names
+}
+
 // NamedDriver is a named driver and has a method called Name()
 type NamedDriver interface {
 	// Name returns the string associated with the storage backed of the driver
@@ -114,15 +199,117 @@ type SnapshotDriver interface {
 	// RemoveSnapshot removes a named snapshot for the volume. Any error will be returned.
 	RemoveSnapshot(string, DriverOptions) error
 
-	// ListSnapshots returns an array of snapshot names provided a maximum number
-	// of snapshots to be returned. Any error will be returned.
-	ListSnapshots(DriverOptions) ([]string, error)
+	// RollbackSnapshot restores the volume to the named snapshot, discarding
+	// everything written since. The volume must not be mounted.
+	RollbackSnapshot(string, DriverOptions) error
+
+	// ListSnapshots returns the snapshots of the volume, oldest first. Any
+	// error will be returned.
+	ListSnapshots(DriverOptions) ([]Snapshot, error)
 
 	// CopySnapshot copies a snapshot into a new volume. Takes a DriverOptions,
 	// snap and volume name (string). Returns error on failure.
 	CopySnapshot(DriverOptions, string, string) error
 }
 
+// ResizeDriver grows volumes.
+type ResizeDriver interface {
+	NamedDriver
+
+	// Resize grows the volume to the size in the DriverOptions. Volumes cannot
+	// be shrunk.
+	Resize(DriverOptions) error
+
+	// GrowFilesystem grows the filesystem of a volume mounted on this host to
+	// fill the volume.
+	GrowFilesystem(DriverOptions) error
+}
+
+// StatsDriver reports the capacity and usage of volumes.
+type StatsDriver interface {
+	NamedDriver
+
+	// Stats returns the capacity and usage of the volume.
+	Stats(DriverOptions) (*Stats, error)
+}
+
+// RenameDriver renames volumes in place.
+type RenameDriver interface {
+	NamedDriver
+
+	// Rename gives the volume a new name, named policy/volume, keeping its data
+	// and snapshots. The volume must not be mounted.
+	Rename(do DriverOptions, newName string) error
+}
+
+// ImageParam is the parameter naming the image in the backend of a volume
+// adopted from an image made outside volplugin, which keeps its name. Volumes
+// without it use images named after them.
+const ImageParam = "image"
+
+// Image is an image in a backend, and the volume using it if there is one.
+type Image struct {
+	Name   string `json:"name"`
+	Volume string `json:"volume,omitempty"`
+}
+
+// AdoptDriver lets images made in the backend outside volplugin be used as
+// volumes. Adopted volumes name their image with ImageParam.
+type AdoptDriver interface {
+	NamedDriver
+
+	// Images lists the images where the params place volumes. Images are named
+	// so that images in different places differ.
+	Images(lo ListOptions) ([]string, error)
+
+	// VolumeImage returns the image of the volume, as Images names it.
+	VolumeImage(volume Volume) (string, error)
+
+	// FileSystem returns the type of the filesystem on the volume, or an
+	// empty string if it has none.
+	FileSystem(do DriverOptions) (string, error)
+}
+
+// FlattenDriver detaches volumes copied from snapshots from their parents.
+type FlattenDriver interface {
+	NamedDriver
+
+	// Flatten copies the data the volume shares with the snapshot it was copied
+	// from into the volume, so the snapshot can be removed. progress is called
+	// with the percentage done as the operation proceeds. Volumes without a
+	// parent are left alone.
+	Flatten(do DriverOptions, progress func(int)) error
+}
+
+// ExportDriver streams volumes to and from portable images. Images are only
+// meant to be imported by the driver which exported them.
+type ExportDriver interface {
+	NamedDriver
+
+	// Export writes an image of the named snapshot of the volume to w.
+	Export(do DriverOptions, snapName string, w io.Writer) error
+
+	// Import creates the volume from an image read from r, in place of Create
+	// and Format. Nothing is left behind if it fails.
+	Import(do DriverOptions, r io.Reader) error
+}
+
+// DiffDriver writes and applies the changes between snapshots, which backups
+// are made of.
+type DiffDriver interface {
+	NamedDriver
+
+	// ExportDiff writes the changes to the volume from snapshot fromSnap to
+	// snapshot toSnap to w. An empty fromSnap writes all of toSnap.
+	ExportDiff(do DriverOptions, fromSnap, toSnap string, w io.Writer) error
+
+	// ImportDiff applies a diff written by ExportDiff to the volume, leaving a
+	// snapshot named as the one the diff was taken to. A diff applies onto the
+	// snapshot it was taken from, so diffs are applied in the order they were
+	// taken, starting with a full one onto a newly created volume.
+	ImportDiff(do DriverOptions, r io.Reader) error
+}
+
 // Validate validates driver options to ensure they are compatible with all
 // storage drivers.
 func (do *DriverOptions) Validate() error {
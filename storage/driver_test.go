@@ -2,6 +2,7 @@ package storage
 
 import (
 	. "testing"
+	"time"
 
 	. "gopkg.in/check.v1"
 )
@@ -39,3 +40,18 @@ func (s *storageSuite) TestVolumeValidate(c *C) {
 	v.Params = map[string]string{}
 	c.Assert(v.Validate(), IsNil)
 }
+
+func (s *storageSuite) TestSortSnapshots(c *C) {
+	now := time.Now()
+
+	snaps := []Snapshot{
+		{Name: "b", Created: now.Add(time.Minute)},
+		{Name: "unknown"},
+		{Name: "a", Created: now},
+		{Name: "c", Created: now.Add(time.Minute)},
+	}
+
+	SortSnapshots(snaps)
+	c.Assert(SnapshotNames(snaps), DeepEquals, []string{"unknown", "a", "b", "c"})
+	c.Assert(SnapshotNames(nil), DeepEquals, []string{})
+}
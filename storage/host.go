@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"os"
+
+	"github.com/contiv/errored"
+)
+
+// HostParam is the parameter recording the host a volume of a host-local
+// backend belongs to. Only that host can reach the storage of the volume, so
+// the drivers of such backends refuse to work on it anywhere else.
+const HostParam = "host"
+
+// Hostname returns the name of this host. It is swapped out by the tests.
+var Hostname = os.Hostname
+
+// ClaimHost records this host as the owner of a volume about to be created
+// here. Volumes whose parameters already name another host are refused.
+func ClaimHost(volume Volume) error {
+	host, err := Hostname()
+	if err != nil {
+		return errored.Errorf("Could not determine hostname").Combine(err)
+	}
+
+	if owner := volume.Params[HostParam]; owner != "" && owner != host {
+		return errored.Errorf("Volume %q must be created on host %q, not %q", volume.Name, owner, host)
+	}
+
+	volume.Params[HostParam] = host
+
+	return nil
+}
+
+// CheckHost returns an error if the volume belongs to another host than this
+// one.
+func CheckHost(volume Volume) error {
+	host, err := Hostname()
+	if err != nil {
+		return errored.Errorf("Could not determine hostname").Combine(err)
+	}
+
+	if owner := volume.Params[HostParam]; owner != host {
+		return errored.Errorf("Volume %q belongs to host %q, not %q", volume.Name, owner, host)
+	}
+
+	return nil
+}
@@ -14,14 +14,17 @@ const (
 	mountInfoFile           = "/proc/self/mountinfo"
 	deviceInfoFile          = "/proc/devices"
 	nfsMajorID              = 0
+	zfsMajorID              = 0 // zfs datasets are mounted on anonymous devices, just like nfs
+	btrfsMajorID            = 0 // so are btrfs subvolumes
+	cephfsMajorID           = 0 // and cephfs mounts
 	totalMountInfoFieldsNum = 10
 )
 
 // GetMountsRequest captures all the params required for scanning mountinfo
 type GetMountsRequest struct {
-	DriverName   string // ceph, nfs
-	FsType       string // nfs4, ext4
-	KernelDriver string // rbd, device-mapper, etc.
+	DriverName   string // ceph, cephfs, nfs, zfs, btrfs, loop, local
+	FsType       string // nfs4, ceph, zfs, btrfs, ext4
+	KernelDriver string // rbd, device-mapper, loop, zvol, etc.
 }
 
 // MountInfo captures the mount info read from /proc/self/mountinfo
@@ -60,8 +63,10 @@ func getDevID(kernelDriver string) (uint, error) {
 			continue
 		}
 
-		if strings.HasSuffix(line, kernelDriver) {
-			parts := strings.Split(line, " ")
+		// XXX major numbers are right-aligned, so low numbers (e.g. "  7 loop")
+		//     are padded with spaces.
+		parts := strings.Fields(line)
+		if len(parts) > 0 && parts[len(parts)-1] == kernelDriver {
 			if len(parts) != 2 {
 				return 0, errored.Errorf("Invalid input from file %q", deviceInfoFile)
 			}
@@ -80,14 +85,25 @@ func getDevID(kernelDriver string) (uint, error) {
 func convertToMountInfo(mountinfo string) (*MountInfo, error) {
 	parts := strings.Split(mountinfo, " ")
 
+	// XXX there may be zero or more optional fields, so the fields after them
+	//     must be found relative to the separator.
+	sep := 6
+	for sep < len(parts) && parts[sep] != "-" {
+		sep++
+	}
+
+	if sep+2 >= len(parts) {
+		return nil, errored.Errorf("Invalid mount info data: %q", mountinfo)
+	}
+
 	mountDetails := &MountInfo{
 		Root:           parts[3],
 		MountPoint:     parts[4],
 		MountOptions:   parts[5],
-		OptionalFields: parts[6],
-		Separator:      parts[7],
-		FilesystemType: parts[8],
-		MountSource:    parts[9],
+		OptionalFields: strings.Join(parts[6:sep], " "),
+		Separator:      parts[sep],
+		FilesystemType: parts[sep+1],
+		MountSource:    parts[sep+2],
 	}
 
 	mountID, err := convertToUint(parts[0])
@@ -124,6 +140,15 @@ func getDriverMajorID(request *GetMountsRequest) (uint, error) {
 	switch request.DriverName {
 	case "nfs":
 		return nfsMajorID, nil
+	case "zfs":
+		return zfsMajorID, nil
+	case "btrfs":
+		return btrfsMajorID, nil
+	case "cephfs":
+		return cephfsMajorID, nil
+	case "local":
+		// local volumes are plain directories, so they may be on any device.
+		return 0, nil
 	default:
 		devID, err := getDevID(request.KernelDriver)
 		if err != nil {
@@ -143,6 +168,20 @@ func validateRequest(request *GetMountsRequest) error {
 		if isEmpty(request.FsType) {
 			return errored.Errorf("Filesystem type is required for scanning NFS mounts")
 		}
+	case "zfs":
+		if isEmpty(request.FsType) {
+			return errored.Errorf("Filesystem type is required for scanning ZFS mounts")
+		}
+	case "btrfs":
+		if isEmpty(request.FsType) {
+			return errored.Errorf("Filesystem type is required for scanning btrfs mounts")
+		}
+	case "cephfs":
+		if isEmpty(request.FsType) {
+			return errored.Errorf("Filesystem type is required for scanning CephFS mounts")
+		}
+	case "local":
+		// anything goes, see getDriverMajorID.
 	default:
 		if isEmpty(request.KernelDriver) {
 			return errored.Errorf("Kernel driver is required for scanning mounts")
@@ -180,7 +219,7 @@ func GetMounts(request *GetMountsRequest) ([]*MountInfo, error) {
 				logrus.Errorf("%s", err)
 				continue
 			} else {
-				if mountDetails.DeviceNumber.Major == driverMajorID {
+				if request.DriverName == "local" || mountDetails.DeviceNumber.Major == driverMajorID {
 					if !isEmpty(request.FsType) && mountDetails.FilesystemType != request.FsType {
 						continue
 					}
@@ -54,6 +54,20 @@ func (s *mountscanSuite) TestGetMountsInput(c *C) {
 	_, err = GetMounts(&GetMountsRequest{DriverName: "ceph", KernelDriver: "rbd"})
 	c.Assert(err, IsNil)
 
+	_, err = GetMounts(&GetMountsRequest{DriverName: "zfs", FsType: "zfs"})
+	c.Assert(err, IsNil)
+
+	_, err = GetMounts(&GetMountsRequest{DriverName: "btrfs", FsType: "btrfs"})
+	c.Assert(err, IsNil)
+
+	_, err = GetMounts(&GetMountsRequest{DriverName: "cephfs", FsType: "ceph"})
+	c.Assert(err, IsNil)
+
+	// every mount on the host is a candidate for the local driver.
+	mounts, err := GetMounts(&GetMountsRequest{DriverName: "local"})
+	c.Assert(err, IsNil)
+	c.Assert(len(mounts) > 0, Equals, true)
+
 	_, err = GetMounts(&GetMountsRequest{DriverName: "none", KernelDriver: "device-mapper"})
 	c.Assert(err, IsNil)
 
@@ -63,6 +77,39 @@ func (s *mountscanSuite) TestGetMountsInput(c *C) {
 	_, err = GetMounts(&GetMountsRequest{DriverName: "nfs"})
 	c.Assert(err, ErrorMatches, ".*Filesystem type is required.*")
 
+	_, err = GetMounts(&GetMountsRequest{DriverName: "zfs"})
+	c.Assert(err, ErrorMatches, ".*Filesystem type is required.*")
+
+	_, err = GetMounts(&GetMountsRequest{DriverName: "btrfs"})
+	c.Assert(err, ErrorMatches, ".*Filesystem type is required.*")
+
+	_, err = GetMounts(&GetMountsRequest{DriverName: "cephfs"})
+	c.Assert(err, ErrorMatches, ".*Filesystem type is required.*")
+
 	_, err = GetMounts(&GetMountsRequest{DriverName: "ceph"})
 	c.Assert(err, ErrorMatches, ".*Kernel driver is required.*")
 }
+
+func (s *mountscanSuite) TestConvertToMountInfo(c *C) {
+	mi, err := convertToMountInfo("36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw,errors=continue")
+	c.Assert(err, IsNil)
+	c.Assert(mi.DeviceNumber, DeepEquals, &DeviceNumber{Major: 98, Minor: 0})
+	c.Assert(mi.MountPoint, Equals, "/mnt2")
+	c.Assert(mi.OptionalFields, Equals, "master:1")
+	c.Assert(mi.FilesystemType, Equals, "ext3")
+	c.Assert(mi.MountSource, Equals, "/dev/root")
+
+	mi, err = convertToMountInfo("43 28 7:0 / /mnt/loop/policy1/test rw,relatime - ext4 /dev/loop0 rw")
+	c.Assert(err, IsNil)
+	c.Assert(mi.OptionalFields, Equals, "")
+	c.Assert(mi.FilesystemType, Equals, "ext4")
+	c.Assert(mi.MountSource, Equals, "/dev/loop0")
+
+	mi, err = convertToMountInfo("43 28 7:0 / /mnt rw,relatime shared:1 master:2 - ext4 /dev/loop0 rw")
+	c.Assert(err, IsNil)
+	c.Assert(mi.OptionalFields, Equals, "shared:1 master:2")
+	c.Assert(mi.MountSource, Equals, "/dev/loop0")
+
+	_, err = convertToMountInfo("43 28 7:0 / /mnt rw,relatime shared:1 master:2 ext4 /dev/loop0 rw")
+	c.Assert(err, NotNil)
+}
@@ -0,0 +1,343 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/errors"
+)
+
+// ProjectParam is the parameter of a volume which records the XFS project
+// its directory was made part of.
+const ProjectParam = "project"
+
+// procMounts and projidFile are swapped out by the tests.
+var (
+	procMounts = "/proc/self/mounts"
+	projidFile = "/etc/projid"
+)
+
+// mountEscapes are the characters escaped in the fields of procMounts.
+var mountEscapes = strings.NewReplacer(`\040`, " ", `\011`, "\t", `\012`, "\n", `\134`, `\`)
+
+// ProjectQuota is the usage and hard block limit of an XFS project, in bytes.
+type ProjectQuota struct {
+	UsedBytes  uint64
+	LimitBytes uint64
+}
+
+// ProjectQuotaRoot returns the mount point of the filesystem dir is on if it
+// is XFS with project quotas enforced, or an empty string if it is not.
+func ProjectQuotaRoot(dir string) (string, error) {
+	dir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", err
+	}
+
+	content, err := ioutil.ReadFile(procMounts)
+	if err != nil {
+		return "", errored.Errorf("Reading mounts").Combine(err)
+	}
+
+	var root, fsType, options string
+
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 {
+			continue
+		}
+
+		mountPoint := mountEscapes.Replace(fields[1])
+		rel, err := filepath.Rel(mountPoint, dir)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+
+		// later mounts over the same point hide earlier ones.
+		if len(mountPoint) >= len(root) {
+			root, fsType, options = mountPoint, fields[2], fields[3]
+		}
+	}
+
+	if fsType != "xfs" {
+		return "", nil
+	}
+
+	for _, option := range strings.Split(options, ",") {
+		if option == "prjquota" || option == "pquota" {
+			return root, nil
+		}
+	}
+
+	return "", nil
+}
+
+func runXFSQuota(root string, timeout time.Duration, command string) (string, error) {
+	stdout := &bytes.Buffer{}
+	if err := RunStreaming(exec.Command("xfs_quota", "-x", "-c", command, root), nil, stdout, timeout); err != nil {
+		return "", err
+	}
+
+	return stdout.String(), nil
+}
+
+// ProjectQuotas returns the quotas of the projects of the XFS filesystem
+// mounted at root, by project ID.
+func ProjectQuotas(root string, timeout time.Duration) (map[uint32]*ProjectQuota, error) {
+	out, err := runXFSQuota(root, timeout, "report -p -b -N -n")
+	if err != nil {
+		return nil, errored.Errorf("Reporting project quotas of %q", root).Combine(err)
+	}
+
+	return parseQuotaReport(out)
+}
+
+// parseQuotaReport parses the lines of a numeric project report of xfs_quota,
+// e.g. `#1001 1024 0 10240 00 [--------]`, which count 1KB blocks.
+func parseQuotaReport(out string) (map[uint32]*ProjectQuota, error) {
+	quotas := map[uint32]*ProjectQuota{}
+
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 || !strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		project, err := strconv.ParseUint(strings.TrimPrefix(fields[0], "#"), 10, 32)
+		if err != nil {
+			return nil, errored.Errorf("Invalid project in quota report: %q", line).Combine(err)
+		}
+
+		used, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return nil, errored.Errorf("Invalid usage in quota report: %q", line).Combine(err)
+		}
+
+		limit, err := strconv.ParseUint(fields[3], 10, 64)
+		if err != nil {
+			return nil, errored.Errorf("Invalid limit in quota report: %q", line).Combine(err)
+		}
+
+		quotas[uint32(project)] = &ProjectQuota{UsedBytes: used * 1024, LimitBytes: limit * 1024}
+	}
+
+	return quotas, nil
+}
+
+// AssignedProjectIDs returns the project IDs named in /etc/projid. Projects
+// without usage or limit are missing from quota reports, but may still be
+// assigned to directories. A missing file names none.
+func AssignedProjectIDs() (map[uint32]bool, error) {
+	content, err := ioutil.ReadFile(projidFile)
+	if os.IsNotExist(err) {
+		return map[uint32]bool{}, nil
+	} else if err != nil {
+		return nil, errored.Errorf("Reading %q", projidFile).Combine(err)
+	}
+
+	return parseProjid(string(content))
+}
+
+// parseProjid parses the `name:id` lines of /etc/projid.
+func parseProjid(content string) (map[uint32]bool, error) {
+	projects := map[uint32]bool{}
+
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.Split(line, ":")
+		if len(parts) != 2 {
+			return nil, errored.Errorf("Invalid line in %q: %q", projidFile, line)
+		}
+
+		project, err := strconv.ParseUint(parts[1], 10, 32)
+		if err != nil {
+			return nil, errored.Errorf("Invalid project in %q: %q", projidFile, line).Combine(err)
+		}
+
+		projects[uint32(project)] = true
+	}
+
+	return projects, nil
+}
+
+// NewProjectID picks a project ID for the volume, named policy/volume, which
+// none of the quotas has and which is not assigned. IDs are derived from the
+// name, so they tend to stay the same when volumes are created again.
+func NewProjectID(volume string, quotas map[uint32]*ProjectQuota, assigned map[uint32]bool) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(volume))
+	project := h.Sum32()
+
+	// project 0 holds everything outside of projects.
+	for project == 0 || quotas[project] != nil || assigned[project] {
+		project++
+	}
+
+	return project
+}
+
+// SetProjectQuota makes dir, on the XFS filesystem mounted at root, the
+// project with the given ID, and limits it to limit MB.
+func SetProjectQuota(root, dir string, project uint32, limit uint64, timeout time.Duration) error {
+	if _, err := runXFSQuota(root, timeout, fmt.Sprintf("project -s -p %s %d", dir, project)); err != nil {
+		return errored.Errorf("Assigning project %d to %q", project, dir).Combine(err)
+	}
+
+	return LimitProjectQuota(root, project, limit, timeout)
+}
+
+// LimitProjectQuota sets the hard block limit of the project on the XFS
+// filesystem mounted at root to limit MB.
+func LimitProjectQuota(root string, project uint32, limit uint64, timeout time.Duration) error {
+	if _, err := runXFSQuota(root, timeout, fmt.Sprintf("limit -p bhard=%dm %d", limit, project)); err != nil {
+		return errored.Errorf("Limiting project %d on %q to %dMB", project, root, limit).Combine(err)
+	}
+
+	return nil
+}
+
+// VolumeProject returns the project of the quota of the volume, which is
+// recorded in its ProjectParam. Volumes without a quota yield false.
+func VolumeProject(volume Volume) (uint32, bool, error) {
+	param := volume.Params[ProjectParam]
+	if param == "" {
+		return 0, false, nil
+	}
+
+	project, err := strconv.ParseUint(param, 10, 32)
+	if err != nil {
+		return 0, false, errored.Errorf("Invalid project %q of volume %q", param, volume.Name).Combine(err)
+	}
+
+	return uint32(project), true, nil
+}
+
+// SetVolumeQuota limits dir, the directory of the volume, to the size of the
+// volume with an XFS project quota, if it is on XFS with project quotas
+// enforced. The project is recorded in the parameters of the volume.
+func SetVolumeQuota(do DriverOptions, dir string) error {
+	root, err := ProjectQuotaRoot(dir)
+	if err != nil {
+		return errored.Errorf("Finding filesystem of directory %q", dir).Combine(err)
+	}
+
+	if root == "" || do.Volume.Size == 0 {
+		logrus.Debugf("Not enforcing size of volume %q: %q is not on XFS with project quotas", do.Volume.Name, dir)
+		return nil
+	}
+
+	quotas, err := ProjectQuotas(root, do.Timeout)
+	if err != nil {
+		return err
+	}
+
+	assigned, err := AssignedProjectIDs()
+	if err != nil {
+		return err
+	}
+
+	project := NewProjectID(do.Volume.Name, quotas, assigned)
+
+	logrus.Infof("Limiting volume %q to %dMB as project %d of %q", do.Volume.Name, do.Volume.Size, project, root)
+
+	if err := SetProjectQuota(root, dir, project, do.Volume.Size, do.Timeout); err != nil {
+		return err
+	}
+
+	do.Volume.Params[ProjectParam] = strconv.FormatUint(uint64(project), 10)
+
+	return nil
+}
+
+// ClearVolumeQuota lifts the limit of the project of the volume, so its ID
+// can be reused.
+func ClearVolumeQuota(do DriverOptions, dir string) error {
+	project, ok, err := VolumeProject(do.Volume)
+	if err != nil || !ok {
+		return err
+	}
+
+	root, err := ProjectQuotaRoot(dir)
+	if err != nil || root == "" {
+		return err
+	}
+
+	return LimitProjectQuota(root, project, 0, do.Timeout)
+}
+
+// ResizeVolumeQuota changes the limit of the project quota of the volume to
+// its size. Volumes without one are given one if dir is now on XFS with
+// project quotas enforced.
+func ResizeVolumeQuota(do DriverOptions, dir string) error {
+	project, ok, err := VolumeProject(do.Volume)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return SetVolumeQuota(do, dir)
+	}
+
+	root, err := ProjectQuotaRoot(dir)
+	if err != nil {
+		return errored.Errorf("Finding filesystem of directory %q", dir).Combine(err)
+	}
+
+	if root == "" {
+		return errored.Errorf("Directory %q of volume %q is no longer on XFS with project quotas", dir, do.Volume.Name)
+	}
+
+	return LimitProjectQuota(root, project, do.Volume.Size, do.Timeout)
+}
+
+// VolumeQuotaStats returns the limit and usage of the project quota of the
+// volume. Volumes without one yield errors.NoActionTaken, as only the
+// filesystem they are on can tell.
+func VolumeQuotaStats(do DriverOptions, dir string) (*Stats, error) {
+	project, ok, err := VolumeProject(do.Volume)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return nil, errors.NoActionTaken
+	}
+
+	root, err := ProjectQuotaRoot(dir)
+	if err != nil {
+		return nil, errored.Errorf("Finding filesystem of directory %q", dir).Combine(err)
+	}
+
+	if root == "" {
+		return nil, errors.NoActionTaken
+	}
+
+	quotas, err := ProjectQuotas(root, do.Timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	quota, ok := quotas[project]
+	if !ok {
+		return nil, errored.Errorf("No quota for project %d of volume %q on %q", project, do.Volume.Name, root)
+	}
+
+	return &Stats{
+		ProvisionedBytes: quota.LimitBytes,
+		UsedBytes:        quota.UsedBytes,
+	}, nil
+}
@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *storageSuite) TestParseQuotaReport(c *C) {
+	report := `
+#0                 8        0        0     00 [--------]
+#1001           1024        0    10240     00 [--------]
+#1002              0        0     2048     00 [--------]
+`
+
+	quotas, err := parseQuotaReport(report)
+	c.Assert(err, IsNil)
+	c.Assert(quotas, DeepEquals, map[uint32]*ProjectQuota{
+		0:    {UsedBytes: 8 * 1024},
+		1001: {UsedBytes: 1024 * 1024, LimitBytes: 10 * 1024 * 1024},
+		1002: {LimitBytes: 2 * 1024 * 1024},
+	})
+
+	quotas, err = parseQuotaReport("")
+	c.Assert(err, IsNil)
+	c.Assert(quotas, HasLen, 0)
+
+	_, err = parseQuotaReport("#1001 lots 0 10240 00 [--------]")
+	c.Assert(err, NotNil)
+}
+
+func (s *storageSuite) TestNewProjectID(c *C) {
+	project := NewProjectID("policy1/test", nil, nil)
+	c.Assert(project, Not(Equals), uint32(0))
+	c.Assert(NewProjectID("policy1/test", nil, nil), Equals, project)
+	c.Assert(NewProjectID("policy1/other", nil, nil), Not(Equals), project)
+
+	// IDs in use are skipped.
+	quotas := map[uint32]*ProjectQuota{project: {}, project + 1: {}}
+	c.Assert(NewProjectID("policy1/test", quotas, nil), Equals, project+2)
+
+	// so are assigned IDs the quotas do not report.
+	c.Assert(NewProjectID("policy1/test", quotas, map[uint32]bool{project + 2: true}), Equals, project+3)
+}
+
+func (s *storageSuite) TestAssignedProjectIDs(c *C) {
+	dir, err := ioutil.TempDir("", "volplugin-quota")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+
+	oldProjidFile := projidFile
+	projidFile = filepath.Join(dir, "projid")
+	defer func() { projidFile = oldProjidFile }()
+
+	projects, err := AssignedProjectIDs()
+	c.Assert(err, IsNil)
+	c.Assert(projects, HasLen, 0)
+
+	c.Assert(ioutil.WriteFile(projidFile, []byte("# comment\nlogs:42\n\ncache:1001\n"), 0600), IsNil)
+	projects, err = AssignedProjectIDs()
+	c.Assert(err, IsNil)
+	c.Assert(projects, DeepEquals, map[uint32]bool{42: true, 1001: true})
+
+	c.Assert(ioutil.WriteFile(projidFile, []byte("logs:lots\n"), 0600), IsNil)
+	_, err = AssignedProjectIDs()
+	c.Assert(err, NotNil)
+}
+
+func (s *storageSuite) TestProjectQuotaRoot(c *C) {
+	dir, err := ioutil.TempDir("", "volplugin-quota")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+
+	dir, err = filepath.EvalSymlinks(dir)
+	c.Assert(err, IsNil)
+
+	for _, sub := range []string{"xfs/volumes", "plain/volumes", "with space/volumes", "xfs/ext4/volumes"} {
+		c.Assert(os.MkdirAll(filepath.Join(dir, sub), 0700), IsNil)
+	}
+
+	mounts := `/dev/sda1 / ext4 rw,relatime 0 0
+/dev/sdb1 ` + dir + `/xfs xfs rw,relatime,attr2,inode64,prjquota 0 0
+/dev/sdc1 ` + dir + `/plain xfs rw,relatime,attr2,inode64,noquota 0 0
+/dev/sdd1 ` + dir + `/with\040space xfs rw,pquota 0 0
+/dev/sde1 ` + dir + `/xfs/ext4 ext4 rw 0 0
+`
+
+	oldProcMounts := procMounts
+	procMounts = filepath.Join(dir, "mounts")
+	defer func() { procMounts = oldProcMounts }()
+	c.Assert(ioutil.WriteFile(procMounts, []byte(mounts), 0600), IsNil)
+
+	root, err := ProjectQuotaRoot(filepath.Join(dir, "xfs/volumes"))
+	c.Assert(err, IsNil)
+	c.Assert(root, Equals, filepath.Join(dir, "xfs"))
+
+	root, err = ProjectQuotaRoot(filepath.Join(dir, "with space/volumes"))
+	c.Assert(err, IsNil)
+	c.Assert(root, Equals, filepath.Join(dir, "with space"))
+
+	for _, sub := range []string{"plain/volumes", "xfs/ext4/volumes", "."} {
+		root, err = ProjectQuotaRoot(filepath.Join(dir, sub))
+		c.Assert(err, IsNil)
+		c.Assert(root, Equals, "", Commentf("%q", sub))
+	}
+
+	_, err = ProjectQuotaRoot(filepath.Join(dir, "nonexistent"))
+	c.Assert(err, NotNil)
+}
@@ -1,9 +1,21 @@
 package storage
 
 import (
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/context"
+	"golang.org/x/sys/unix"
 
 	"github.com/contiv/errored"
+	"github.com/contiv/executor"
 	"github.com/contiv/volplugin/errors"
 )
 
@@ -20,3 +32,234 @@ func SplitName(name string) (string, string, error) {
 
 	return parts[0], parts[1], nil
 }
+
+// TemplateFSCmd replaces each `%` in a filesystem creation command with the
+// path to the device. `%%` is left alone.
+func TemplateFSCmd(fscmd, devicePath string) string {
+	for idx := 0; idx < len(fscmd); idx++ {
+		if fscmd[idx] == '%' {
+			if idx < len(fscmd)-1 && fscmd[idx+1] == '%' {
+				idx++
+				continue
+			}
+			var lhs, rhs string
+
+			switch {
+			case idx == 0:
+				lhs = ""
+				rhs = fscmd[1:]
+			case idx == len(fscmd)-1:
+				lhs = fscmd[:idx]
+				rhs = ""
+			default:
+				lhs = fscmd[:idx]
+				rhs = fscmd[idx+1:]
+			}
+
+			fscmd = fmt.Sprintf("%s%s%s", lhs, devicePath, rhs)
+		}
+	}
+
+	return fscmd
+}
+
+// mountFlags are the mount options which are flags to mount(2) rather than
+// options of the filesystem. Options which clear flags map to zero.
+var mountFlags = map[string]uintptr{
+	"defaults":    0,
+	"rw":          0,
+	"ro":          unix.MS_RDONLY,
+	"nosuid":      unix.MS_NOSUID,
+	"nodev":       unix.MS_NODEV,
+	"noexec":      unix.MS_NOEXEC,
+	"sync":        unix.MS_SYNCHRONOUS,
+	"dirsync":     unix.MS_DIRSYNC,
+	"mand":        unix.MS_MANDLOCK,
+	"noatime":     unix.MS_NOATIME,
+	"nodiratime":  unix.MS_NODIRATIME,
+	"relatime":    unix.MS_RELATIME,
+	"strictatime": unix.MS_STRICTATIME,
+}
+
+// ParseMountOptions translates comma-separated mount options, as in fstab,
+// into the flags and data arguments of mount(2). Options which are not flags,
+// such as discard or the options of xfs, are passed on in the data.
+func ParseMountOptions(options string) (uintptr, string) {
+	var (
+		flags uintptr
+		data  []string
+	)
+
+	for _, option := range strings.Split(options, ",") {
+		option = strings.TrimSpace(option)
+		if option == "" {
+			continue
+		}
+
+		if flag, ok := mountFlags[option]; ok {
+			flags |= flag
+		} else {
+			data = append(data, option)
+		}
+	}
+
+	return flags, strings.Join(data, ",")
+}
+
+// MountStats returns the capacity and usage of the filesystem of a mount.
+func MountStats(mount *Mount) (*Stats, error) {
+	statfs := &syscall.Statfs_t{}
+	if err := syscall.Statfs(mount.Path, statfs); err != nil {
+		return nil, errored.Errorf("Retrieving filesystem statistics for %q", mount.Path).Combine(err)
+	}
+
+	return &Stats{
+		ProvisionedBytes: statfs.Blocks * uint64(statfs.Bsize),
+		UsedBytes:        (statfs.Blocks - statfs.Bfree) * uint64(statfs.Bsize),
+		Inodes:           statfs.Files,
+		InodesUsed:       statfs.Files - statfs.Ffree,
+	}, nil
+}
+
+// RunCommand runs the command and folds its output into the error if it
+// fails. The standard output is returned on success. The command is killed
+// when the timeout runs out.
+func RunCommand(cmd *exec.Cmd, timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	er, err := executor.NewCapture(cmd).Run(ctx)
+	if err != nil {
+		if er == nil {
+			return "", errored.Errorf("Could not run %v", cmd.Args).Combine(err)
+		}
+
+		return "", errored.Errorf("Error running %v: %v (%v)", cmd.Args, er, strings.TrimSpace(er.Stderr)).Combine(err)
+	}
+
+	return er.Stdout, nil
+}
+
+// RunStreaming runs the command with its standard input read from stdin and
+// its standard output written to stdout; either may be nil. The command is
+// killed when the timeout runs out. Failures carry its standard error.
+func RunStreaming(cmd *exec.Cmd, stdin io.Reader, stdout io.Writer, timeout time.Duration) error {
+	stderr := &bytes.Buffer{}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	e := executor.New(cmd)
+	e.Stdin = stdin
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if _, err := e.Run(ctx); err != nil {
+		return errored.Errorf("Error running %v: %v", cmd.Args, strings.TrimSpace(stderr.String())).Combine(err)
+	}
+
+	return nil
+}
+
+var (
+	ext4BlockCount = regexp.MustCompile(`(?m)^Block count:\s+(\d+)$`)
+	ext4BlockSize  = regexp.MustCompile(`(?m)^Block size:\s+(\d+)$`)
+	xfsDataBlocks  = regexp.MustCompile(`(?m)^data\s+=\s*bsize=(\d+)\s+blocks=(\d+)`)
+)
+
+// FileSystemSize returns the size in bytes of the filesystem of type fsType on
+// the device, mounted at mountPath. Filesystems span their devices when they
+// are made or grown, so it tells if the filesystem has been grown along with
+// its device. Only ext and xfs filesystems are supported.
+func FileSystemSize(fsType, device, mountPath string, timeout time.Duration) (uint64, error) {
+	var cmd *exec.Cmd
+
+	switch fsType {
+	case "ext2", "ext3", "ext4":
+		cmd = exec.Command("dumpe2fs", "-h", device)
+	case "xfs":
+		cmd = exec.Command("xfs_info", mountPath)
+	default:
+		return 0, errored.Errorf("Telling the size of filesystem %q is not supported", fsType)
+	}
+
+	out, err := RunCommand(cmd, timeout)
+	if err != nil {
+		return 0, errored.Errorf("Reading the size of the filesystem on %q", device).Combine(err)
+	}
+
+	return parseFileSystemSize(fsType, out)
+}
+
+func parseFileSystemSize(fsType, out string) (uint64, error) {
+	var blockSize, blocks []string
+
+	if fsType == "xfs" {
+		if match := xfsDataBlocks.FindStringSubmatch(out); match != nil {
+			blockSize, blocks = match[1:2], match[2:3]
+		}
+	} else {
+		blockSize, blocks = ext4BlockSize.FindStringSubmatch(out), ext4BlockCount.FindStringSubmatch(out)
+		if blockSize != nil && blocks != nil {
+			blockSize, blocks = blockSize[1:], blocks[1:]
+		}
+	}
+
+	if len(blockSize) != 1 || len(blocks) != 1 {
+		return 0, errored.Errorf("No size of %s filesystem found in %q", fsType, out)
+	}
+
+	size, err := strconv.ParseUint(blockSize[0], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := strconv.ParseUint(blocks[0], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	return size * count, nil
+}
+
+// DevNumbers splits a device number into its major and minor numbers. Minors
+// past 255, which device-mapper, loop devices and zvols quickly reach, take
+// the extended encoding.
+func DevNumbers(dev uint64) (uint, uint) {
+	major := ((dev >> 8) & 0xfff) | ((dev >> 32) &^ 0xfff)
+	minor := (dev & 0xff) | ((dev >> 12) &^ 0xff)
+	return uint(major), uint(minor)
+}
+
+// FileSystemType returns the type of the filesystem on the device, as blkid
+// probes it, or an empty string if there is none.
+func FileSystemType(device string, timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.Command("blkid", "-p", "-o", "value", "-s", "TYPE", device)
+	er, err := executor.NewCapture(cmd).Run(ctx)
+
+	// blkid exits 2 when it finds nothing.
+	if er != nil && er.ExitStatus == 2 {
+		return "", nil
+	} else if er != nil && er.ExitStatus != 0 {
+		return "", errored.Errorf("Probing filesystem of %q: %v (%v)", device, er, strings.TrimSpace(er.Stderr))
+	} else if err != nil {
+		return "", errored.Errorf("Probing filesystem of %q", device).Combine(err)
+	}
+
+	return strings.TrimSpace(er.Stdout), nil
+}
+
+// ArchiveDirectory writes a tar archive of the contents of dir to w. It is
+// the image format of volumes which are directories.
+func ArchiveDirectory(dir string, w io.Writer, timeout time.Duration) error {
+	return RunStreaming(exec.Command("tar", "--numeric-owner", "-C", dir, "-cf", "-", "."), nil, w, timeout)
+}
+
+// ExtractArchive extracts a tar archive written by ArchiveDirectory from r
+// into dir, keeping owners and permissions.
+func ExtractArchive(dir string, r io.Reader, timeout time.Duration) error {
+	return RunStreaming(exec.Command("tar", "--numeric-owner", "-C", dir, "-xpf", "-"), r, nil, timeout)
+}
@@ -1,6 +1,15 @@
 package storage
 
 import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
 	. "gopkg.in/check.v1"
 
 	"github.com/contiv/errored"
@@ -36,3 +45,138 @@ func (s *storageSuite) TestSplitName(c *C) {
 		c.Assert(volume, Equals, results[1])
 	}
 }
+
+func (s *storageSuite) TestTemplateFSCmd(c *C) {
+	c.Assert(TemplateFSCmd("%", "foo"), Equals, "foo")
+	c.Assert(TemplateFSCmd("%%", "foo"), Equals, "%%")
+	c.Assert(TemplateFSCmd("%%%", "foo"), Equals, "%%foo")
+	c.Assert(TemplateFSCmd("% test % test %", "foo"), Equals, "foo test foo test foo")
+	c.Assert(TemplateFSCmd("% %% %", "foo"), Equals, "foo %% foo")
+	c.Assert(TemplateFSCmd("mkfs.ext4 -m0 %", "/dev/sda1"), Equals, "mkfs.ext4 -m0 /dev/sda1")
+}
+
+func (s *storageSuite) TestParseMountOptions(c *C) {
+	flags, data := ParseMountOptions("")
+	c.Assert(flags, Equals, uintptr(0))
+	c.Assert(data, Equals, "")
+
+	flags, data = ParseMountOptions("defaults,noatime, nodiratime,discard,nobarrier")
+	c.Assert(flags, Equals, uintptr(unix.MS_NOATIME|unix.MS_NODIRATIME))
+	c.Assert(data, Equals, "discard,nobarrier")
+
+	flags, data = ParseMountOptions("ro,,logbufs=8,allocsize=64m")
+	c.Assert(flags, Equals, uintptr(unix.MS_RDONLY))
+	c.Assert(data, Equals, "logbufs=8,allocsize=64m")
+}
+
+func (s *storageSuite) TestMountStats(c *C) {
+	dir, err := ioutil.TempDir("", "volplugin-storage")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+
+	stats, err := MountStats(&Mount{Path: dir})
+	c.Assert(err, IsNil)
+	c.Assert(stats.ProvisionedBytes > 0, Equals, true)
+	c.Assert(stats.UsedBytes <= stats.ProvisionedBytes, Equals, true)
+	c.Assert(stats.InodesUsed <= stats.Inodes, Equals, true)
+
+	_, err = MountStats(&Mount{Path: dir + "/nonexistent"})
+	c.Assert(err, NotNil)
+}
+
+func (s *storageSuite) TestDevNumbers(c *C) {
+	major, minor := DevNumbers(0xe6a0)
+	c.Assert(major, Equals, uint(230))
+	c.Assert(minor, Equals, uint(160))
+
+	// device-mapper and zvol minors run past 255.
+	major, minor = DevNumbers(0x10e600)
+	c.Assert(major, Equals, uint(230))
+	c.Assert(minor, Equals, uint(256))
+	major, minor = DevNumbers(0x10fd2c)
+	c.Assert(major, Equals, uint(253))
+	c.Assert(minor, Equals, uint(300))
+}
+
+func (s *storageSuite) TestRunCommand(c *C) {
+	out, err := RunCommand(exec.Command("echo", "captured"), time.Minute)
+	c.Assert(err, IsNil)
+	c.Assert(out, Equals, "captured\n")
+
+	_, err = RunCommand(exec.Command("sh", "-c", "echo broken >&2; exit 1"), time.Minute)
+	c.Assert(err, ErrorMatches, "(?s).*broken.*")
+
+	_, err = RunCommand(exec.Command("sleep", "10"), 10*time.Millisecond)
+	c.Assert(err, NotNil)
+}
+
+func (s *storageSuite) TestRunStreaming(c *C) {
+	out := &bytes.Buffer{}
+	c.Assert(RunStreaming(exec.Command("cat"), strings.NewReader("streamed"), out, time.Minute), IsNil)
+	c.Assert(out.String(), Equals, "streamed")
+
+	c.Assert(RunStreaming(exec.Command("true"), nil, nil, time.Minute), IsNil)
+
+	err := RunStreaming(exec.Command("sh", "-c", "echo broken >&2; exit 1"), nil, nil, time.Minute)
+	c.Assert(err, ErrorMatches, "(?s).*broken.*")
+
+	c.Assert(RunStreaming(exec.Command("sleep", "10"), nil, nil, 10*time.Millisecond), NotNil)
+}
+
+func (s *storageSuite) TestArchiveDirectory(c *C) {
+	source, err := ioutil.TempDir("", "volplugin-archive")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(source)
+
+	target, err := ioutil.TempDir("", "volplugin-archive")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(target)
+
+	c.Assert(os.Mkdir(filepath.Join(source, "dir"), 0700), IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(source, "dir", "file"), []byte("archived"), 0640), IsNil)
+
+	archive := &bytes.Buffer{}
+	c.Assert(ArchiveDirectory(source, archive, time.Minute), IsNil)
+	c.Assert(ExtractArchive(target, archive, time.Minute), IsNil)
+
+	content, err := ioutil.ReadFile(filepath.Join(target, "dir", "file"))
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Equals, "archived")
+
+	fi, err := os.Stat(filepath.Join(target, "dir", "file"))
+	c.Assert(err, IsNil)
+	c.Assert(fi.Mode().Perm(), Equals, os.FileMode(0640))
+
+	c.Assert(ArchiveDirectory(filepath.Join(source, "nonexistent"), &bytes.Buffer{}, time.Minute), NotNil)
+	c.Assert(ExtractArchive(target, strings.NewReader("garbage"), time.Minute), NotNil)
+}
+
+func (s *storageSuite) TestParseFileSystemSize(c *C) {
+	ext4 := `Filesystem volume name:   <none>
+Block count:              262144
+Reserved block count:     0
+Block size:               4096
+`
+
+	size, err := parseFileSystemSize("ext4", ext4)
+	c.Assert(err, IsNil)
+	c.Assert(size, Equals, uint64(1024*1024*1024))
+
+	xfs := `meta-data=/dev/rbd0              isize=512    agcount=8, agsize=32768 blks
+         =                       sectsz=512   attr=2, projid32bit=1
+data     =                       bsize=4096   blocks=262144, imaxpct=25
+         =                       sunit=1024   swidth=1024 blks
+naming   =version 2              bsize=4096   ascii-ci=0 ftype=1
+log      =internal log           bsize=4096   blocks=2560, version=2
+`
+
+	size, err = parseFileSystemSize("xfs", xfs)
+	c.Assert(err, IsNil)
+	c.Assert(size, Equals, uint64(1024*1024*1024))
+
+	_, err = parseFileSystemSize("ext4", "Block count: 262144")
+	c.Assert(err, NotNil)
+
+	_, err = parseFileSystemSize("xfs", ext4)
+	c.Assert(err, NotNil)
+}
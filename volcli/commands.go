@@ -133,7 +133,13 @@ var Commands = []cli.Command{
 				ArgsUsage:   "[policy name]",
 				Description: "Given a policy name, produces a newline-delimited list of volumes.",
 				Usage:       "List all volumes for a given policy",
-				Action:      VolumeList,
+				Flags: []cli.Flag{
+					cli.BoolFlag{
+						Name:  "usage",
+						Usage: "Show the capacity and usage of each volume",
+					},
+				},
+				Action: VolumeList,
 			},
 			{
 				Name:        "list-all",
@@ -166,6 +172,91 @@ var Commands = []cli.Command{
 				Usage:       "Remove a volume and its contents",
 				Action:      VolumeRemove,
 			},
+			{
+				Name:        "resize",
+				ArgsUsage:   "[policy name]/[volume name] [size]",
+				Description: "Grows the volume to the new size, e.g. 20G. Mounted volumes have their filesystem grown on the host they are mounted on.",
+				Usage:       "Grow a volume",
+				Action:      VolumeResize,
+			},
+			{
+				Name:        "rename",
+				ArgsUsage:   "[policy name]/[volume name] [new volume name]",
+				Description: "Renames the volume in its backend and in the database, along with its snapshots, copies and backups. The volume must not be mounted anywhere.",
+				Usage:       "Rename a volume",
+				Action:      VolumeRename,
+			},
+			{
+				Name:      "move",
+				ArgsUsage: "[policy name]/[volume name]",
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "policy",
+						Usage: "The policy to move the volume to",
+					},
+				},
+				Description: "Moves the volume to another policy using the same backends. The volume keeps its data and create options, and takes the runtime options of the policy. The volume must not be mounted anywhere, nor share its data with copies which are not flattened.",
+				Usage:       "Move a volume to another policy",
+				Action:      VolumeMove,
+			},
+			{
+				Name:      "import-existing",
+				ArgsUsage: "[policy name]/[volume name], or [policy name] with --pool",
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "image",
+						Usage: "The image to import, as [pool]/[image] or [image] in the pool of the policy",
+					},
+					cli.StringFlag{
+						Name:  "pool",
+						Usage: "Import all images in the pool which no volume uses, as volumes named after the images with dots replaced by dashes",
+					},
+					cli.BoolFlag{
+						Name:  "detect-fs",
+						Usage: "Probe the images for their filesystems instead of assuming the one of the policy",
+					},
+				},
+				Description: "Records images made in the backend outside volplugin as volumes, without creating or formatting them. Images keep their names in the backend. Images used by volumes are skipped, and volumes of policies which encrypt them cannot be imported.",
+				Usage:       "Import existing backend images as volumes",
+				Action:      VolumeImportExisting,
+			},
+			{
+				Name:      "clone",
+				ArgsUsage: "[policy name]/[volume name] [new volume name]",
+				Flags: []cli.Flag{
+					cli.BoolFlag{
+						Name:  "flatten",
+						Usage: "Detach the new volume from its snapshot before returning, and remove the snapshot",
+					},
+				},
+				Description: "Copies the volume as it is now to the new volume name, taking the snapshot to copy it from. The policy will remain the same, as well as the volume parameters. Unflattened clones keep their snapshot until they are flattened.",
+				Usage:       "Copy a volume to a new volume",
+				Action:      VolumeClone,
+			},
+			{
+				Name:      "export",
+				ArgsUsage: "[policy name]/[volume name]",
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "snapshot",
+						Usage: "The snapshot of the volume to export",
+					},
+				},
+				Description: "Writes an image of a snapshot of the volume to stdout. Images can be imported with \"volume import\" into volumes of the same backend.",
+				Usage:       "Export a snapshot of a volume to an image",
+				Action:      VolumeExport,
+			},
+			{
+				Name: "import",
+				Flags: []cli.Flag{cli.StringSliceFlag{
+					Name:  "opt",
+					Usage: "Provide key=value options to create the volume",
+				}},
+				ArgsUsage:   "[policy name]/[volume name]",
+				Description: "Creates a volume for the policy from an image, read from stdin, that \"volume export\" wrote.",
+				Usage:       "Create a volume from an exported image",
+				Action:      VolumeImport,
+			},
 			{
 				Name:        "snapshot",
 				Description: "Snapshot management tools",
@@ -176,21 +267,74 @@ var Commands = []cli.Command{
 						ArgsUsage:   "[policy name]/[volume name]",
 						Description: "Take a snapshot for a volume now",
 						Usage:       "Take a snapshot for a volume now",
-						Action:      VolumeSnapshotTake,
+						Flags: []cli.Flag{
+							cli.StringSliceFlag{
+								Name:  "label",
+								Usage: "Provide key=value labels to record with the snapshot",
+							},
+						},
+						Action: VolumeSnapshotTake,
 					},
 					{
 						Name:        "list",
 						ArgsUsage:   "[policy name]/[volume name]",
 						Description: "List snapshots",
 						Usage:       "List snapshots",
-						Action:      VolumeSnapshotList,
+						Flags: []cli.Flag{
+							cli.BoolFlag{
+								Name:  "details",
+								Usage: "Show when each snapshot was taken, its size, origin, flags and labels",
+							},
+						},
+						Action: VolumeSnapshotList,
 					},
 					{
 						Name:        "copy",
 						ArgsUsage:   "[policy name]/[volume name] [snapshot name] [new volume name]",
 						Description: "Copies a volume with a given snapshot name to the new volume name. The policy will remain the same, as well as the volume parameters.",
 						Usage:       "Copy a volume snapshot to a new volume",
-						Action:      VolumeSnapshotCopy,
+						Flags: []cli.Flag{
+							cli.BoolFlag{
+								Name:  "flatten",
+								Usage: "Detach the new volume from the snapshot in the background, and wait for it",
+							},
+						},
+						Action: VolumeSnapshotCopy,
+					},
+					{
+						Name:        "copy-status",
+						ArgsUsage:   "[policy name]/[volume name]",
+						Description: "Shows the snapshot a volume was copied from and how far along flattening it is.",
+						Usage:       "Show the status of a snapshot copy",
+						Action:      VolumeSnapshotCopyStatus,
+					},
+					{
+						Name:        "rollback",
+						ArgsUsage:   "[policy name]/[volume name] [snapshot name]",
+						Description: "Restores a volume to a snapshot, discarding everything written since. The volume must not be mounted anywhere.",
+						Usage:       "Roll a volume back to a snapshot",
+						Action:      VolumeSnapshotRollback,
+					},
+				},
+			},
+			{
+				Name:        "backup",
+				Description: "Backup management tools",
+				Usage:       "Backup management tools",
+				Subcommands: []cli.Command{
+					{
+						Name:        "list",
+						ArgsUsage:   "[policy name]/[volume name]",
+						Description: "Lists the backups of a volume in the backup repository of its policy, oldest first.",
+						Usage:       "List the backups of a volume",
+						Action:      VolumeBackupList,
+					},
+					{
+						Name:        "restore",
+						ArgsUsage:   "[policy name]/[volume name] [backup name] [new volume name]",
+						Description: "Rebuilds the volume as of a backup into a new volume, from the full backup it goes back to and every incremental one since.",
+						Usage:       "Restore a backup into a new volume",
+						Action:      VolumeBackupRestore,
 					},
 				},
 			},
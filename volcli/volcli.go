@@ -7,19 +7,26 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"os/signal"
+	"path"
+	"sort"
 	"strings"
 	"syscall"
+	"text/tabwriter"
 	"time"
 
 	"github.com/codegangsta/cli"
 	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/backup"
 	"github.com/contiv/volplugin/config"
 	"github.com/contiv/volplugin/errors"
 	"github.com/contiv/volplugin/lock"
+	"github.com/contiv/volplugin/storage"
 	"github.com/contiv/volplugin/watch"
+	"github.com/docker/go-units"
 	"github.com/kr/pty"
 )
 
@@ -610,6 +617,417 @@ func volumeRemove(ctx *cli.Context) (bool, error) {
 	return false, nil
 }
 
+// VolumeResize grows a volume to a new size.
+func VolumeResize(ctx *cli.Context) {
+	execCliAndExit(ctx, volumeResize)
+}
+
+func volumeResize(ctx *cli.Context) (bool, error) {
+	if len(ctx.Args()) != 2 {
+		return true, errorInvalidArgCount(len(ctx.Args()), 2, ctx.Args())
+	}
+
+	policy, volume, err := splitVolume(ctx)
+	if err != nil {
+		return true, err
+	}
+
+	req := &config.VolumeRequest{
+		Name:   volume,
+		Policy: policy,
+		Options: map[string]string{
+			"size": ctx.Args()[1],
+		},
+	}
+
+	content, err := json.Marshal(req)
+	if err != nil {
+		return false, errored.Errorf("Could not create request JSON: %v", err)
+	}
+
+	resp, err := http.Post(fmt.Sprintf("http://%s/volumes/resize", ctx.GlobalString("apiserver")), "application/json", bytes.NewBuffer(content))
+	if err != nil {
+		return false, err
+	}
+
+	if resp.StatusCode != 200 {
+		qualifiedVolume := fmt.Sprintf("%v/%v", policy, volume)
+		if _, err := io.Copy(os.Stderr, resp.Body); err != nil {
+			return false, errored.Errorf("Error copying body: %v\n Volume %v Response Status Code was %d, not 200", err, qualifiedVolume, resp.StatusCode)
+		}
+		return false, errored.Errorf("Volume %v Response Status Code was %d, not 200", qualifiedVolume, resp.StatusCode)
+	}
+
+	return false, nil
+}
+
+// VolumeClone copies a volume as it is now to a new volume.
+func VolumeClone(ctx *cli.Context) {
+	execCliAndExit(ctx, volumeClone)
+}
+
+func volumeClone(ctx *cli.Context) (bool, error) {
+	if len(ctx.Args()) != 2 {
+		return true, errorInvalidArgCount(len(ctx.Args()), 2, ctx.Args())
+	}
+
+	policy, volume, err := splitVolume(ctx)
+	if err != nil {
+		return true, err
+	}
+
+	req := &config.VolumeRequest{
+		Name:   volume,
+		Policy: policy,
+		Options: map[string]string{
+			"target": ctx.Args()[1],
+		},
+	}
+
+	if ctx.Bool("flatten") {
+		req.Options["flatten"] = "true"
+	}
+
+	content, err := json.Marshal(req)
+	if err != nil {
+		return false, errored.Errorf("Could not create request JSON: %v", err)
+	}
+
+	resp, err := http.Post(fmt.Sprintf("http://%s/volumes/clone", ctx.GlobalString("apiserver")), "application/json", bytes.NewBuffer(content))
+	if err != nil {
+		return false, err
+	}
+
+	if resp.StatusCode != 200 {
+		qualifiedVolume := fmt.Sprintf("%v/%v", policy, volume)
+		if _, err := io.Copy(os.Stderr, resp.Body); err != nil {
+			return false, errored.Errorf("Error copying body: %v\n Volume %v Response Status Code was %d, not 200", err, qualifiedVolume, resp.StatusCode)
+		}
+		return false, errored.Errorf("Volume %v Response Status Code was %d, not 200", qualifiedVolume, resp.StatusCode)
+	}
+
+	content, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return false, errored.New("Reading body processing response").Combine(err)
+	}
+
+	vol := &config.Volume{}
+	if err := json.Unmarshal(content, vol); err != nil {
+		return false, errors.UnmarshalVolume.Combine(err)
+	}
+
+	fmt.Println(strings.Join([]string{vol.PolicyName, vol.VolumeName}, "/"))
+
+	return false, nil
+}
+
+// VolumeRename renames a volume.
+func VolumeRename(ctx *cli.Context) {
+	execCliAndExit(ctx, volumeRename)
+}
+
+func volumeRename(ctx *cli.Context) (bool, error) {
+	if len(ctx.Args()) != 2 {
+		return true, errorInvalidArgCount(len(ctx.Args()), 2, ctx.Args())
+	}
+
+	policy, volume, err := splitVolume(ctx)
+	if err != nil {
+		return true, err
+	}
+
+	return false, renameVolume(ctx, policy, volume, map[string]string{"target": ctx.Args()[1]})
+}
+
+// VolumeMove moves a volume to another policy.
+func VolumeMove(ctx *cli.Context) {
+	execCliAndExit(ctx, volumeMove)
+}
+
+func volumeMove(ctx *cli.Context) (bool, error) {
+	if len(ctx.Args()) != 1 {
+		return true, errorInvalidArgCount(len(ctx.Args()), 1, ctx.Args())
+	}
+
+	policy, volume, err := splitVolume(ctx)
+	if err != nil {
+		return true, err
+	}
+
+	if ctx.String("policy") == "" {
+		return true, errored.New("The policy to move the volume to must be provided with --policy")
+	}
+
+	return false, renameVolume(ctx, policy, volume, map[string]string{"target-policy": ctx.String("policy")})
+}
+
+func renameVolume(ctx *cli.Context, policy, volume string, options map[string]string) error {
+	req := &config.VolumeRequest{
+		Name:    volume,
+		Policy:  policy,
+		Options: options,
+	}
+
+	content, err := json.Marshal(req)
+	if err != nil {
+		return errored.Errorf("Could not create request JSON: %v", err)
+	}
+
+	resp, err := http.Post(fmt.Sprintf("http://%s/volumes/rename", ctx.GlobalString("apiserver")), "application/json", bytes.NewBuffer(content))
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != 200 {
+		qualifiedVolume := fmt.Sprintf("%v/%v", policy, volume)
+		if _, err := io.Copy(os.Stderr, resp.Body); err != nil {
+			return errored.Errorf("Error copying body: %v\n Volume %v Response Status Code was %d, not 200", err, qualifiedVolume, resp.StatusCode)
+		}
+		return errored.Errorf("Volume %v Response Status Code was %d, not 200", qualifiedVolume, resp.StatusCode)
+	}
+
+	content, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return errored.New("Reading body processing response").Combine(err)
+	}
+
+	vol := &config.Volume{}
+	if err := json.Unmarshal(content, vol); err != nil {
+		return errors.UnmarshalVolume.Combine(err)
+	}
+
+	fmt.Println(strings.Join([]string{vol.PolicyName, vol.VolumeName}, "/"))
+
+	return nil
+}
+
+// VolumeImportExisting adopts images made in the backend outside volplugin
+// as volumes.
+func VolumeImportExisting(ctx *cli.Context) {
+	execCliAndExit(ctx, volumeImportExisting)
+}
+
+func volumeImportExisting(ctx *cli.Context) (bool, error) {
+	if len(ctx.Args()) != 1 {
+		return true, errorInvalidArgCount(len(ctx.Args()), 1, ctx.Args())
+	}
+
+	if pool := ctx.String("pool"); pool != "" {
+		if ctx.String("image") != "" {
+			return true, errored.New("Only one of --image and --pool may be provided")
+		}
+
+		policy := ctx.Args()[0]
+		if strings.Contains(policy, "/") {
+			return true, errorInvalidVolumeSyntax(policy, `<policyName>`)
+		}
+
+		return false, importExistingPool(ctx, policy, pool)
+	}
+
+	policy, volume, err := splitVolume(ctx)
+	if err != nil {
+		return true, err
+	}
+
+	if ctx.String("image") == "" {
+		return true, errored.New("The image to import must be provided with --image, or a pool to import with --pool")
+	}
+
+	return false, importExisting(ctx, policy, volume, ctx.String("image"))
+}
+
+// importExistingPool imports all the images in the pool which no volume uses
+// as volumes of the policy named after them. Images used by volumes, and
+// images failing to import, are reported and skipped.
+func importExistingPool(ctx *cli.Context, policy, pool string) error {
+	resp, err := http.Get(fmt.Sprintf("http://%s/images/%s?pool=%s", ctx.GlobalString("apiserver"), policy, url.QueryEscape(pool)))
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		if _, err := io.Copy(os.Stderr, resp.Body); err != nil {
+			return errored.Errorf("Error copying body: %v\n Policy %v Response Status Code was %d, not 200", err, policy, resp.StatusCode)
+		}
+		return errored.Errorf("Policy %v Response Status Code was %d, not 200", policy, resp.StatusCode)
+	}
+
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return errored.New("Reading body processing response").Combine(err)
+	}
+
+	images := []storage.Image{}
+	if err := json.Unmarshal(content, &images); err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, image := range images {
+		if image.Volume != "" {
+			fmt.Fprintf(os.Stderr, "Skipping image %q: used by volume %q\n", image.Name, image.Volume)
+			continue
+		}
+
+		if err := importExisting(ctx, policy, imageVolumeName(image.Name), image.Name); err != nil {
+			fmt.Fprintf(os.Stderr, "Importing image %q: %v\n", image.Name, err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return errored.Errorf("%d of %d images in pool %q could not be imported", failed, len(images), pool)
+	}
+
+	return nil
+}
+
+// imageVolumeName names the volume an image of a pool is imported as after the
+// image. Volume names cannot contain dots, so they are replaced with dashes.
+func imageVolumeName(image string) string {
+	return strings.Replace(path.Base(image), ".", "-", -1)
+}
+
+func importExisting(ctx *cli.Context, policy, volume, image string) error {
+	options := map[string]string{"image": image}
+	if ctx.Bool("detect-fs") {
+		options["detect-filesystem"] = "true"
+	}
+
+	req := &config.VolumeRequest{
+		Name:    volume,
+		Policy:  policy,
+		Options: options,
+	}
+
+	content, err := json.Marshal(req)
+	if err != nil {
+		return errored.Errorf("Could not create request JSON: %v", err)
+	}
+
+	resp, err := http.Post(fmt.Sprintf("http://%s/volumes/adopt", ctx.GlobalString("apiserver")), "application/json", bytes.NewBuffer(content))
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		qualifiedVolume := fmt.Sprintf("%v/%v", policy, volume)
+		if _, err := io.Copy(os.Stderr, resp.Body); err != nil {
+			return errored.Errorf("Error copying body: %v\n Volume %v Response Status Code was %d, not 200", err, qualifiedVolume, resp.StatusCode)
+		}
+		return errored.Errorf("Volume %v Response Status Code was %d, not 200", qualifiedVolume, resp.StatusCode)
+	}
+
+	content, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return errored.New("Reading body processing response").Combine(err)
+	}
+
+	vol := &config.Volume{}
+	if err := json.Unmarshal(content, vol); err != nil {
+		return errors.UnmarshalVolume.Combine(err)
+	}
+
+	fmt.Println(strings.Join([]string{vol.PolicyName, vol.VolumeName}, "/"))
+
+	return nil
+}
+
+// VolumeExport writes an image of a snapshot of a volume to stdout.
+func VolumeExport(ctx *cli.Context) {
+	execCliAndExit(ctx, volumeExport)
+}
+
+func volumeExport(ctx *cli.Context) (bool, error) {
+	if len(ctx.Args()) != 1 {
+		return true, errorInvalidArgCount(len(ctx.Args()), 1, ctx.Args())
+	}
+
+	policy, volume, err := splitVolume(ctx)
+	if err != nil {
+		return true, err
+	}
+
+	if ctx.String("snapshot") == "" {
+		return true, errored.New("A snapshot to export must be provided with --snapshot")
+	}
+
+	resp, err := http.Get(fmt.Sprintf("http://%s/volumes/%s/%s/export?snapshot=%s", ctx.GlobalString("apiserver"), policy, volume, url.QueryEscape(ctx.String("snapshot"))))
+	if err != nil {
+		return false, err
+	}
+
+	defer resp.Body.Close()
+
+	qualifiedVolume := fmt.Sprintf("%v/%v", policy, volume)
+
+	if resp.StatusCode != 200 {
+		if _, err := io.Copy(os.Stderr, resp.Body); err != nil {
+			return false, errored.Errorf("Error copying body: %v\n Volume %v Response Status Code was %d, not 200", err, qualifiedVolume, resp.StatusCode)
+		}
+		return false, errored.Errorf("Volume %v Response Status Code was %d, not 200", qualifiedVolume, resp.StatusCode)
+	}
+
+	if _, err := io.Copy(os.Stdout, resp.Body); err != nil {
+		return false, errored.Errorf("Exporting volume %v: %v", qualifiedVolume, err)
+	}
+
+	// failures once the image is streaming can only come in the trailer.
+	if msg := resp.Trailer.Get("Export-Error"); msg != "" {
+		return false, errored.Errorf("Exporting volume %v: %v", qualifiedVolume, msg)
+	}
+
+	return false, nil
+}
+
+// VolumeImport creates a volume from an image read from stdin.
+func VolumeImport(ctx *cli.Context) {
+	execCliAndExit(ctx, volumeImport)
+}
+
+func volumeImport(ctx *cli.Context) (bool, error) {
+	if len(ctx.Args()) != 1 {
+		return true, errorInvalidArgCount(len(ctx.Args()), 1, ctx.Args())
+	}
+
+	policy, volume, err := splitVolume(ctx)
+	if err != nil {
+		return true, err
+	}
+
+	// the body is the image, so the options go in the query.
+	opts := url.Values{}
+
+	for _, str := range ctx.StringSlice("opt") {
+		pair := strings.SplitN(str, "=", 2)
+		if len(pair) < 2 {
+			return false, errored.Errorf("Mismatched option pair %q", pair)
+		}
+
+		opts.Set(pair[0], pair[1])
+	}
+
+	resp, err := http.Post(fmt.Sprintf("http://%s/volumes/import/%s/%s?%s", ctx.GlobalString("apiserver"), policy, volume, opts.Encode()), "application/octet-stream", os.Stdin)
+	if err != nil {
+		return false, err
+	}
+
+	if resp.StatusCode != 200 {
+		qualifiedVolume := fmt.Sprintf("%v/%v", policy, volume)
+		if _, err := io.Copy(os.Stderr, resp.Body); err != nil {
+			return false, errored.Errorf("Error copying body: %v\n Volume %v Response Status Code was %d, not 200", err, qualifiedVolume, resp.StatusCode)
+		}
+		return false, errored.Errorf("Volume %v Response Status Code was %d, not 200", qualifiedVolume, resp.StatusCode)
+	}
+
+	return false, nil
+}
+
 // VolumeList prints the list of volumes for a pool.
 func VolumeList(ctx *cli.Context) {
 	execCliAndExit(ctx, volumeList)
@@ -644,11 +1062,63 @@ func volumeList(ctx *cli.Context) (bool, error) {
 		return false, err
 	}
 
+	if !ctx.Bool("usage") {
+		for _, volume := range volumes {
+			fmt.Println(volume.VolumeName)
+		}
+
+		return false, nil
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(writer, "VOLUME\tUSED\tPROVISIONED\tUSE%\tINODES USED")
+
 	for _, volume := range volumes {
-		fmt.Println(volume.VolumeName)
+		stats, err := volumeStats(ctx, volume.PolicyName, volume.VolumeName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Could not retrieve statistics for %q: %v\n", volume.String(), err)
+			fmt.Fprintf(writer, "%s\t-\t-\t-\t-\n", volume.VolumeName)
+			continue
+		}
+
+		percent := "-"
+		if stats.ProvisionedBytes > 0 {
+			percent = fmt.Sprintf("%d%%", stats.UsedBytes*100/stats.ProvisionedBytes)
+		}
+
+		inodes := "-"
+		if stats.Inodes > 0 {
+			inodes = fmt.Sprintf("%d/%d", stats.InodesUsed, stats.Inodes)
+		}
+
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\n", volume.VolumeName, units.BytesSize(float64(stats.UsedBytes)), units.BytesSize(float64(stats.ProvisionedBytes)), percent, inodes)
 	}
 
-	return false, nil
+	return false, writer.Flush()
+}
+
+func volumeStats(ctx *cli.Context, policy, volume string) (*storage.Stats, error) {
+	resp, err := http.Get(fmt.Sprintf("http://%s/volumes/%s/%s/stats", ctx.GlobalString("apiserver"), policy, volume))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != 200 {
+		return nil, errored.Errorf("Response Status Code was %d, not 200: %s", resp.StatusCode, strings.TrimSpace(string(content)))
+	}
+
+	stats := &storage.Stats{}
+	if err := json.Unmarshal(content, stats); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
 }
 
 // VolumeSnapshotTake takes a snapshot for a volume immediately.
@@ -666,7 +1136,23 @@ func volumeSnapshotTake(ctx *cli.Context) (bool, error) {
 		return true, err
 	}
 
-	resp, err := http.Post(fmt.Sprintf("http://%s/snapshots/take/%s/%s", ctx.GlobalString("apiserver"), policy, volume), "application/json", nil)
+	labels := map[string]string{}
+
+	for _, str := range ctx.StringSlice("label") {
+		pair := strings.SplitN(str, "=", 2)
+		if len(pair) < 2 {
+			return false, errored.Errorf("Mismatched label pair %q", pair)
+		}
+
+		labels[pair[0]] = pair[1]
+	}
+
+	content, err := json.Marshal(labels)
+	if err != nil {
+		return false, errored.Errorf("Could not create request JSON: %v", err)
+	}
+
+	resp, err := http.Post(fmt.Sprintf("http://%s/snapshots/take/%s/%s", ctx.GlobalString("apiserver"), policy, volume), "application/json", bytes.NewBuffer(content))
 	if err != nil {
 		return false, err
 	}
@@ -709,6 +1195,10 @@ func volumeSnapshotCopy(ctx *cli.Context) (bool, error) {
 		},
 	}
 
+	if ctx.Bool("flatten") {
+		req.Options["flatten"] = "true"
+	}
+
 	content, err := json.Marshal(req)
 	if err != nil {
 		return false, errored.Errorf("Could not create request JSON: %v", err)
@@ -739,6 +1229,139 @@ func volumeSnapshotCopy(ctx *cli.Context) (bool, error) {
 
 	fmt.Println(strings.Join([]string{vol.PolicyName, vol.VolumeName}, "/"))
 
+	if !ctx.Bool("flatten") {
+		return false, nil
+	}
+
+	return false, waitForFlatten(ctx, vol.PolicyName, vol.VolumeName)
+}
+
+// waitForFlatten reports the progress of flattening the copy until it is done.
+func waitForFlatten(ctx *cli.Context, policy, volume string) error {
+	progress := -1
+
+	for {
+		cp, err := volumeCopy(ctx, policy, volume)
+		if err != nil {
+			return err
+		}
+
+		switch cp.Status {
+		case config.CopyFlattened:
+			fmt.Println("Flattened")
+			return nil
+		case config.CopyFailed:
+			return errored.Errorf("Flattening %v/%v failed: %v", policy, volume, cp.Error)
+		}
+
+		if cp.Progress != progress {
+			progress = cp.Progress
+			fmt.Printf("Flattening: %d%%\n", progress)
+		}
+
+		time.Sleep(time.Second)
+	}
+}
+
+func volumeCopy(ctx *cli.Context, policy, volume string) (*config.Copy, error) {
+	resp, err := http.Get(fmt.Sprintf("http://%s/copies/%s/%s", ctx.GlobalString("apiserver"), policy, volume))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == 404 {
+		return nil, errored.Errorf("Volume %v/%v was not copied from a snapshot", policy, volume)
+	} else if resp.StatusCode != 200 {
+		return nil, errored.Errorf("Response Status Code was %d, not 200: %s", resp.StatusCode, strings.TrimSpace(string(content)))
+	}
+
+	cp := &config.Copy{}
+	if err := json.Unmarshal(content, cp); err != nil {
+		return nil, err
+	}
+
+	return cp, nil
+}
+
+// VolumeSnapshotCopyStatus shows how far along flattening a copy is.
+func VolumeSnapshotCopyStatus(ctx *cli.Context) {
+	execCliAndExit(ctx, volumeSnapshotCopyStatus)
+}
+
+func volumeSnapshotCopyStatus(ctx *cli.Context) (bool, error) {
+	if len(ctx.Args()) != 1 {
+		return true, errorInvalidArgCount(len(ctx.Args()), 1, ctx.Args())
+	}
+
+	policy, volume, err := splitVolume(ctx)
+	if err != nil {
+		return true, err
+	}
+
+	cp, err := volumeCopy(ctx, policy, volume)
+	if err != nil {
+		return false, err
+	}
+
+	fmt.Printf("Source: %s@%s\n", cp.Source, cp.Snapshot)
+	fmt.Printf("Status: %s\n", cp.Status)
+	if cp.Status == config.CopyFlattening {
+		fmt.Printf("Progress: %d%%\n", cp.Progress)
+	}
+	if cp.Error != "" {
+		fmt.Printf("Error: %s\n", cp.Error)
+	}
+
+	return false, nil
+}
+
+// VolumeSnapshotRollback rolls a volume back to a snapshot.
+func VolumeSnapshotRollback(ctx *cli.Context) {
+	execCliAndExit(ctx, volumeSnapshotRollback)
+}
+
+func volumeSnapshotRollback(ctx *cli.Context) (bool, error) {
+	if len(ctx.Args()) != 2 {
+		return true, errorInvalidArgCount(len(ctx.Args()), 2, ctx.Args())
+	}
+
+	policy, volume, err := splitVolume(ctx)
+	if err != nil {
+		return true, err
+	}
+
+	req := &config.VolumeRequest{
+		Name:   volume,
+		Policy: policy,
+		Options: map[string]string{
+			"snapshot": ctx.Args()[1],
+		},
+	}
+
+	content, err := json.Marshal(req)
+	if err != nil {
+		return false, errored.Errorf("Could not create request JSON: %v", err)
+	}
+
+	resp, err := http.Post(fmt.Sprintf("http://%s/volumes/rollback", ctx.GlobalString("apiserver")), "application/json", bytes.NewBuffer(content))
+	if err != nil {
+		return false, err
+	}
+
+	if resp.StatusCode != 200 {
+		qualifiedVolume := fmt.Sprintf("%v/%v", policy, volume)
+		if _, err := io.Copy(os.Stderr, resp.Body); err != nil {
+			return false, errored.Errorf("Error copying body: %v\n Volume %v Response Status Code was %d, not 200", err, qualifiedVolume, resp.StatusCode)
+		}
+		return false, errored.Errorf("Volume %v Response Status Code was %d, not 200", qualifiedVolume, resp.StatusCode)
+	}
+
 	return false, nil
 }
 
@@ -775,14 +1398,149 @@ func volumeSnapshotList(ctx *cli.Context) (bool, error) {
 		return false, err
 	}
 
-	var results []string
+	var results []storage.Snapshot
+
+	if err := json.Unmarshal(content, &results); err != nil {
+		return false, err
+	}
+
+	if !ctx.Bool("details") {
+		for _, result := range results {
+			fmt.Println(result.Name)
+		}
+
+		return false, nil
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(writer, "SNAPSHOT\tCREATED\tSIZE\tORIGIN\tFLAGS\tLABELS")
+
+	for _, result := range results {
+		created, size, origin := "-", "-", "-"
+		if !result.Created.IsZero() {
+			created = result.Created.Format(time.RFC3339)
+		}
+		if result.Size > 0 {
+			size = units.BytesSize(float64(result.Size))
+		}
+		if result.Origin != "" {
+			origin = result.Origin
+		}
+
+		flags := []string{}
+		if result.Protected {
+			flags = append(flags, "protected")
+		}
+		if result.Parent {
+			flags = append(flags, "parent")
+		}
+
+		labels := []string{}
+		for key, value := range result.Labels {
+			labels = append(labels, key+"="+value)
+		}
+		sort.Strings(labels)
+
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s\n", result.Name, created, size, origin, strings.Join(flags, ","), strings.Join(labels, ","))
+	}
+
+	return false, writer.Flush()
+}
+
+// VolumeBackupList lists the backups of a volume, oldest first.
+func VolumeBackupList(ctx *cli.Context) {
+	execCliAndExit(ctx, volumeBackupList)
+}
+
+func volumeBackupList(ctx *cli.Context) (bool, error) {
+	if len(ctx.Args()) != 1 {
+		return true, errorInvalidArgCount(len(ctx.Args()), 1, ctx.Args())
+	}
+
+	policy, volume, err := splitVolume(ctx)
+	if err != nil {
+		return true, err
+	}
+
+	resp, err := http.Get(fmt.Sprintf("http://%s/backups/%s/%s", ctx.GlobalString("apiserver"), policy, volume))
+	if err != nil {
+		return false, err
+	}
+
+	if resp.StatusCode != 200 {
+		qualifiedVolume := fmt.Sprintf("%v/%v", policy, volume)
+		if _, err := io.Copy(os.Stderr, resp.Body); err != nil {
+			return false, errored.Errorf("Error copying body: %v\n Volume %v Response Status Code was %d, not 200", err, qualifiedVolume, resp.StatusCode)
+		}
+		return false, errored.Errorf("Volume %v Response Status Code was %d, not 200", qualifiedVolume, resp.StatusCode)
+	}
+
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return false, err
+	}
+
+	var results []*backup.Backup
 
 	if err := json.Unmarshal(content, &results); err != nil {
 		return false, err
 	}
 
+	writer := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(writer, "BACKUP\tTYPE\tPARENT\tCREATED\tSIZE")
+
 	for _, result := range results {
-		fmt.Println(result)
+		typ, parent := "full", "-"
+		if !result.Full() {
+			typ, parent = "incremental", result.Parent
+		}
+
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\n", result.Name, typ, parent, result.Created.Format(time.RFC3339), units.BytesSize(float64(result.Size)))
+	}
+
+	return false, writer.Flush()
+}
+
+// VolumeBackupRestore rebuilds a volume from a backup into a new volume.
+func VolumeBackupRestore(ctx *cli.Context) {
+	execCliAndExit(ctx, volumeBackupRestore)
+}
+
+func volumeBackupRestore(ctx *cli.Context) (bool, error) {
+	if len(ctx.Args()) != 3 {
+		return true, errorInvalidArgCount(len(ctx.Args()), 3, ctx.Args())
+	}
+
+	policy, volume, err := splitVolume(ctx)
+	if err != nil {
+		return true, err
+	}
+
+	req := &config.VolumeRequest{
+		Name:   volume,
+		Policy: policy,
+		Options: map[string]string{
+			"backup": ctx.Args()[1],
+			"target": ctx.Args()[2],
+		},
+	}
+
+	content, err := json.Marshal(req)
+	if err != nil {
+		return false, errored.Errorf("Could not create request JSON: %v", err)
+	}
+
+	resp, err := http.Post(fmt.Sprintf("http://%s/backups/restore", ctx.GlobalString("apiserver")), "application/json", bytes.NewBuffer(content))
+	if err != nil {
+		return false, err
+	}
+
+	if resp.StatusCode != 200 {
+		qualifiedVolume := fmt.Sprintf("%v/%v", policy, volume)
+		if _, err := io.Copy(os.Stderr, resp.Body); err != nil {
+			return false, errored.Errorf("Error copying body: %v\n Volume %v Response Status Code was %d, not 200", err, qualifiedVolume, resp.StatusCode)
+		}
+		return false, errored.Errorf("Volume %v Response Status Code was %d, not 200", qualifiedVolume, resp.StatusCode)
 	}
 
 	return false, nil
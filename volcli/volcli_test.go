@@ -97,6 +97,116 @@ func (s *volcliSuite) TestErrorReturns(c *C) {
 			args: []string{"foo"},
 			err:  errorInvalidVolumeSyntax("foo", `<policyName>/<volumeName>`),
 		},
+		"volumeResize": {
+			f:    volumeResize,
+			args: []string{"foo/bar"},
+			err:  errorInvalidArgCount(1, 2, []string{"foo/bar"}),
+		},
+		"volumeResizeInvalidPolicy": {
+			f:    volumeResize,
+			args: []string{"foo", "20G"},
+			err:  errorInvalidVolumeSyntax("foo", `<policyName>/<volumeName>`),
+		},
+		"volumeSnapshotCopyStatus": {
+			f:    volumeSnapshotCopyStatus,
+			args: []string{},
+			err:  errorInvalidArgCount(0, 1, []string{}),
+		},
+		"volumeSnapshotCopyStatusInvalidPolicy": {
+			f:    volumeSnapshotCopyStatus,
+			args: []string{"foo"},
+			err:  errorInvalidVolumeSyntax("foo", `<policyName>/<volumeName>`),
+		},
+		"volumeSnapshotRollback": {
+			f:    volumeSnapshotRollback,
+			args: []string{"foo/bar"},
+			err:  errorInvalidArgCount(1, 2, []string{"foo/bar"}),
+		},
+		"volumeSnapshotRollbackInvalidPolicy": {
+			f:    volumeSnapshotRollback,
+			args: []string{"foo", "snap"},
+			err:  errorInvalidVolumeSyntax("foo", `<policyName>/<volumeName>`),
+		},
+		"volumeClone": {
+			f:    volumeClone,
+			args: []string{"foo/bar"},
+			err:  errorInvalidArgCount(1, 2, []string{"foo/bar"}),
+		},
+		"volumeCloneInvalidPolicy": {
+			f:    volumeClone,
+			args: []string{"foo", "baz"},
+			err:  errorInvalidVolumeSyntax("foo", `<policyName>/<volumeName>`),
+		},
+		"volumeRename": {
+			f:    volumeRename,
+			args: []string{"foo/bar"},
+			err:  errorInvalidArgCount(1, 2, []string{"foo/bar"}),
+		},
+		"volumeRenameInvalidPolicy": {
+			f:    volumeRename,
+			args: []string{"foo", "baz"},
+			err:  errorInvalidVolumeSyntax("foo", `<policyName>/<volumeName>`),
+		},
+		"volumeMove": {
+			f:    volumeMove,
+			args: []string{},
+			err:  errorInvalidArgCount(0, 1, []string{}),
+		},
+		"volumeMoveInvalidPolicy": {
+			f:    volumeMove,
+			args: []string{"foo"},
+			err:  errorInvalidVolumeSyntax("foo", `<policyName>/<volumeName>`),
+		},
+		"volumeImportExisting": {
+			f:    volumeImportExisting,
+			args: []string{},
+			err:  errorInvalidArgCount(0, 1, []string{}),
+		},
+		"volumeImportExistingInvalidPolicy": {
+			f:    volumeImportExisting,
+			args: []string{"foo"},
+			err:  errorInvalidVolumeSyntax("foo", `<policyName>/<volumeName>`),
+		},
+		"volumeExport": {
+			f:    volumeExport,
+			args: []string{},
+			err:  errorInvalidArgCount(0, 1, []string{}),
+		},
+		"volumeExportInvalidPolicy": {
+			f:    volumeExport,
+			args: []string{"foo"},
+			err:  errorInvalidVolumeSyntax("foo", `<policyName>/<volumeName>`),
+		},
+		"volumeImport": {
+			f:    volumeImport,
+			args: []string{"foo/bar", "baz"},
+			err:  errorInvalidArgCount(2, 1, []string{"foo/bar", "baz"}),
+		},
+		"volumeImportInvalidPolicy": {
+			f:    volumeImport,
+			args: []string{"foo"},
+			err:  errorInvalidVolumeSyntax("foo", `<policyName>/<volumeName>`),
+		},
+		"volumeBackupList": {
+			f:    volumeBackupList,
+			args: []string{},
+			err:  errorInvalidArgCount(0, 1, []string{}),
+		},
+		"volumeBackupListInvalidPolicy": {
+			f:    volumeBackupList,
+			args: []string{"foo"},
+			err:  errorInvalidVolumeSyntax("foo", `<policyName>/<volumeName>`),
+		},
+		"volumeBackupRestore": {
+			f:    volumeBackupRestore,
+			args: []string{"foo/bar", "backup"},
+			err:  errorInvalidArgCount(2, 3, []string{"foo/bar", "backup"}),
+		},
+		"volumeBackupRestoreInvalidPolicy": {
+			f:    volumeBackupRestore,
+			args: []string{"foo", "backup", "baz"},
+			err:  errorInvalidVolumeSyntax("foo", `<policyName>/<volumeName>`),
+		},
 		"volumeList": {
 			f:    volumeList,
 			args: []string{},
@@ -152,3 +262,9 @@ func (s *volcliSuite) TestErrorReturns(c *C) {
 		c.Assert(err.Error(), Equals, test.err.Error(), Commentf("test key: %q", key))
 	}
 }
+
+func (s *volcliSuite) TestImageVolumeName(c *C) {
+	c.Assert(imageVolumeName("rbd/disk"), Equals, "disk")
+	c.Assert(imageVolumeName("rbd/policy1.test"), Equals, "policy1-test")
+	c.Assert(imageVolumeName("disk.img.v2"), Equals, "disk-img-v2")
+}
@@ -0,0 +1,122 @@
+package volplugin
+
+import (
+	"reflect"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/api"
+	"github.com/contiv/volplugin/config"
+	"github.com/contiv/volplugin/storage"
+	"github.com/contiv/volplugin/storage/backend"
+	"github.com/contiv/volplugin/watch"
+	"github.com/docker/go-units"
+)
+
+// pollResize grows the filesystems of volumes mounted on this host when the
+// apiserver resizes them. Volumes of host-local backends which belong to this
+// host are resized here as well, as the apiserver cannot reach their storage.
+func (dc *DaemonConfig) pollResize() {
+	volumeChan := make(chan *watch.Watch)
+	dc.Client.WatchVolumeUpdates(volumeChan)
+	for {
+		volWatch := <-volumeChan
+
+		vol, ok := volWatch.Config.(*config.Volume)
+		if !ok {
+			logrus.Error(errored.Errorf("Error processing update for volume %q: assertion failed", volWatch.Key))
+			continue
+		}
+
+		if err := dc.resizeOwned(vol); err != nil {
+			logrus.Error(errored.Errorf("Error resizing volume %q", vol).Combine(err))
+		}
+
+		// only the hosts that have the volume mounted can grow it.
+		mc, err := dc.API.MountCollection.Get(vol.String())
+		if err != nil {
+			continue
+		}
+
+		driver, err := backend.NewMountDriver(vol.Backends.Mount, dc.Global.MountPath)
+		if err != nil {
+			logrus.Errorf("Error constructing driver to grow volume %q: %v", vol, err)
+			continue
+		}
+
+		resizer, ok := driver.(storage.ResizeDriver)
+		if !ok {
+			continue
+		}
+
+		do, err := vol.ToDriverOptions(dc.Global.Timeout)
+		if err != nil {
+			logrus.Errorf("Error processing update for volume %q: %v", vol, err)
+			continue
+		}
+
+		// volumes are updated for more than resizes.
+		if !api.NeedsGrowing(mc, do) {
+			continue
+		}
+
+		logrus.Infof("Growing filesystem of volume %q", vol)
+
+		if err := resizer.GrowFilesystem(do); err != nil {
+			logrus.Error(errored.Errorf("Error growing filesystem of volume %q", vol).Combine(err))
+		}
+	}
+}
+
+// resizeOwned applies the size of a volume of a host-local backend which
+// belongs to this host. Parameters the driver records while resizing, such as
+// the project of a new quota, are published.
+func (dc *DaemonConfig) resizeOwned(vol *config.Volume) error {
+	if vol.Backends.CRUD == "" {
+		return nil
+	}
+
+	do, err := vol.ToDriverOptions(dc.Global.Timeout)
+	if err != nil {
+		return err
+	}
+
+	// volumes of other backends have no owner.
+	if err := storage.CheckHost(do.Volume); err != nil {
+		return nil
+	}
+
+	driver, err := backend.NewCRUDDriver(vol.Backends.CRUD)
+	if err != nil {
+		return err
+	}
+
+	resizer, ok := driver.(storage.ResizeDriver)
+	if !ok {
+		return nil
+	}
+
+	// volumes are updated for more than resizes.
+	if statser, ok := driver.(storage.StatsDriver); ok {
+		if stats, err := statser.Stats(do); err == nil && stats.ProvisionedBytes == do.Volume.Size*units.MiB {
+			return nil
+		}
+	}
+
+	params := storage.Params{}
+	for key, value := range do.Volume.Params {
+		params[key] = value
+	}
+
+	logrus.Infof("Resizing volume %q to %dMB", vol, do.Volume.Size)
+
+	if err := resizer.Resize(do); err != nil {
+		return err
+	}
+
+	if reflect.DeepEqual(params, do.Volume.Params) {
+		return nil
+	}
+
+	return dc.Client.UpdateVolume(vol)
+}
@@ -0,0 +1,131 @@
+package volplugin
+
+import (
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/config"
+	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/storage"
+	"github.com/contiv/volplugin/storage/backend"
+)
+
+// statsInterval is how often the stats of volumes are published. They expire
+// after a few intervals, once the volume is no longer mounted here.
+const statsInterval = time.Minute
+
+// pollStats publishes the stats of the volumes mounted on this host, and of
+// the volumes of host-local backends which belong to it. The apiserver
+// reports them, as it can neither reach their filesystems nor their storage.
+func (dc *DaemonConfig) pollStats() {
+	for {
+		dc.publishStats()
+		time.Sleep(statsInterval)
+	}
+}
+
+func (dc *DaemonConfig) publishStats() {
+	allStats := map[string]*storage.Stats{}
+
+	for _, mc := range dc.API.MountCollection.List() {
+		stats, err := storage.MountStats(mc)
+		if err != nil {
+			logrus.Errorf("Error retrieving stats of volume %q: %v", mc.Volume.Name, err)
+			continue
+		}
+
+		allStats[mc.Volume.Name] = stats
+	}
+
+	volumes, err := dc.ownedVolumes()
+	if err != nil {
+		logrus.Errorf("Error listing volumes to publish stats: %v", err)
+	}
+
+	for _, vol := range volumes {
+		stats, err := dc.driverStats(vol)
+		if err == errors.NoActionTaken {
+			continue
+		} else if err != nil {
+			logrus.Errorf("Error retrieving stats of volume %q: %v", vol, err)
+			continue
+		}
+
+		// the storage knows better than the filesystem it is mounted as.
+		allStats[vol.String()] = stats
+	}
+
+	for name, stats := range allStats {
+		if err := dc.Client.PublishVolumeStats(name, stats, 3*statsInterval); err != nil {
+			logrus.Errorf("Error publishing stats of volume %q: %v", name, err)
+		}
+	}
+}
+
+// ownedVolumes returns the volumes of host-local backends which belong to
+// this host.
+func (dc *DaemonConfig) ownedVolumes() ([]*config.Volume, error) {
+	names, err := dc.Client.ListAllVolumes()
+	if err != nil {
+		return nil, err
+	}
+
+	volumes := []*config.Volume{}
+
+	for _, name := range names {
+		policy, volName, err := storage.SplitName(name)
+		if err != nil {
+			return nil, err
+		}
+
+		vol, err := dc.Client.GetVolume(policy, volName)
+		if err != nil {
+			logrus.Errorf("Error retrieving volume %q: %v", name, err)
+			continue
+		}
+
+		// volumes of other backends have no owner.
+		if err := storage.CheckHost(storage.Volume{Name: name, Params: vol.DriverOptions}); err != nil {
+			continue
+		}
+
+		volumes = append(volumes, vol)
+	}
+
+	return volumes, nil
+}
+
+// driverStats asks the CRUD driver of the volume for its stats. Drivers which
+// cannot tell yield errors.NoActionTaken.
+func (dc *DaemonConfig) driverStats(vol *config.Volume) (*storage.Stats, error) {
+	if vol.Backends.CRUD == "" {
+		return nil, errors.NoActionTaken
+	}
+
+	driver, err := backend.NewCRUDDriver(vol.Backends.CRUD)
+	if err != nil {
+		return nil, err
+	}
+
+	statser, ok := driver.(storage.StatsDriver)
+	if !ok {
+		return nil, errors.NoActionTaken
+	}
+
+	do, err := vol.ToDriverOptions(dc.Global.Timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	stats, err := statser.Stats(do)
+	if err != nil {
+		if er, ok := err.(*errored.Error); ok && er.Contains(errors.StatsUnsupported) {
+			return nil, errors.NoActionTaken
+		}
+
+		return nil, err
+	}
+
+	return stats, nil
+}
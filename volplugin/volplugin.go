@@ -98,6 +98,8 @@ func (dc *DaemonConfig) Daemon() error {
 	}
 
 	go dc.pollRuntime()
+	go dc.pollResize()
+	go dc.pollStats()
 
 	driverPath := path.Join(basePath, fmt.Sprintf("%s.sock", dc.PluginName))
 	if err := os.Remove(driverPath); err != nil && !os.IsNotExist(err) {
@@ -0,0 +1,145 @@
+package volsupervisor
+
+import (
+	"io"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/backup"
+	"github.com/contiv/volplugin/config"
+	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/lock"
+	"github.com/contiv/volplugin/storage"
+	"github.com/contiv/volplugin/storage/backend"
+)
+
+// backupTimeout bounds writing a backup, which can copy all of the volume and
+// run far longer than the global timeout.
+const backupTimeout = 24 * time.Hour
+
+// lastBackup returns the name of the last backup of the volume, or an empty
+// string if it has none.
+func (dc *DaemonConfig) lastBackup(val *config.Volume) string {
+	if !val.RuntimeOptions.UseBackups {
+		return ""
+	}
+
+	catalog, err := backup.NewRepository(val.RuntimeOptions.Backup.Repository).Catalog(val.String())
+	if err != nil {
+		logrus.Errorf("Could not read backups of volume %q: %v", val, err)
+		return ""
+	}
+
+	if latest := catalog.Latest(); latest != nil {
+		return latest.Name
+	}
+
+	return ""
+}
+
+// backupParent returns the backup the next backup of the volume should hold
+// the changes since, or an empty string if it should be full.
+func backupParent(val *config.Volume, catalog *backup.Catalog, snaps []storage.Snapshot) string {
+	latest := catalog.Latest()
+	if latest == nil {
+		return ""
+	}
+
+	chain, err := catalog.Chain(latest.Name)
+	if err != nil {
+		return ""
+	}
+
+	if fullEvery := val.RuntimeOptions.Backup.FullEvery; fullEvery > 0 && uint(len(chain)) >= fullEvery {
+		return ""
+	}
+
+	// the changes are taken against the snapshot of the last backup, which
+	// may have been removed since.
+	for _, snap := range snaps {
+		if snap.Name == latest.Name {
+			return latest.Name
+		}
+	}
+
+	return ""
+}
+
+func (dc *DaemonConfig) backup(val *config.Volume) {
+	logrus.Infof("Backing up %q.", val)
+
+	if val.Backends.Snapshot == "" {
+		logrus.Errorf("Snapshot driver for volume %v was empty, cannot back up.", val)
+		return
+	}
+
+	driver, err := backend.NewSnapshotDriver(val.Backends.Snapshot)
+	if err != nil {
+		logrus.Errorf("Error establishing driver backend %q; cannot back up", val.Backends.Snapshot)
+		return
+	}
+
+	differ, ok := driver.(storage.DiffDriver)
+	if !ok {
+		logrus.Error(errors.BackupsUnsupported.Combine(errored.New(val.Backends.Snapshot)))
+		return
+	}
+
+	uc := &config.UseSnapshot{
+		Volume: val.String(),
+		Reason: lock.ReasonBackup,
+	}
+
+	stopChan, err := lock.NewDriver(dc.Config).AcquireWithTTLRefresh(uc, dc.Global.TTL, dc.Global.Timeout)
+	if err != nil {
+		logrus.Error(errors.LockFailed.Combine(err))
+		return
+	}
+
+	defer func() { stopChan <- struct{}{} }()
+
+	repo := backup.NewRepository(val.RuntimeOptions.Backup.Repository)
+
+	catalog, err := repo.Catalog(val.String())
+	if err != nil {
+		logrus.Error(errors.Backup.Combine(err))
+		return
+	}
+
+	driverOpts := storage.DriverOptions{
+		Volume: storage.Volume{
+			Name:   val.String(),
+			Params: val.DriverOptions,
+		},
+		Timeout: dc.Global.Timeout,
+	}
+
+	snaps, err := driver.ListSnapshots(driverOpts)
+	if err != nil {
+		logrus.Error(errors.Backup.Combine(errors.ListSnapshots).Combine(err))
+		return
+	}
+
+	parent := backupParent(val, catalog, snaps)
+
+	snapName, err := dc.takeSnapshot(driver, val, storage.SnapshotBackup, nil)
+	if err != nil {
+		logrus.Error(errors.Backup.Combine(err))
+		return
+	}
+
+	driverOpts.Timeout = backupTimeout
+
+	b := &backup.Backup{Name: snapName, Parent: parent}
+	err = repo.Add(val.String(), b, func(w io.Writer) error {
+		return differ.ExportDiff(driverOpts, parent, snapName, w)
+	})
+
+	if err != nil {
+		logrus.Error(errors.Backup.Combine(errored.Errorf("Backing up volume %q", val)).Combine(err))
+		return
+	}
+
+	logrus.Infof("Backed up volume %q as %q (full: %v, %d bytes)", val, b.Name, b.Full(), b.Size)
+}
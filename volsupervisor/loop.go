@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/contiv/errored"
 	"github.com/contiv/volplugin/config"
 	"github.com/contiv/volplugin/errors"
 	"github.com/contiv/volplugin/lock"
@@ -13,6 +14,11 @@ import (
 	"github.com/contiv/volplugin/storage/backend"
 )
 
+// snapshotNameFormat names snapshots after the time they are taken. Drivers
+// replace characters they do not allow in names, such as spaces and colons,
+// which would make the names they list differ from the ones recorded.
+const snapshotNameFormat = "2006-01-02T15.04.05.000000000Z"
+
 var (
 	volumes     = map[string]*config.Volume{}
 	volumeMutex = &sync.Mutex{}
@@ -74,10 +80,8 @@ func (dc *DaemonConfig) pruneSnapshots(val *config.Volume) {
 
 	driverOpts := storage.DriverOptions{
 		Volume: storage.Volume{
-			Name: val.String(),
-			Params: storage.Params{
-				"pool": val.DriverOptions["pool"],
-			},
+			Name:   val.String(),
+			Params: val.DriverOptions,
 		},
 		Timeout: dc.Global.Timeout,
 	}
@@ -88,22 +92,79 @@ func (dc *DaemonConfig) pruneSnapshots(val *config.Volume) {
 		return
 	}
 
+	// drivers which cannot tell when snapshots were taken list them in order.
+	storage.SortSnapshots(list)
+
+	infos, err := dc.Config.ListSnapshotInfo(val.String())
+	if err != nil {
+		logrus.Errorf("Could not list snapshot info for volume %q, not pruning: %v", val.VolumeName, err)
+		return
+	}
+
+	// clones take snapshots only to copy them, so those do not count toward
+	// the snapshots kept; they are removed once no copy depends on them.
+	kept := []storage.Snapshot{}
+	toDelete := []storage.Snapshot{}
+	for _, snap := range list {
+		if info, ok := infos[snap.Name]; ok && info.Origin == storage.SnapshotPreCopy {
+			toDelete = append(toDelete, snap)
+		} else {
+			kept = append(kept, snap)
+		}
+	}
+
 	logrus.Debugf("Volume %q: keeping %d snapshots", val, val.RuntimeOptions.Snapshot.Keep)
 
-	toDeleteCount := len(list) - int(val.RuntimeOptions.Snapshot.Keep)
-	if toDeleteCount < 0 {
+	if toDeleteCount := len(kept) - int(val.RuntimeOptions.Snapshot.Keep); toDeleteCount > 0 {
+		toDelete = append(toDelete, kept[:toDeleteCount]...)
+	}
+
+	if len(toDelete) == 0 {
 		return
 	}
 
-	for i := 0; i < toDeleteCount; i++ {
-		logrus.Infof("Removing snapshot %q for volume %q", list[i], val.VolumeName)
-		if err := driver.RemoveSnapshot(list[i], driverOpts); err != nil {
-			logrus.Errorf("Removing snapshot %q for volume %q failed: %v", list[i], val.VolumeName, err)
+	copies, err := dc.Config.ListCopies(val.PolicyName)
+	if err != nil {
+		logrus.Errorf("Could not list copies of volume %q, not pruning: %v", val.VolumeName, err)
+		return
+	}
+
+	// snapshots which copies still depend on cannot be removed.
+	dependents := map[string]bool{}
+	for _, cp := range copies {
+		if cp.Source == val.String() && cp.Dependent() {
+			dependents[cp.Snapshot] = true
+		}
+	}
+
+	// the snapshot of the last backup is the one the next is taken against.
+	lastBackup := dc.lastBackup(val)
+
+	for _, snap := range toDelete {
+		if dependents[snap.Name] {
+			logrus.Infof("Keeping snapshot %q for volume %q: copies still depend on it", snap.Name, val.VolumeName)
+			continue
+		}
+
+		if lastBackup != "" && snap.Name == lastBackup {
+			logrus.Infof("Keeping snapshot %q for volume %q: the next backup is taken against it", snap.Name, val.VolumeName)
+			continue
+		}
+
+		logrus.Infof("Removing snapshot %q for volume %q", snap.Name, val.VolumeName)
+		if err := driver.RemoveSnapshot(snap.Name, driverOpts); err != nil {
+			logrus.Errorf("Removing snapshot %q for volume %q failed: %v", snap.Name, val.VolumeName, err)
+			continue
+		}
+
+		// snapshots taken before their info was recorded have none.
+		if err := dc.Config.RemoveSnapshotInfo(val.String(), snap.Name); err != nil {
+			logrus.Debugf("Removing info of snapshot %q for volume %q: %v", snap.Name, val.VolumeName, err)
 		}
 	}
 }
 
-func (dc *DaemonConfig) createSnapshot(val *config.Volume) {
+func (dc *DaemonConfig) createSnapshot(val *config.Volume, origin string, labels map[string]string) {
 	logrus.Infof("Snapshotting %q.", val)
 
 	uc := &config.UseSnapshot{
@@ -125,19 +186,34 @@ func (dc *DaemonConfig) createSnapshot(val *config.Volume) {
 		return
 	}
 
+	if _, err := dc.takeSnapshot(driver, val, origin, labels); err != nil {
+		logrus.Error(err)
+	}
+}
+
+// takeSnapshot snapshots the volume and records where the snapshot came from.
+// The snapshot lock must be held. It returns the name of the snapshot.
+func (dc *DaemonConfig) takeSnapshot(driver storage.SnapshotDriver, val *config.Volume, origin string, labels map[string]string) (string, error) {
 	driverOpts := storage.DriverOptions{
 		Volume: storage.Volume{
-			Name: val.String(),
-			Params: storage.Params{
-				"pool": val.DriverOptions["pool"],
-			},
+			Name:   val.String(),
+			Params: val.DriverOptions,
 		},
 		Timeout: dc.Global.Timeout,
 	}
 
-	if err := driver.CreateSnapshot(time.Now().String(), driverOpts); err != nil {
-		logrus.Errorf("Error creating snapshot for volume %q: %v", val, err)
+	snapName := time.Now().UTC().Format(snapshotNameFormat)
+
+	if err := driver.CreateSnapshot(snapName, driverOpts); err != nil {
+		return "", errored.Errorf("Error creating snapshot for volume %q", val).Combine(err)
+	}
+
+	info := &config.SnapshotInfo{Origin: origin, Labels: labels}
+	if err := dc.Config.PublishSnapshotInfo(val.String(), snapName, info); err != nil {
+		logrus.Errorf("Error recording snapshot %q for volume %q: %v", snapName, val, err)
 	}
+
+	return snapName, nil
 }
 
 func (dc *DaemonConfig) loop() {
@@ -172,12 +248,24 @@ func (dc *DaemonConfig) loop() {
 					go func(val *config.Volume, isUsed bool) {
 						// XXX we still want to prune snapshots even if the volume is not in use.
 						if isUsed {
-							dc.createSnapshot(val)
+							dc.createSnapshot(val, storage.SnapshotScheduled, nil)
 						}
 						dc.pruneSnapshots(val)
 					}(val, isUsed)
 				}
 			}
+
+			if val.RuntimeOptions.UseBackups {
+				freq, err := time.ParseDuration(val.RuntimeOptions.Backup.Frequency)
+				if err != nil || freq < time.Second {
+					logrus.Errorf("Volume %q has an invalid backup frequency. Skipping backup.", volume)
+					continue
+				}
+
+				if time.Now().Unix()%int64(freq.Seconds()) == 0 {
+					go dc.backup(val)
+				}
+			}
 		}
 	}
 }
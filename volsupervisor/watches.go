@@ -4,6 +4,7 @@ import (
 	"strings"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/contiv/volplugin/storage"
 	"github.com/contiv/volplugin/watch"
 )
 
@@ -24,7 +25,9 @@ func (dc *DaemonConfig) signalSnapshot() {
 				continue
 			}
 
-			go dc.createSnapshot(vol)
+			labels, _ := snapshot.Config.(map[string]string)
+
+			go dc.createSnapshot(vol, storage.SnapshotManual, labels)
 			if err := dc.Config.RemoveTakeSnapshot(vol.String()); err != nil {
 				logrus.Errorf("Error removing snapshot reference: %v", err)
 				continue